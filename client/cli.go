@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// CLIHandler implements the login handler interface of the Vault CLI. A
+// Vault build registering it under "openstack" logs in from an instance with
+// `vault login -method=openstack`, discovering the instance ID and the role
+// with the metadata service.
+type CLIHandler struct{}
+
+// Auth logs in with the key-value pairs given on the command line.
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (*api.Secret, error) {
+	config := make(map[string]interface{}, len(m))
+	for key, val := range m {
+		config[key] = val
+	}
+
+	opts, err := configOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := NewOpenStackAuth(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.Login(context.Background(), c)
+}
+
+// Help returns the help of the login handler.
+func (h *CLIHandler) Help() string {
+	help := `
+Usage: vault login -method=openstack [CONFIG K=V...]
+
+  The OpenStack auth method allows an OpenStack instance to log in with its
+  own identity. The instance ID and, unless given, the role are read from
+  the metadata service of the instance.
+
+  Log in with the role in the instance metadata:
+
+      $ vault login -method=openstack
+
+  Log in with the "web" role of a backend mounted at "os":
+
+      $ vault login -method=openstack mount=os role=web
+
+Configuration:
+
+  cloud=<string>
+      Entry of clouds.yaml with the OpenStack credentials to write the nonce
+      with. Defaults to OS_CLOUD, or to the OS_* environment variables.
+
+  instance_id=<string>
+      ID of the instance. Read from the metadata service by default.
+
+  metadata_key=<string>
+      Instance metadata key holding the role. Defaults to "vault-role".
+
+  metadata_url=<string>
+      Endpoint of the metadata service. Defaults to
+      "http://169.254.169.254".
+
+  mount=<string>
+      Path the auth method is mounted at. Defaults to "openstack".
+
+  nonce=<bool>
+      Request a nonce and write it into the instance metadata with the
+      compute API before logging in, as required by the roles with
+      nonce_metadata_key. Defaults to false.
+
+  role=<string>
+      Role to log in with. Read from the instance metadata by default.
+
+  vendordata_service=<string>
+      Name of the dynamic vendordata service issuing the signed identity
+      document of the instance. No document is passed by default.
+`
+
+	return strings.TrimSpace(help)
+}
+
+// AgentAuthMethod implements the auto-auth method interface of Vault Agent,
+// so that a Vault build registering it logs in with the same configuration
+// keys as the CLI handler.
+type AgentAuthMethod struct {
+	auth *OpenStackAuth
+}
+
+// NewAgentAuthMethod returns the auto-auth method for the mount path and
+// the config of the auto_auth stanza. The mount path may include the auth/
+// prefix, as Vault Agent passes it.
+func NewAgentAuthMethod(mountPath string, config map[string]interface{}) (*AgentAuthMethod, error) {
+	opts, err := configOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	if mountPath != "" {
+		opts = append(opts, WithMountPath(strings.TrimPrefix(strings.Trim(mountPath, "/"), "auth/")))
+	}
+
+	auth, err := NewOpenStackAuth(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AgentAuthMethod{auth: auth}, nil
+}
+
+// Authenticate returns the path and the data of the login request.
+func (m *AgentAuthMethod) Authenticate(ctx context.Context, client *api.Client) (string, http.Header, map[string]interface{}, error) {
+	data, err := m.auth.loginData(ctx, client)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return m.auth.loginPath(), nil, data, nil
+}
+
+// NewCreds returns nil, since the identity of the instance never changes.
+func (m *AgentAuthMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (m *AgentAuthMethod) CredSuccess() {}
+
+func (m *AgentAuthMethod) Shutdown() {}
+
+// configOptions converts the configuration keys of the CLI handler and the
+// auto-auth method to the login options.
+func configOptions(config map[string]interface{}) ([]LoginOption, error) {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	opts := []LoginOption{}
+	nonce, cloud := false, ""
+	for _, key := range keys {
+		val, ok := config[key].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+
+		switch key {
+		case "nonce":
+			var err error
+			nonce, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("nonce must be a boolean: %w", err)
+			}
+		case "cloud":
+			cloud = val
+		case "mount":
+			opts = append(opts, WithMountPath(val))
+		case "role":
+			opts = append(opts, WithRole(val))
+		case "instance_id":
+			opts = append(opts, WithInstanceID(val))
+		case "metadata_key":
+			opts = append(opts, WithMetadataKey(val))
+		case "metadata_url":
+			opts = append(opts, WithMetadataURL(val))
+		case "vendordata_service":
+			opts = append(opts, WithVendorDataService(val))
+		default:
+			return nil, fmt.Errorf("unknown configuration key %q", key)
+		}
+	}
+
+	if nonce {
+		opts = append(opts, WithNonceWriter(NewComputeNonceWriter(cloud)))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCLIHandler(t *testing.T) {
+	metadata := newTestMetadataServer(t, 0)
+
+	var tests = []struct {
+		args    map[string]string
+		mount   string
+		policy  string
+		success bool
+	}{
+		{map[string]string{}, DefaultMountPath, "dev", true},
+		{map[string]string{"mount": "os", "role": "web"}, "os", "web", true},
+		{map[string]string{"metadata_key": "app-role"}, DefaultMountPath, "app", true},
+		// fail: unknown key
+		{map[string]string{"rol": "web"}, DefaultMountPath, "", false},
+	}
+
+	for _, test := range tests {
+		client := newTestVaultClient(t, test.mount)
+
+		test.args["metadata_url"] = metadata.URL
+		secret, err := (&CLIHandler{}).Auth(client, test.args)
+		if test.success != (err == nil) {
+			t.Errorf("unexpected result: %v - %v", test, err)
+			continue
+		}
+
+		if test.success && (secret.Auth.ClientToken != "s.token" || secret.Auth.Policies[0] != test.policy) {
+			t.Errorf("unexpected secret: %v - %v", test, secret.Auth)
+		}
+	}
+}
+
+func TestAgentAuthMethod(t *testing.T) {
+	metadata := newTestMetadataServer(t, 0)
+
+	method, err := NewAgentAuthMethod("auth/os", map[string]interface{}{
+		"metadata_url": metadata.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, _, data, err := method.Authenticate(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "auth/os/login" || data["instance_id"] != testInstanceID || data["role"] != "dev" {
+		t.Errorf("unexpected login request: %s - %v", path, data)
+	}
+
+	method, err = NewAgentAuthMethod("", map[string]interface{}{
+		"metadata_url":       metadata.URL,
+		"vendordata_service": "identity",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, data, err = method.Authenticate(context.Background(), nil)
+	if err != nil || data["identity_document"] != "signed.document" {
+		t.Errorf("unexpected identity document: %v - %v", data, err)
+	}
+
+	method, err = NewAgentAuthMethod("", map[string]interface{}{
+		"metadata_url":       metadata.URL,
+		"vendordata_service": "missing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = method.Authenticate(context.Background(), nil)
+	if err == nil {
+		t.Errorf("login without identity document was attempted")
+	}
+
+	_, err = NewAgentAuthMethod("", map[string]interface{}{"nonce": "maybe"})
+	if err == nil {
+		t.Errorf("non-boolean nonce was accepted")
+	}
+
+	_, err = NewAgentAuthMethod("auth/os", map[string]interface{}{"role": 1})
+	if err == nil {
+		t.Errorf("non-string config was accepted")
+	}
+}
@@ -0,0 +1,399 @@
+// Package client implements the login to the OpenStack auth backend for
+// the instances, as an auth method of the Vault API client.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// DefaultMountPath is the path the backend is mounted at by default.
+	DefaultMountPath = "openstack"
+
+	// DefaultMetadataKey is the instance metadata key holding the role.
+	DefaultMetadataKey = "vault-role"
+
+	// DefaultMetadataURL is the endpoint of the OpenStack metadata service.
+	DefaultMetadataURL = "http://169.254.169.254"
+)
+
+const (
+	// metadataAttempts is the number of attempts to read the metadata, which
+	// may not be reachable yet while the network of the instance comes up.
+	metadataAttempts = 5
+
+	// metadataRetryInterval is the initial interval between the attempts,
+	// doubled on each retry.
+	metadataRetryInterval = time.Second
+
+	// metadataTimeout is the timeout of a request to the metadata service.
+	metadataTimeout = 5 * time.Second
+)
+
+// OpenStackAuth logs in to the OpenStack auth backend with the instance it
+// runs on. It implements api.AuthMethod.
+type OpenStackAuth struct {
+	mountPath     string
+	role          string
+	instanceID    string
+	metadataKey   string
+	metadataURL   string
+	vendorData    string
+	nonceWriter   NonceWriter
+	retryInterval time.Duration
+	httpClient    *http.Client
+}
+
+var _ api.AuthMethod = (*OpenStackAuth)(nil)
+
+// LoginOption configures the login.
+type LoginOption func(a *OpenStackAuth) error
+
+// NewOpenStackAuth returns the auth method. The instance ID and the role
+// are discovered with the metadata service unless they are specified.
+func NewOpenStackAuth(opts ...LoginOption) (*OpenStackAuth, error) {
+	a := &OpenStackAuth{
+		mountPath:     DefaultMountPath,
+		metadataKey:   DefaultMetadataKey,
+		metadataURL:   DefaultMetadataURL,
+		retryInterval: metadataRetryInterval,
+		httpClient:    &http.Client{Timeout: metadataTimeout},
+	}
+
+	for _, opt := range opts {
+		err := opt(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// WithMountPath sets the path the backend is mounted at.
+func WithMountPath(path string) LoginOption {
+	return func(a *OpenStackAuth) error {
+		path = strings.Trim(path, "/")
+		if path == "" {
+			return errors.New("mount path cannot be empty")
+		}
+		a.mountPath = path
+		return nil
+	}
+}
+
+// WithRole sets the role to login with instead of reading it from the
+// instance metadata.
+func WithRole(role string) LoginOption {
+	return func(a *OpenStackAuth) error {
+		a.role = role
+		return nil
+	}
+}
+
+// WithInstanceID sets the ID of the instance instead of reading it from the
+// metadata service.
+func WithInstanceID(id string) LoginOption {
+	return func(a *OpenStackAuth) error {
+		a.instanceID = id
+		return nil
+	}
+}
+
+// WithMetadataKey sets the instance metadata key holding the role, which
+// must match the metadata_key of the role.
+func WithMetadataKey(key string) LoginOption {
+	return func(a *OpenStackAuth) error {
+		a.metadataKey = key
+		return nil
+	}
+}
+
+// WithMetadataURL sets the endpoint of the metadata service.
+func WithMetadataURL(url string) LoginOption {
+	return func(a *OpenStackAuth) error {
+		a.metadataURL = strings.TrimSuffix(url, "/")
+		return nil
+	}
+}
+
+// WithVendorDataService sets the name of the dynamic vendordata service
+// which issues the signed identity document of the instance. The document
+// is read from the vendordata and passed with the login.
+func WithVendorDataService(name string) LoginOption {
+	return func(a *OpenStackAuth) error {
+		a.vendorData = name
+		return nil
+	}
+}
+
+// WithNonceWriter makes the login request a nonce from the backend and
+// write it into the instance metadata with the writer before logging in,
+// as required by the roles with nonce_metadata_key.
+func WithNonceWriter(w NonceWriter) LoginOption {
+	return func(a *OpenStackAuth) error {
+		a.nonceWriter = w
+		return nil
+	}
+}
+
+// Login logs in to the backend. The errors of the login are returned as is,
+// note that the backend allows only auth_limit attempts per instance.
+func (a *OpenStackAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	data, err := a.loginData(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().WriteWithContext(ctx, a.loginPath(), data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, errors.New("login response has no auth information")
+	}
+
+	return secret, nil
+}
+
+func (a *OpenStackAuth) loginPath() string {
+	return fmt.Sprintf("auth/%s/login", a.mountPath)
+}
+
+func (a *OpenStackAuth) noncePath() string {
+	return fmt.Sprintf("auth/%s/login/nonce", a.mountPath)
+}
+
+// loginData returns the data of the login request, discovering the
+// instance ID and the role with the metadata service unless they are
+// specified. If a nonce writer is set, a nonce is requested with the
+// client and written into the instance metadata first.
+func (a *OpenStackAuth) loginData(ctx context.Context, client *api.Client) (map[string]interface{}, error) {
+	instanceID, role := a.instanceID, a.role
+	if instanceID == "" || role == "" {
+		metadata, err := a.readMetadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instance metadata: %w", err)
+		}
+
+		if instanceID == "" {
+			instanceID = metadata.UUID
+		}
+		if role == "" {
+			role = metadata.Meta[a.metadataKey]
+		}
+	}
+
+	if instanceID == "" {
+		return nil, errors.New("instance ID is unknown")
+	}
+	if role == "" {
+		return nil, fmt.Errorf("role is not specified and the instance has no %s metadata", a.metadataKey)
+	}
+
+	data := map[string]interface{}{
+		"instance_id": instanceID,
+		"role":        role,
+	}
+
+	if a.nonceWriter != nil {
+		err := a.writeNonce(ctx, client, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write nonce: %w", err)
+		}
+	}
+
+	if a.vendorData != "" {
+		document, err := a.readIdentityDocument(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity document: %w", err)
+		}
+		data["identity_document"] = document
+	}
+
+	return data, nil
+}
+
+// writeNonce requests a nonce for the instance and the role of the login
+// data, and writes it into the instance metadata under the key returned by
+// the backend.
+func (a *OpenStackAuth) writeNonce(ctx context.Context, client *api.Client, data map[string]interface{}) error {
+	secret, err := client.Logical().WriteWithContext(ctx, a.noncePath(), data)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return errors.New("nonce response has no data")
+	}
+
+	nonce, _ := secret.Data["nonce"].(string)
+	key, _ := secret.Data["metadata_key"].(string)
+	if nonce == "" || key == "" {
+		return errors.New("nonce response has no nonce")
+	}
+
+	return a.nonceWriter(ctx, data["instance_id"].(string), key, nonce)
+}
+
+// metadata is the part of the OpenStack instance metadata used to login.
+type metadata struct {
+	UUID string            `json:"uuid"`
+	Meta map[string]string `json:"meta"`
+}
+
+// readMetadata reads the instance metadata, retrying with backoff while
+// the metadata service is unreachable or fails.
+func (a *OpenStackAuth) readMetadata(ctx context.Context) (*metadata, error) {
+	interval := a.retryInterval
+
+	var err error
+	for i := 0; i < metadataAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(interval):
+			}
+			interval *= 2
+		}
+
+		var m *metadata
+		m, err = a.fetchMetadata(ctx)
+		if err == nil {
+			return m, nil
+		}
+	}
+
+	return nil, err
+}
+
+func (a *OpenStackAuth) fetchMetadata(ctx context.Context) (*metadata, error) {
+	m := &metadata{}
+	err := a.fetchJSON(ctx, "/openstack/latest/meta_data.json", m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// readIdentityDocument reads the identity document issued by the vendordata
+// service, which returns it in the identity_document field.
+func (a *OpenStackAuth) readIdentityDocument(ctx context.Context) (string, error) {
+	vendorData := map[string]struct {
+		IdentityDocument string `json:"identity_document"`
+	}{}
+	err := a.fetchJSON(ctx, "/openstack/latest/vendor_data2.json", &vendorData)
+	if err != nil {
+		return "", err
+	}
+
+	document := vendorData[a.vendorData].IdentityDocument
+	if document == "" {
+		return "", fmt.Errorf("vendordata service %s returned no identity document", a.vendorData)
+	}
+
+	return document, nil
+}
+
+func (a *OpenStackAuth) fetchJSON(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.metadataURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from metadata service: %d", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// loginErrorPattern matches the reason of a denied login in the error
+// message of the backend.
+var loginErrorPattern = regexp.MustCompile(`\(reason=([a-z_]+) retryable=(true|false)\)`)
+
+// LoginErrorReason returns the reason the backend denied the login with,
+// such as addr_mismatch or instance_not_active, and whether the login may
+// pass when it is retried later without any change. ok is false if the
+// error is not a denied login.
+func LoginErrorReason(err error) (reason string, retryable bool, ok bool) {
+	if err == nil {
+		return "", false, false
+	}
+
+	match := loginErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false, false
+	}
+
+	return match[1], match[2] == "true", true
+}
+
+// Renew keeps renewing the token of the secret until it cannot be renewed
+// any more or the context is canceled. It returns nil when the token
+// reached its max TTL, the caller should then stop using the token.
+func Renew(ctx context.Context, client *api.Client, secret *api.Secret) error {
+	watcher, err := client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		return err
+	}
+
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.DoneCh():
+			return err
+		case <-watcher.RenewCh():
+		}
+	}
+}
+
+// WriteTokenFile writes the token of the secret to the file, which can be
+// read by a Vault Agent with the token_file auto-auth method. The file is
+// replaced atomically so that the readers never see a partial token.
+func WriteTokenFile(path string, secret *api.Secret) error {
+	if secret == nil || secret.Auth == nil {
+		return errors.New("secret has no auth information")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = f.Chmod(0600)
+	if err == nil {
+		_, err = f.WriteString(secret.Auth.ClientToken)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const testInstanceID = "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5"
+
+func newTestMetadataServer(t *testing.T, failures int64) *httptest.Server {
+	var requests int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openstack/latest/vendor_data2.json" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"identity": map[string]string{"identity_document": "signed.document"},
+			})
+			return
+		}
+
+		if r.URL.Path != "/openstack/latest/meta_data.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if atomic.AddInt64(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"uuid": testInstanceID,
+			"meta": map[string]string{"vault-role": "dev", "app-role": "app"},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestVaultClient(t *testing.T, mountPath string) *api.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/"+mountPath+"/login" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var data map[string]string
+		json.NewDecoder(r.Body).Decode(&data)
+		if data["instance_id"] != testInstanceID {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"failed to login"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token": "s.token",
+				"policies":     []string{data["role"]},
+				"renewable":    true,
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestLogin(t *testing.T) {
+	var tests = []struct {
+		failures int64
+		opts     []LoginOption
+		mount    string
+		policy   string
+		success  bool
+	}{
+		{0, nil, DefaultMountPath, "dev", true},
+		{2, nil, DefaultMountPath, "dev", true},
+		{0, []LoginOption{WithMetadataKey("app-role")}, DefaultMountPath, "app", true},
+		{0, []LoginOption{WithRole("ops"), WithMountPath("/os/")}, "os", "ops", true},
+		// fail: no role metadata
+		{0, []LoginOption{WithMetadataKey("missing")}, DefaultMountPath, "", false},
+		// fail: wrong instance
+		{0, []LoginOption{WithInstanceID("0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c")}, DefaultMountPath, "", false},
+		// fail: metadata service is unavailable
+		{metadataAttempts, nil, DefaultMountPath, "", false},
+	}
+
+	for _, test := range tests {
+		metadata := newTestMetadataServer(t, test.failures)
+		client := newTestVaultClient(t, test.mount)
+
+		opts := append([]LoginOption{WithMetadataURL(metadata.URL)}, test.opts...)
+		auth, err := NewOpenStackAuth(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth.retryInterval = 0
+
+		secret, err := client.Auth().Login(context.Background(), auth)
+		if test.success != (err == nil) {
+			t.Errorf("unexpected result: %v - %v", test, err)
+			continue
+		}
+
+		if test.success && (client.Token() != "s.token" || len(secret.Auth.Policies) != 1 || secret.Auth.Policies[0] != test.policy) {
+			t.Errorf("unexpected secret: %v - %v", test, secret.Auth)
+		}
+	}
+}
+
+func TestLoginNonce(t *testing.T) {
+	metadata := newTestMetadataServer(t, 0)
+
+	var written string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		json.NewDecoder(r.Body).Decode(&data)
+
+		switch r.URL.Path {
+		case "/v1/auth/openstack/login/nonce":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"nonce": "n-" + data["instance_id"], "metadata_key": "vault-nonce"},
+			})
+		case "/v1/auth/openstack/login":
+			if written != "vault-nonce=n-"+testInstanceID {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"failed to login"}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "s.token"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := func(ctx context.Context, instanceID, key, nonce string) error {
+		if instanceID != testInstanceID {
+			return errors.New("unexpected instance")
+		}
+		written = key + "=" + nonce
+		return nil
+	}
+
+	auth, err := NewOpenStackAuth(WithMetadataURL(metadata.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Auth().Login(context.Background(), auth)
+	if err == nil {
+		t.Errorf("login without nonce passed")
+	}
+
+	auth, err = NewOpenStackAuth(WithMetadataURL(metadata.URL), WithNonceWriter(writer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Auth().Login(context.Background(), auth)
+	if err != nil {
+		t.Errorf("failed to login with nonce: %v", err)
+	}
+
+	written = ""
+	auth, err = NewOpenStackAuth(WithMetadataURL(metadata.URL), WithNonceWriter(func(context.Context, string, string, string) error {
+		return errors.New("forbidden")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Auth().Login(context.Background(), auth)
+	if err == nil {
+		t.Errorf("login passed without writing the nonce")
+	}
+}
+
+func TestWriteTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+
+	for _, token := range []string{"s.first", "s.second"} {
+		err := WriteTokenFile(path, &api.Secret{Auth: &api.SecretAuth{ClientToken: token}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != token {
+			t.Errorf("unexpected token: %s - %v", data, err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected file mode: %v - %v", info, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left: %v", entries)
+	}
+
+	err = WriteTokenFile(path, &api.Secret{})
+	if err == nil {
+		t.Errorf("secret without auth was written")
+	}
+}
+
+func TestLoginErrorReason(t *testing.T) {
+	var tests = []struct {
+		err       error
+		reason    string
+		retryable bool
+		ok        bool
+	}{
+		{errors.New("Code: 403. Errors:\n\n* failed to login (reason=instance_not_active retryable=true): instance is not active"), "instance_not_active", true, true},
+		{errors.New("Code: 403. Errors:\n\n* failed to login (reason=addr_mismatch retryable=false): ip address mismatched"), "addr_mismatch", false, true},
+		{errors.New("Code: 502. Errors:\n\n* failed to look up instance"), "", false, false},
+		{nil, "", false, false},
+	}
+
+	for _, test := range tests {
+		reason, retryable, ok := LoginErrorReason(test.err)
+		if reason != test.reason || retryable != test.retryable || ok != test.ok {
+			t.Errorf("unexpected result: %v - %s, %v, %v", test.err, reason, retryable, ok)
+		}
+	}
+}
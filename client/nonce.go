@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// NonceWriter writes the nonce into the server metadata of the instance
+// under the key.
+type NonceWriter func(ctx context.Context, instanceID, key, nonce string) error
+
+// NewComputeNonceWriter returns a NonceWriter which sets the server metadata
+// with the compute API. The credentials are read from the entry of
+// clouds.yaml named cloud, or from the OS_* environment variables if cloud
+// is empty and OS_CLOUD is not set.
+func NewComputeNonceWriter(cloud string) NonceWriter {
+	return func(ctx context.Context, instanceID, key, nonce string) error {
+		client, err := clientconfig.NewServiceClient("compute", &clientconfig.ClientOpts{Cloud: cloud})
+		if err != nil {
+			return err
+		}
+		client.Context = ctx
+
+		_, err = servers.UpdateMetadata(client, instanceID, servers.MetadataOpts{key: nonce}).Extract()
+		return err
+	}
+}
@@ -0,0 +1,250 @@
+// Command osvault-diag runs the attestation of an instance for a role with
+// the code of the OpenStack auth backend, outside of Vault, and prints the
+// result of each check. The backend runs in the process on an in-memory
+// storage, so nothing is written to Vault or counted as a login attempt.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	openstack "github.com/summerwind/vault-plugin-auth-openstack/plugin"
+)
+
+// configEnv maps the standard OpenStack environment variables to the fields
+// of the backend config.
+var configEnv = map[string]string{
+	"OS_AUTH_URL":                      "auth_url",
+	"OS_TOKEN":                         "token",
+	"OS_USER_ID":                       "user_id",
+	"OS_USERNAME":                      "username",
+	"OS_PASSWORD":                      "password",
+	"OS_PROJECT_ID":                    "project_id",
+	"OS_PROJECT_NAME":                  "project_name",
+	"OS_USER_DOMAIN_ID":                "user_domain_id",
+	"OS_USER_DOMAIN_NAME":              "user_domain_name",
+	"OS_PROJECT_DOMAIN_ID":             "project_domain_id",
+	"OS_PROJECT_DOMAIN_NAME":           "project_domain_name",
+	"OS_DOMAIN_ID":                     "domain_id",
+	"OS_DOMAIN_NAME":                   "domain_name",
+	"OS_REGION_NAME":                   "region_name",
+	"OS_APPLICATION_CREDENTIAL_ID":     "application_credential_id",
+	"OS_APPLICATION_CREDENTIAL_SECRET": "application_credential_secret",
+}
+
+// errChecksFailed is returned when a check of the attestation failed.
+var errChecksFailed = errors.New("attestation failed")
+
+type options struct {
+	configFile string
+	roleFile   string
+	roleName   string
+	instanceID string
+	addrs      string
+	json       bool
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.configFile, "config", "", "JSON file with the fields of the backend config. The OS_* environment variables are used for the fields it doesn't set.")
+	flag.StringVar(&opts.roleFile, "role", "", "JSON file with the fields of the role.")
+	flag.StringVar(&opts.roleName, "role-name", "", "Name of the role, which the instance metadata must match. Defaults to the name of the role file without extension.")
+	flag.StringVar(&opts.instanceID, "instance-id", "", "ID of the instance to attest.")
+	flag.StringVar(&opts.addrs, "addr", "", "Comma separated request addresses to verify against the instance addresses. The address check is skipped by default.")
+	flag.BoolVar(&opts.json, "json", false, "Print the report as JSON.")
+	flag.Parse()
+
+	if opts.roleFile == "" || opts.instanceID == "" {
+		fmt.Fprintln(os.Stderr, "-role and -instance-id are required")
+		os.Exit(2)
+	}
+
+	err := run(context.Background(), opts, os.Stdout)
+	if errors.Is(err, errChecksFailed) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// run attests the instance with a backend on an in-memory storage and
+// writes the report. errChecksFailed is returned if a check failed.
+func run(ctx context.Context, opts options, w io.Writer) error {
+	config, err := readConfig(opts.configFile)
+	if err != nil {
+		return err
+	}
+
+	role := map[string]interface{}{}
+	err = readJSONFile(opts.roleFile, &role)
+	if err != nil {
+		return err
+	}
+
+	roleName := opts.roleName
+	if roleName == "" {
+		roleName = strings.TrimSuffix(filepath.Base(opts.roleFile), filepath.Ext(opts.roleFile))
+	}
+
+	storage := &logical.InmemStorage{}
+	b, err := openstack.Factory(ctx, &logical.BackendConfig{
+		Logger: hclog.New(&hclog.LoggerOptions{Name: "osvault-diag", Level: hclog.Warn, Output: os.Stderr}),
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+		StorageView: storage,
+	})
+	if err != nil {
+		return err
+	}
+	defer b.Cleanup(ctx)
+
+	_, err = handle(ctx, b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      config,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	_, err = handle(ctx, b, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/" + roleName,
+		Storage:   storage,
+		Data:      role,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid role: %w", err)
+	}
+
+	data := map[string]interface{}{"role": roleName}
+	if opts.addrs != "" {
+		data["request_addr"] = opts.addrs
+	}
+	res, err := handle(ctx, b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "debug/attest/" + opts.instanceID,
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	checks, _ := res.Data["checks"].([]*openstack.AttestCheck)
+	passed, _ := res.Data["passed"].(bool)
+
+	if opts.json {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(res.Data)
+	} else {
+		err = writeReport(w, opts.instanceID, roleName, passed, checks)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !passed {
+		return errChecksFailed
+	}
+
+	return nil
+}
+
+// handle runs the request and returns the error responses as errors.
+func handle(ctx context.Context, b logical.Backend, req *logical.Request) (*logical.Response, error) {
+	res, err := b.HandleRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res != nil && res.IsError() {
+		return nil, res.Error()
+	}
+
+	return res, nil
+}
+
+// readConfig returns the backend config of the file, completed with the
+// standard OpenStack environment variables.
+func readConfig(path string) (map[string]interface{}, error) {
+	config := map[string]interface{}{}
+	if path != "" {
+		err := readJSONFile(path, &config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for env, field := range configEnv {
+		if _, ok := config[field]; ok {
+			continue
+		}
+		if val := os.Getenv(env); val != "" {
+			config[field] = val
+		}
+	}
+
+	return config, nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(buf, v)
+	if err != nil {
+		return fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeReport writes a line for each check with the error and the hint of
+// the failed ones.
+func writeReport(w io.Writer, instanceID, roleName string, passed bool, checks []*openstack.AttestCheck) error {
+	result := "PASSED"
+	if !passed {
+		result = "FAILED"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "instance %s, role %s: %s\n", instanceID, roleName, result)
+	for _, check := range checks {
+		switch {
+		case check.Skipped:
+			fmt.Fprintf(&sb, "  SKIP  %s\n", check.Name)
+		case check.Passed:
+			fmt.Fprintf(&sb, "  PASS  %s\n", check.Name)
+		default:
+			fmt.Fprintf(&sb, "  FAIL  %s: %s\n", check.Name, check.Error)
+			if check.Reason != "" {
+				fmt.Fprintf(&sb, "        reason: %s\n", check.Reason)
+			}
+			if check.Hint != "" {
+				fmt.Fprintf(&sb, "        hint: %s\n", check.Hint)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
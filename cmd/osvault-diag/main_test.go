@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+
+	"github.com/summerwind/vault-plugin-auth-openstack/internal/openstacktest"
+)
+
+func TestRun(t *testing.T) {
+	m := openstacktest.NewServer(t)
+	m.AddServer(&servers.Server{
+		ID:         "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5",
+		TenantID:   openstacktest.ProjectID,
+		Status:     "ACTIVE",
+		AccessIPv4: "192.168.1.1",
+		Metadata:   map[string]string{"vault-role": "web"},
+		Created:    time.Now(),
+	})
+
+	t.Setenv("OS_AUTH_URL", m.AuthURL())
+	t.Setenv("OS_USERNAME", "vault")
+	t.Setenv("OS_PASSWORD", "secret")
+	t.Setenv("OS_USER_DOMAIN_NAME", "Default")
+	t.Setenv("OS_PROJECT_ID", openstacktest.ProjectID)
+
+	dir := t.TempDir()
+	roleFile := filepath.Join(dir, "web.json")
+	err := os.WriteFile(roleFile, []byte(`{"policies": "web", "metadata_key": "vault-role", "auth_period": "10m", "auth_limit": 3}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		opts   options
+		err    error
+		report []string
+	}{
+		{
+			options{roleFile: roleFile, instanceID: "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", addrs: "192.168.1.1"},
+			nil,
+			[]string{"role web: PASSED", "PASS  address", "SKIP  stack"},
+		},
+		// fail: address mismatched
+		{
+			options{roleFile: roleFile, instanceID: "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", addrs: "192.168.1.2"},
+			errChecksFailed,
+			[]string{"role web: FAILED", "FAIL  address", "reason: addr_mismatch"},
+		},
+		// fail: role is not assigned to the instance
+		{
+			options{roleFile: roleFile, roleName: "db", instanceID: "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5"},
+			errChecksFailed,
+			[]string{"role db: FAILED", "SKIP  address", "FAIL  metadata"},
+		},
+	}
+
+	for i, test := range tests {
+		out := &bytes.Buffer{}
+		err := run(context.Background(), test.opts, out)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		}
+		for _, line := range test.report {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("%d: %q is not in the report:\n%s", i, line, out.String())
+			}
+		}
+	}
+
+	// fail: unknown instance
+	err = run(context.Background(), options{roleFile: roleFile, instanceID: "0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c"}, &bytes.Buffer{})
+	if err == nil || errors.Is(err, errChecksFailed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Command vault-openstack-login logs in to the OpenStack auth backend from
+// an instance and writes the token to a file, which Vault Agent can pick up
+// with the token_file auto-auth method.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/summerwind/vault-plugin-auth-openstack/client"
+)
+
+func main() {
+	var (
+		namespace   = flag.String("namespace", "", "Vault namespace the backend is mounted in. Defaults to VAULT_NAMESPACE.")
+		mountPath   = flag.String("mount", client.DefaultMountPath, "Path the OpenStack auth backend is mounted at, relative to the namespace.")
+		role        = flag.String("role", "", "Role to login with. Read from the instance metadata by default.")
+		instanceID  = flag.String("instance-id", "", "ID of the instance. Read from the metadata service by default.")
+		metadataKey = flag.String("metadata-key", client.DefaultMetadataKey, "Instance metadata key holding the role.")
+		metadataURL = flag.String("metadata-url", client.DefaultMetadataURL, "Endpoint of the metadata service.")
+		vendorData  = flag.String("vendordata-service", "", "Name of the vendordata service issuing the signed identity document of the instance.")
+		nonce       = flag.Bool("nonce", false, "Request a nonce and write it into the instance metadata before logging in, as required by the roles with nonce_metadata_key.")
+		cloud       = flag.String("cloud", "", "Entry of clouds.yaml to write the nonce with. Defaults to OS_CLOUD, or to the OS_* environment variables.")
+		sink        = flag.String("sink", "", "Path of the file to write the token to.")
+		renew       = flag.Bool("renew", false, "Keep running and renew the token until it reaches its max TTL.")
+	)
+	flag.Parse()
+
+	logger := hclog.New(&hclog.LoggerOptions{Name: "vault-openstack-login"})
+
+	if *sink == "" {
+		logger.Error("-sink is required")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The address and the TLS settings of Vault are read from the standard
+	// VAULT_* environment variables.
+	vaultClient, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		logger.Error("failed to create vault client", "error", err)
+		os.Exit(1)
+	}
+	if *namespace != "" {
+		vaultClient.SetNamespace(*namespace)
+	}
+
+	opts := []client.LoginOption{
+		client.WithMountPath(*mountPath),
+		client.WithRole(*role),
+		client.WithInstanceID(*instanceID),
+		client.WithMetadataKey(*metadataKey),
+		client.WithMetadataURL(*metadataURL),
+		client.WithVendorDataService(*vendorData),
+	}
+	if *nonce {
+		opts = append(opts, client.WithNonceWriter(client.NewComputeNonceWriter(*cloud)))
+	}
+
+	auth, err := client.NewOpenStackAuth(opts...)
+	if err != nil {
+		logger.Error("invalid login options", "error", err)
+		os.Exit(2)
+	}
+
+	secret, err := vaultClient.Auth().Login(ctx, auth)
+	if err != nil {
+		logger.Error("failed to login", "error", err)
+		os.Exit(1)
+	}
+
+	err = client.WriteTokenFile(*sink, secret)
+	if err != nil {
+		logger.Error("failed to write token", "sink", *sink, "error", err)
+		os.Exit(1)
+	}
+	logger.Info("token has been written", "sink", *sink, "accessor", secret.Auth.Accessor)
+
+	if !*renew {
+		return
+	}
+
+	err = client.Renew(ctx, vaultClient, secret)
+	if err != nil && ctx.Err() == nil {
+		logger.Error("failed to renew token", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("token is no longer renewed")
+}
@@ -0,0 +1,1217 @@
+// Package openstacktest provides a fake OpenStack cloud for the tests of the
+// backend. The server implements the parts of the Keystone, Nova, Heat,
+// Ironic, Neutron and Designate APIs, and of the Selectel APIs, that the
+// backend uses, so that the login flows can be tested end to end without a
+// real cloud.
+package openstacktest
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/applicationcredentials"
+)
+
+// The credentials and the identifiers the server accepts and returns.
+const (
+	Token     = "gAAAAABmocktoken"
+	ProjectID = "fcad67a6189847c4aecfa3c81a05783b"
+	UserID    = "a1c3e5f7b9d24f6a8c0e2b4d6f8a0c2e"
+
+	FederatedToken = "gAAAAABmockfederatedtoken"
+	AccessToken    = "mock-access-token"
+	ClientID       = "vault"
+	ClientSecret   = "client-secret"
+	Region         = "RegionOne"
+
+	SelectelToken = "selectel-token"
+)
+
+// Server is a fake OpenStack cloud served over HTTP. Its catalog points all
+// the services at the server itself, and every API requires Token.
+type Server struct {
+	server *httptest.Server
+
+	mutex             sync.RWMutex
+	servers           map[string]*servers.Server
+	availabilityZones map[string]string
+	projects          map[string]string
+	dedicated         map[string]*DedicatedServer
+	users             map[string]string
+	roles             map[string][]string
+	stacks            map[string]*Stack
+	nodes             map[string]*Node
+	groups            map[string]*ServerGroup
+	flavors           map[string]string
+	floatingIPs       map[string][]string
+	secrets           map[string]string
+
+	credentials map[string]*applicationcredentials.ApplicationCredential
+	recordSets  []*recordsets.RecordSet
+
+	computeVersion string
+	totpSecret     string
+	password       string
+
+	roleAssignmentsForbidden bool
+
+	identityRequests int64
+
+	authRequests   int64
+	serverRequests int64
+}
+
+// NewServer starts a server which is closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	return newServer(t, httptest.NewServer)
+}
+
+// NewTLSServer starts a server which serves HTTPS with a self-signed
+// certificate, returned by Certificate.
+func NewTLSServer(t testing.TB) *Server {
+	return newServer(t, httptest.NewTLSServer)
+}
+
+func newServer(t testing.TB, start func(http.Handler) *httptest.Server) *Server {
+	m := &Server{
+		servers:           map[string]*servers.Server{},
+		availabilityZones: map[string]string{},
+		projects:          map[string]string{},
+		dedicated:         map[string]*DedicatedServer{},
+		users:             map[string]string{},
+		roles:             map[string][]string{},
+		stacks:            map[string]*Stack{},
+		nodes:             map[string]*Node{},
+		groups:            map[string]*ServerGroup{},
+		flavors:           map[string]string{},
+		floatingIPs:       map[string][]string{},
+		secrets:           map[string]string{},
+
+		credentials: map[string]*applicationcredentials.ApplicationCredential{},
+
+		computeVersion: "2.96",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/auth/tokens", m.handleToken)
+	mux.HandleFunc("/v2.1/", m.handleComputeVersion)
+	mux.HandleFunc("/v2.1/servers/", m.handleServer)
+	mux.HandleFunc("/v2.1/os-server-groups", m.handleServerGroup)
+	mux.HandleFunc("/v2.1/os-server-groups/", m.handleServerGroup)
+	mux.HandleFunc("/v2.1/flavors/", m.handleFlavor)
+	mux.HandleFunc("/v3/projects/", m.handleIdentity)
+	mux.HandleFunc("/v3/users/", m.handleIdentity)
+	mux.HandleFunc("/v3/domains/", m.handleIdentity)
+	mux.HandleFunc("/v3/role_assignments", m.handleRoleAssignments)
+	mux.HandleFunc("/vpc/resell/v2/projects", m.handleProjects)
+	mux.HandleFunc("/servers/v2/resource/", m.handleDedicatedServer)
+	mux.HandleFunc("/heat/stacks/", m.handleStack)
+	mux.HandleFunc("/baremetal/nodes/", m.handleNode)
+	mux.HandleFunc("/baremetal/ports", m.handleNodePorts)
+	mux.HandleFunc("/network/v2.0/ports", m.handleNetworkPorts)
+	mux.HandleFunc("/network/v2.0/ports/", m.handleNetworkPort)
+	mux.HandleFunc("/network/v2.0/floatingips", m.handleFloatingIPs)
+	mux.HandleFunc("/designate/v2/zones", m.handleZones)
+	mux.HandleFunc("/v3/OS-FEDERATION/identity_providers/", m.handleFederationAuth)
+	mux.HandleFunc("/idp/.well-known/openid-configuration", m.handleOIDCDiscovery)
+	mux.HandleFunc("/idp/token", m.handleOIDCToken)
+	mux.HandleFunc("/designate/v2/zones/", m.handleRecordSets)
+	mux.HandleFunc("/key-manager/v1/secrets/", m.handleSecretPayload)
+
+	m.server = start(mux)
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+// URL returns the base URL of the server.
+func (m *Server) URL() string {
+	return m.server.URL
+}
+
+// Certificate returns the certificate of a server started with
+// NewTLSServer.
+func (m *Server) Certificate() *x509.Certificate {
+	return m.server.Certificate()
+}
+
+// Close shuts the server down before the end of the test, making the cloud
+// unreachable.
+func (m *Server) Close() {
+	m.server.Close()
+}
+
+// AuthURL returns the Keystone endpoint URL of the server.
+func (m *Server) AuthURL() string {
+	return m.server.URL + "/v3"
+}
+
+// SelectelURL returns the Selectel cloud management API URL of the server.
+func (m *Server) SelectelURL() string {
+	return m.server.URL + "/vpc/resell"
+}
+
+// AddProject registers the project to be returned by the Selectel API.
+func (m *Server) AddProject(id, name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.projects[id] = name
+}
+
+// SelectelServersURL returns the Selectel servers API URL of the server.
+func (m *Server) SelectelServersURL() string {
+	return m.server.URL + "/servers/v2"
+}
+
+// DedicatedServer is a server of the Selectel servers API.
+type DedicatedServer struct {
+	UUID        string            `json:"uuid"`
+	Name        string            `json:"name"`
+	State       string            `json:"state"`
+	ProjectUUID string            `json:"project_uuid"`
+	IPAddresses []string          `json:"ip_addresses"`
+	Tags        map[string]string `json:"tags"`
+	Created     time.Time         `json:"created"`
+}
+
+// AddDedicatedServer registers the server to be returned by the Selectel
+// servers API.
+func (m *Server) AddDedicatedServer(d *DedicatedServer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.dedicated[d.UUID] = d
+}
+
+// AddServer registers the server to be returned by the compute API.
+func (m *Server) AddServer(s *servers.Server) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.servers[s.ID] = s
+}
+
+// SetServerAvailabilityZone sets the availability zone the registered
+// server runs in.
+func (m *Server) SetServerAvailabilityZone(id, zone string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.availabilityZones[id] = zone
+}
+
+// AddServerFloatingIP associates the floating IP with the port of the
+// registered server.
+func (m *Server) AddServerFloatingIP(id, addr string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.floatingIPs[id] = append(m.floatingIPs[id], addr)
+}
+
+// SetServerStatus changes the status of the registered server.
+func (m *Server) SetServerStatus(id, status string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if s, ok := m.servers[id]; ok {
+		s.Status = status
+		s.Updated = time.Now()
+	}
+}
+
+// SetServerMetadata replaces the metadata of the registered server.
+func (m *Server) SetServerMetadata(id string, metadata map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if s, ok := m.servers[id]; ok {
+		s.Metadata = metadata
+		s.Updated = time.Now()
+	}
+}
+
+// AddUser registers the user to be returned by the identity API.
+func (m *Server) AddUser(id, name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.users[id] = name
+}
+
+// AddRoleAssignment assigns the role to the user on the project.
+func (m *Server) AddRoleAssignment(userID, projectID, role string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := userID + "/" + projectID
+	m.roles[key] = append(m.roles[key], role)
+}
+
+// Stack is a Heat stack with the IDs of the instances it contains.
+type Stack struct {
+	ID        string
+	Name      string
+	Status    string
+	Instances []string
+}
+
+// AddStack registers the stack to be returned by the orchestration API.
+func (m *Server) AddStack(stack *Stack) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.stacks[stack.ID] = stack
+}
+
+// ServerGroup is a Nova server group with the IDs of its members.
+type ServerGroup struct {
+	ID      string
+	Name    string
+	Members []string
+}
+
+// AddServerGroup registers the server group to be returned by the compute
+// API.
+func (m *Server) AddServerGroup(group *ServerGroup) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.groups[group.ID] = group
+}
+
+// AddFlavor registers the flavor to be returned by the compute API.
+func (m *Server) AddFlavor(id, name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.flavors[id] = name
+}
+
+// Node is an Ironic node with the addresses of its ports by MAC. The
+// Neutron ports of the addresses are bound to the node and belong to the
+// instance deployed on it.
+type Node struct {
+	UUID         string
+	InstanceUUID string
+	Name         string
+	State        string
+	Owner        string
+	Extra        map[string]string
+	Addresses    map[string]string
+	Deployed     time.Time
+}
+
+// AddNode registers the node to be returned by the bare metal API.
+func (m *Server) AddNode(node *Node) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nodes[node.UUID] = node
+}
+
+// AddSecret registers the payload of a secret to be returned by the key
+// manager API.
+func (m *Server) AddSecret(id, payload string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.secrets[id] = payload
+}
+
+// AddRecordSet registers the record set to be returned by the DNS API. The
+// zone of the record set is created on first use.
+func (m *Server) AddRecordSet(zone, name, recordType string, records ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.recordSets = append(m.recordSets, &recordsets.RecordSet{
+		ID:       fmt.Sprintf("recordset-%d", len(m.recordSets)+1),
+		ZoneID:   "zone-" + zone,
+		ZoneName: zone,
+		Name:     name,
+		Type:     recordType,
+		Records:  records,
+		Status:   "ACTIVE",
+	})
+}
+
+// SetComputeVersion sets the maximum microversion of the compute API. An
+// empty version makes the version document unavailable.
+func (m *Server) SetComputeVersion(version string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.computeVersion = version
+}
+
+// ApplicationCredential returns the application credential created with
+// the identity API.
+func (m *Server) ApplicationCredential(id string) *applicationcredentials.ApplicationCredential {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.credentials[id]
+}
+
+// SetTOTPSecret requires the token requests to authenticate with the
+// password and a TOTP passcode of the secret.
+func (m *Server) SetTOTPSecret(secret string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.totpSecret = secret
+}
+
+// SetPassword makes the token requests with the password method require
+// the password, which the user can change with the identity API.
+func (m *Server) SetPassword(password string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.password = password
+}
+
+// SetRoleAssignmentsForbidden makes the role assignment requests fail
+// with 403 Forbidden.
+func (m *Server) SetRoleAssignmentsForbidden(forbidden bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.roleAssignmentsForbidden = forbidden
+}
+
+// Password returns the current password of the user.
+func (m *Server) Password() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.password
+}
+
+// IdentityRequests returns the number of identity API requests received.
+func (m *Server) IdentityRequests() int64 {
+	return atomic.LoadInt64(&m.identityRequests)
+}
+
+// AuthRequests returns the number of token requests received.
+func (m *Server) AuthRequests() int64 {
+	return atomic.LoadInt64(&m.authRequests)
+}
+
+// ServerRequests returns the number of server requests received.
+func (m *Server) ServerRequests() int64 {
+	return atomic.LoadInt64(&m.serverRequests)
+}
+
+func (m *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&m.authRequests, 1)
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+				TOTP struct {
+					User struct {
+						Passcode string `json:"passcode"`
+					} `json:"user"`
+				} `json:"totp"`
+				ApplicationCredential struct {
+					ID     string `json:"id"`
+					Secret string `json:"secret"`
+				} `json:"application_credential"`
+				Token struct {
+					ID string `json:"id"`
+				} `json:"token"`
+			} `json:"identity"`
+		} `json:"auth"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	identity := body.Auth.Identity
+
+	m.mutex.RLock()
+	secret := m.totpSecret
+	password := m.password
+	credential := m.credentials[identity.ApplicationCredential.ID]
+	m.mutex.RUnlock()
+
+	if password != "" && len(identity.Methods) > 0 && identity.Methods[0] == "password" && identity.Password.User.Password != password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if len(identity.Methods) == 1 && identity.Methods[0] == "token" {
+		if identity.Token.ID != Token && identity.Token.ID != FederatedToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	} else if len(identity.Methods) == 1 && identity.Methods[0] == "application_credential" {
+		if credential == nil || credential.Secret != identity.ApplicationCredential.Secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	} else if secret != "" {
+		// The passcode of the previous step is accepted as well, like
+		// Keystone does by default.
+		current, _ := passcode(secret, time.Now())
+		previous, _ := passcode(secret, time.Now().Add(-passcodeStep))
+		passcode := identity.TOTP.User.Passcode
+		if len(identity.Methods) != 2 || (passcode != current && passcode != previous) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	token := map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"issued_at":  time.Now().UTC().Format(time.RFC3339),
+			"methods":    identity.Methods,
+			"user": map[string]interface{}{
+				"id":     UserID,
+				"name":   "vault",
+				"domain": map[string]interface{}{"id": "default", "name": "Default"},
+			},
+			"project": map[string]interface{}{
+				"id":     ProjectID,
+				"name":   "test",
+				"domain": map[string]interface{}{"id": "default", "name": "Default"},
+			},
+			"catalog": []interface{}{
+				catalogEntry("compute", "nova", m.server.URL+"/v2.1"),
+				catalogEntry("network", "neutron", m.server.URL+"/network"),
+				catalogEntry("identity", "keystone", m.server.URL+"/v3"),
+				catalogEntry("orchestration", "heat", m.server.URL+"/heat"),
+				catalogEntry("baremetal", "ironic", m.server.URL+"/baremetal"),
+				catalogEntry("dns", "designate", m.server.URL+"/designate"),
+				catalogEntry("key-manager", "barbican", m.server.URL+"/key-manager"),
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Subject-Token", Token)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+func catalogEntry(serviceType, name, url string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": serviceType,
+		"name": name,
+		"endpoints": []interface{}{
+			map[string]interface{}{
+				"interface": "public",
+				"region":    Region,
+				"region_id": Region,
+				"url":       url,
+			},
+		},
+	}
+}
+
+func (m *Server) handleServer(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&m.serverRequests, 1)
+
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v2.1/servers/")
+	if id == "detail" {
+		m.handleServerList(w, r)
+		return
+	}
+
+	m.mutex.RLock()
+	s, ok := m.servers[id]
+	zone := m.availabilityZones[id]
+	m.mutex.RUnlock()
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"itemNotFound": {"code": 404, "message": "Instance %s could not be found."}}`, id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"server": serverBody(s, zone),
+	})
+}
+
+// handleServerList lists the servers matching the name filter, which is a
+// regular expression as in the compute API, and the tenant filter.
+func (m *Server) handleServerList(w http.ResponseWriter, r *http.Request) {
+	name, err := regexp.Compile(r.URL.Query().Get("name"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	tenantID := r.URL.Query().Get("tenant_id")
+
+	m.mutex.RLock()
+	list := []map[string]interface{}{}
+	for id, s := range m.servers {
+		if !name.MatchString(s.Name) || (tenantID != "" && s.TenantID != tenantID) {
+			continue
+		}
+		list = append(list, serverBody(s, m.availabilityZones[id]))
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"servers": list,
+	})
+}
+
+// serverBody returns the server as returned by the compute API.
+func serverBody(s *servers.Server, zone string) map[string]interface{} {
+	// The image of an instance booted from a volume is an empty string.
+	var image interface{} = ""
+	if s.Image != nil {
+		image = s.Image
+	}
+
+	return map[string]interface{}{
+		"id":         s.ID,
+		"name":       s.Name,
+		"tenant_id":  s.TenantID,
+		"user_id":    s.UserID,
+		"hostId":     s.HostID,
+		"status":     s.Status,
+		"accessIPv4": s.AccessIPv4,
+		"accessIPv6": s.AccessIPv6,
+		"addresses":  s.Addresses,
+		"metadata":   s.Metadata,
+		"flavor":     s.Flavor,
+		"image":      image,
+		"key_name":   s.KeyName,
+		"created":    s.Created.UTC().Format(time.RFC3339),
+		"updated":    s.Updated.UTC().Format(time.RFC3339),
+
+		"OS-EXT-AZ:availability_zone": zone,
+	}
+}
+
+func (m *Server) handleProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Token") != SelectelToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	m.mutex.RLock()
+	projects := []map[string]interface{}{}
+	for id, name := range m.projects {
+		projects = append(projects, map[string]interface{}{"id": id, "name": name, "enabled": true})
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"projects": projects})
+}
+
+func (m *Server) handleDedicatedServer(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Token") != SelectelToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/servers/v2/resource/")
+
+	m.mutex.RLock()
+	d, ok := m.dedicated[id]
+	m.mutex.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": d})
+}
+
+func (m *Server) handleIdentity(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&m.identityRequests, 1)
+
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v3/"), "/")
+	if len(parts) == 3 && parts[0] == "users" && parts[2] == "application_credentials" {
+		m.handleApplicationCredentials(w, r, parts[1])
+		return
+	}
+	if len(parts) == 3 && parts[0] == "users" && parts[2] == "password" {
+		m.handleChangePassword(w, r, parts[1])
+		return
+	}
+	if len(parts) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	kind, id := parts[0], parts[1]
+
+	m.mutex.RLock()
+	var body map[string]interface{}
+	switch kind {
+	case "projects":
+		if name, ok := m.projects[id]; ok {
+			body = map[string]interface{}{"project": map[string]interface{}{"id": id, "name": name, "domain_id": "default", "enabled": true}}
+		}
+	case "users":
+		if name, ok := m.users[id]; ok {
+			body = map[string]interface{}{"user": map[string]interface{}{"id": id, "name": name, "domain_id": "default", "enabled": true}}
+		}
+	case "domains":
+		if id == "default" {
+			body = map[string]interface{}{"domain": map[string]interface{}{"id": id, "name": "Default", "enabled": true}}
+		}
+	}
+	m.mutex.RUnlock()
+
+	if body == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (m *Server) handleApplicationCredentials(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if userID != UserID {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		ApplicationCredential *applicationcredentials.ApplicationCredential `json:"application_credential"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.ApplicationCredential == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	credential := body.ApplicationCredential
+	credential.ProjectID = ProjectID
+	credential.Secret = "secret-" + credential.Name
+
+	m.mutex.Lock()
+	credential.ID = fmt.Sprintf("credential-%d", len(m.credentials)+1)
+	m.credentials[credential.ID] = credential
+	m.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"application_credential": credential})
+}
+
+func (m *Server) handleChangePassword(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if userID != UserID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		User struct {
+			OriginalPassword string `json:"original_password"`
+			Password         string `json:"password"`
+		} `json:"user"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.User.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if body.User.OriginalPassword != m.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	m.password = body.User.Password
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Server) handleRoleAssignments(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&m.identityRequests, 1)
+
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID := r.URL.Query().Get("user.id")
+	projectID := r.URL.Query().Get("scope.project.id")
+
+	m.mutex.RLock()
+	if m.roleAssignmentsForbidden {
+		m.mutex.RUnlock()
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	assignments := []map[string]interface{}{}
+	for _, role := range m.roles[userID+"/"+projectID] {
+		assignments = append(assignments, map[string]interface{}{
+			"role":  map[string]interface{}{"id": role, "name": role},
+			"scope": map[string]interface{}{"project": map[string]interface{}{"id": projectID}},
+			"user":  map[string]interface{}{"id": userID},
+		})
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"role_assignments": assignments, "links": map[string]interface{}{"next": nil}})
+}
+
+func (m *Server) handleServerGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	body := func(g *ServerGroup) map[string]interface{} {
+		return map[string]interface{}{
+			"id":       g.ID,
+			"name":     g.Name,
+			"policies": []string{"anti-affinity"},
+			"members":  g.Members,
+			"metadata": map[string]string{},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v2.1/os-server-groups"), "/")
+	if id == "" {
+		groups := []map[string]interface{}{}
+		for _, g := range m.groups {
+			groups = append(groups, body(g))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"server_groups": groups})
+		return
+	}
+
+	g, ok := m.groups[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"server_group": body(g)})
+}
+
+func (m *Server) handleFlavor(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v2.1/flavors/")
+
+	m.mutex.RLock()
+	name, ok := m.flavors[id]
+	m.mutex.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"flavor": map[string]interface{}{
+			"id":    id,
+			"name":  name,
+			"vcpus": 2,
+			"ram":   4096,
+			"disk":  20,
+		},
+	})
+}
+
+func (m *Server) handleStack(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/heat/stacks/"), "/")
+
+	m.mutex.RLock()
+	var stack *Stack
+	for _, s := range m.stacks {
+		if s.ID == parts[0] || s.Name == parts[0] {
+			stack = s
+		}
+	}
+	m.mutex.RUnlock()
+
+	if stack == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(parts) == 3 && parts[2] == "resources" {
+		resources := []map[string]interface{}{}
+		for i, id := range stack.Instances {
+			resources = append(resources, map[string]interface{}{
+				"resource_name":        fmt.Sprintf("server-%d", i),
+				"physical_resource_id": id,
+				"resource_type":        "OS::Nova::Server",
+				"resource_status":      "CREATE_COMPLETE",
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"resources": resources})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stack": map[string]interface{}{
+			"id":           stack.ID,
+			"stack_name":   stack.Name,
+			"stack_status": stack.Status,
+		},
+	})
+}
+
+func (m *Server) handleNode(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/baremetal/nodes/")
+
+	m.mutex.RLock()
+	node, ok := m.nodes[id]
+	m.mutex.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uuid":                 node.UUID,
+		"name":                 node.Name,
+		"provision_state":      node.State,
+		"owner":                node.Owner,
+		"instance_uuid":        node.InstanceUUID,
+		"extra":                node.Extra,
+		"created_at":           node.Deployed.Add(-24 * time.Hour),
+		"provision_updated_at": node.Deployed,
+	})
+}
+
+func (m *Server) handleNodePorts(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	m.mutex.RLock()
+	ports := []map[string]interface{}{}
+	if node, ok := m.nodes[r.URL.Query().Get("node_uuid")]; ok {
+		for mac := range node.Addresses {
+			ports = append(ports, map[string]interface{}{"address": mac, "node_uuid": node.UUID})
+		}
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ports": ports})
+}
+
+func (m *Server) handleNetworkPorts(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	mac := r.URL.Query().Get("mac_address")
+
+	m.mutex.RLock()
+	ports := []map[string]interface{}{}
+	if id := r.URL.Query().Get("device_id"); id != "" {
+		if s, ok := m.servers[id]; ok {
+			ports = append(ports, serverPortBody(s))
+		}
+	}
+	if fixed := r.URL.Query().Get("fixed_ips"); fixed != "" {
+		for _, s := range m.servers {
+			if fixed == "ip_address="+s.AccessIPv4 {
+				ports = append(ports, serverPortBody(s))
+			}
+		}
+	}
+	for _, node := range m.nodes {
+		if addr, ok := node.Addresses[mac]; ok {
+			ports = append(ports, map[string]interface{}{
+				"mac_address":     mac,
+				"network_id":      "provisioning",
+				"device_id":       node.InstanceUUID,
+				"binding:host_id": node.UUID,
+				"fixed_ips":       []map[string]interface{}{{"ip_address": addr}},
+			})
+		}
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ports": ports})
+}
+
+// handleNetworkPort serves the ports of the registered servers, which
+// hold the IPv4 access address of the server as the fixed IP.
+func (m *Server) handleNetworkPort(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/network/v2.0/ports/port-")
+
+	m.mutex.RLock()
+	s, ok := m.servers[id]
+	m.mutex.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"port": serverPortBody(s)})
+}
+
+func serverPortBody(s *servers.Server) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         "port-" + s.ID,
+		"device_id":  s.ID,
+		"network_id": "private",
+		"fixed_ips":  []map[string]interface{}{{"ip_address": s.AccessIPv4}},
+	}
+}
+
+func (m *Server) handleFloatingIPs(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	port := r.URL.Query().Get("port_id")
+	floating := r.URL.Query().Get("floating_ip_address")
+
+	m.mutex.RLock()
+	ips := []map[string]interface{}{}
+	for id, addrs := range m.floatingIPs {
+		if port != "" && port != "port-"+id {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if floating != "" && floating != addr {
+				continue
+			}
+			ips = append(ips, map[string]interface{}{"floating_ip_address": addr, "port_id": "port-" + id})
+		}
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"floatingips": ips})
+}
+
+func (m *Server) handleZones(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+
+	m.mutex.RLock()
+	found := []map[string]interface{}{}
+	for _, recordSet := range m.recordSets {
+		if recordSet.ZoneName == name {
+			found = append(found, map[string]interface{}{"id": recordSet.ZoneID, "name": recordSet.ZoneName, "status": "ACTIVE"})
+			break
+		}
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"zones": found, "links": map[string]interface{}{}})
+}
+
+func (m *Server) handleRecordSets(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/designate/v2/zones/"), "/")
+	if len(parts) != 2 || parts[1] != "recordsets" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := r.URL.Query().Get("name")
+
+	m.mutex.RLock()
+	found := []*recordsets.RecordSet{}
+	for _, recordSet := range m.recordSets {
+		if recordSet.ZoneID == parts[0] && recordSet.Name == name {
+			found = append(found, recordSet)
+		}
+	}
+	m.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recordsets": found, "links": map[string]interface{}{}})
+}
+
+// IDPURL returns the OpenID Connect identity provider URL of the server.
+func (m *Server) IDPURL() string {
+	return m.server.URL + "/idp"
+}
+
+func (m *Server) handleOIDCDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":         m.IDPURL(),
+		"token_endpoint": m.IDPURL() + "/token",
+	})
+}
+
+// handleOIDCToken issues the access tokens with the client credentials
+// grant, and with the password grant for the user alice.
+func (m *Server) handleOIDCToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if r.Method != http.MethodPost || clientID != ClientID || clientSecret != ClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "client_credentials":
+	case "password":
+		if r.PostFormValue("username") != "alice" || r.PostFormValue("password") != "wonderland" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+	})
+}
+
+func (m *Server) handleFederationAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v3/OS-FEDERATION/identity_providers/idp/protocols/openid/auth" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("X-Subject-Token", FederatedToken)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *Server) handleComputeVersion(w http.ResponseWriter, r *http.Request) {
+	m.mutex.RLock()
+	version := m.computeVersion
+	m.mutex.RUnlock()
+
+	if r.URL.Path != "/v2.1/" || version == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": map[string]interface{}{
+			"id":          "v2.1",
+			"status":      "CURRENT",
+			"min_version": "2.1",
+			"version":     version,
+		},
+	})
+}
+
+func (m *Server) handleSecretPayload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/key-manager/v1/secrets/"), "/payload")
+
+	m.mutex.RLock()
+	payload, ok := m.secrets[id]
+	m.mutex.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(payload))
+}
@@ -0,0 +1,58 @@
+package openstacktest
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+func TestServer(t *testing.T) {
+	m := NewServer(t)
+	m.AddServer(&servers.Server{
+		ID:       "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5",
+		TenantID: ProjectID,
+		Status:   "ACTIVE",
+		Metadata: map[string]string{"vault-role": "test"},
+	})
+
+	provider, err := openstack.AuthenticatedClient(gophercloud.AuthOptions{
+		IdentityEndpoint: m.AuthURL(),
+		Username:         "vault",
+		Password:         "secret",
+		DomainName:       "Default",
+		TenantID:         ProjectID,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Token() != Token {
+		t.Errorf("unexpected token: %s", provider.Token())
+	}
+
+	compute, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{Region: Region})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m.SetServerStatus("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", "SHUTOFF")
+	m.SetServerMetadata("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", map[string]string{"vault-role": "other"})
+
+	server, err := servers.Get(compute, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5").Extract()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server.Status != "SHUTOFF" || server.Metadata["vault-role"] != "other" {
+		t.Errorf("unexpected server: %v", server)
+	}
+
+	_, err = servers.Get(compute, "0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c").Extract()
+	if _, ok := err.(gophercloud.ErrDefault404); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if m.AuthRequests() != 1 || m.ServerRequests() != 2 {
+		t.Errorf("unexpected number of requests: %d, %d", m.AuthRequests(), m.ServerRequests())
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/sdk/plugin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 
 	openstack "github.com/summerwind/vault-plugin-auth-openstack/plugin"
 )
@@ -18,13 +24,49 @@ func main() {
 	tlsConfig := meta.GetTLSConfig()
 	tlsProviderFunc := api.VaultPluginTLSProvider(tlsConfig)
 
-	err := plugin.Serve(&plugin.ServeOpts{
+	logger := hclog.New(&hclog.LoggerOptions{})
+
+	shutdown, err := setupTracing(context.Background())
+	if err != nil {
+		logger.Warn("failed to set up tracing", "error", err)
+	}
+
+	err = plugin.Serve(&plugin.ServeOpts{
 		BackendFactoryFunc: openstack.Factory,
 		TLSProviderFunc:    tlsProviderFunc,
 	})
+
+	if shutdown != nil {
+		shutdown(context.Background())
+	}
+
 	if err != nil {
-		logger := hclog.New(&hclog.LoggerOptions{})
 		logger.Error("plugin shutting down", "error", err)
 		os.Exit(1)
 	}
 }
+
+// setupTracing exports the spans with OTLP over HTTP when the exporter
+// endpoint is specified in the environment of the plugin.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("vault-plugin-auth-openstack"),
+			semconv.ServiceVersionKey.String(openstack.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+const (
+	aliasNameInstanceID = "instance_id"
+	aliasNameProjectID  = "project_id"
+	aliasNameRole       = "role"
+)
+
+// aliasNames is the list of the attributes the entity alias can be named
+// after.
+var aliasNames = []string{aliasNameInstanceID, aliasNameProjectID, aliasNameRole}
+
+// validateAliasName returns an error if the alias_name of the config is
+// not one of the aliasNames.
+func (c *Config) validateAliasName() error {
+	errs := fieldErrors{}
+
+	if c.AliasName != "" && !strutil.StrListContains(aliasNames, c.AliasName) {
+		errs.add("alias_name", "must be one of %s", strings.Join(aliasNames, ", "))
+	}
+
+	return errs.err()
+}
+
+// entityAliasName returns the name of the entity alias of the instance. By
+// default each instance is its own entity, while naming the alias after the
+// project or the role lets the instances share one.
+func entityAliasName(config *Config, roleName string, instance *Instance) string {
+	switch config.AliasName {
+	case aliasNameProjectID:
+		return instance.TenantID
+	case aliasNameRole:
+		return roleName
+	default:
+		return instance.ID
+	}
+}
@@ -5,20 +5,117 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
-	"github.com/mitchellh/mapstructure"
 )
 
-type address struct {
-	Version int    `mapstructure:"version"`
-	Address string `mapstructure:"addr"`
+// Reasons of the attestation failures.
+const (
+	ReasonInstanceTooOld      = "instance_too_old"
+	ReasonAuthLimitExceeded   = "auth_limit_exceeded"
+	ReasonAddrMismatch        = "addr_mismatch"
+	ReasonInstanceNotActive   = "instance_not_active"
+	ReasonMetadataMismatch    = "metadata_mismatch"
+	ReasonTenantMismatch      = "tenant_mismatch"
+	ReasonUserMismatch        = "user_mismatch"
+	ReasonStackMismatch       = "stack_mismatch"
+	ReasonMKSMismatch         = "mks_mismatch"
+	ReasonDNSMismatch         = "dns_mismatch"
+	ReasonNotRegistered       = "not_registered"
+	ReasonInstanceRevoked     = "instance_revoked"
+	ReasonNonceMismatch       = "nonce_mismatch"
+	ReasonServerGroupMismatch = "server_group_mismatch"
+	ReasonFlavorMismatch      = "flavor_mismatch"
+	ReasonImageMismatch       = "image_mismatch"
+	ReasonKeyNameMismatch     = "key_name_mismatch"
+	ReasonTagsMismatch        = "tags_mismatch"
+
+	ReasonAvailabilityZoneMismatch = "availability_zone_mismatch"
+
+	ReasonIdentityDocumentInvalid = "identity_document_invalid"
+
+	ReasonReauthenticationDisallowed = "reauthentication_disallowed"
+
+	ReasonPortOwnershipMismatch = "port_ownership_mismatch"
+)
+
+const authLimitHint = "the instance exceeded auth_limit of the role, the attempts are kept until the auth deadline of the instance"
+
+// AttestError is returned when an instance fails the attestation. The hint
+// tells the operator how to fix the most common causes of the failure.
+type AttestError struct {
+	Reason string
+	Hint   string
+	Err    error
+}
+
+func (e *AttestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AttestError) Unwrap() error {
+	return e.Err
+}
+
+// attestReason returns the reason of the attestation failure. An empty
+// string is returned if the error is not an attestation failure.
+func attestReason(err error) string {
+	var attestErr *AttestError
+	if errors.As(err, &attestErr) {
+		return attestErr.Reason
+	}
+
+	return ""
+}
+
+// retryableReasons are the reasons of the attestation failures which may
+// pass when the login is retried later without any change, such as an
+// instance which is still being built.
+var retryableReasons = []string{
+	ReasonInstanceNotActive,
+	ReasonStackMismatch,
+	ReasonDNSMismatch,
+	ReasonNonceMismatch,
+}
+
+// attestRetryable returns whether the attestation failure may pass when the
+// login is retried later.
+func attestRetryable(err error) bool {
+	return strutil.StrListContains(retryableReasons, attestReason(err))
+}
+
+// attestHint returns the remediation hint of the attestation failure. An
+// empty string is returned if the failure has no hint.
+func attestHint(err error) string {
+	var attestErr *AttestError
+	if errors.As(err, &attestErr) {
+		return attestErr.Hint
+	}
+
+	return ""
+}
+
+// withHint appends the hint of the error to the message.
+func withHint(msg string, err error) string {
+	hint := attestHint(err)
+	if hint == "" {
+		return msg
+	}
+
+	return fmt.Sprintf("%s (hint: %s)", msg, hint)
 }
 
 type Attestor struct {
 	storage logical.Storage
+
+	// The identity document passed with the login and the error of its
+	// verification.
+	identityDocument    *identityDocument
+	identityDocumentErr error
 }
 
 // NewAttestor returns new attestor.
@@ -27,7 +124,17 @@ func NewAttestor(s logical.Storage) *Attestor {
 }
 
 // Attest is used to attest a OpenStack instance based on binded role and IP address.
-func (at *Attestor) Attest(instance *servers.Server, role *Role, addrs []string) error {
+func (at *Attestor) Attest(instance *Instance, role *Role, addrs []string) error {
+	err := at.AttestRevocation(instance)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestReauthentication(instance, role)
+	if err != nil {
+		return err
+	}
+
 	deadline, err := at.VerifyAuthPeriod(instance, role.AuthPeriod)
 	if err != nil {
 		return err
@@ -38,17 +145,37 @@ func (at *Attestor) Attest(instance *servers.Server, role *Role, addrs []string)
 		return err
 	}
 
-	err = at.AttestAddr(instance, addrs, role.AdditionalAcceptedPrefixes)
+	err = at.AttestIdentityDocument(instance, role)
 	if err != nil {
 		return err
 	}
 
+	// The nonce and the identity document prove the possession of the
+	// instance better than the request address, so they replace the
+	// address check.
+	if role.NonceMetadataKey == "" && at.identityDocument == nil {
+		err = at.AttestAddr(instance, addrs, role.AcceptedSourceCIDRs)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = at.AttestStatus(instance)
 	if err != nil {
 		return err
 	}
 
-	err = at.AttestMetadata(instance, role.MetadataKey, role.Name)
+	err = at.AttestRoleMetadata(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestBoundMetadata(instance, role.BoundMetadata)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestNonce(instance, role)
 	if err != nil {
 		return err
 	}
@@ -58,32 +185,208 @@ func (at *Attestor) Attest(instance *servers.Server, role *Role, addrs []string)
 		return err
 	}
 
+	err = at.AttestTenantID(instance, role.ProjectID)
+	if err != nil {
+		return err
+	}
+
 	err = at.AttestUserID(instance, role.UserID)
 	if err != nil {
 		return err
 	}
 
+	err = at.AttestAvailabilityZone(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestImage(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestKeyName(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestTags(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestRegistration(instance, role)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AttestInstance is used to attest a OpenStack instance based on binded
+// role without the request address and the authentication attempts. This
+// is used when the instance is attested on behalf of a provisioner.
+func (at *Attestor) AttestInstance(instance *Instance, role *Role) error {
+	err := at.AttestRevocation(instance)
+	if err != nil {
+		return err
+	}
+
+	_, err = at.VerifyAuthPeriod(instance, role.AuthPeriod)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestStatus(instance)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestRoleMetadata(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestBoundMetadata(instance, role.BoundMetadata)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestTenantID(instance, role.TenantID)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestTenantID(instance, role.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestUserID(instance, role.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestAvailabilityZone(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestImage(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestKeyName(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestTags(instance, role)
+	if err != nil {
+		return err
+	}
+
+	err = at.AttestRegistration(instance, role)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// AttestRoleMetadata attests the role name, or one of the metadata values
+// of the role, in the instance metadata. Roles bound to Kubernetes clusters
+// without a metadata key are identified by the cluster bindings instead,
+// since the worker nodes cannot carry the role.
+func (at *Attestor) AttestRoleMetadata(instance *Instance, role *Role) error {
+	if role.MetadataKey == "" && role.hasMKSBindings() {
+		return nil
+	}
+
+	if len(role.MetadataValues) > 0 {
+		return at.AttestMetadataValues(instance, role.MetadataKey, role.MetadataValues)
+	}
+
+	return at.AttestMetadata(instance, role.MetadataKey, role.Name)
+}
+
 // AttestMetadata is used to attest a OpenStack instance metadata.
-func (at *Attestor) AttestMetadata(instance *servers.Server, metadataKey string, roleName string) error {
+func (at *Attestor) AttestMetadata(instance *Instance, metadataKey string, roleName string) error {
 	val, ok := instance.Metadata[metadataKey]
 	if !ok {
-		return errors.New("metadata key not found")
+		return &AttestError{
+			Reason: ReasonMetadataMismatch,
+			Hint:   fmt.Sprintf("instance metadata key '%s' missing, set it with `openstack server set --property %s=%s <instance>`", metadataKey, metadataKey, roleName),
+			Err:    errors.New("metadata key not found"),
+		}
 	}
 
 	if val != roleName {
-		return fmt.Errorf("metadata role name mismatched: expected %s, got %s", val, roleName)
+		return &AttestError{
+			Reason: ReasonMetadataMismatch,
+			Hint:   fmt.Sprintf("the instance is assigned to role '%s', log in with that role or set it with `openstack server set --property %s=%s <instance>`", val, metadataKey, roleName),
+			Err:    fmt.Errorf("metadata role name mismatched: expected %s, got %s", val, roleName),
+		}
+	}
+
+	return nil
+}
+
+// AttestMetadataValues is used to attest that a OpenStack instance metadata
+// matches any of the values, which may contain * wildcards.
+func (at *Attestor) AttestMetadataValues(instance *Instance, metadataKey string, values []string) error {
+	val, ok := instance.Metadata[metadataKey]
+	if !ok {
+		return &AttestError{
+			Reason: ReasonMetadataMismatch,
+			Hint:   fmt.Sprintf("instance metadata key '%s' missing, set it with `openstack server set --property %s=<value> <instance>` to a value matching one of %s", metadataKey, metadataKey, strings.Join(values, ", ")),
+			Err:    errors.New("metadata key not found"),
+		}
+	}
+
+	if !strutil.StrListContainsGlob(values, val) {
+		return &AttestError{
+			Reason: ReasonMetadataMismatch,
+			Hint:   fmt.Sprintf("the instance metadata key '%s' is '%s', set it to a value matching one of %s", metadataKey, val, strings.Join(values, ", ")),
+			Err:    fmt.Errorf("metadata value mismatched: %s matches none of %v", val, values),
+		}
+	}
+
+	return nil
+}
+
+// AttestBoundMetadata is used to attest that a OpenStack instance metadata
+// has all the key-value pairs. The values may contain * wildcards.
+func (at *Attestor) AttestBoundMetadata(instance *Instance, bound map[string]string) error {
+	keys := make([]string, 0, len(bound))
+	for key := range bound {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val, ok := instance.Metadata[key]
+		if !ok || !strutil.StrListContainsGlob([]string{bound[key]}, val) {
+			return &AttestError{
+				Reason: ReasonMetadataMismatch,
+				Hint:   fmt.Sprintf("the role requires the instance metadata %s=%s, set it with `openstack server set --property %s=<value> <instance>`", key, bound[key], key),
+				Err:    fmt.Errorf("metadata mismatched: %s does not match %s", key, bound[key]),
+			}
+		}
 	}
 
 	return nil
 }
 
 // AttestStatus is used to attest the status of OpenStack instance.
-func (at *Attestor) AttestStatus(instance *servers.Server) error {
+func (at *Attestor) AttestStatus(instance *Instance) error {
 	if instance.Status != "ACTIVE" {
-		return errors.New("instance is not active")
+		return &AttestError{
+			Reason: ReasonInstanceNotActive,
+			Hint:   fmt.Sprintf("the instance is %s, log in once it is ACTIVE", instance.Status),
+			Err:    errors.New("instance is not active"),
+		}
 	}
 
 	return nil
@@ -91,9 +394,7 @@ func (at *Attestor) AttestStatus(instance *servers.Server) error {
 
 // AttestAddr is used to attest the IP address of OpenStack instance
 // with source IP address.
-func (at *Attestor) AttestAddr(instance *servers.Server, addrs []string, additionalAcceptedPrefixes []string) error {
-	var instanceAddresses map[string][]address
-
+func (at *Attestor) AttestAddr(instance *Instance, addrs []string, additionalAcceptedPrefixes []string) error {
 	for _, addr := range addrs {
 		if instance.AccessIPv4 == addr {
 			return nil
@@ -101,55 +402,95 @@ func (at *Attestor) AttestAddr(instance *servers.Server, addrs []string, additio
 		if instance.AccessIPv6 == addr {
 			return nil
 		}
+		if hasAddress(instance.Addresses, addr) {
+			return nil
+		}
+		if strutil.StrListContains(instance.FloatingIPs, addr) {
+			return nil
+		}
+	}
 
-		err := mapstructure.Decode(instance.Addresses, &instanceAddresses)
-		if err != nil {
-			return err
+	if len(additionalAcceptedPrefixes) > 0 {
+		ips := make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil {
+				ips = append(ips, ip)
+			}
 		}
 
-		for _, instAddrs := range instanceAddresses {
-			for _, val := range instAddrs {
-				if val.Address == addr {
+		for _, prefix := range additionalAcceptedPrefixes {
+			_, cidr, err := net.ParseCIDR(prefix)
+			if err != nil {
+				return err
+			}
+			for _, ip := range ips {
+				if cidr.Contains(ip) {
 					return nil
 				}
 			}
 		}
 	}
 
-	for _, prefix := range additionalAcceptedPrefixes {
-		for _, addr := range addrs {
-			if _, cidr, err := net.ParseCIDR(prefix); err != nil {
-				return err
-			} else if cidr.Contains(net.ParseIP(addr)) {
-				return nil
+	return &AttestError{
+		Reason: ReasonAddrMismatch,
+		Hint:   "log in from an address of the instance; behind a proxy or NAT, set request_address_headers in the config or accepted_source_cidrs on the role",
+		Err:    fmt.Errorf("address mismatched: none of %v belongs to instance", addrs),
+	}
+}
+
+// hasAddress reports whether addr is attached to any network of the
+// instance. The addresses are traversed as decoded from the API response
+// so that nothing is allocated for each request address.
+func hasAddress(addresses map[string]interface{}, addr string) bool {
+	for _, network := range addresses {
+		entries, ok := network.([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, entry := range entries {
+			fields, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if val, ok := fields["addr"].(string); ok && val == addr {
+				return true
 			}
 		}
 	}
 
-	return fmt.Errorf("address mismatched: none of %v belongs to instance", addrs)
+	return false
 }
 
 // AttestTenantID is used to attest the tenant ID of OpenStack instance.
-func (at *Attestor) AttestTenantID(instance *servers.Server, tenantID string) error {
+func (at *Attestor) AttestTenantID(instance *Instance, tenantID string) error {
 	if tenantID == "" {
 		return nil
 	}
 
 	if instance.TenantID != tenantID {
-		return fmt.Errorf("tenant ID mismatched: expected %s, got %s", instance.TenantID, tenantID)
+		return &AttestError{
+			Reason: ReasonTenantMismatch,
+			Hint:   fmt.Sprintf("the instance belongs to project %s, launch it in the project bound to the role or use a role bound to its project", instance.TenantID),
+			Err:    fmt.Errorf("tenant ID mismatched: expected %s, got %s", instance.TenantID, tenantID),
+		}
 	}
 
 	return nil
 }
 
 // AttestUserID is used to attest the user ID of OpenStack instance.
-func (at *Attestor) AttestUserID(instance *servers.Server, userID string) error {
+func (at *Attestor) AttestUserID(instance *Instance, userID string) error {
 	if userID == "" {
 		return nil
 	}
 
 	if instance.UserID != userID {
-		return fmt.Errorf("user ID mismatched: expected %s, got %s", instance.UserID, userID)
+		return &AttestError{
+			Reason: ReasonUserMismatch,
+			Hint:   fmt.Sprintf("the instance was launched by user %s, launch it as the user bound to the role", instance.UserID),
+			Err:    fmt.Errorf("user ID mismatched: expected %s, got %s", instance.UserID, userID),
+		}
 	}
 
 	return nil
@@ -158,10 +499,14 @@ func (at *Attestor) AttestUserID(instance *servers.Server, userID string) error
 // VerifyAuthPeriod is used to verify the deadline of authentication.
 // The deadline is calculated by the create date of OpenStack instance and
 // the authentication period specified by a binded role.
-func (at *Attestor) VerifyAuthPeriod(instance *servers.Server, period time.Duration) (time.Time, error) {
+func (at *Attestor) VerifyAuthPeriod(instance *Instance, period time.Duration) (time.Time, error) {
 	deadline := instance.Created.Add(period)
 	if time.Now().After(deadline) {
-		return deadline, errors.New("authentication deadline exceeded")
+		return deadline, &AttestError{
+			Reason: ReasonInstanceTooOld,
+			Hint:   "instances can only log in within auth_period of their creation, log in at boot or raise auth_period of the role",
+			Err:    errors.New("authentication deadline exceeded"),
+		}
 	}
 
 	return deadline, nil
@@ -169,7 +514,7 @@ func (at *Attestor) VerifyAuthPeriod(instance *servers.Server, period time.Durat
 
 // VerifyAuthLimit is used to verify the number of attempts of authentication.
 // The limit of authentication is specified by a binded role.
-func (at *Attestor) VerifyAuthLimit(instance *servers.Server, limit int, deadline time.Time) (int, error) {
+func (at *Attestor) VerifyAuthLimit(instance *Instance, limit int, deadline time.Time) (int, error) {
 	ctx := context.Background()
 
 	attempt, err := readAuthAttempt(ctx, at.storage, instance.ID)
@@ -193,8 +538,218 @@ func (at *Attestor) VerifyAuthLimit(instance *servers.Server, limit int, deadlin
 	}
 
 	if attempt.Count > limit {
-		return attempt.Count, errors.New("too many authentication failures")
+		return attempt.Count, &AttestError{Reason: ReasonAuthLimitExceeded, Hint: authLimitHint, Err: errors.New("too many authentication failures")}
 	}
 
 	return attempt.Count, nil
 }
+
+// AttestCheck is the result of a single check of the attestation.
+type AttestCheck struct {
+	Name    string                 `json:"name" structs:"name" mapstructure:"name"`
+	Input   map[string]interface{} `json:"input" structs:"input" mapstructure:"input"`
+	Passed  bool                   `json:"passed" structs:"passed" mapstructure:"passed"`
+	Skipped bool                   `json:"skipped" structs:"skipped" mapstructure:"skipped"`
+	Reason  string                 `json:"reason,omitempty" structs:"reason" mapstructure:"reason"`
+	Hint    string                 `json:"hint,omitempty" structs:"hint" mapstructure:"hint"`
+	Error   string                 `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+// Trace runs every check of the attestation and returns the result of each
+// check with its inputs. Unlike Attest, Trace doesn't stop at the first
+// failure and doesn't count an authentication attempt. The address check
+// is skipped when no address is given, the role requires a nonce or an
+// identity document was verified.
+func (at *Attestor) Trace(instance *Instance, role *Role, addrs []string) ([]*AttestCheck, error) {
+	checks := []*AttestCheck{}
+
+	checks = append(checks, newAttestCheck("revocation", map[string]interface{}{
+		"instance_id": instance.ID,
+	}, at.AttestRevocation(instance)))
+
+	reauthCheck := newAttestCheck("reauthentication", map[string]interface{}{
+		"disallow_reauthentication": role.DisallowReauthentication,
+	}, at.AttestReauthentication(instance, role))
+	reauthCheck.Skipped = !role.DisallowReauthentication
+	checks = append(checks, reauthCheck)
+
+	deadline, err := at.VerifyAuthPeriod(instance, role.AuthPeriod)
+	checks = append(checks, newAttestCheck("auth_period", map[string]interface{}{
+		"created":     instance.Created,
+		"auth_period": int64(role.AuthPeriod / time.Second),
+		"deadline":    deadline,
+	}, err))
+
+	attempt, err := readAuthAttempt(context.Background(), at.storage, instance.ID)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	if attempt != nil {
+		count = attempt.Count
+	}
+	err = nil
+	if count >= role.AuthLimit {
+		err = &AttestError{Reason: ReasonAuthLimitExceeded, Hint: authLimitHint, Err: errors.New("too many authentication failures")}
+	}
+	checks = append(checks, newAttestCheck("auth_limit", map[string]interface{}{
+		"attempts":   count,
+		"auth_limit": role.AuthLimit,
+	}, err))
+
+	documentCheck := newAttestCheck("identity_document", map[string]interface{}{
+		"require_identity_document": role.RequireIdentityDocument,
+	}, at.AttestIdentityDocument(instance, role))
+	documentCheck.Skipped = at.identityDocument == nil && at.identityDocumentErr == nil && !role.RequireIdentityDocument
+	checks = append(checks, documentCheck)
+
+	addrCheck := newAttestCheck("address", map[string]interface{}{
+		"request_addresses":     addrs,
+		"instance_addresses":    instanceAddresses(instance),
+		"accepted_source_cidrs": role.AcceptedSourceCIDRs,
+	}, nil)
+	if len(addrs) > 0 && role.NonceMetadataKey == "" && at.identityDocument == nil {
+		addrCheck = newAttestCheck(addrCheck.Name, addrCheck.Input, at.AttestAddr(instance, addrs, role.AcceptedSourceCIDRs))
+	} else {
+		addrCheck.Skipped = true
+	}
+	checks = append(checks, addrCheck)
+
+	checks = append(checks, newAttestCheck("status", map[string]interface{}{
+		"status": instance.Status,
+	}, at.AttestStatus(instance)))
+
+	metadataCheck := newAttestCheck("metadata", map[string]interface{}{
+		"metadata_key": role.MetadataKey,
+		"value":        instance.Metadata[role.MetadataKey],
+		"role":         role.Name,
+		"values":       role.MetadataValues,
+	}, at.AttestRoleMetadata(instance, role))
+	metadataCheck.Skipped = role.MetadataKey == "" && role.hasMKSBindings()
+	checks = append(checks, metadataCheck)
+
+	boundMetadata := make(map[string]string, len(role.BoundMetadata))
+	for key := range role.BoundMetadata {
+		boundMetadata[key] = instance.Metadata[key]
+	}
+	boundMetadataCheck := newAttestCheck("bound_metadata", map[string]interface{}{
+		"instance": boundMetadata,
+		"role":     role.BoundMetadata,
+	}, at.AttestBoundMetadata(instance, role.BoundMetadata))
+	boundMetadataCheck.Skipped = len(role.BoundMetadata) == 0
+	checks = append(checks, boundMetadataCheck)
+
+	nonceCheck := newAttestCheck("nonce", map[string]interface{}{
+		"nonce_metadata_key": role.NonceMetadataKey,
+	}, at.AttestNonce(instance, role))
+	nonceCheck.Skipped = role.NonceMetadataKey == ""
+	checks = append(checks, nonceCheck)
+
+	checks = append(checks, newAttestCheck("tenant_id", map[string]interface{}{
+		"instance": instance.TenantID,
+		"role":     role.TenantID,
+	}, at.AttestTenantID(instance, role.TenantID)))
+
+	checks = append(checks, newAttestCheck("project_id", map[string]interface{}{
+		"instance": instance.TenantID,
+		"role":     role.ProjectID,
+	}, at.AttestTenantID(instance, role.ProjectID)))
+
+	checks = append(checks, newAttestCheck("user_id", map[string]interface{}{
+		"instance": instance.UserID,
+		"role":     role.UserID,
+	}, at.AttestUserID(instance, role.UserID)))
+
+	zoneCheck := newAttestCheck("availability_zone", map[string]interface{}{
+		"instance": instance.AvailabilityZone,
+		"role":     role.BoundAvailabilityZones,
+	}, at.AttestAvailabilityZone(instance, role))
+	zoneCheck.Skipped = len(role.BoundAvailabilityZones) == 0
+	checks = append(checks, zoneCheck)
+
+	imageCheck := newAttestCheck("image", map[string]interface{}{
+		"instance": instance.Image["id"],
+		"role":     role.BoundImageIDs,
+	}, at.AttestImage(instance, role))
+	imageCheck.Skipped = len(role.BoundImageIDs) == 0
+	checks = append(checks, imageCheck)
+
+	keyNameCheck := newAttestCheck("key_name", map[string]interface{}{
+		"instance": instance.KeyName,
+		"role":     role.BoundKeyNames,
+	}, at.AttestKeyName(instance, role))
+	keyNameCheck.Skipped = len(role.BoundKeyNames) == 0
+	checks = append(checks, keyNameCheck)
+
+	var tags []string
+	if instance.Tags != nil {
+		tags = *instance.Tags
+	}
+	tagsCheck := newAttestCheck("tags", map[string]interface{}{
+		"instance": tags,
+		"role":     role.BoundTags,
+	}, at.AttestTags(instance, role))
+	tagsCheck.Skipped = len(role.BoundTags) == 0
+	checks = append(checks, tagsCheck)
+
+	registrationCheck := newAttestCheck("registration", map[string]interface{}{
+		"require_preregistration": role.RequirePreregistration,
+	}, at.AttestRegistration(instance, role))
+	registrationCheck.Skipped = !role.RequirePreregistration
+	checks = append(checks, registrationCheck)
+
+	return checks, nil
+}
+
+func newAttestCheck(name string, input map[string]interface{}, err error) *AttestCheck {
+	check := &AttestCheck{
+		Name:   name,
+		Input:  input,
+		Passed: err == nil,
+	}
+
+	if err != nil {
+		check.Reason = attestReason(err)
+		check.Hint = attestHint(err)
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+// instanceAddresses returns all addresses of the instance.
+func instanceAddresses(instance *Instance) []string {
+	addrs := []string{}
+
+	if instance.AccessIPv4 != "" {
+		addrs = append(addrs, instance.AccessIPv4)
+	}
+	if instance.AccessIPv6 != "" {
+		addrs = append(addrs, instance.AccessIPv6)
+	}
+
+	for _, network := range instance.Addresses {
+		entries, ok := network.([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, entry := range entries {
+			fields, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if val, ok := fields["addr"].(string); ok {
+				addrs = append(addrs, val)
+			}
+		}
+	}
+
+	for _, addr := range instance.FloatingIPs {
+		if !strutil.StrListContains(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
@@ -1,28 +1,35 @@
 package plugin
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/vault/sdk/logical"
 )
 
-func newTestInstance() *servers.Server {
-	return &servers.Server{
-		ID:         "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5",
-		Name:       "test",
-		UserID:     "9349aff8be7545ac9d2f1d00999a23cd",
-		TenantID:   "fcad67a6189847c4aecfa3c81a05783b",
-		HostID:     "29d3c8c896a45aa4c34e52247875d7fefc3d94bbcc9f622b5d204362",
-		Status:     "ACTIVE",
-		AccessIPv4: "",
-		AccessIPv6: "",
-		Addresses:  map[string]interface{}{},
-		Metadata:   map[string]string{},
-		Created:    time.Now(),
-		Updated:    time.Now(),
+func newTestInstance() *Instance {
+	return &Instance{
+		Server: servers.Server{
+			ID:         "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5",
+			Name:       "test",
+			UserID:     "9349aff8be7545ac9d2f1d00999a23cd",
+			TenantID:   "fcad67a6189847c4aecfa3c81a05783b",
+			HostID:     "29d3c8c896a45aa4c34e52247875d7fefc3d94bbcc9f622b5d204362",
+			Status:     "ACTIVE",
+			AccessIPv4: "",
+			AccessIPv6: "",
+			Addresses:  map[string]interface{}{},
+			Metadata:   map[string]string{},
+			Created:    time.Now(),
+			Updated:    time.Now(),
+		},
 	}
 }
 
@@ -137,6 +144,64 @@ func TestAttestMetadata(t *testing.T) {
 	}
 }
 
+func TestAttestMetadataValues(t *testing.T) {
+	var tests = []struct {
+		val    string
+		values []string
+		result bool
+	}{
+		{"web", []string{"web"}, true},
+		{"web-prod", []string{"web-*"}, true},
+		{"web-prod", []string{"db-*", "web-*"}, true},
+		{"eu-web-prod", []string{"*-web-*"}, true},
+		{"web", []string{"web-*"}, false},
+		{"db-prod", []string{"web-*", "web"}, false},
+		{"", []string{"web-*"}, false},
+	}
+
+	_, storage := newTestBackend(t)
+	attestor := NewAttestor(storage)
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		if test.val != "" {
+			instance.Metadata["vault-role"] = test.val
+		}
+
+		err := attestor.AttestRoleMetadata(instance, &Role{Name: "test", MetadataKey: "vault-role", MetadataValues: test.values})
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+	}
+}
+
+func TestAttestBoundMetadata(t *testing.T) {
+	var tests = []struct {
+		bound  map[string]string
+		result bool
+	}{
+		{nil, true},
+		{map[string]string{"env": "prod"}, true},
+		{map[string]string{"env": "prod", "tier": "web-*"}, true},
+		{map[string]string{"env": "prod", "tier": "db"}, false},
+		{map[string]string{"env": "prod", "zone": "a"}, false},
+	}
+
+	_, storage := newTestBackend(t)
+	attestor := NewAttestor(storage)
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		instance.Metadata["env"] = "prod"
+		instance.Metadata["tier"] = "web-frontend"
+
+		err := attestor.AttestBoundMetadata(instance, test.bound)
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+	}
+}
+
 func TestAttestStatus(t *testing.T) {
 	var tests = []struct {
 		status string
@@ -290,6 +355,101 @@ func TestAttestUserID(t *testing.T) {
 	}
 }
 
+func TestAttestImage(t *testing.T) {
+	var tests = []struct {
+		image    map[string]interface{}
+		imageIDs []string
+		result   bool
+	}{
+		{nil, nil, true},
+		{map[string]interface{}{"id": "2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}, []string{"2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}, true},
+		{map[string]interface{}{"id": "2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}, []string{"other", "2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}, true},
+		{map[string]interface{}{"id": "2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}, []string{"other"}, false},
+		// booted from a volume
+		{nil, []string{"2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}, false},
+	}
+
+	_, storage := newTestBackend(t)
+	attestor := NewAttestor(storage)
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		instance.Image = test.image
+
+		err := attestor.AttestImage(instance, &Role{BoundImageIDs: test.imageIDs})
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+		if err != nil && attestReason(err) != ReasonImageMismatch {
+			t.Errorf("unexpected reason: %v - %v", test, err)
+		}
+	}
+}
+
+func TestAttestKeyName(t *testing.T) {
+	var tests = []struct {
+		keyName  string
+		keyNames []string
+		result   bool
+	}{
+		{"", nil, true},
+		{"deploy", []string{"deploy"}, true},
+		{"deploy", []string{"admin", "deploy"}, true},
+		{"personal", []string{"deploy"}, false},
+		{"", []string{"deploy"}, false},
+	}
+
+	_, storage := newTestBackend(t)
+	attestor := NewAttestor(storage)
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		instance.KeyName = test.keyName
+
+		err := attestor.AttestKeyName(instance, &Role{BoundKeyNames: test.keyNames})
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+		if err != nil && attestReason(err) != ReasonKeyNameMismatch {
+			t.Errorf("unexpected reason: %v - %v", test, err)
+		}
+	}
+}
+
+func TestAttestTags(t *testing.T) {
+	var tests = []struct {
+		tags      []string
+		boundTags []string
+		result    bool
+	}{
+		{nil, nil, true},
+		{[]string{"prod", "web"}, []string{"web"}, true},
+		{[]string{"prod", "web"}, []string{"web", "prod"}, true},
+		{[]string{"web"}, []string{"web", "prod"}, false},
+		{[]string{}, []string{"web"}, false},
+		// the tags are not returned before microversion 2.26
+		{nil, []string{"web"}, false},
+	}
+
+	_, storage := newTestBackend(t)
+	attestor := NewAttestor(storage)
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		if test.tags != nil {
+			instance.Tags = &test.tags
+		}
+
+		err := attestor.AttestTags(instance, &Role{BoundTags: test.boundTags})
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+		if err != nil && attestReason(err) != ReasonTagsMismatch {
+			t.Errorf("unexpected reason: %v - %v", test, err)
+		}
+	}
+}
+
 func TestVerifyAuthPeriod(t *testing.T) {
 	var tests = []struct {
 		diff   int
@@ -340,3 +500,147 @@ func TestVerifyAuthLimit(t *testing.T) {
 		t.Errorf("unexpected result: [%d]", count)
 	}
 }
+
+func newBenchmarkInstance() *Instance {
+	instance := newTestInstance()
+	instance.Metadata["vault-role"] = "test"
+
+	networks := map[string][]string{
+		"private":    {"10.0.0.11", "10.0.0.12", "fd00::11"},
+		"storage":    {"10.1.0.11", "fd01::11"},
+		"management": {"10.2.0.11", "fd02::11"},
+		"public":     {"203.0.113.11", "2001:db8::11", correctIPv4},
+	}
+
+	instance.Addresses = map[string]interface{}{}
+	for name, addrs := range networks {
+		entries := []interface{}{}
+		for _, addr := range addrs {
+			ipVersion := 4
+			if net.ParseIP(addr).To4() == nil {
+				ipVersion = 6
+			}
+			entries = append(entries, map[string]interface{}{
+				"OS-EXT-IPS-MAC:mac_addr": "fa:16:3e:9e:89:be",
+				"OS-EXT-IPS:type":         "fixed",
+				"version":                 float64(ipVersion),
+				"addr":                    addr,
+			})
+		}
+		instance.Addresses[name] = entries
+	}
+
+	return instance
+}
+
+func BenchmarkAttest(b *testing.B) {
+	attestor := NewAttestor(&logical.InmemStorage{})
+	instance := newBenchmarkInstance()
+	requestAddr := []string{proxyIPv4, correctIPv4}
+
+	role := &Role{
+		Name:        "test",
+		MetadataKey: "vault-role",
+		TenantID:    "fcad67a6189847c4aecfa3c81a05783b",
+		AuthPeriod:  time.Duration(120) * time.Second,
+		AuthLimit:   math.MaxInt32,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := attestor.Attest(instance, role, requestAddr)
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkAttestAddr(b *testing.B) {
+	var benchmarks = []struct {
+		name                       string
+		request                    []string
+		additionalAcceptedPrefixes []string
+	}{
+		{"match", []string{proxyIPv4, correctIPv4}, []string{}},
+		{"mismatch", []string{proxyIPv4, wrongIPv4}, []string{}},
+		{"prefix", []string{proxyIPv4, natIPv4}, []string{"192.168.99.0/24", fmt.Sprintf("%s/32", natIPv4)}},
+	}
+
+	attestor := NewAttestor(&logical.InmemStorage{})
+	instance := newBenchmarkInstance()
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				attestor.AttestAddr(instance, bm.request, bm.additionalAcceptedPrefixes)
+			}
+		})
+	}
+}
+
+func TestAttestReason(t *testing.T) {
+	var tests = []struct {
+		status   string
+		metadata string
+		reason   string
+	}{
+		{"ACTIVE", "test", ""},
+		{"ERROR", "test", ReasonInstanceNotActive},
+		{"ACTIVE", "invalid", ReasonMetadataMismatch},
+	}
+
+	attestor := NewAttestor(&logical.InmemStorage{})
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		instance.Status = test.status
+		instance.Metadata["vault-role"] = test.metadata
+
+		err := attestor.AttestInstance(instance, &Role{Name: "test", MetadataKey: "vault-role", AuthPeriod: time.Minute})
+		if reason := attestReason(err); reason != test.reason {
+			t.Errorf("unexpected reason: %v - %s", test, reason)
+		}
+	}
+}
+
+func TestAttestHint(t *testing.T) {
+	var tests = []struct {
+		metadata map[string]string
+		hint     string
+	}{
+		{map[string]string{"vault-role": "test"}, ""},
+		{map[string]string{}, "instance metadata key 'vault-role' missing, set it with `openstack server set --property vault-role=test <instance>`"},
+		{map[string]string{"vault-role": "other"}, "the instance is assigned to role 'other', log in with that role or set it with `openstack server set --property vault-role=test <instance>`"},
+	}
+
+	attestor := NewAttestor(&logical.InmemStorage{})
+
+	for _, test := range tests {
+		instance := newTestInstance()
+		instance.Metadata = test.metadata
+
+		err := attestor.AttestMetadata(instance, "vault-role", "test")
+		if hint := attestHint(err); hint != test.hint {
+			t.Errorf("unexpected hint: %v - %s", test, hint)
+		}
+	}
+
+	res, err := attestErrorResponse("failed to login", attestor.AttestMetadata(newTestInstance(), "missing", "test"))
+	var codedErr logical.HTTPCodedError
+	if res != nil || !errors.As(err, &codedErr) || codedErr.Code() != http.StatusForbidden || !strings.Contains(err.Error(), "(hint: instance metadata key 'missing' missing") {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if !strings.HasPrefix(err.Error(), "failed to login (reason=metadata_mismatch retryable=false): metadata key not found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	instance := newTestInstance()
+	instance.Status = "BUILD"
+	_, err = attestErrorResponse("failed to login", attestor.AttestStatus(instance))
+	if !strings.HasPrefix(err.Error(), "failed to login (reason=instance_not_active retryable=true): ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -52,28 +52,51 @@ func updateAuthAttempt(ctx context.Context, s logical.Storage, attempt *AuthAtte
 	return nil
 }
 
-func cleanupAuthAttempt(ctx context.Context, s logical.Storage) (int, error) {
-	count := 0
+// sweepResult holds the number of records scanned and deleted by a
+// maintenance run.
+type sweepResult struct {
+	Scanned int
+	Deleted int
+}
+
+func cleanupAuthAttempt(ctx context.Context, s logical.Storage) (sweepResult, error) {
+	return tidyAuthAttempt(ctx, s, 0)
+}
+
+// tidyAuthAttempt removes the auth attempts whose deadline passed more than
+// the safety buffer ago.
+func tidyAuthAttempt(ctx context.Context, s logical.Storage, safetyBuffer time.Duration) (sweepResult, error) {
+	result := sweepResult{}
 
 	keys, err := s.List(ctx, "auth_attempt/")
 	if err != nil {
-		return 0, err
+		return result, err
 	}
 
 	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		result.Scanned += 1
+
 		attempt, err := readAuthAttempt(ctx, s, key)
 		if err != nil {
-			return 0, err
+			return result, err
+		}
+
+		if attempt == nil {
+			continue
 		}
 
-		if time.Now().After(attempt.Deadline) {
+		if time.Now().After(attempt.Deadline.Add(safetyBuffer)) {
 			err := s.Delete(ctx, fmt.Sprintf("auth_attempt/%s", key))
 			if err != nil {
-				return 0, err
+				return result, err
 			}
-			count += 1
+			result.Deleted += 1
 		}
 	}
 
-	return count, nil
+	return result, nil
 }
@@ -0,0 +1,227 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestCleanupAuthAttempt(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	for i, deadline := range []time.Time{time.Now().Add(-time.Minute), time.Now().Add(time.Minute)} {
+		err := updateAuthAttempt(ctx, storage, &AuthAttempt{Name: fmt.Sprintf("test%d", i), Deadline: deadline, Count: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := cleanupAuthAttempt(canceledCtx, storage)
+	if err == nil {
+		t.Errorf("cleanup was not canceled")
+	}
+
+	result, err := cleanupAuthAttempt(ctx, storage)
+	if result.Scanned != 2 || result.Deleted != 1 || err != nil {
+		t.Errorf("unexpected result: %+v %v", result, err)
+	}
+
+	keys, _ := storage.List(ctx, "auth_attempt/")
+	if len(keys) != 1 || keys[0] != "test1" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestPeriodicHandler(t *testing.T) {
+	sink := newTestMetricsSink(t)
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	backend := b.(*OpenStackAuthBackend)
+
+	err := updateAuthAttempt(ctx, storage, &AuthAttempt{Name: "test", Deadline: time.Now().Add(-time.Minute), Count: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = backend.periodicHandler(ctx, &logical.Request{Storage: storage})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	backend.cleanupWG.Wait()
+
+	keys, _ := storage.List(ctx, "auth_attempt/")
+	if len(keys) != 0 {
+		t.Errorf("expired auth attempts were not removed: %v", keys)
+	}
+
+	if count := counterValue(sink, "vault.openstack.sweep.deleted;sweeper=auth_attempt"); count != 1 {
+		t.Errorf("unexpected number of sweep metrics: %d", count)
+	}
+}
+
+func TestPeriodicHandlerInterval(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	backend := b.(*OpenStackAuthBackend)
+
+	entry, err := logical.StorageEntryJSON("config", &Config{AuthAttemptCleanupInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = storage.Put(ctx, entry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err := updateAuthAttempt(ctx, storage, &AuthAttempt{Name: fmt.Sprintf("test%d", i), Deadline: time.Now().Add(-time.Minute), Count: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = backend.periodicHandler(ctx, &logical.Request{Storage: storage})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		backend.cleanupWG.Wait()
+	}
+
+	// The second run is skipped until the interval elapses.
+	keys, _ := storage.List(ctx, "auth_attempt/")
+	if len(keys) != 1 || keys[0] != "test1" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestPeriodicHandlerBusy(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	backend := b.(*OpenStackAuthBackend)
+
+	entry, err := logical.StorageEntryJSON("config", &Config{AuthAttemptCleanupInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = storage.Put(ctx, entry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = updateAuthAttempt(ctx, storage, &AuthAttempt{Name: "test", Deadline: time.Now().Add(-time.Minute), Count: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A run skipped while a tidy is running doesn't count as the last run.
+	_, ok := backend.acquireCleanup(ctx)
+	if !ok {
+		t.Fatalf("failed to acquire cleanup")
+	}
+	err = backend.periodicHandler(ctx, &logical.Request{Storage: storage})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	backend.releaseCleanup()
+
+	err = backend.periodicHandler(ctx, &logical.Request{Storage: storage})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	backend.cleanupWG.Wait()
+
+	keys, _ := storage.List(ctx, "auth_attempt/")
+	if len(keys) != 0 {
+		t.Errorf("expired auth attempts were not removed: %v", keys)
+	}
+}
+
+func TestTidy(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	backend := b.(*OpenStackAuthBackend)
+
+	for i, deadline := range []time.Time{time.Now().Add(-time.Minute), time.Now().Add(time.Minute)} {
+		err := updateAuthAttempt(ctx, storage, &AuthAttempt{Name: fmt.Sprintf("test%d", i), Deadline: deadline, Count: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	err := updateInstanceEvent(ctx, storage, &InstanceEvent{Name: "deleted", Expiration: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   storage,
+	}
+	res, err := b.HandleRequest(ctx, req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	attempts := res.Data["auth_attempt"].(map[string]interface{})
+	if attempts["scanned"] != 2 || attempts["deleted"] != 1 {
+		t.Errorf("unexpected auth attempt result: %v", attempts)
+	}
+	events := res.Data["instance_event"].(map[string]interface{})
+	if events["scanned"] != 1 || events["deleted"] != 1 {
+		t.Errorf("unexpected instance event result: %v", events)
+	}
+
+	_, ok := backend.acquireCleanup(ctx)
+	if !ok {
+		t.Fatal("cleanup was not released")
+	}
+	defer backend.releaseCleanup()
+
+	_, err = b.HandleRequest(ctx, req)
+	if code, ok := err.(logical.HTTPCodedError); !ok || code.Code() != 409 {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTidyAuthAttempts(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	for i, deadline := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Minute), time.Now().Add(time.Minute)} {
+		err := updateAuthAttempt(ctx, storage, &AuthAttempt{Name: fmt.Sprintf("test%d", i), Deadline: deadline, Count: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy/auth-attempts",
+		Storage:   storage,
+		Data:      map[string]interface{}{"safety_buffer": "-1s"},
+	}
+	res, err := b.HandleRequest(ctx, req)
+	if err != nil || res == nil || !res.IsError() {
+		t.Errorf("negative safety buffer was accepted: %v - %v", res, err)
+	}
+
+	req.Data["safety_buffer"] = "1h"
+	res, err = b.HandleRequest(ctx, req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["scanned"] != 3 || res.Data["deleted"] != 1 {
+		t.Errorf("unexpected result: %v", res.Data)
+	}
+
+	keys, _ := storage.List(ctx, "auth_attempt/")
+	if len(keys) != 2 {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
@@ -0,0 +1,26 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// AttestAvailabilityZone is used to attest that the instance runs in one of
+// the availability zones bound to the role.
+func (at *Attestor) AttestAvailabilityZone(instance *Instance, role *Role) error {
+	if len(role.BoundAvailabilityZones) == 0 {
+		return nil
+	}
+
+	if !strutil.StrListContains(role.BoundAvailabilityZones, instance.AvailabilityZone) {
+		return &AttestError{
+			Reason: ReasonAvailabilityZoneMismatch,
+			Hint:   fmt.Sprintf("the instance runs in availability zone '%s', launch it in one of %s", instance.AvailabilityZone, strings.Join(role.BoundAvailabilityZones, ", ")),
+			Err:    fmt.Errorf("availability zone mismatched: expected one of %v, got %s", role.BoundAvailabilityZones, instance.AvailabilityZone),
+		}
+	}
+
+	return nil
+}
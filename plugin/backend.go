@@ -2,40 +2,178 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/utils/openstack/clientconfig"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	help = "The OpenStack backend plugin allows authentication for OpenStack instances."
+
+	// cleanupTimeout is the deadline of a single auth attempt cleanup run.
+	cleanupTimeout = 5 * time.Minute
 )
 
+// clientKey identifies the clients built with a config for a project,
+// region and endpoint availability.
+type clientKey struct {
+	config       string
+	projectID    string
+	projectName  string
+	region       string
+	availability gophercloud.Availability
+}
+
+// String returns the key as a string, which starts with the prefix of the
+// config.
+func (k clientKey) String() string {
+	return clientKeyPrefix(k.config) + strings.Join([]string{k.projectID, k.projectName, k.region, string(k.availability)}, "/")
+}
+
+// clientKeyPrefix returns the prefix of the keys of the clients built with
+// the config. Config names cannot contain a slash.
+func clientKeyPrefix(config string) string {
+	return config + "/"
+}
+
+// newClientKey returns the key of the clients the role looks up the
+// instances with. The roles of a config with a fixed scope share the
+// clients, while the other roles get the clients of their projects.
+func newClientKey(config *Config, r *Role) clientKey {
+	key := clientKey{
+		config:       config.name,
+		region:       r.region(config),
+		availability: config.availability(),
+	}
+
+	if !config.fixedScope() {
+		key.projectID, key.projectName = r.ProjectID, r.ProjectName
+		if r.TenantID != "" {
+			key.projectID = r.TenantID
+		}
+		if r.TenantName != "" {
+			key.projectName = r.TenantName
+		}
+	}
+
+	return key
+}
+
+// cloudClients are the OpenStack clients built with a config.
+type cloudClients struct {
+	key    clientKey
+	client *gophercloud.ServiceClient
+
+	// The provider and the endpoint options of the compute client, which
+	// are shared by the clients of the other services.
+	provider         *gophercloud.ProviderClient
+	endpointOpts     gophercloud.EndpointOpts
+	networkClient    *gophercloud.ServiceClient
+	identityClient   *gophercloud.ServiceClient
+	stackClient      *gophercloud.ServiceClient
+	baremetalClient  *gophercloud.ServiceClient
+	dnsClient        *gophercloud.ServiceClient
+	keyManagerClient *gophercloud.ServiceClient
+}
+
 type OpenStackAuthBackend struct {
 	*framework.Backend
-	client      *gophercloud.ServiceClient
 	clientMutex sync.RWMutex
+	clientGroup singleflight.Group
+	// clientGeneration is incremented when the clients are dropped, so that
+	// the clients built meanwhile with the previous config are not kept.
+	clientGeneration uint64
+	throttles        *throttles
+	breakers         *circuitBreakers
+	config           *Config
+	configMutex      sync.RWMutex
+
+	// The clients are kept by their keys, and the configs of the config
+	// profiles by their names.
+	clients        map[clientKey]*cloudClients
+	profileConfigs map[string]*Config
+
+	instanceGroup    singleflight.Group
+	lookupSlots      chan struct{}
+	notFoundCache    *cache[struct{}]
+	instanceCache    *cache[*Instance]
+	projectCache     *cache[string]
+	identityCache    *cache[any]
+	trustAnchorCache *cache[string]
+	stats            *backendStats
+	logSampler       *logSampler
+
+	identityKey      *identityKey
+	identityKeyMutex sync.RWMutex
+
+	migrationMutex sync.Mutex
+
+	// instanceLocks serialize the logins of an instance which consume its
+	// nonce or record its login.
+	instanceLocks []*locksutil.LockEntry
+
+	cleanupCancel context.CancelFunc
+	cleanupMutex  sync.Mutex
+	cleanupWG     sync.WaitGroup
+	cleanupLast   time.Time
+
+	// The client warm-ups run in the background until the backend is
+	// cleaned up.
+	warmUpCtx    context.Context
+	warmUpCancel context.CancelFunc
+	warmUpWG     sync.WaitGroup
 }
 
 func NewBackend() *OpenStackAuthBackend {
-	b := &OpenStackAuthBackend{}
+	b := &OpenStackAuthBackend{
+		throttles:        newThrottles(),
+		breakers:         newCircuitBreakers(circuitBreakerThreshold, circuitBreakerCooldown),
+		clients:          map[clientKey]*cloudClients{},
+		profileConfigs:   map[string]*Config{},
+		lookupSlots:      make(chan struct{}, maxConcurrentLookups),
+		notFoundCache:    newCache[struct{}]("not_found", notFoundCacheSize, notFoundCacheTTL),
+		instanceCache:    newCache[*Instance]("instance", instanceCacheSize, defaultInstanceCacheTTL),
+		projectCache:     newCache[string]("project", projectCacheSize, projectCacheTTL),
+		identityCache:    newCache[any]("identity", identityCacheSize, identityCacheTTL),
+		trustAnchorCache: newCache[string]("trust_anchor", trustAnchorCacheSize, trustAnchorCacheTTL),
+		stats:            newBackendStats(),
+		logSampler:       newLogSampler(logSampleWindow, logSamplerSize),
+		instanceLocks:    locksutil.CreateLocks(),
+	}
+
+	b.warmUpCtx, b.warmUpCancel = context.WithCancel(context.Background())
+
+	b.breakers.onOpen = func(host string, failures int, cooldown time.Duration) {
+		b.Logger().Warn("openstack API requests suspended after consecutive failures", "host", host, "failures", failures, "cooldown", cooldown)
+	}
 
 	b.Backend = &framework.Backend{
-		BackendType:  logical.TypeCredential,
-		Invalidate:   b.invalidateHandler,
-		PeriodicFunc: b.periodicHandler,
-		AuthRenew:    b.authRenewHandler,
-		Help:         help,
+		BackendType:    logical.TypeCredential,
+		Invalidate:     b.invalidateHandler,
+		InitializeFunc: b.initializeHandler,
+		Clean:          b.cleanHandler,
+		PeriodicFunc:   b.periodicHandler,
+		AuthRenew:      b.authRenewHandler,
+		RunningVersion: runningVersion(),
+		Help:           help,
 		PathsSpecial: &logical.Paths{
-			Unauthenticated: []string{"login"},
-			SealWrapStorage: []string{"config"},
+			Unauthenticated: []string{"login", "login/nonce", "identity/keys"},
+			SealWrapStorage: []string{"config", "config/", identityKeyStorageKey},
+			Root:            []string{"login/verify", "debug/*", "notifications/*", "migrate", "tidy", "tidy/*", "export", "import", "revoke-instance/*"},
 		},
-		Paths: framework.PathAppend(NewPathConfig(b), NewPathRole(b), NewPathLogin(b)),
+		Paths: framework.PathAppend(NewPathCredentials(b), NewPathConfig(b), NewPathRole(b), NewPathLogin(b), NewPathLoginNonce(b), NewPathLoginVerify(b), NewPathInfo(b), NewPathMetrics(b), NewPathDebug(b), NewPathNotification(b), NewPathIdentityKeys(b), NewPathMigrate(b), NewPathTidy(b), NewPathAllowlist(b), NewPathExport(b), NewPathRevokeInstance(b)),
 	}
 
 	return b
@@ -45,25 +183,261 @@ func (b *OpenStackAuthBackend) Close() {
 	b.clientMutex.Lock()
 	defer b.clientMutex.Unlock()
 
-	b.client = nil
+	b.clients = map[clientKey]*cloudClients{}
+	b.clientGeneration++
+	b.notFoundCache.Purge()
+	b.instanceCache.Purge()
+	b.breakers.Reset()
+	b.throttles.Reset()
+	b.projectCache.Purge()
+	b.identityCache.Purge()
+	b.trustAnchorCache.Purge()
 }
 
-func (b *OpenStackAuthBackend) getClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+// getConfig returns the cached config, reading it from the storage
+// when the cache is empty.
+func (b *OpenStackAuthBackend) getConfig(ctx context.Context, s logical.Storage) (*Config, error) {
+	b.configMutex.RLock()
+	if b.config != nil {
+		defer b.configMutex.RUnlock()
+		return b.config, nil
+	}
+	b.configMutex.RUnlock()
+
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	if b.config != nil {
+		return b.config, nil
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	b.config = config
+
+	return config, nil
+}
+
+func (b *OpenStackAuthBackend) resetConfig() {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	b.config = nil
+}
+
+// getNamedConfig returns the cached config profile, reading it from the
+// storage when it is not cached. The default config is returned for an
+// empty name.
+func (b *OpenStackAuthBackend) getNamedConfig(ctx context.Context, s logical.Storage, name string) (*Config, error) {
+	if name == "" {
+		return b.getConfig(ctx, s)
+	}
+
+	b.configMutex.RLock()
+	config, ok := b.profileConfigs[name]
+	b.configMutex.RUnlock()
+	if ok {
+		return config, nil
+	}
+
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	if config, ok := b.profileConfigs[name]; ok {
+		return config, nil
+	}
+
+	config, err := readNamedConfig(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if config != nil {
+		b.profileConfigs[name] = config
+	}
+
+	return config, nil
+}
+
+// getRoleConfig returns the config the role looks up the instances with.
+func (b *OpenStackAuthBackend) getRoleConfig(ctx context.Context, s logical.Storage, r *Role) (*Config, error) {
+	return b.getNamedConfig(ctx, s, r.Config)
+}
+
+// resetNamedConfig drops the config profile and its clients, so that they
+// are built again from the stored profile.
+func (b *OpenStackAuthBackend) resetNamedConfig(name string) {
+	if name == "" {
+		b.resetConfig()
+		b.Close()
+		return
+	}
+
+	b.configMutex.Lock()
+	delete(b.profileConfigs, name)
+	b.configMutex.Unlock()
+
+	b.clientMutex.Lock()
+	for key := range b.clients {
+		if key.config == name {
+			delete(b.clients, key)
+		}
+	}
+	b.clientGeneration++
+	b.clientMutex.Unlock()
+
+	prefix := clientKeyPrefix(name)
+	b.notFoundCache.RemovePrefix(prefix)
+	b.instanceCache.RemovePrefix(prefix)
+}
+
+// clientKeys returns the keys of the clients built with every config.
+func (b *OpenStackAuthBackend) clientKeys() []clientKey {
 	b.clientMutex.RLock()
-	if b.client != nil {
-		defer b.clientMutex.RUnlock()
-		return b.client, nil
+	defer b.clientMutex.RUnlock()
+
+	keys := make([]clientKey, 0, len(b.clients))
+	for key := range b.clients {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (b *OpenStackAuthBackend) getClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	c, err := b.getClients(ctx, s, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.client, nil
+}
+
+// getClients returns the clients the role looks up the instances with,
+// authenticating them on first use.
+func (b *OpenStackAuthBackend) getClients(ctx context.Context, s logical.Storage, r *Role) (*cloudClients, error) {
+	config, err := b.getRoleConfig(ctx, s, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil && r.Config != "" {
+		return nil, fmt.Errorf("config profile %s does not exist", r.Config)
+	}
+	if config == nil {
+		return nil, errors.New("backend is not configured")
 	}
+
+	key := newClientKey(config, r)
+
+	b.clientMutex.RLock()
+	c, ok := b.clients[key]
+	generation := b.clientGeneration
 	b.clientMutex.RUnlock()
+	if ok {
+		return c, nil
+	}
 
-	b.clientMutex.Lock()
-	defer b.clientMutex.Unlock()
+	// The clients are authenticated outside of the lock so that a slow
+	// Keystone doesn't hold up the roles using other clients, while the
+	// requests needing the same clients share a single authentication. The
+	// authentication is not cancelled with the request which started it,
+	// since it is shared by the others.
+	val, err, _ := b.clientGroup.Do(key.String(), func() (interface{}, error) {
+		c, err := b.newClients(detachedContext{ctx}, config, r, key)
+		if err != nil {
+			return nil, err
+		}
 
-	config, err := readConfig(ctx, s)
+		b.clientMutex.Lock()
+		defer b.clientMutex.Unlock()
+
+		// The clients of a config which was reset in the meantime are used
+		// once but not kept.
+		if b.clientGeneration == generation {
+			b.clients[key] = c
+		}
+
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return val.(*cloudClients), nil
+}
+
+// detachedContext keeps the values of the context, such as the request
+// logger, without its cancellation and deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (c detachedContext) Done() <-chan struct{} { return nil }
+
+func (c detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// newClients authenticates with the config and builds the compute client
+// of the key.
+func (b *OpenStackAuthBackend) newClients(ctx context.Context, config *Config, r *Role, key clientKey) (*cloudClients, error) {
+	logger := b.contextLogger(ctx)
+
+	provider, opts, err := b.authenticate(ctx, config, r)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("using openstack endpoint interface", "availability", key.availability, "region", key.region)
+
+	endpointOpts := gophercloud.EndpointOpts{
+		Availability: key.availability,
+		Region:       key.region,
+	}
+
+	client, err := openstack.NewComputeV2(provider, endpointOpts)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.ComputeAPIMicroversion != "" {
+		client.Microversion = config.ComputeAPIMicroversion
+		logger.Debug("using configured compute microversion", "microversion", config.ComputeAPIMicroversion)
+	} else {
+		microversion, unsupported, err := negotiateMicroversion(ctx, client)
+		if err != nil {
+			logger.Warn("failed to negotiate compute microversion, using the base version", "error", err)
+		} else {
+			client.Microversion = microversion
+			logger.Debug("using compute microversion", "microversion", microversion, "unsupported_features", unsupported)
+		}
+	}
+
+	c := &cloudClients{
+		key:          key,
+		client:       client,
+		provider:     provider,
+		endpointOpts: endpointOpts,
+	}
+
+	if opts.AuthInfo.ProjectID != "" {
+		logger.Info("using openstack project", "config", configDisplayName(r.Config), "project", opts.AuthInfo.ProjectID, "region", key.region)
+	} else {
+		logger.Info("using openstack project", "config", configDisplayName(r.Config), "project_name", opts.AuthInfo.ProjectName, "region", key.region)
+	}
+
+	return c, nil
+}
+
+// authenticate returns the provider authenticated with the credentials of
+// the config, scoped to the project of the role unless all_tenants is set.
+func (b *OpenStackAuthBackend) authenticate(ctx context.Context, config *Config, r *Role) (*gophercloud.ProviderClient, *clientconfig.ClientOpts, error) {
 	opts := &clientconfig.ClientOpts{
 		AuthInfo: &clientconfig.AuthInfo{
 			AuthURL:           config.AuthURL,
@@ -79,6 +453,9 @@ func (b *OpenStackAuthBackend) getClient(ctx context.Context, s logical.Storage,
 			ProjectDomainName: config.ProjectDomainName,
 			DomainID:          config.DomainID,
 			DomainName:        config.DomainName,
+
+			ApplicationCredentialID:     config.ApplicationCredentialID,
+			ApplicationCredentialSecret: config.ApplicationCredentialSecret,
 		},
 	}
 
@@ -89,76 +466,368 @@ func (b *OpenStackAuthBackend) getClient(ctx context.Context, s logical.Storage,
 		opts.AuthInfo.ProjectName = config.TenantName
 	}
 
-	if r.ProjectID != "" {
-		opts.AuthInfo.ProjectID = r.ProjectID
+	// With all_tenants or an application credential the client stays scoped
+	// to the configured project and the project of the role is verified
+	// against the instance.
+	if !config.fixedScope() {
+		if r.ProjectID != "" {
+			opts.AuthInfo.ProjectID = r.ProjectID
+		}
+		if r.ProjectName != "" {
+			opts.AuthInfo.ProjectName = r.ProjectName
+		}
+
+		if r.TenantID != "" {
+			opts.AuthInfo.ProjectID = r.TenantID
+		}
+		if r.TenantName != "" {
+			opts.AuthInfo.ProjectName = r.TenantName
+		}
 	}
-	if r.ProjectName != "" {
-		opts.AuthInfo.ProjectName = r.ProjectName
+
+	authOpts, err := clientconfig.AuthOptions(opts)
+	if err != nil {
+		return nil, nil, err
 	}
+	authOpts.AllowReauth = true
 
-	if r.TenantID != "" {
-		opts.AuthInfo.ProjectID = r.TenantID
+	provider, err := openstack.NewClient(authOpts.IdentityEndpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport, err := config.transport()
+	if err != nil {
+		return nil, nil, err
+	}
+	provider.HTTPClient = http.Client{
+		Transport: &throttledTransport{
+			base: &breakerTransport{
+				base:     transport,
+				breakers: b.breakers,
+			},
+			throttles: b.throttles,
+		},
+		Timeout: config.requestTimeout(),
 	}
-	if r.TenantName != "" {
-		opts.AuthInfo.ProjectName = r.TenantName
+	provider.RetryBackoffFunc = b.throttles.Backoff
+	provider.MaxBackoffRetries = config.maxRetries()
+
+	// The TOTP passcodes and the federated tokens expire before the token
+	// does, so they are refreshed on every authentication.
+	var refresh func(ctx context.Context, opts *gophercloud.AuthOptions) error
+	switch {
+	case config.federated():
+		refresh = func(ctx context.Context, opts *gophercloud.AuthOptions) error {
+			token, err := federatedToken(ctx, &provider.HTTPClient, config)
+			if err != nil {
+				return err
+			}
+			opts.TokenID = token
+			opts.Username = ""
+			opts.UserID = ""
+			opts.Password = ""
+			opts.DomainID = ""
+			opts.DomainName = ""
+			return nil
+		}
+	case config.TOTPSecret != "":
+		refresh = func(ctx context.Context, opts *gophercloud.AuthOptions) (err error) {
+			opts.Passcode, err = totpPasscode(config.TOTPSecret, time.Now())
+			return err
+		}
 	}
 
-	authOpts, err := clientconfig.AuthOptions(opts)
+	_, span := startSpan(ctx, "keystone.authenticate", attribute.String("openstack.auth_url", config.AuthURL))
+	if refresh != nil {
+		err = refresh(ctx, authOpts)
+	}
+	if err == nil {
+		err = openstack.Authenticate(provider, *authOpts)
+	}
+	endSpan(span, err)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	authOpts.AllowReauth = true
 
-	provider, err := openstack.AuthenticatedClient(*authOpts)
+	if refresh != nil {
+		provider.ReauthFunc = func() error {
+			return reauthenticate(provider, *authOpts, refresh)
+		}
+	}
+
+	return provider, opts, nil
+}
+
+// reauthenticate authenticates again with the refreshed options and hands
+// the token over to the provider. The reauthentication of gophercloud,
+// which replays the same options, cannot be used with the options which
+// expire.
+func reauthenticate(provider *gophercloud.ProviderClient, opts gophercloud.AuthOptions, refresh func(context.Context, *gophercloud.AuthOptions) error) error {
+	err := refresh(context.Background(), &opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	opts.AllowReauth = false
 
-	availability := gophercloud.Availability(config.Availability)
-	if config.Availability == "" {
-		availability = gophercloud.AvailabilityPublic
+	tmp, err := openstack.NewClient(opts.IdentityEndpoint)
+	if err != nil {
+		return err
 	}
-	b.Logger().Debug(fmt.Sprintf("using openstack endpoint %s interface", availability))
+	tmp.HTTPClient = provider.HTTPClient
+
+	err = openstack.Authenticate(tmp, opts)
+	if err != nil {
+		return err
+	}
+	provider.CopyTokenFrom(tmp)
+
+	return nil
+}
 
-	client, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{
-		Availability: availability,
-		Region: config.RegionName,
+// getNetworkClient returns the networking client built from the provider
+// of the compute client.
+func (b *OpenStackAuthBackend) getNetworkClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	return b.getServiceClient(ctx, s, r, func(c *cloudClients) **gophercloud.ServiceClient { return &c.networkClient }, openstack.NewNetworkV2)
+}
+
+// getIdentityClient returns the identity client built from the provider
+// of the compute client.
+func (b *OpenStackAuthBackend) getIdentityClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	return b.getServiceClient(ctx, s, r, func(c *cloudClients) **gophercloud.ServiceClient { return &c.identityClient }, openstack.NewIdentityV3)
+}
+
+// getStackClient returns the orchestration client built from the provider
+// of the compute client.
+func (b *OpenStackAuthBackend) getStackClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	return b.getServiceClient(ctx, s, r, func(c *cloudClients) **gophercloud.ServiceClient { return &c.stackClient }, openstack.NewOrchestrationV1)
+}
+
+// getBaremetalClient returns the bare metal client built from the provider
+// of the compute client.
+func (b *OpenStackAuthBackend) getBaremetalClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	return b.getServiceClient(ctx, s, r, func(c *cloudClients) **gophercloud.ServiceClient { return &c.baremetalClient }, func(provider *gophercloud.ProviderClient, opts gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error) {
+		client, err := openstack.NewBareMetalV1(provider, opts)
+		if err != nil {
+			return nil, err
+		}
+		client.Microversion = baremetalMicroversion
+
+		return client, nil
 	})
+}
+
+// getDNSClient returns the DNS client built from the provider of the
+// compute client.
+func (b *OpenStackAuthBackend) getDNSClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	return b.getServiceClient(ctx, s, r, func(c *cloudClients) **gophercloud.ServiceClient { return &c.dnsClient }, openstack.NewDNSV2)
+}
+
+// getKeyManagerClient returns the key manager client built from the
+// provider of the compute client.
+func (b *OpenStackAuthBackend) getKeyManagerClient(ctx context.Context, s logical.Storage, r *Role) (*gophercloud.ServiceClient, error) {
+	return b.getServiceClient(ctx, s, r, func(c *cloudClients) **gophercloud.ServiceClient { return &c.keyManagerClient }, openstack.NewKeyManagerV1)
+}
+
+// getServiceClient returns the client of a service, building it on first
+// use from the authenticated provider with the same availability and region
+// as the compute client. The client is dropped together with the compute
+// client.
+func (b *OpenStackAuthBackend) getServiceClient(ctx context.Context, s logical.Storage, r *Role, field func(*cloudClients) **gophercloud.ServiceClient, newClient func(*gophercloud.ProviderClient, gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error)) (*gophercloud.ServiceClient, error) {
+	c, err := b.getClients(ctx, s, r)
+	if err != nil {
+		return nil, err
+	}
+
+	b.clientMutex.RLock()
+	client := *field(c)
+	b.clientMutex.RUnlock()
+	if client != nil {
+		return client, nil
+	}
+
+	b.clientMutex.Lock()
+	defer b.clientMutex.Unlock()
+
+	cached := field(c)
+	if *cached != nil {
+		return *cached, nil
+	}
+
+	client, err = newClient(c.provider, c.endpointOpts)
 	if err != nil {
 		return nil, err
 	}
+	*cached = client
 
-	b.client = client
+	return client, nil
+}
 
-	if opts.AuthInfo.ProjectID != "" {
-		b.Logger().Info(fmt.Sprintf("using openstack project with id %s", opts.AuthInfo.ProjectID))
-	} else {
-		b.Logger().Info(fmt.Sprintf("using openstack project with name %s", opts.AuthInfo.ProjectName))
+// initializeHandler migrates the storage to the current schema, and warms
+// up the client when it is enabled in the config, so the first login after
+// an unseal doesn't have to wait for it.
+func (b *OpenStackAuthBackend) initializeHandler(ctx context.Context, req *logical.InitializationRequest) error {
+	_, err := b.migrate(ctx, req.Storage)
+	if err != nil && !errors.Is(err, logical.ErrReadOnly) {
+		return fmt.Errorf("failed to migrate storage: %w", err)
 	}
 
-	return b.client, nil
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	if config != nil && config.WarmUpClient {
+		b.warmUpClient(req.Storage, "")
+	}
+
+	names, err := req.Storage.List(ctx, "config/")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		config, err := b.getNamedConfig(ctx, req.Storage, name)
+		if err != nil {
+			return err
+		}
+
+		if config != nil && config.WarmUpClient {
+			b.warmUpClient(req.Storage, name)
+		}
+	}
+
+	return nil
+}
+
+// warmUpClient builds the client of the config profile scoped to its
+// configured project in the background, which the roles without a project
+// and all the roles of a config with a fixed scope share. Failures are
+// only logged since the client is built again on the next login.
+func (b *OpenStackAuthBackend) warmUpClient(s logical.Storage, name string) {
+	b.warmUpWG.Add(1)
+	go func() {
+		defer b.warmUpWG.Done()
+
+		_, err := b.getClient(b.warmUpCtx, s, &Role{Config: name})
+		if err != nil {
+			b.Logger().Warn("failed to warm up openstack client", "config", configDisplayName(name), "error", err)
+			return
+		}
+
+		b.Logger().Debug("openstack client has been warmed up", "config", configDisplayName(name))
+	}()
 }
 
 func (b *OpenStackAuthBackend) invalidateHandler(_ context.Context, key string) {
-	switch key {
-	case "config":
+	switch {
+	case key == "config":
+		b.resetConfig()
 		b.Close()
+	case strings.HasPrefix(key, "config/"):
+		b.resetNamedConfig(strings.TrimPrefix(key, "config/"))
+	case key == identityKeyStorageKey:
+		b.identityKeyMutex.Lock()
+		b.identityKey = nil
+		b.identityKeyMutex.Unlock()
 	}
 }
 
+// periodicHandler starts the storage cleanups in the background so
+// that slow storage never stalls the periodic function of the mount. The
+// cleanups are skipped until auth_attempt_cleanup_interval of the config
+// has elapsed since the last one. The log lines suppressed in the sampling
+// windows which have passed are reported first.
 func (b *OpenStackAuthBackend) periodicHandler(ctx context.Context, req *logical.Request) error {
-	count, err := cleanupAuthAttempt(ctx, req.Storage)
+	for key, suppressed := range b.logSampler.Rollover() {
+		b.Logger().Info(fmt.Sprintf("%d log lines suppressed", suppressed), "key", key)
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
 	if err != nil {
 		return err
 	}
 
-	if count > 0 {
-		b.Logger().Info(fmt.Sprintf("%d expired auth attempts has been removed", count))
+	if config != nil && !b.cleanupDue(config.AuthAttemptCleanupInterval) {
+		return nil
+	}
+
+	cleanupCtx, ok := b.acquireCleanup(context.Background())
+	if !ok {
+		b.Logger().Debug("auth attempt cleanup is still running")
+		return nil
 	}
+	b.markCleanup()
+
+	go func() {
+		defer b.releaseCleanup()
+		b.tidy(cleanupCtx, req.Storage)
+	}()
 
 	return nil
 }
 
+// cleanupDue returns whether the interval has elapsed since the last
+// periodic cleanup.
+func (b *OpenStackAuthBackend) cleanupDue(interval time.Duration) bool {
+	b.cleanupMutex.Lock()
+	defer b.cleanupMutex.Unlock()
+
+	return interval <= 0 || time.Since(b.cleanupLast) >= interval
+}
+
+// markCleanup records the current time as the last periodic cleanup. It is
+// called once the cleanup is acquired, so that a run skipped because
+// another cleanup was still running doesn't postpone the next one.
+func (b *OpenStackAuthBackend) markCleanup() {
+	b.cleanupMutex.Lock()
+	defer b.cleanupMutex.Unlock()
+
+	b.cleanupLast = time.Now()
+}
+
+// acquireCleanup reserves the storage cleanup, so that the periodic
+// function and the tidy endpoint never run it concurrently. It returns
+// false when a cleanup is already running.
+func (b *OpenStackAuthBackend) acquireCleanup(ctx context.Context) (context.Context, bool) {
+	b.cleanupMutex.Lock()
+	defer b.cleanupMutex.Unlock()
+
+	if b.cleanupCancel != nil {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cleanupTimeout)
+	b.cleanupCancel = cancel
+	b.cleanupWG.Add(1)
+
+	return ctx, true
+}
+
+// releaseCleanup releases the storage cleanup reserved by acquireCleanup.
+func (b *OpenStackAuthBackend) releaseCleanup() {
+	b.cleanupMutex.Lock()
+	b.cleanupCancel()
+	b.cleanupCancel = nil
+	b.cleanupMutex.Unlock()
+
+	b.cleanupWG.Done()
+}
+
+// cleanHandler stops the running cleanup and the client warm-ups when the
+// backend is unmounted.
+func (b *OpenStackAuthBackend) cleanHandler(_ context.Context) {
+	b.cleanupMutex.Lock()
+	if b.cleanupCancel != nil {
+		b.cleanupCancel()
+	}
+	b.cleanupMutex.Unlock()
+
+	b.warmUpCancel()
+
+	b.cleanupWG.Wait()
+	b.warmUpWG.Wait()
+}
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	b := NewBackend()
 	err := b.Setup(ctx, conf)
@@ -1,7 +1,10 @@
 package plugin
 
 import (
+	"bytes"
 	"context"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,12 +13,13 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
-func newTestBackend(t *testing.T) (logical.Backend, logical.Storage) {
+func newTestBackend(t testing.TB) (logical.Backend, logical.Storage) {
 	config := &logical.BackendConfig{
 		Logger: logging.NewVaultLogger(hclog.Trace),
 		System: &logical.StaticSystemView{
 			DefaultLeaseTTLVal: time.Hour * 12,
 			MaxLeaseTTLVal:     time.Hour * 24,
+			PluginEnvironment:  &logical.PluginEnvironment{VaultVersion: "1.13.0"},
 		},
 		StorageView: &logical.InmemStorage{},
 	}
@@ -27,3 +31,324 @@ func newTestBackend(t *testing.T) (logical.Backend, logical.Storage) {
 
 	return b, config.StorageView
 }
+
+func TestConfigCache(t *testing.T) {
+	b, storage := newTestBackend(t)
+	backend := b.(*OpenStackAuthBackend)
+	ctx := context.Background()
+
+	config, err := backend.getConfig(ctx, storage)
+	if err != nil || config != nil {
+		t.Fatalf("unexpected result: %v - %v", config, err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"auth_url": "http://keystone.test/v3"},
+	}
+	_, err = b.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config, err = backend.getConfig(ctx, storage)
+	if err != nil || config == nil || config.AuthURL != "http://keystone.test/v3" {
+		t.Fatalf("unexpected result: %v - %v", config, err)
+	}
+
+	entry, err := logical.StorageEntryJSON("config", &Config{AuthURL: "http://other.test/v3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = storage.Put(ctx, entry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config, _ = backend.getConfig(ctx, storage)
+	if config.AuthURL != "http://keystone.test/v3" {
+		t.Errorf("config was not cached: %s", config.AuthURL)
+	}
+
+	backend.invalidateHandler(ctx, "config")
+
+	config, _ = backend.getConfig(ctx, storage)
+	if config.AuthURL != "http://other.test/v3" {
+		t.Errorf("config was not invalidated: %s", config.AuthURL)
+	}
+}
+
+func TestWarmUpClient(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestBackend(t)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"auth_url":         m.AuthURL(),
+			"username":         "vault",
+			"password":         "secret",
+			"user_domain_name": "Default",
+			"project_id":       mockProjectID,
+			"warm_up_client":   true,
+		},
+	}
+	_, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.AuthRequests() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if m.AuthRequests() != 1 {
+		t.Errorf("client was not warmed up: %d auth requests", m.AuthRequests())
+	}
+}
+
+func TestCleanWaitsForWarmUp(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestBackend(t)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"auth_url":         m.AuthURL(),
+			"username":         "vault",
+			"password":         "secret",
+			"user_domain_name": "Default",
+			"project_id":       mockProjectID,
+			"warm_up_client":   true,
+		},
+	}
+	_, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b.Cleanup(context.Background())
+
+	// No warm-up is left running once the backend is cleaned up.
+	count := m.AuthRequests()
+	time.Sleep(50 * time.Millisecond)
+	if m.AuthRequests() != count {
+		t.Errorf("client was warmed up after the cleanup")
+	}
+}
+
+func TestServiceClients(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+	backend := b.(*OpenStackAuthBackend)
+
+	network, err := backend.getNetworkClient(context.Background(), storage, &Role{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	identity, err := backend.getIdentityClient(context.Background(), storage, &Role{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	compute, err := backend.getClient(context.Background(), storage, &Role{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if network.ProviderClient != compute.ProviderClient || identity.ProviderClient != compute.ProviderClient {
+		t.Errorf("service clients do not share the provider")
+	}
+	if !strings.HasPrefix(network.Endpoint, m.URL()+"/network") || !strings.HasPrefix(identity.Endpoint, m.URL()+"/v3") {
+		t.Errorf("unexpected endpoints: %s, %s", network.Endpoint, identity.Endpoint)
+	}
+	if m.AuthRequests() != 1 {
+		t.Errorf("unexpected number of auth requests: %d", m.AuthRequests())
+	}
+
+	backend.Close()
+	if len(backend.clients) != 0 {
+		t.Errorf("service clients were not dropped")
+	}
+}
+
+func TestClientPerProject(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+	backend := b.(*OpenStackAuthBackend)
+	ctx := context.Background()
+
+	first, err := backend.getClient(ctx, storage, &Role{ProjectID: "project-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := backend.getClient(ctx, storage, &Role{ProjectID: "project-2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first == second {
+		t.Errorf("roles of different projects share a client")
+	}
+
+	// The roles of the same project and region share the client.
+	again, err := backend.getClient(ctx, storage, &Role{ProjectID: "project-1", AuthLimit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again != first {
+		t.Errorf("roles of the same project do not share a client")
+	}
+	if m.AuthRequests() != 2 {
+		t.Errorf("unexpected number of auth requests: %d", m.AuthRequests())
+	}
+
+	// With all_tenants the roles share the client of the configured scope.
+	backend.resetConfig()
+	backend.Close()
+	config, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AllTenants = true
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Put(ctx, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err = backend.getClient(ctx, storage, &Role{ProjectID: "project-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err = backend.getClient(ctx, storage, &Role{ProjectID: "project-2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("roles of all_tenants config do not share a client")
+	}
+}
+
+func TestClientsShareAuthentication(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+	backend := b.(*OpenStackAuthBackend)
+
+	before := m.AuthRequests()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := backend.getClient(context.Background(), storage, &Role{ProjectID: "project-1"}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := m.AuthRequests() - before; count != 1 {
+		t.Errorf("unexpected number of auth requests: %d", count)
+	}
+
+	// The shared authentication is not cancelled with the request which
+	// started it.
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"auth_type":             "v3oidcclientcredentials",
+			"identity_provider":     "idp",
+			"client_id":             mockClientID,
+			"client_secret":         mockClientSecret,
+			"access_token_endpoint": m.IDPURL() + "/token",
+		},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	// The config is cached, so that only the authentication sees the
+	// cancelled context.
+	if _, err := backend.getConfig(context.Background(), storage); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := backend.getClient(ctx, storage, &Role{ProjectID: "project-1"}); err != nil {
+		t.Errorf("authentication was cancelled: %v", err)
+	}
+}
+
+func TestClientLogsRequestID(t *testing.T) {
+	m := newMockOpenStack(t)
+	_, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	var buf bytes.Buffer
+	b, err := Factory(context.Background(), &logical.BackendConfig{
+		Logger:      hclog.New(&hclog.LoggerOptions{Output: &buf, Level: hclog.Info}),
+		System:      &logical.StaticSystemView{DefaultLeaseTTLVal: time.Hour, MaxLeaseTTLVal: time.Hour},
+		StorageView: storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	req.ID = "7d3c8f2a-request"
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "using openstack project") && !strings.Contains(line, "request_id="+req.ID) {
+			t.Errorf("client log line without request ID: %s", line)
+		}
+	}
+	if !strings.Contains(buf.String(), "using openstack project") {
+		t.Errorf("client was not authenticated: %s", buf.String())
+	}
+}
+
+func TestResetNamedConfigCaches(t *testing.T) {
+	b := NewBackend()
+
+	instanceID := "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5"
+	first := instanceKey(clientKey{config: "first", region: "RegionOne"}, instanceID)
+	second := instanceKey(clientKey{config: "second", region: "RegionOne"}, instanceID)
+	for _, key := range []string{first, second} {
+		b.notFoundCache.Add(key, struct{}{})
+		b.instanceCache.Add(key, &Instance{})
+	}
+
+	b.resetNamedConfig("second")
+
+	if _, ok := b.notFoundCache.Get(first); !ok {
+		t.Errorf("instance of another profile was removed")
+	}
+	if _, ok := b.instanceCache.Get(first); !ok {
+		t.Errorf("instance of another profile was removed")
+	}
+	if _, ok := b.notFoundCache.Get(second); ok {
+		t.Errorf("instance of the profile was not removed")
+	}
+	if _, ok := b.instanceCache.Get(second); ok {
+		t.Errorf("instance of the profile was not removed")
+	}
+}
@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/keymanager/v1/secrets"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// trustAnchorCacheSize is the maximum number of cached Barbican secrets.
+	trustAnchorCacheSize = 256
+
+	// trustAnchorCacheTTL is the duration to remember a Barbican secret, so
+	// that a rotated certificate is picked up without rewriting the role.
+	trustAnchorCacheTTL = 5 * time.Minute
+)
+
+// secretID returns the ID of a Barbican secret given by its ID or by its
+// reference, i.e. the URL of the secret.
+func secretID(ref string) (string, error) {
+	id := ref[strings.LastIndex(ref, "/")+1:]
+	if _, err := uuid.ParseUUID(id); err != nil {
+		return "", fmt.Errorf("invalid secret reference: %s", ref)
+	}
+
+	return id, nil
+}
+
+// certificateKeys returns the public keys of the PEM encoded certificates
+// in the data, which may hold a bundle of certificates.
+func certificateKeys(data []byte) ([]interface{}, error) {
+	keys := []interface{}{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, cert.PublicKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+
+	return keys, nil
+}
+
+// roleIdentityDocumentKeys returns the public keys of the certificates
+// stored in the Barbican secrets of the role, which sign the identity
+// documents along with the certificates of the config.
+func (b *OpenStackAuthBackend) roleIdentityDocumentKeys(ctx context.Context, s logical.Storage, role *Role) ([]interface{}, error) {
+	if len(role.IdentityDocumentSecrets) == 0 {
+		return nil, nil
+	}
+
+	client, err := b.getKeyManagerClient(ctx, s, role)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []interface{}{}
+	for _, ref := range role.IdentityDocumentSecrets {
+		id, err := secretID(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := b.getSecretPayload(ctx, client, role, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", id, err)
+		}
+
+		secretKeys, err := certificateKeys([]byte(payload))
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", id, err)
+		}
+
+		keys = append(keys, secretKeys...)
+	}
+
+	return keys, nil
+}
+
+// getSecretPayload returns the cached payload of the Barbican secret,
+// reading it on a cache miss. The secrets are cached per config profile,
+// since the profiles may point to different clouds.
+func (b *OpenStackAuthBackend) getSecretPayload(ctx context.Context, client *gophercloud.ServiceClient, role *Role, id string) (payload string, err error) {
+	key := role.Config + "/" + id
+	if payload, ok := b.trustAnchorCache.Get(key); ok {
+		return payload, nil
+	}
+
+	_, span := startSpan(ctx, "barbican.secrets.payload", attribute.String("openstack.secret_id", id))
+	defer func() { endSpan(span, err) }()
+
+	data, err := secrets.GetPayload(client, id, nil).Extract()
+	if err != nil {
+		return "", err
+	}
+
+	payload = string(data)
+	b.trustAnchorCache.Add(key, payload)
+
+	return payload, nil
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestLoginIdentityDocumentSecrets(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("4e6a8c0e-2a4c-4e6a-8c0e-2a4c6e8a0c2e")
+	m.AddServer(&instance.Server)
+
+	signer, cert := newTestDocumentSigner(t)
+	m.AddSecret("6f1c3e5a-7b9d-4f1c-8e5a-7b9d1f3c5e7a", cert)
+	m.AddSecret("8a2c4e6f-0b1d-4a2c-9e6f-0b1d3a5c7e9f", "not a certificate")
+
+	now := time.Now()
+	document := signTestDocument(t, signer, identityDocument{
+		Claims: jwt.Claims{
+			Subject:  instance.ID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	})
+
+	var tests = []struct {
+		secrets []string
+		status  int
+	}{
+		{[]string{"6f1c3e5a-7b9d-4f1c-8e5a-7b9d1f3c5e7a"}, http.StatusOK},
+		{[]string{"https://barbican.test/v1/secrets/6f1c3e5a-7b9d-4f1c-8e5a-7b9d1f3c5e7a"}, http.StatusOK},
+		// fail: the secret does not exist
+		{[]string{"1d3f5b7d-9f1b-4d3f-8b7d-9f1b3d5f7b9d"}, http.StatusBadGateway},
+		// fail: the secret holds no certificate
+		{[]string{"8a2c4e6f-0b1d-4a2c-9e6f-0b1d3a5c7e9f"}, http.StatusBadGateway},
+		// fail: no certificate to verify the document with
+		{nil, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"identity_document_secrets": test.secrets},
+		})
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req := newTestLoginRequest(storage, instance.ID, wrongIPv4)
+		req.Data["identity_document"] = document
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test.secrets, status, res, err)
+		}
+	}
+
+	b, storage := newTestLoginBackend(t, m)
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data:      map[string]interface{}{"identity_document_secrets": []string{"not-a-secret"}},
+	})
+	if err != nil || res == nil || !res.IsError() {
+		t.Errorf("invalid secret reference was accepted: %v - %v", res, err)
+	}
+}
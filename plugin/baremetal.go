@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	baremetalports "github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
+	networkports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/hashicorp/go-uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// serverTypeBaremetal is the type of the servers looked up with the Ironic
+// bare metal API.
+const serverTypeBaremetal = "baremetal"
+
+// baremetalMicroversion is the bare metal API microversion which returns
+// the owner of the nodes.
+const baremetalMicroversion = "1.50"
+
+// getBaremetalNode fetches the Ironic node and converts it to the instance
+// representation used by the attestation. The owner of the node is the
+// project, the extra fields of the node play the role of the instance
+// metadata, and the addresses are the fixed IPs of the Neutron ports of the
+// node with the MAC addresses of the node ports. The node is considered started
+// when its provision state last changed, i.e. when it was deployed.
+func (b *OpenStackAuthBackend) getBaremetalNode(ctx context.Context, client, network *gophercloud.ServiceClient, nodeID string) (instance *Instance, err error) {
+	if _, err := uuid.ParseUUID(nodeID); err != nil {
+		return nil, errInvalidInstanceID
+	}
+
+	ctx, span := startSpan(ctx, "ironic.nodes.get", attribute.String("openstack.node_id", nodeID))
+	defer func() { endSpan(span, err) }()
+
+	result := nodes.Get(client, nodeID)
+	node, err := result.Extract()
+	if err != nil {
+		return nil, instanceError(err)
+	}
+
+	var times struct {
+		CreatedAt          time.Time  `json:"created_at"`
+		ProvisionUpdatedAt *time.Time `json:"provision_updated_at"`
+	}
+	err = result.ExtractInto(&times)
+	if err != nil {
+		return nil, err
+	}
+
+	created := times.CreatedAt
+	if times.ProvisionUpdatedAt != nil {
+		created = *times.ProvisionUpdatedAt
+	}
+
+	status := strings.ToUpper(node.ProvisionState)
+	if node.Maintenance {
+		status = "MAINTENANCE"
+	}
+
+	metadata := make(map[string]string, len(node.Extra))
+	for key, val := range node.Extra {
+		if s, ok := val.(string); ok {
+			metadata[key] = s
+		}
+	}
+
+	addrs, err := b.getBaremetalAddresses(ctx, client, network, node)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Instance{
+		Server: servers.Server{
+			ID:        node.UUID,
+			Name:      node.Name,
+			TenantID:  node.Owner,
+			Status:    status,
+			Addresses: addrs,
+			Metadata:  metadata,
+			Created:   created,
+		},
+	}, nil
+}
+
+// baremetalNetworkPort is a Neutron port with the host it is bound to.
+type baremetalNetworkPort struct {
+	networkports.Port
+	portsbinding.PortsBindingExt
+}
+
+// getBaremetalAddresses returns the fixed IPs of the Neutron ports which
+// have the MAC addresses of the ports of the node, grouped by network.
+func (b *OpenStackAuthBackend) getBaremetalAddresses(ctx context.Context, client, network *gophercloud.ServiceClient, node *nodes.Node) (addrs map[string]interface{}, err error) {
+	_, span := startSpan(ctx, "ironic.ports.list", attribute.String("openstack.node_id", node.UUID))
+	defer func() { endSpan(span, err) }()
+
+	pages, err := baremetalports.List(client, baremetalports.ListOpts{NodeUUID: node.UUID}).AllPages()
+	if err != nil {
+		return nil, instanceError(err)
+	}
+
+	nodePorts, err := baremetalports.ExtractPorts(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs = map[string]interface{}{}
+	for _, nodePort := range nodePorts {
+		pages, err := networkports.List(network, networkports.ListOpts{MACAddress: nodePort.Address}).AllPages()
+		if err != nil {
+			return nil, instanceError(err)
+		}
+
+		var ports []baremetalNetworkPort
+		err = networkports.ExtractPortsInto(pages, &ports)
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := nodeNetworkPort(node, nodePort.Address, ports)
+		if err != nil {
+			return nil, err
+		}
+
+		if port == nil {
+			continue
+		}
+
+		entries, _ := addrs[port.NetworkID].([]interface{})
+		for _, ip := range port.FixedIPs {
+			version := 4.0
+			if addr := net.ParseIP(ip.IPAddress); addr != nil && addr.To4() == nil {
+				version = 6
+			}
+			entries = append(entries, map[string]interface{}{"addr": ip.IPAddress, "version": version})
+		}
+		addrs[port.NetworkID] = entries
+	}
+
+	return addrs, nil
+}
+
+// nodeNetworkPort returns the Neutron port with the MAC address which
+// belongs to the node, either as the device of the port or as the host the
+// port is bound to. A MAC address is not unique across the networks, and a
+// stale port of another device could otherwise lend its addresses to the
+// node, so more than one matching port is an error.
+func nodeNetworkPort(node *nodes.Node, mac string, ports []baremetalNetworkPort) (*baremetalNetworkPort, error) {
+	var found *baremetalNetworkPort
+	for i, port := range ports {
+		owned := port.DeviceID == node.UUID || port.HostID == node.UUID
+		if node.InstanceUUID != "" && port.DeviceID == node.InstanceUUID {
+			owned = true
+		}
+		if !owned {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("multiple network ports with MAC address %s belong to node %s", mac, node.UUID)
+		}
+		found = &ports[i]
+	}
+
+	return found, nil
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
+	networkports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+)
+
+func TestNodeNetworkPort(t *testing.T) {
+	node := &nodes.Node{
+		UUID:         "1be26c0b-03f2-4d2e-ae87-c02d7f33c123",
+		InstanceUUID: "9f2c4e6a-8b1d-4f3a-9c5e-7b1d3f5a7c9e",
+	}
+
+	port := func(id, deviceID, hostID string) baremetalNetworkPort {
+		return baremetalNetworkPort{
+			Port:            networkports.Port{ID: id, DeviceID: deviceID},
+			PortsBindingExt: portsbinding.PortsBindingExt{HostID: hostID},
+		}
+	}
+
+	var tests = []struct {
+		ports []baremetalNetworkPort
+		found string
+		err   bool
+	}{
+		{[]baremetalNetworkPort{port("instance", node.InstanceUUID, "")}, "instance", false},
+		{[]baremetalNetworkPort{port("node", node.UUID, "")}, "node", false},
+		{[]baremetalNetworkPort{port("bound", "", node.UUID)}, "bound", false},
+		{[]baremetalNetworkPort{port("other", "5a9d2c7e-6b1f-4a3d-8e2c-7f4b9a1d3e5c", "other-host"), port("bound", node.InstanceUUID, node.UUID)}, "bound", false},
+		{[]baremetalNetworkPort{port("other", "5a9d2c7e-6b1f-4a3d-8e2c-7f4b9a1d3e5c", "other-host")}, "", false},
+		// fail: the MAC address is ambiguous
+		{[]baremetalNetworkPort{port("instance", node.InstanceUUID, ""), port("bound", "", node.UUID)}, "", true},
+	}
+
+	for _, test := range tests {
+		found, err := nodeNetworkPort(node, "52:54:00:12:34:56", test.ports)
+		if (err != nil) != test.err {
+			t.Errorf("unexpected error: %v - %v", test.ports, err)
+			continue
+		}
+
+		id := ""
+		if found != nil {
+			id = found.ID
+		}
+		if id != test.found {
+			t.Errorf("unexpected port: %v - %s", test.ports, id)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"errors"
+	"net"
+
+	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// boundCIDRMasks returns the prefix lengths the addresses of the instance
+// are widened to when the tokens are bound to them.
+func (r *Role) boundCIDRMasks() (ipv4, ipv6 int) {
+	ipv4, ipv6 = 32, 128
+	if r.BindTokenIPv4Mask > 0 {
+		ipv4 = r.BindTokenIPv4Mask
+	}
+	if r.BindTokenIPv6Mask > 0 {
+		ipv6 = r.BindTokenIPv6Mask
+	}
+
+	return ipv4, ipv6
+}
+
+// instanceBoundCIDRs returns the CIDRs the token issued to the instance is
+// bound to: the addresses of the instance widened to the masks of the role,
+// and the additional accepted prefixes of the role, so that the instances
+// behind a NAT can use their tokens.
+func instanceBoundCIDRs(instance *Instance, role *Role) ([]*sockaddr.SockAddrMarshaler, error) {
+	ipv4Mask, ipv6Mask := role.boundCIDRMasks()
+
+	cidrs := []string{}
+	for _, addr := range instanceAddresses(instance) {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+
+		mask := net.CIDRMask(ipv6Mask, 128)
+		if ip.To4() != nil {
+			ip = ip.To4()
+			mask = net.CIDRMask(ipv4Mask, 32)
+		}
+
+		cidr := (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+		if !strutil.StrListContains(cidrs, cidr) {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+
+	if len(cidrs) == 0 {
+		return nil, &AttestError{
+			Reason: ReasonAddrMismatch,
+			Hint:   "the instance has no address to bind the token to, attach it to a network or disable bind_token_addresses on the role",
+			Err:    errors.New("instance has no address"),
+		}
+	}
+
+	cidrs = append(cidrs, role.AcceptedSourceCIDRs...)
+
+	bound := make([]*sockaddr.SockAddrMarshaler, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		addr, err := sockaddr.NewSockAddr(cidr)
+		if err != nil {
+			return nil, err
+		}
+		bound = append(bound, &sockaddr.SockAddrMarshaler{SockAddr: addr})
+	}
+
+	return bound, nil
+}
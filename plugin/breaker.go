@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// circuitBreakerThreshold is the number of consecutive failed
+	// OpenStack API requests which opens the circuit.
+	circuitBreakerThreshold = 5
+
+	// circuitBreakerCooldown is the duration the requests fail fast once
+	// the circuit is open.
+	circuitBreakerCooldown = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("upstream unavailable: openstack API requests are suspended after repeated failures")
+
+// circuitBreaker fails the requests to an OpenStack API endpoint fast
+// during an outage of the endpoint, instead of holding every login until
+// the requests time out.
+// The circuit opens after a number of consecutive failures. Once the
+// cooldown has passed the requests are sent again, and the next failure
+// opens the circuit again while a success closes it.
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+
+	// onOpen is called when the circuit opens.
+	onOpen func(failures int, cooldown time.Duration)
+}
+
+// circuitBreakers holds a circuit breaker per endpoint host, so that an
+// outage of one cloud, region or service doesn't suspend the requests to
+// the others.
+type circuitBreakers struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*circuitBreaker
+
+	// onOpen is called when the circuit of a host opens.
+	onOpen func(host string, failures int, cooldown time.Duration)
+}
+
+func newCircuitBreakers(threshold int, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  map[string]*circuitBreaker{},
+	}
+}
+
+// Get returns the circuit breaker of the host, creating it on first use.
+func (cbs *circuitBreakers) Get(host string) *circuitBreaker {
+	cbs.mutex.Lock()
+	defer cbs.mutex.Unlock()
+
+	if cb, ok := cbs.breakers[host]; ok {
+		return cb
+	}
+
+	cb := newCircuitBreaker(cbs.threshold, cbs.cooldown)
+	cb.onOpen = func(failures int, cooldown time.Duration) {
+		metrics.IncrCounterWithLabels([]string{"openstack", "api", "circuit_open"}, 1, []metrics.Label{
+			{Name: "host", Value: host},
+		})
+		if cbs.onOpen != nil {
+			cbs.onOpen(host, failures, cooldown)
+		}
+	}
+	cbs.breakers[host] = cb
+
+	return cb
+}
+
+// Reset drops the circuit breakers, which closes every circuit.
+func (cbs *circuitBreakers) Reset() {
+	cbs.mutex.Lock()
+	defer cbs.mutex.Unlock()
+
+	cbs.breakers = map[string]*circuitBreaker{}
+}
+
+// Snapshot returns the state of the circuit of each host.
+func (cbs *circuitBreakers) Snapshot() map[string]interface{} {
+	cbs.mutex.Lock()
+	defer cbs.mutex.Unlock()
+
+	snapshot := make(map[string]interface{}, len(cbs.breakers))
+	for host, cb := range cbs.breakers {
+		snapshot[host] = cb.Snapshot()
+	}
+
+	return snapshot
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns errCircuitOpen while the circuit is open.
+func (cb *circuitBreaker) Allow() error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if time.Now().Before(cb.openUntil) {
+		return errCircuitOpen
+	}
+
+	return nil
+}
+
+// Record records the outcome of a request.
+func (cb *circuitBreaker) Record(success bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if success {
+		cb.failures = 0
+		return
+	}
+
+	cb.failures += 1
+	if cb.failures < cb.threshold || time.Now().Before(cb.openUntil) {
+		return
+	}
+
+	cb.openUntil = time.Now().Add(cb.cooldown)
+	if cb.onOpen != nil {
+		cb.onOpen(cb.failures, cb.cooldown)
+	}
+}
+
+// Reset closes the circuit.
+func (cb *circuitBreaker) Reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.failures = 0
+	cb.openUntil = time.Time{}
+}
+
+// Snapshot returns the state of the circuit.
+func (cb *circuitBreaker) Snapshot() map[string]interface{} {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	snapshot := map[string]interface{}{
+		"open":     time.Now().Before(cb.openUntil),
+		"failures": cb.failures,
+	}
+	if time.Now().Before(cb.openUntil) {
+		snapshot["open_until"] = cb.openUntil.Format(time.RFC3339)
+	}
+
+	return snapshot
+}
+
+// breakerTransport is a http.RoundTripper which fails the requests while
+// the circuit of the host is open, and records the connection errors and
+// the server errors as failures.
+type breakerTransport struct {
+	base     http.RoundTripper
+	breakers *circuitBreakers
+}
+
+func (tr *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := tr.breakers.Get(req.URL.Host)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	res, err := tr.base.RoundTrip(req)
+	switch {
+	case err != nil:
+		// Requests canceled by the caller say nothing about the API.
+		if !errors.Is(err, context.Canceled) {
+			breaker.Record(false)
+		}
+	case res.StatusCode >= http.StatusInternalServerError:
+		breaker.Record(false)
+	default:
+		breaker.Record(true)
+	}
+
+	return res, err
+}
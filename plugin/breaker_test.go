@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var count, status int32
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	})
+
+	client.HTTPClient = http.Client{
+		Transport: &breakerTransport{base: http.DefaultTransport, breakers: newCircuitBreakers(3, 100*time.Millisecond)},
+	}
+
+	get := func() error {
+		_, err := client.Get(client.ServiceURL("servers", "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5"), nil, nil)
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		get()
+	}
+
+	// The circuit opens after 3 failures and the other requests fail fast.
+	if count != 3 {
+		t.Errorf("unexpected number of requests: %d", count)
+	}
+	if err := get(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("unexpected result: %v", err)
+	}
+
+	// A failure after the cooldown opens the circuit again.
+	time.Sleep(150 * time.Millisecond)
+	get()
+	if err := get(); !errors.Is(err, errCircuitOpen) || count != 4 {
+		t.Errorf("unexpected result: %d - %v", count, err)
+	}
+
+	// A success after the cooldown closes the circuit.
+	time.Sleep(150 * time.Millisecond)
+	atomic.StoreInt32(&status, http.StatusOK)
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Errorf("unexpected result: %v", err)
+		}
+	}
+	if count != 7 {
+		t.Errorf("unexpected number of requests: %d", count)
+	}
+}
+
+func TestCircuitBreakerPerHost(t *testing.T) {
+	failing := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	healthy := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	breakers := newCircuitBreakers(3, time.Minute)
+	for _, client := range []*gophercloud.ServiceClient{failing, healthy} {
+		client.HTTPClient = http.Client{
+			Transport: &breakerTransport{base: http.DefaultTransport, breakers: breakers},
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		failing.Get(failing.ServiceURL("servers"), nil, nil)
+	}
+
+	if _, err := failing.Get(failing.ServiceURL("servers"), nil, nil); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("unexpected result: %v", err)
+	}
+	// The outage of one endpoint does not suspend the requests to another.
+	if _, err := healthy.Get(healthy.ServiceURL("servers"), nil, nil); err != nil {
+		t.Errorf("unexpected result: %v", err)
+	}
+	if snapshot := breakers.Snapshot(); len(snapshot) != 2 {
+		t.Errorf("unexpected snapshot: %v", snapshot)
+	}
+}
+
+func TestLoginCircuitOpen(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	m.Close()
+
+	for i := 0; i < circuitBreakerThreshold; i++ {
+		req := newTestLoginRequest(storage, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", correctIPv4)
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != http.StatusBadGateway {
+			t.Errorf("unexpected status: %d - %v - %v", status, res, err)
+		}
+	}
+
+	req := newTestLoginRequest(storage, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", correctIPv4)
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusServiceUnavailable || !strings.Contains(err.Error(), "upstream unavailable") {
+		t.Errorf("unexpected result: %d - %v - %v", status, res, err)
+	}
+}
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+// cache is a size bounded in-memory cache with expiring entries. When the
+// cache is full, the least recently used entry is evicted.
+type cache[V any] struct {
+	name    string
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	stats   cacheStats
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// cacheStats holds the counters of a cache.
+type cacheStats struct {
+	Hits      uint64 `json:"hits" structs:"hits" mapstructure:"hits"`
+	Misses    uint64 `json:"misses" structs:"misses" mapstructure:"misses"`
+	Evictions uint64 `json:"evictions" structs:"evictions" mapstructure:"evictions"`
+}
+
+func newCache[V any](name string, size int, ttl time.Duration) *cache[V] {
+	return &cache[V]{
+		name:    name,
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Get returns the value of the key if it exists and has not expired.
+func (c *cache[V]) Get(key string) (V, bool) {
+	var empty V
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses += 1
+		return empty, false
+	}
+
+	entry := elem.Value.(*cacheEntry[V])
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		c.stats.Misses += 1
+		return empty, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.stats.Hits += 1
+
+	return entry.value, true
+}
+
+// Add stores the value of the key, evicting the least recently used entry
+// when the cache is full.
+func (c *cache[V]) Add(key string, value V) {
+	c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL stores the value of the key like Add, expiring it after the
+// given TTL instead of the TTL of the cache.
+func (c *cache[V]) AddWithTTL(key string, value V, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expires := time.Now().Add(ttl)
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry[V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	for c.order.Len() >= c.size && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+		c.stats.Evictions += 1
+		metrics.IncrCounter([]string{"openstack", "cache", c.name, "evictions"}, 1)
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry[V]{key: key, value: value, expires: expires})
+}
+
+// Remove deletes the key from the cache.
+func (c *cache[V]) Remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// RemovePrefix deletes the keys starting with the prefix from the cache.
+func (c *cache[V]) RemovePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(elem)
+		}
+	}
+}
+
+// Range calls fn with each unexpired entry of the cache. fn must not call
+// the methods of the cache.
+func (c *cache[V]) Range(fn func(key string, value V)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, elem := range c.entries {
+		entry := elem.Value.(*cacheEntry[V])
+		if now.Before(entry.expires) {
+			fn(key, entry.value)
+		}
+	}
+}
+
+// Purge deletes all entries from the cache.
+func (c *cache[V]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
+
+// Len returns the number of entries in the cache including expired ones.
+func (c *cache[V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+// Stats returns the counters of the cache.
+func (c *cache[V]) Stats() cacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.stats
+}
+
+func (c *cache[V]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry[V]).key)
+}
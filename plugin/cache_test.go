@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := newCache[int]("test", 2, time.Minute)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	if val, ok := c.Get("a"); !ok || val != 1 {
+		t.Errorf("unexpected result: %d, %v", val, ok)
+	}
+
+	// "b" is the least recently used entry.
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("least recently used entry was not evicted")
+	}
+	if val, ok := c.Get("c"); !ok || val != 3 {
+		t.Errorf("unexpected result: %d, %v", val, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("unexpected length: %d", c.Len())
+	}
+
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("entry was not removed")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("cache was not purged: %d", c.Len())
+	}
+}
+
+func TestCacheExpiration(t *testing.T) {
+	c := newCache[string]("test", 10, 10*time.Millisecond)
+
+	c.Add("a", "value")
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("entry was not found")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("entry was not expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expired entry was not removed: %d", c.Len())
+	}
+}
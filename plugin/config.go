@@ -2,33 +2,233 @@ package plugin
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
 type Config struct {
-	AuthURL               string   `json:"auth_url" structs:"auth_url" mapstructure:"auth_url"`
-	Availability          string   `json:"availability" structs:"availability" mapstructure:"availability"`
-	Token                 string   `json:"token" structs:"token" mapstructure:"token"`
-	UserID                string   `json:"user_id" structs:"user_id" mapstructure:"user_id"`
-	Username              string   `json:"username" structs:"username" mapstructure:"username"`
-	Password              string   `json:"password" structs:"password" mapstructure:"password"`
-	ProjectID             string   `json:"project_id" structs:"project_id" mapstructure:"project_id"`
-	ProjectName           string   `json:"project_name" structs:"project_name" mapstructure:"project_name"`
-	TenantID              string   `json:"tenant_id" structs:"tenant_id" mapstructure:"tenant_id"`
-	TenantName            string   `json:"tenant_name" structs:"tenant_name" mapstructure:"tenant_name"`
-	UserDomainID          string   `json:"user_domain_id" structs:"user_domain_id" mapstructure:"user_domain_id"`
-	UserDomainName        string   `json:"user_domain_name" structs:"user_domain_name" mapstructure:"user_domain_name"`
-	ProjectDomainID       string   `json:"project_domain_id" structs:"project_domain_id" mapstructure:"project_domain_id"`
-	ProjectDomainName     string   `json:"project_domain_name" structs:"project_domain_name" mapstructure:"project_domain_name"`
-	DomainID              string   `json:"domain_id" structs:"domain_id" mapstructure:"domain_id"`
-	DomainName            string   `json:"domain_name" structs:"domain_name" mapstructure:"domain_name"`
-	RequestAddressHeaders []string `json:"request_address_headers" structs:"request_address_headers" mapstructure:"request_address_headers"`
-	RegionName            string `json:"region_name" structs:"region_name" mapstructure:"region_name"`
+	AuthURL                      string         `json:"auth_url" structs:"auth_url" mapstructure:"auth_url"`
+	Availability                 string         `json:"availability" structs:"availability" mapstructure:"availability"`
+	Token                        string         `json:"token" structs:"token" mapstructure:"token"`
+	UserID                       string         `json:"user_id" structs:"user_id" mapstructure:"user_id"`
+	Username                     string         `json:"username" structs:"username" mapstructure:"username"`
+	Password                     string         `json:"password" structs:"password" mapstructure:"password"`
+	ProjectID                    string         `json:"project_id" structs:"project_id" mapstructure:"project_id"`
+	ProjectName                  string         `json:"project_name" structs:"project_name" mapstructure:"project_name"`
+	TenantID                     string         `json:"tenant_id" structs:"tenant_id" mapstructure:"tenant_id"`
+	TenantName                   string         `json:"tenant_name" structs:"tenant_name" mapstructure:"tenant_name"`
+	UserDomainID                 string         `json:"user_domain_id" structs:"user_domain_id" mapstructure:"user_domain_id"`
+	UserDomainName               string         `json:"user_domain_name" structs:"user_domain_name" mapstructure:"user_domain_name"`
+	ProjectDomainID              string         `json:"project_domain_id" structs:"project_domain_id" mapstructure:"project_domain_id"`
+	ProjectDomainName            string         `json:"project_domain_name" structs:"project_domain_name" mapstructure:"project_domain_name"`
+	DomainID                     string         `json:"domain_id" structs:"domain_id" mapstructure:"domain_id"`
+	DomainName                   string         `json:"domain_name" structs:"domain_name" mapstructure:"domain_name"`
+	RequestAddressHeaders        []string       `json:"request_address_headers" structs:"request_address_headers" mapstructure:"request_address_headers"`
+	RequestAddressSource         string         `json:"request_address_source" structs:"request_address_source" mapstructure:"request_address_source"`
+	TrustedProxies               []string       `json:"trusted_proxies" structs:"trusted_proxies" mapstructure:"trusted_proxies"`
+	RegionName                   string         `json:"region_name" structs:"region_name" mapstructure:"region_name"`
+	WarmUpClient                 bool           `json:"warm_up_client" structs:"warm_up_client" mapstructure:"warm_up_client"`
+	AllTenants                   bool           `json:"all_tenants" structs:"all_tenants" mapstructure:"all_tenants"`
+	AuditNonHMACFields           []string       `json:"audit_non_hmac_fields" structs:"audit_non_hmac_fields" mapstructure:"audit_non_hmac_fields"`
+	AliasName                    string         `json:"alias_name" structs:"alias_name" mapstructure:"alias_name"`
+	AuthAttemptCleanupInterval   time.Duration  `json:"auth_attempt_cleanup_interval" structs:"auth_attempt_cleanup_interval" mapstructure:"auth_attempt_cleanup_interval"`
+	TTL                          time.Duration  `json:"ttl" structs:"ttl" mapstructure:"ttl"`
+	MaxTTL                       time.Duration  `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	Period                       time.Duration  `json:"period" structs:"period" mapstructure:"period"`
+	CACert                       string         `json:"cacert" structs:"cacert" mapstructure:"cacert"`
+	InsecureSkipVerify           bool           `json:"insecure_skip_verify" structs:"insecure_skip_verify" mapstructure:"insecure_skip_verify"`
+	ClientCert                   string         `json:"client_cert" structs:"client_cert" mapstructure:"client_cert"`
+	ClientKey                    string         `json:"client_key" structs:"client_key" mapstructure:"client_key"`
+	HTTPProxy                    string         `json:"http_proxy" structs:"http_proxy" mapstructure:"http_proxy"`
+	RequestTimeout               time.Duration  `json:"request_timeout" structs:"request_timeout" mapstructure:"request_timeout"`
+	MaxRetries                   *int           `json:"max_retries,omitempty" structs:"max_retries" mapstructure:"max_retries"`
+	LookupAttempts               int            `json:"lookup_attempts" structs:"lookup_attempts" mapstructure:"lookup_attempts"`
+	InstanceCacheTTL             *time.Duration `json:"instance_cache_ttl,omitempty" structs:"instance_cache_ttl" mapstructure:"instance_cache_ttl"`
+	ComputeAPIMicroversion       string         `json:"compute_api_microversion" structs:"compute_api_microversion" mapstructure:"compute_api_microversion"`
+	SelectelAPIURL               string         `json:"selectel_api_url" structs:"selectel_api_url" mapstructure:"selectel_api_url"`
+	SelectelAPIToken             string         `json:"selectel_api_token" structs:"selectel_api_token" mapstructure:"selectel_api_token"`
+	SelectelServersAPIURL        string         `json:"selectel_servers_api_url" structs:"selectel_servers_api_url" mapstructure:"selectel_servers_api_url"`
+	TOTPSecret                   string         `json:"totp_secret" structs:"totp_secret" mapstructure:"totp_secret"`
+	MKSClusterMetadataKey        string         `json:"mks_cluster_metadata_key" structs:"mks_cluster_metadata_key" mapstructure:"mks_cluster_metadata_key"`
+	MKSNodeGroupMetadataKey      string         `json:"mks_nodegroup_metadata_key" structs:"mks_nodegroup_metadata_key" mapstructure:"mks_nodegroup_metadata_key"`
+	ApplicationCredentialID      string         `json:"application_credential_id" structs:"application_credential_id" mapstructure:"application_credential_id"`
+	ApplicationCredentialSecret  string         `json:"application_credential_secret" structs:"application_credential_secret" mapstructure:"application_credential_secret"`
+	AuthType                     string         `json:"auth_type" structs:"auth_type" mapstructure:"auth_type"`
+	IdentityProvider             string         `json:"identity_provider" structs:"identity_provider" mapstructure:"identity_provider"`
+	FederationProtocol           string         `json:"protocol" structs:"protocol" mapstructure:"protocol"`
+	ClientID                     string         `json:"client_id" structs:"client_id" mapstructure:"client_id"`
+	ClientSecret                 string         `json:"client_secret" structs:"client_secret" mapstructure:"client_secret"`
+	DiscoveryEndpoint            string         `json:"discovery_endpoint" structs:"discovery_endpoint" mapstructure:"discovery_endpoint"`
+	AccessTokenEndpoint          string         `json:"access_token_endpoint" structs:"access_token_endpoint" mapstructure:"access_token_endpoint"`
+	OIDCScope                    string         `json:"openid_scope" structs:"openid_scope" mapstructure:"openid_scope"`
+	IdentityDocumentCertificates []string       `json:"identity_document_certificates" structs:"identity_document_certificates" mapstructure:"identity_document_certificates"`
+	Version                      int            `json:"version" structs:"version" mapstructure:"version"`
+
+	// name is the name of the config profile, empty for the default
+	// config.
+	name string
+}
+
+// Fingerprint returns the fingerprint of the config. The credentials and
+// the version are excluded, so that the fingerprint does not leak secrets
+// and stays the same when the same config is written again.
+func (c *Config) Fingerprint() string {
+	config, _ := c.withoutSecrets()
+	config.Version = 0
+
+	return fingerprint(config)
+}
+
+// configSecrets are the credentials of the config.
+type configSecrets struct {
+	Token                       string `json:"token,omitempty"`
+	Password                    string `json:"password,omitempty"`
+	SelectelAPIToken            string `json:"selectel_api_token,omitempty"`
+	TOTPSecret                  string `json:"totp_secret,omitempty"`
+	ApplicationCredentialSecret string `json:"application_credential_secret,omitempty"`
+	ClientSecret                string `json:"client_secret,omitempty"`
+	ClientKey                   string `json:"client_key,omitempty"`
+}
+
+// withoutSecrets returns a copy of the config without the credentials,
+// and the credentials.
+func (c *Config) withoutSecrets() (Config, configSecrets) {
+	config := *c
+	secrets := configSecrets{
+		Token:                       c.Token,
+		Password:                    c.Password,
+		SelectelAPIToken:            c.SelectelAPIToken,
+		TOTPSecret:                  c.TOTPSecret,
+		ApplicationCredentialSecret: c.ApplicationCredentialSecret,
+		ClientSecret:                c.ClientSecret,
+		ClientKey:                   c.ClientKey,
+	}
+	config.setSecrets(configSecrets{})
+
+	return config, secrets
+}
+
+// names returns the names of the config fields of the credentials which
+// are set, so that a read of the config shows them without their values.
+func (s configSecrets) names() []string {
+	secrets := []struct {
+		name  string
+		value string
+	}{
+		{"token", s.Token},
+		{"password", s.Password},
+		{"selectel_api_token", s.SelectelAPIToken},
+		{"totp_secret", s.TOTPSecret},
+		{"application_credential_secret", s.ApplicationCredentialSecret},
+		{"client_secret", s.ClientSecret},
+		{"client_key", s.ClientKey},
+	}
+
+	names := []string{}
+	for _, secret := range secrets {
+		if secret.value != "" {
+			names = append(names, secret.name)
+		}
+	}
+
+	return names
+}
+
+// authMethod returns how the config authenticates to Keystone, in the
+// order the credentials take precedence.
+func (c *Config) authMethod() string {
+	switch {
+	case c.federated():
+		return c.AuthType
+	case c.ApplicationCredentialID != "":
+		return "application_credential"
+	case c.Token != "":
+		return "token"
+	case c.TOTPSecret != "":
+		return "totp"
+	case c.Password != "":
+		return "password"
+	default:
+		return ""
+	}
+}
+
+// setSecrets replaces the credentials of the config.
+func (c *Config) setSecrets(secrets configSecrets) {
+	c.Token = secrets.Token
+	c.Password = secrets.Password
+	c.SelectelAPIToken = secrets.SelectelAPIToken
+	c.TOTPSecret = secrets.TOTPSecret
+	c.ApplicationCredentialSecret = secrets.ApplicationCredentialSecret
+	c.ClientSecret = secrets.ClientSecret
+	c.ClientKey = secrets.ClientKey
+}
+
+// availability returns the endpoint interface of the OpenStack APIs.
+func (c *Config) availability() gophercloud.Availability {
+	if c.Availability == "" {
+		return gophercloud.AvailabilityPublic
+	}
+
+	return gophercloud.Availability(c.Availability)
+}
+
+// fixedScope returns whether the client stays scoped to the configured
+// project instead of the project of the role. Application credentials
+// cannot be rescoped.
+func (c *Config) fixedScope() bool {
+	return c.AllTenants || c.ApplicationCredentialID != ""
+}
+
+// auditFields is the list of the login fields which can be recorded in the
+// token metadata, which is not HMAC'd in the audit log.
+var auditFields = []string{"instance_id", "role", "request_addr"}
+
+// reservedConfigNames are the names of the paths under config/ which
+// cannot be used for the config profiles.
+var reservedConfigNames = []string{"generate-credentials", "rotate", "exists"}
+
+// configStorageKey returns the storage key of the config profile. The
+// default config has an empty name.
+func configStorageKey(name string) string {
+	if name == "" {
+		return "config"
+	}
+
+	return fmt.Sprintf("config/%s", name)
+}
+
+// configDisplayName returns the name of the config profile in the messages
+// and the change records.
+func configDisplayName(name string) string {
+	if name == "" {
+		return "config"
+	}
+
+	return name
+}
+
+// configMissingResponse returns the error response of a request with a
+// role whose config doesn't exist.
+func configMissingResponse(r *Role) *logical.Response {
+	if r.Config != "" {
+		return logical.ErrorResponse(fmt.Sprintf("config profile %s of role %s does not exist", r.Config, r.Name))
+	}
+
+	return logical.ErrorResponse("backend is not configured")
 }
 
 func readConfig(ctx context.Context, s logical.Storage) (*Config, error) {
-	entry, err := s.Get(ctx, "config")
+	return readNamedConfig(ctx, s, "")
+}
+
+// readNamedConfig returns the config profile, or the default config for an
+// empty name.
+func readNamedConfig(ctx context.Context, s logical.Storage, name string) (*Config, error) {
+	entry, err := s.Get(ctx, configStorageKey(name))
 	if err != nil {
 		return nil, err
 	}
@@ -42,6 +242,7 @@ func readConfig(ctx context.Context, s logical.Storage) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	config.name = name
 
 	return config, nil
 }
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/users"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// credentialAccessRules are the API requests the backend makes, as paths
+// relative to the endpoint of each service. The application credentials
+// generated for the backend are restricted to them.
+var credentialAccessRules = []struct {
+	service string
+	path    string
+}{
+	// The version document is read to negotiate the compute microversion.
+	{"compute", ""},
+	{"compute", "servers/*"},
+	{"network", "v2.0/ports"},
+	{"network", "v2.0/ports/*"},
+	{"network", "v2.0/floatingips"},
+	{"identity", "projects/*"},
+	{"identity", "users/*"},
+	{"identity", "domains/*"},
+	{"identity", "role_assignments"},
+	{"orchestration", "stacks/**"},
+	{"baremetal", "nodes/*"},
+	{"baremetal", "ports"},
+	{"dns", "v2/zones"},
+	{"dns", "v2/zones/*/recordsets"},
+}
+
+// generateCredential authenticates with the bootstrap config and creates an
+// application credential of the bootstrap user restricted to the access
+// rules of the services in the catalog.
+func (b *OpenStackAuthBackend) generateCredential(ctx context.Context, bootstrap *Config, name string, roles []string) (*applicationcredentials.ApplicationCredential, error) {
+	provider, _, err := b.authenticate(ctx, bootstrap, &Role{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", identityError(err))
+	}
+
+	result, ok := provider.GetAuthResult().(interface {
+		ExtractUser() (*tokens.User, error)
+		ExtractServiceCatalog() (*tokens.ServiceCatalog, error)
+	})
+	if !ok {
+		return nil, errors.New("application credentials require the Keystone v3 API")
+	}
+
+	user, err := result.ExtractUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token user: %w", err)
+	}
+
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service catalog: %w", err)
+	}
+
+	endpointOpts := gophercloud.EndpointOpts{
+		Region:       bootstrap.RegionName,
+		Availability: bootstrap.availability(),
+	}
+
+	rules, err := accessRules(catalog, endpointOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := openstack.NewIdentityV3(provider, endpointOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := applicationcredentials.CreateOpts{
+		Name:        name,
+		Description: "Credential of the Vault OpenStack auth backend.",
+		AccessRules: rules,
+	}
+	for _, role := range roles {
+		opts.Roles = append(opts.Roles, applicationcredentials.Role{Name: role})
+	}
+
+	_, span := startSpan(ctx, "keystone.application_credentials.create", attribute.String("openstack.user_id", user.ID))
+	credential, err := applicationcredentials.Create(client, user.ID, opts).Extract()
+	endSpan(span, err)
+	if err != nil {
+		return nil, identityError(err)
+	}
+
+	return credential, nil
+}
+
+// accessRules returns the access rules of the API requests the backend
+// makes. The services without an endpoint in the catalog are skipped.
+func accessRules(catalog *tokens.ServiceCatalog, opts gophercloud.EndpointOpts) ([]applicationcredentials.AccessRule, error) {
+	rules := []applicationcredentials.AccessRule{}
+	for _, rule := range credentialAccessRules {
+		opts.Type = rule.service
+		endpoint, err := openstack.V3EndpointURL(catalog, opts)
+		if err != nil {
+			continue
+		}
+
+		u, err := url.Parse(gophercloud.NormalizeURL(endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s endpoint: %w", rule.service, err)
+		}
+
+		rules = append(rules, applicationcredentials.AccessRule{
+			Service: rule.service,
+			Method:  "GET",
+			Path:    u.Path + rule.path,
+		})
+	}
+
+	return rules, nil
+}
+
+// defaultCredentialName returns the name of a generated application
+// credential, unique per second so that rotating the credential does not
+// conflict with the previous one.
+func defaultCredentialName(now time.Time) string {
+	return fmt.Sprintf("vault-auth-openstack-%s", now.UTC().Format("20060102150405"))
+}
+
+// rotatable returns whether the config authenticates with the password of a
+// Keystone user, which the backend can replace on its own.
+func (c *Config) rotatable() bool {
+	return c.Password != "" && c.ApplicationCredentialID == "" && !c.federated()
+}
+
+// rotatePassword changes the password of the Keystone user of the config
+// to a random one, and returns the ID of the user and the new password.
+func (b *OpenStackAuthBackend) rotatePassword(ctx context.Context, config *Config) (userID, password string, err error) {
+	provider, _, err := b.authenticate(ctx, config, &Role{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to authenticate: %w", identityError(err))
+	}
+
+	result, ok := provider.GetAuthResult().(interface {
+		ExtractUser() (*tokens.User, error)
+	})
+	if !ok {
+		return "", "", errors.New("password rotation requires the Keystone v3 API")
+	}
+
+	user, err := result.ExtractUser()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read token user: %w", err)
+	}
+
+	client, err := openstack.NewIdentityV3(provider, gophercloud.EndpointOpts{
+		Region:       config.RegionName,
+		Availability: config.availability(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = randomPassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	_, span := startSpan(ctx, "keystone.users.change_password", attribute.String("openstack.user_id", user.ID))
+	err = users.ChangePassword(client, user.ID, users.ChangePasswordOpts{
+		OriginalPassword: config.Password,
+		Password:         password,
+	}).ExtractErr()
+	endSpan(span, err)
+	if err != nil {
+		return "", "", identityError(err)
+	}
+
+	return user.ID, password, nil
+}
+
+// randomPassword returns a password of 32 URL-safe characters.
+func randomPassword() (string, error) {
+	buf := make([]byte, 24)
+	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
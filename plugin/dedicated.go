@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Types of the servers a role attests.
+const (
+	serverTypeCloud     = "cloud"
+	serverTypeDedicated = "dedicated"
+)
+
+// defaultSelectelServersAPIURL is the endpoint of the Selectel dedicated
+// servers API.
+const defaultSelectelServersAPIURL = "https://api.selectel.ru/servers/v2"
+
+var errSelectelNotConfigured = errors.New("selectel_api_token is not configured")
+
+// dedicatedServer is a Selectel dedicated server as returned by the
+// servers API.
+type dedicatedServer struct {
+	UUID        string            `json:"uuid"`
+	Name        string            `json:"name"`
+	State       string            `json:"state"`
+	ProjectUUID string            `json:"project_uuid"`
+	IPAddresses []string          `json:"ip_addresses"`
+	Tags        map[string]string `json:"tags"`
+	Created     time.Time         `json:"created"`
+}
+
+// Server converts the dedicated server to the instance representation used
+// by the attestation, so that the roles, the metadata and the addresses are
+// verified the same way as for the cloud instances. The tags of the server
+// play the role of the instance metadata.
+func (d *dedicatedServer) Server() *Instance {
+	status := strings.ToUpper(d.State)
+
+	addrs := make([]interface{}, 0, len(d.IPAddresses))
+	for _, addr := range d.IPAddresses {
+		version := 4.0
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+			version = 6
+		}
+		addrs = append(addrs, map[string]interface{}{"addr": addr, "version": version})
+	}
+
+	metadata := make(map[string]string, len(d.Tags))
+	for key, val := range d.Tags {
+		metadata[key] = val
+	}
+
+	return &Instance{
+		Server: servers.Server{
+			ID:        d.UUID,
+			Name:      d.Name,
+			TenantID:  d.ProjectUUID,
+			Status:    status,
+			Addresses: map[string]interface{}{serverTypeDedicated: addrs},
+			Metadata:  metadata,
+			Created:   d.Created,
+		},
+	}
+}
+
+// getDedicatedServer fetches the dedicated server from the Selectel
+// servers API. The errors are mapped to the same errors as the instance
+// lookups, so that they are reported the same way.
+func (b *OpenStackAuthBackend) getDedicatedServer(ctx context.Context, config *Config, serverID string) (server *Instance, err error) {
+	if _, err := uuid.ParseUUID(serverID); err != nil {
+		return nil, errInvalidInstanceID
+	}
+
+	if config.SelectelAPIToken == "" {
+		return nil, errSelectelNotConfigured
+	}
+
+	url := config.SelectelServersAPIURL
+	if url == "" {
+		url = defaultSelectelServersAPIURL
+	}
+	url = strings.TrimSuffix(url, "/")
+
+	ctx, span := startSpan(ctx, "selectel.servers.get", attribute.String("selectel.server_id", serverID))
+	defer func() { endSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/resource/%s", url, serverID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Token", config.SelectelAPIToken)
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: selectelTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errInstanceNotFound
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: selectel API returned %d", errUnauthorized, res.StatusCode)
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("%w: selectel API returned %d", errForbidden, res.StatusCode)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return nil, fmt.Errorf("%w: selectel API returned %d", errUnavailable, res.StatusCode)
+	default:
+		return nil, fmt.Errorf("unexpected status from selectel API: %d", res.StatusCode)
+	}
+
+	var body struct {
+		Result dedicatedServer `json:"result"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	return body.Result.Server(), nil
+}
+
+// lookupFunc fetches an instance to attest by ID.
+type lookupFunc func(ctx context.Context, instanceID string) (*Instance, error)
+
+// instanceLookup returns the lookup of the instances attested by the role.
+// The instances reported as deleted by the cloud notifications are never
+// found.
+func (b *OpenStackAuthBackend) instanceLookup(ctx context.Context, s logical.Storage, config *Config, role *Role) (lookupFunc, error) {
+	lookup, err := b.apiLookup(ctx, s, config, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return withInstanceEvents(s, lookup), nil
+}
+
+// apiLookup returns the lookup of the instances with the API of the role.
+// Roles of dedicated servers look up the servers with the Selectel servers
+// API, roles of bare metal nodes look up the nodes with the Ironic API, and
+// other roles look up the instances with the compute API.
+func (b *OpenStackAuthBackend) apiLookup(ctx context.Context, s logical.Storage, config *Config, role *Role) (lookupFunc, error) {
+	if role.ServerType == serverTypeDedicated {
+		if config.SelectelAPIToken == "" {
+			return nil, errSelectelNotConfigured
+		}
+
+		return func(ctx context.Context, instanceID string) (*Instance, error) {
+			return b.getDedicatedServer(ctx, config, instanceID)
+		}, nil
+	}
+
+	if role.ServerType == serverTypeBaremetal {
+		client, err := b.getBaremetalClient(ctx, s, role)
+		if err != nil {
+			return nil, err
+		}
+
+		network, err := b.getNetworkClient(ctx, s, role)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context, instanceID string) (*Instance, error) {
+			return b.getBaremetalNode(ctx, client, network, instanceID)
+		}, nil
+	}
+
+	c, err := b.getClients(ctx, s, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, instanceID string) (*Instance, error) {
+		return b.getInstance(ctx, c.client, c.key, instanceID, config.lookupOptions(role))
+	}, nil
+}
+
+// lookupErrorResponse converts the error of building the instance lookup
+// to the response.
+func lookupErrorResponse(logger hclog.Logger, roleName string, err error) (*logical.Response, error) {
+	if errors.Is(err, errSelectelNotConfigured) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: dedicated servers require %v (hint: set selectel_api_token in the config)", err)), nil
+	}
+
+	if errors.Is(err, errCircuitOpen) {
+		logger.Warn("rejecting instance lookup", "role", roleName, "error", err)
+		return nil, logical.CodedError(http.StatusServiceUnavailable, err.Error())
+	}
+
+	msg := "openstack client error"
+	logger.Error(msg, "role", roleName, "error", err)
+	return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+}
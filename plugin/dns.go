@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// dnsRecordTypes is the list of the record types attested against the
+// addresses of the instance.
+var dnsRecordTypes = []string{"A", "AAAA"}
+
+// attestDNS verifies that the Designate zone bound to the role has an A or
+// AAAA record for the name of the instance pointing at one of the addresses
+// of the instance.
+func (b *OpenStackAuthBackend) attestDNS(ctx context.Context, s logical.Storage, role *Role, instance *Instance) (err error) {
+	if role.BoundDNSZone == "" {
+		return nil
+	}
+
+	client, err := b.getDNSClient(ctx, s, role)
+	if err != nil {
+		return err
+	}
+
+	zoneName := dnsName(role.BoundDNSZone)
+	recordName := dnsName(instance.Name + "." + zoneName)
+
+	ctx, span := startSpan(ctx, "designate.recordsets.verify", attribute.String("openstack.dns_zone", zoneName), attribute.String("openstack.instance_id", instance.ID))
+	defer func() { endSpan(span, err) }()
+
+	pages, err := zones.List(client, zones.ListOpts{Name: zoneName}).AllPages()
+	if err != nil {
+		return err
+	}
+
+	found, err := zones.ExtractZones(pages)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return &AttestError{
+			Reason: ReasonDNSMismatch,
+			Hint:   fmt.Sprintf("check bound_dns_zone of the role, zone %s is not visible to the backend", zoneName),
+			Err:    fmt.Errorf("zone not found: %s", zoneName),
+		}
+	}
+
+	pages, err = recordsets.ListByZone(client, found[0].ID, recordsets.ListOpts{Name: recordName}).AllPages()
+	if err != nil {
+		return err
+	}
+
+	records, err := recordsets.ExtractRecordSets(pages)
+	if err != nil {
+		return err
+	}
+
+	addrs := instanceAddresses(instance)
+	for _, record := range records {
+		if !strutil.StrListContains(dnsRecordTypes, record.Type) {
+			continue
+		}
+
+		for _, addr := range record.Records {
+			if sameAddress(addrs, addr) {
+				return nil
+			}
+		}
+	}
+
+	return &AttestError{
+		Reason: ReasonDNSMismatch,
+		Hint:   fmt.Sprintf("create an A or AAAA record %s with an address of the instance", recordName),
+		Err:    fmt.Errorf("no address record of %s points at the instance", recordName),
+	}
+}
+
+// sameAddress returns whether the address is one of the addresses,
+// comparing the parsed IPs since the IPv6 addresses can be written in
+// several forms.
+func sameAddress(addrs []string, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, a := range addrs {
+		if ip.Equal(net.ParseIP(a)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dnsName returns the fully qualified, lower-cased form of the DNS name.
+func dnsName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	eventLogin       = "openstack/login"
+	eventLoginDenied = "openstack/login-denied"
+)
+
+// sendEvent publishes the event to the event system of Vault. The events
+// are dropped on the Vault versions without the event system.
+func (b *OpenStackAuthBackend) sendEvent(ctx context.Context, eventType string, metadata map[string]interface{}) {
+	event, err := logical.NewEvent()
+	if err == nil {
+		event.Metadata, err = structpb.NewStruct(metadata)
+	}
+	if err == nil {
+		err = b.SendEvent(ctx, logical.EventType(eventType), event)
+	}
+	if err != nil && !errors.Is(err, framework.ErrNoEvents) {
+		b.Logger().Warn("failed to send event", "event_type", eventType, "error", err)
+	}
+}
+
+// sendLoginEvent publishes the outcome of a login. The logins which failed
+// with an error are not attested and are not published.
+func (b *OpenStackAuthBackend) sendLoginEvent(ctx context.Context, req *logical.Request, roleName, instanceID, reason string, res *logical.Response, err error) {
+	metadata := map[string]interface{}{
+		"role":           roleName,
+		"instance_id":    instanceID,
+		"mount_accessor": req.MountAccessor,
+	}
+
+	switch requestOutcome(res, err) {
+	case outcomeSuccess:
+		b.sendEvent(ctx, eventLogin, metadata)
+	case outcomeDenied:
+		if reason == "" {
+			reason = reasonOther
+		}
+		metadata["reason"] = reason
+		b.sendEvent(ctx, eventLoginDenied, metadata)
+	}
+}
+
+// changeEventType returns the event type of a change of the config or a
+// role, such as openstack/role-write.
+func changeEventType(kind string, operation logical.Operation) string {
+	action := "write"
+	if operation == logical.DeleteOperation {
+		action = "delete"
+	}
+
+	return "openstack/" + kind + "-" + action
+}
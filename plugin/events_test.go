@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// mockEventSender records the events sent by the backend.
+type mockEventSender struct {
+	mutex  sync.Mutex
+	events []logical.EventType
+	data   []*logical.EventData
+}
+
+func (s *mockEventSender) Send(ctx context.Context, eventType logical.EventType, event *logical.EventData) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.events = append(s.events, eventType)
+	s.data = append(s.data, event)
+	return nil
+}
+
+func TestEvents(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("1f3b5d7f-9b1d-4f3b-8d7f-9b1d3f5b7d9f")
+	m.AddServer(&instance.Server)
+
+	sender := &mockEventSender{}
+	config := &logical.BackendConfig{
+		Logger: logging.NewVaultLogger(hclog.Trace),
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour * 12,
+			MaxLeaseTTLVal:     time.Hour * 24,
+		},
+		StorageView:  &logical.InmemStorage{},
+		EventsSender: sender,
+	}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("unable to create backend: %v", err)
+	}
+	storage := config.StorageView
+
+	requests := []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"auth_url":         m.AuthURL(),
+				"username":         "vault",
+				"password":         "secret",
+				"user_domain_name": "Default",
+				"project_id":       mockProjectID,
+			},
+		},
+		{
+			Operation: logical.CreateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"policies":     "test",
+				"metadata_key": "vault-role",
+				"auth_period":  120,
+				"auth_limit":   1,
+			},
+		},
+		newTestLoginRequest(storage, instance.ID, correctIPv4),
+		// denied: auth_limit exceeded
+		newTestLoginRequest(storage, instance.ID, correctIPv4),
+		{
+			Operation: logical.DeleteOperation,
+			Path:      "role/test",
+			Storage:   storage,
+		},
+	}
+
+	for _, req := range requests {
+		b.HandleRequest(context.Background(), req)
+	}
+
+	expected := []logical.EventType{
+		"openstack/config-write",
+		"openstack/role-write",
+		"openstack/login",
+		"openstack/login-denied",
+		"openstack/role-delete",
+	}
+	if !reflect.DeepEqual(sender.events, expected) {
+		t.Fatalf("unexpected events: %v", sender.events)
+	}
+
+	metadata := sender.data[3].Metadata.AsMap()
+	if metadata["instance_id"] != instance.ID || metadata["role"] != "test" || metadata["reason"] != ReasonAuthLimitExceeded {
+		t.Errorf("unexpected metadata of denied login: %v", metadata)
+	}
+}
@@ -0,0 +1,250 @@
+package plugin
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/scrypt"
+)
+
+// exportFormatVersion is the version of the format of the export document.
+const exportFormatVersion = 1
+
+const (
+	sealSaltSize = 16
+	sealKeySize  = 32
+)
+
+var errSealedSecrets = errors.New("failed to unseal secrets, the passphrase is wrong or the document was modified")
+
+// exportDocument is the state of the backend, exported to be imported to
+// another mount. The credentials of the config and the signing key of the
+// identity tokens are only included sealed with a passphrase.
+type exportDocument struct {
+	FormatVersion int                              `json:"format_version"`
+	SchemaVersion int                              `json:"schema_version"`
+	ExportedAt    time.Time                        `json:"exported_at"`
+	Config        *Config                          `json:"config,omitempty"`
+	Configs       map[string]*Config               `json:"configs,omitempty"`
+	Roles         map[string]*Role                 `json:"roles"`
+	Allowlist     map[string]*InstanceRegistration `json:"allowlist"`
+	Sealed        string                           `json:"sealed,omitempty"`
+}
+
+// exportSecrets are the secrets of the backend sealed in the export
+// document.
+type exportSecrets struct {
+	Config      configSecrets            `json:"config"`
+	Configs     map[string]configSecrets `json:"configs,omitempty"`
+	IdentityKey *identityKey             `json:"identity_key,omitempty"`
+}
+
+// configSecrets returns the sealed credentials of the config profile, or
+// of the default config for an empty name.
+func (s *exportSecrets) configSecrets(name string) configSecrets {
+	if name == "" {
+		return s.Config
+	}
+
+	return s.Configs[name]
+}
+
+// exportState returns the state of the backend. The secrets are sealed
+// with the passphrase, or left out without one.
+func exportState(ctx context.Context, s logical.Storage, passphrase string) (*exportDocument, error) {
+	stored, err := readSchemaVersion(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &exportDocument{
+		FormatVersion: exportFormatVersion,
+		SchemaVersion: baseSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Roles:         map[string]*Role{},
+		Allowlist:     map[string]*InstanceRegistration{},
+	}
+	if stored != nil {
+		doc.SchemaVersion = stored.Version
+	}
+
+	secrets := exportSecrets{}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		sanitized, configSecrets := config.withoutSecrets()
+		doc.Config = &sanitized
+		secrets.Config = configSecrets
+	}
+
+	profiles, err := s.List(ctx, "config/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range profiles {
+		config, err := readNamedConfig(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			continue
+		}
+
+		if doc.Configs == nil {
+			doc.Configs = map[string]*Config{}
+			secrets.Configs = map[string]configSecrets{}
+		}
+		sanitized, configSecrets := config.withoutSecrets()
+		doc.Configs[name] = &sanitized
+		secrets.Configs[name] = configSecrets
+	}
+
+	names, err := s.List(ctx, "role/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		role, err := readRole(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil {
+			doc.Roles[name] = role
+		}
+	}
+
+	ids, err := s.List(ctx, "instance_registration/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		registration, err := readInstanceRegistration(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if registration != nil && !registration.expired(time.Now()) {
+			doc.Allowlist[id] = registration
+		}
+	}
+
+	if passphrase == "" {
+		return doc, nil
+	}
+
+	entry, err := s.Get(ctx, identityKeyStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		secrets.IdentityKey = &identityKey{}
+		err = entry.DecodeJSON(secrets.IdentityKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Sealed, err = seal(passphrase, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// unsealSecrets returns the secrets sealed in the document.
+func (d *exportDocument) unsealSecrets(passphrase string) (*exportSecrets, error) {
+	plaintext, err := unseal(passphrase, d.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := &exportSecrets{}
+	err = json.Unmarshal(plaintext, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// sealKey derives the key of the passphrase with scrypt.
+func sealKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, sealKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with AES-GCM and a key derived from the
+// passphrase. The result holds the salt, the nonce and the ciphertext.
+func seal(passphrase string, plaintext []byte) (string, error) {
+	salt := make([]byte, sealSaltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := sealKey(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = aead.Seal(sealed, nonce, plaintext, []byte(fmt.Sprintf("v%d", exportFormatVersion)))
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func unseal(passphrase string, sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < sealSaltSize {
+		return nil, errSealedSecrets
+	}
+
+	aead, err := sealKey(passphrase, raw[:sealSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	raw = raw[sealSaltSize:]
+	if len(raw) < aead.NonceSize() {
+		return nil, errSealedSecrets
+	}
+
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(fmt.Sprintf("v%d", exportFormatVersion)))
+	if err != nil {
+		return nil, errSealedSecrets
+	}
+
+	return plaintext, nil
+}
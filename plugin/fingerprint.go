@@ -0,0 +1,20 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// fingerprint returns a short hash of the JSON encoding of the value, which
+// is used to tell the revisions of the config and the roles apart in the
+// logs and the metrics.
+func fingerprint(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:8])
+}
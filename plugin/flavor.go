@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// hasFlavorBinding returns whether the role is bound to flavors.
+func (r *Role) hasFlavorBinding() bool {
+	return len(r.BoundFlavorIDs) > 0 || len(r.BoundFlavorNames) > 0
+}
+
+// attestFlavor verifies that the instance was built on one of the flavors
+// bound to the role by their IDs or names.
+func (b *OpenStackAuthBackend) attestFlavor(ctx context.Context, s logical.Storage, role *Role, instance *Instance) (err error) {
+	if !role.hasFlavorBinding() {
+		return nil
+	}
+
+	// The compute API returns the ID of the flavor before microversion
+	// 2.47, and its name from then on.
+	id, _ := instance.Flavor["id"].(string)
+	name, _ := instance.Flavor["original_name"].(string)
+
+	if id != "" && strutil.StrListContains(role.BoundFlavorIDs, id) {
+		return nil
+	}
+
+	if name == "" && id != "" && len(role.BoundFlavorNames) > 0 {
+		client, err := b.getClient(ctx, s, role)
+		if err != nil {
+			return err
+		}
+
+		_, span := startSpan(ctx, "nova.flavors.get", attribute.String("openstack.flavor_id", id))
+		flavor, err := flavors.Get(client, id).Extract()
+		endSpan(span, err)
+
+		switch {
+		case errors.As(err, &gophercloud.ErrDefault404{}):
+		case err != nil:
+			return err
+		default:
+			name = flavor.Name
+		}
+	}
+
+	if name != "" && strutil.StrListContains(role.BoundFlavorNames, name) {
+		return nil
+	}
+
+	flavor := id
+	if name != "" {
+		flavor = name
+	}
+
+	return &AttestError{
+		Reason: ReasonFlavorMismatch,
+		Hint:   fmt.Sprintf("the instance was built on flavor '%s', launch it with one of the flavors bound to the role or update bound_flavor_ids or bound_flavor_names", flavor),
+		Err:    fmt.Errorf("flavor mismatched: %s is not bound to the role", flavor),
+	}
+}
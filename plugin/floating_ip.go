@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	networkports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// resolveFloatingIPs returns the instance with the floating IPs associated
+// with its ports, when the role resolves them and none of the request
+// addresses is an address of the instance. Nova may omit the floating IPs,
+// while the instances are often reached through them. The instance is
+// returned as is otherwise.
+func (b *OpenStackAuthBackend) resolveFloatingIPs(ctx context.Context, s logical.Storage, role *Role, instance *Instance, addrs []string) (resolved *Instance, err error) {
+	if !role.ResolveFloatingIPs || len(addrs) == 0 {
+		return instance, nil
+	}
+
+	if NewAttestor(s).AttestAddr(instance, addrs, role.AcceptedSourceCIDRs) == nil {
+		return instance, nil
+	}
+
+	client, err := b.getNetworkClient(ctx, s, role)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span := startSpan(ctx, "neutron.floatingips.list", attribute.String("openstack.instance_id", instance.ID))
+	defer func() { endSpan(span, err) }()
+
+	pages, err := networkports.List(client, networkports.ListOpts{DeviceID: instance.ID}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := networkports.ExtractPorts(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	floating := []string{}
+	for _, port := range ports {
+		pages, err := floatingips.List(client, floatingips.ListOpts{PortID: port.ID}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := floatingips.ExtractFloatingIPs(pages)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			floating = append(floating, ip.FloatingIP)
+		}
+	}
+
+	// The instance may be shared with concurrent lookups, so the floating
+	// IPs are set on a copy.
+	resolved = &Instance{}
+	*resolved = *instance
+	resolved.FloatingIPs = floating
+
+	return resolved, nil
+}
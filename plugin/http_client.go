@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultRequestTimeout is the timeout of the OpenStack API requests
+	// when the config doesn't set request_timeout.
+	defaultRequestTimeout = 30 * time.Second
+)
+
+// transport returns the transport of the OpenStack API requests, which
+// trusts the CA, presents the client certificate and goes through the
+// proxy of the config.
+func (c *Config) transport() (http.RoundTripper, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := c.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil && proxy == nil {
+		return http.DefaultTransport, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return transport, nil
+}
+
+// proxyURL returns the URL of the proxy of the OpenStack API requests, or
+// nil when the proxy is taken from the environment.
+func (c *Config) proxyURL() (*url.URL, error) {
+	if c.HTTPProxy == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(c.HTTPProxy)
+	if err != nil {
+		return nil, fmt.Errorf("http_proxy: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("http_proxy: unsupported scheme '%s'", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("http_proxy: host missing")
+	}
+
+	return u, nil
+}
+
+// requestTimeout returns the timeout of the OpenStack API requests.
+func (c *Config) requestTimeout() time.Duration {
+	if c.RequestTimeout == 0 {
+		return defaultRequestTimeout
+	}
+
+	return c.RequestTimeout
+}
+
+// maxRetries returns how many times a request rejected with an over-limit
+// status is retried. An explicit 0 disables the retries.
+func (c *Config) maxRetries() uint {
+	if c.MaxRetries == nil {
+		return maxBackoffRetries
+	}
+
+	return uint(*c.MaxRetries)
+}
+
+func (c *Config) validateHTTPClient() error {
+	errs := fieldErrors{}
+
+	_, err := c.proxyURL()
+	errs.addErr(err)
+
+	if c.RequestTimeout < 0 {
+		errs.add("request_timeout", "cannot be negative")
+	}
+
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		errs.add("max_retries", "cannot be negative")
+	}
+
+	return errs.err()
+}
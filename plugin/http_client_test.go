@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func writeTestConfig(t *testing.T, b logical.Backend, storage logical.Storage, data map[string]interface{}) {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	var requests int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+
+		r.RequestURI = ""
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+
+		for key, vals := range res.Header {
+			w.Header()[key] = vals
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	defer proxy.Close()
+
+	b, storage := newTestLoginBackend(t, m)
+	writeTestConfig(t, b, storage, map[string]interface{}{
+		"http_proxy": proxy.URL,
+	})
+
+	_, err := b.(*OpenStackAuthBackend).getClient(context.Background(), storage, &Role{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if atomic.LoadInt64(&requests) == 0 {
+		t.Errorf("requests did not go through the proxy")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer hang.Close()
+	defer close(done)
+
+	b, storage := newTestBackend(t)
+	writeTestConfig(t, b, storage, map[string]interface{}{
+		"auth_url":         hang.URL + "/v3",
+		"username":         "vault",
+		"password":         "secret",
+		"user_domain_name": "Default",
+		"project_id":       mockProjectID,
+		"request_timeout":  1,
+	})
+
+	start := time.Now()
+	_, err := b.(*OpenStackAuthBackend).getClient(context.Background(), storage, &Role{})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request did not time out: %s", elapsed)
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	var tests = []struct {
+		data    map[string]interface{}
+		retries uint
+	}{
+		{map[string]interface{}{}, maxBackoffRetries},
+		{map[string]interface{}{"max_retries": 5}, 5},
+		{map[string]interface{}{"max_retries": 0}, 0},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestBackend(t)
+
+		data := map[string]interface{}{
+			"auth_url":   "http://127.0.0.1/v3",
+			"token":      "token",
+			"project_id": mockProjectID,
+		}
+		for key, val := range test.data {
+			data[key] = val
+		}
+		writeTestConfig(t, b, storage, data)
+
+		config, err := readConfig(context.Background(), storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if retries := config.maxRetries(); retries != test.retries {
+			t.Errorf("unexpected retries: %v - %d", test.data, retries)
+		}
+	}
+}
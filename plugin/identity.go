@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/roles"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// identityCacheSize is the maximum number of cached Keystone lookups.
+	identityCacheSize = 4096
+
+	// identityCacheTTL is the duration to remember a Keystone lookup.
+	identityCacheTTL = 5 * time.Minute
+)
+
+// groupAliasPrefix is the prefix of the group aliases mapped from the
+// Keystone roles, followed by the project ID and the role name.
+const groupAliasPrefix = "os-project-"
+
+var errIdentityNotFound = errors.New("identity resource not found")
+
+// identityLookup returns the cached result of a Keystone lookup, calling
+// fetch on a cache miss. Failed lookups are not cached.
+func identityLookup[V any](b *OpenStackAuthBackend, key string, fetch func() (V, error)) (V, error) {
+	if val, ok := b.identityCache.Get(key); ok {
+		return val.(V), nil
+	}
+
+	val, err := fetch()
+	if err != nil {
+		return val, identityError(err)
+	}
+	b.identityCache.Add(key, val)
+
+	return val, nil
+}
+
+// getRoleAssignments returns the names of the roles effectively assigned
+// to the user on the project, including the roles inherited from groups.
+func (b *OpenStackAuthBackend) getRoleAssignments(ctx context.Context, s logical.Storage, r *Role, userID, projectID string) ([]string, error) {
+	client, err := b.getIdentityClient(ctx, s, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return identityLookup(b, fmt.Sprintf("assignments/%s/%s", userID, projectID), func() (names []string, err error) {
+		_, span := startSpan(ctx, "keystone.role_assignments.list", attribute.String("openstack.user_id", userID), attribute.String("openstack.project_id", projectID))
+		defer func() { endSpan(span, err) }()
+
+		effective := true
+		includeNames := true
+		pages, err := roles.ListAssignments(client, roles.ListAssignmentsOpts{
+			UserID:         userID,
+			ScopeProjectID: projectID,
+			Effective:      &effective,
+			IncludeNames:   &includeNames,
+		}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+
+		assignments, err := roles.ExtractRoleAssignments(pages)
+		if err != nil {
+			return nil, err
+		}
+
+		names = make([]string, 0, len(assignments))
+		for _, assignment := range assignments {
+			names = append(names, assignment.Role.Name)
+		}
+
+		return names, nil
+	})
+}
+
+// groupAliases returns the group aliases of the Keystone roles assigned to
+// the owner of the instance on the project of the instance, so that the
+// Vault group policies can mirror the OpenStack RBAC.
+func (b *OpenStackAuthBackend) groupAliases(ctx context.Context, s logical.Storage, role *Role, instance *Instance) ([]*logical.Alias, error) {
+	if !role.KeystoneGroupAliases || instance.UserID == "" {
+		return nil, nil
+	}
+
+	names, err := b.getRoleAssignments(ctx, s, role, instance.UserID, instance.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Roles inherited from several groups are listed once per assignment.
+	names = strutil.RemoveDuplicates(names, true)
+
+	aliases := make([]*logical.Alias, 0, len(names))
+	for _, name := range names {
+		aliases = append(aliases, &logical.Alias{Name: groupAliasName(instance.TenantID, name)})
+	}
+
+	return aliases, nil
+}
+
+// groupAliasName returns the name of the group alias of the Keystone role
+// on the project. The project ID keeps a role on one project from matching
+// the groups of the same role on the other projects.
+func groupAliasName(projectID, roleName string) string {
+	return groupAliasPrefix + projectID + "-" + roleName
+}
+
+// identityError maps the Keystone API errors to the errors of the backend.
+func identityError(err error) error {
+	switch {
+	case errors.As(err, &gophercloud.ErrDefault404{}):
+		return fmt.Errorf("%w: %v", errIdentityNotFound, err)
+	case errors.As(err, &gophercloud.ErrDefault401{}):
+		return fmt.Errorf("%w: %v", errUnauthorized, err)
+	case errors.As(err, &gophercloud.ErrDefault403{}):
+		return fmt.Errorf("%w: %v", errForbidden, err)
+	case errors.As(err, &gophercloud.ErrDefault429{}), errors.As(err, &gophercloud.ErrDefault503{}):
+		return fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// identityDocumentLeeway is the clock skew tolerated when the validity of
+// an identity document is verified.
+const identityDocumentLeeway = time.Minute
+
+const identityDocumentHint = "pass identity_document read from the vendordata of the instance, the document must be signed by one of identity_document_certificates or identity_document_secrets and not be expired"
+
+// identityDocument is a signed instance identity document. OpenStack has no
+// signed document of its own, so the document is a JWT issued by a dynamic
+// vendordata service of the cloud, with the instance ID as the subject.
+type identityDocument struct {
+	jwt.Claims
+	ProjectID string `json:"project_id,omitempty"`
+}
+
+// identityDocumentKeys returns the public keys of the certificates which
+// sign the identity documents.
+func (c *Config) identityDocumentKeys() ([]interface{}, error) {
+	keys := []interface{}{}
+	for i, data := range c.IdentityDocumentCertificates {
+		block, _ := pem.Decode([]byte(data))
+		if block == nil {
+			return nil, fmt.Errorf("certificate %d is not PEM encoded", i)
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %d is invalid: %w", i, err)
+		}
+
+		keys = append(keys, cert.PublicKey)
+	}
+
+	return keys, nil
+}
+
+func (c *Config) validateIdentityDocumentCertificates() error {
+	_, err := c.identityDocumentKeys()
+	if err != nil {
+		return fmt.Errorf("identity_document_certificates: %w", err)
+	}
+
+	return nil
+}
+
+// verifyIdentityDocument verifies the signature and the validity of the
+// identity document of the instance.
+func verifyIdentityDocument(keys []interface{}, token, instanceID string, now time.Time) (*identityDocument, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, &AttestError{Reason: ReasonIdentityDocumentInvalid, Hint: identityDocumentHint, Err: fmt.Errorf("malformed identity document: %w", err)}
+	}
+
+	var doc *identityDocument
+	for _, key := range keys {
+		claims := &identityDocument{}
+		if parsed.Claims(key, claims) == nil {
+			doc = claims
+			break
+		}
+	}
+	if doc == nil {
+		return nil, &AttestError{Reason: ReasonIdentityDocumentInvalid, Hint: identityDocumentHint, Err: errors.New("identity document signature is not trusted")}
+	}
+
+	if doc.Expiry == nil {
+		return nil, &AttestError{Reason: ReasonIdentityDocumentInvalid, Hint: identityDocumentHint, Err: errors.New("identity document has no expiry")}
+	}
+
+	err = doc.ValidateWithLeeway(jwt.Expected{Subject: instanceID, Time: now}, identityDocumentLeeway)
+	if err != nil {
+		return nil, &AttestError{Reason: ReasonIdentityDocumentInvalid, Hint: identityDocumentHint, Err: fmt.Errorf("invalid identity document: %w", err)}
+	}
+
+	return doc, nil
+}
+
+// VerifyIdentityDocument verifies the identity document passed with the
+// login, which then replaces the address check of the attestation.
+func (at *Attestor) VerifyIdentityDocument(keys []interface{}, token, instanceID string) {
+	at.identityDocument, at.identityDocumentErr = verifyIdentityDocument(keys, token, instanceID, time.Now())
+}
+
+// AttestIdentityDocument is used to attest the verified identity document
+// with the instance, when a document was passed or the role requires one.
+func (at *Attestor) AttestIdentityDocument(instance *Instance, role *Role) error {
+	if at.identityDocumentErr != nil {
+		return at.identityDocumentErr
+	}
+
+	doc := at.identityDocument
+	if doc == nil {
+		if role.RequireIdentityDocument {
+			return &AttestError{
+				Reason: ReasonIdentityDocumentInvalid,
+				Hint:   "the role requires a signed identity document, " + identityDocumentHint,
+				Err:    errors.New("identity document is missing"),
+			}
+		}
+		return nil
+	}
+
+	if doc.ProjectID != "" && doc.ProjectID != instance.TenantID {
+		return &AttestError{
+			Reason: ReasonIdentityDocumentInvalid,
+			Hint:   identityDocumentHint,
+			Err:    fmt.Errorf("identity document project mismatched: expected %s, got %s", instance.TenantID, doc.ProjectID),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// newTestDocumentSigner returns a signer of the identity documents and its
+// PEM encoded certificate.
+func newTestDocumentSigner(t *testing.T) (jose.Signer, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vendordata"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func signTestDocument(t *testing.T, signer jose.Signer, doc identityDocument) string {
+	token, err := jwt.Signed(signer).Claims(doc).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestLoginIdentityDocument(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("9d1f3b5d-7f9b-4d1f-8b5d-7f9b1d3f5b7d")
+	m.AddServer(&instance.Server)
+
+	signer, cert := newTestDocumentSigner(t)
+	untrusted, _ := newTestDocumentSigner(t)
+
+	now := time.Now()
+	valid := identityDocument{
+		Claims: jwt.Claims{
+			Subject:  instance.ID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		ProjectID: instance.TenantID,
+	}
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(now.Add(-5 * time.Minute))
+	otherInstance := valid
+	otherInstance.Subject = "0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c"
+	otherProject := valid
+	otherProject.ProjectID = "other"
+	noExpiry := valid
+	noExpiry.Expiry = nil
+
+	var tests = []struct {
+		document string
+		require  bool
+		status   int
+	}{
+		// the document replaces the address check
+		{signTestDocument(t, signer, valid), false, http.StatusOK},
+		{signTestDocument(t, signer, valid), true, http.StatusOK},
+		// fail: address mismatched without a document
+		{"", false, http.StatusForbidden},
+		// fail: the role requires a document
+		{"", true, http.StatusForbidden},
+		{"malformed", false, http.StatusForbidden},
+		{signTestDocument(t, untrusted, valid), false, http.StatusForbidden},
+		{signTestDocument(t, signer, expired), false, http.StatusForbidden},
+		{signTestDocument(t, signer, otherInstance), false, http.StatusForbidden},
+		{signTestDocument(t, signer, otherProject), false, http.StatusForbidden},
+		{signTestDocument(t, signer, noExpiry), false, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		for path, data := range map[string]map[string]interface{}{
+			"config":    {"identity_document_certificates": []string{cert}},
+			"role/test": {"require_identity_document": test.require},
+		} {
+			res, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      path,
+				Storage:   storage,
+				Data:      data,
+			})
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req := newTestLoginRequest(storage, instance.ID, wrongIPv4)
+		req.Data["identity_document"] = test.document
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+
+	// The documents are rejected without the certificates.
+	b, storage := newTestLoginBackend(t, m)
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	req.Data["identity_document"] = signTestDocument(t, signer, valid)
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadRequest {
+		t.Errorf("unexpected status: %d, %v - %v", status, res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"identity_document_certificates": []string{"invalid"}},
+	})
+	if err != nil || res == nil || !res.IsError() {
+		t.Errorf("invalid certificate was accepted: %v - %v", res, err)
+	}
+}
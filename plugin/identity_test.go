@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestIdentityLookups(t *testing.T) {
+	m := newMockOpenStack(t)
+	m.AddProject(mockProjectID, "test")
+	m.AddRoleAssignment("d6a3b8e4f1c24b7e9a1f2c3d4e5f6a7b", mockProjectID, "member")
+
+	b, storage := newTestLoginBackend(t, m)
+	backend := b.(*OpenStackAuthBackend)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		roles, err := backend.getRoleAssignments(ctx, storage, &Role{}, "d6a3b8e4f1c24b7e9a1f2c3d4e5f6a7b", mockProjectID)
+		if err != nil || len(roles) != 1 || roles[0] != "member" {
+			t.Fatalf("unexpected roles: %v - %v", roles, err)
+		}
+	}
+
+	if m.IdentityRequests() != 1 {
+		t.Errorf("lookups were not cached: %d identity requests", m.IdentityRequests())
+	}
+
+	err := identityError(gophercloud.ErrDefault404{})
+	if !errors.Is(err, errIdentityNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// identityKeyStorageKey is the storage key of the signing key of the
+// identity tokens.
+const identityKeyStorageKey = "identity/key"
+
+// identityTokenIssuer is the issuer of the identity tokens.
+const identityTokenIssuer = "vault-plugin-auth-openstack"
+
+var errNoIdentityKey = errors.New("identity token signing key is not generated")
+
+// identityKey is the key signing the identity tokens.
+type identityKey struct {
+	KeyID      string    `json:"key_id"`
+	PrivateKey []byte    `json:"private_key"`
+	Created    time.Time `json:"created"`
+}
+
+// identityClaims are the claims of the identity tokens in addition to the
+// registered claims.
+type identityClaims struct {
+	InstanceID string `json:"instance_id"`
+	ProjectID  string `json:"project_id"`
+	Role       string `json:"role"`
+	Region     string `json:"region,omitempty"`
+}
+
+// signer returns the signer of the key.
+func (k *identityKey) signer() (jose.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.ES256,
+		Key:       jose.JSONWebKey{Key: key, KeyID: k.KeyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+}
+
+// publicKey returns the public JSON web key of the key.
+func (k *identityKey) publicKey() (jose.JSONWebKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+
+	signer, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return jose.JSONWebKey{}, errors.New("identity key is not an ECDSA key")
+	}
+
+	return jose.JSONWebKey{
+		Key:       signer.Public(),
+		KeyID:     k.KeyID,
+		Algorithm: string(jose.ES256),
+		Use:       "sig",
+	}, nil
+}
+
+// getIdentityKey returns the cached signing key, reading it from the
+// storage when the cache is empty.
+func (b *OpenStackAuthBackend) getIdentityKey(ctx context.Context, s logical.Storage) (*identityKey, error) {
+	b.identityKeyMutex.RLock()
+	key := b.identityKey
+	b.identityKeyMutex.RUnlock()
+
+	if key != nil {
+		return key, nil
+	}
+
+	entry, err := s.Get(ctx, identityKeyStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, errNoIdentityKey
+	}
+
+	key = &identityKey{}
+	err = entry.DecodeJSON(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b.identityKeyMutex.Lock()
+	b.identityKey = key
+	b.identityKeyMutex.Unlock()
+
+	return key, nil
+}
+
+// ensureIdentityKey generates the signing key unless it exists. The key is
+// generated when a role enables the identity tokens, since the logins may
+// be served by the nodes which cannot write the storage.
+func (b *OpenStackAuthBackend) ensureIdentityKey(ctx context.Context, s logical.Storage) error {
+	_, err := b.getIdentityKey(ctx, s)
+	if !errors.Is(err, errNoIdentityKey) {
+		return err
+	}
+
+	b.identityKeyMutex.Lock()
+	defer b.identityKeyMutex.Unlock()
+
+	if b.identityKey != nil {
+		return nil
+	}
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	keyID, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	key := &identityKey{KeyID: keyID, PrivateKey: der, Created: time.Now()}
+
+	entry, err := logical.StorageEntryJSON(identityKeyStorageKey, key)
+	if err != nil {
+		return err
+	}
+
+	err = s.Put(ctx, entry)
+	if err != nil {
+		return err
+	}
+	b.identityKey = key
+
+	return nil
+}
+
+// identityToken returns the signed identity token of the attested instance.
+func (b *OpenStackAuthBackend) identityToken(ctx context.Context, s logical.Storage, config *Config, role *Role, roleName string, instance *Instance) (string, error) {
+	key, err := b.getIdentityKey(ctx, s)
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := key.signer()
+	if err != nil {
+		return "", err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.Claims{
+		ID:        id,
+		Issuer:    identityTokenIssuer,
+		Subject:   instance.ID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Expiry:    jwt.NewNumericDate(now.Add(role.IdentityTokenTTL)),
+	}
+	if role.IdentityTokenAudience != "" {
+		claims.Audience = jwt.Audience{role.IdentityTokenAudience}
+	}
+
+	return jwt.Signed(signer).Claims(claims).Claims(identityClaims{
+		InstanceID: instance.ID,
+		ProjectID:  instance.TenantID,
+		Role:       roleName,
+		Region:     role.region(config),
+	}).CompactSerialize()
+}
@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestLoginIdentityToken(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("3d5f7b9d-1f3b-4d5f-8b9d-1f3b5d7f9b1d")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"identity_token_ttl":      300,
+			"identity_token_audience": "inventory",
+		},
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	token, ok := res.Data["identity_token"].(string)
+	if !ok {
+		t.Fatalf("no identity token in response: %v", res.Data)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "identity/keys",
+		Storage:   storage,
+	})
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	keys := jose.JSONWebKeySet{}
+	err = json.Unmarshal(res.Data[logical.HTTPRawBody].([]byte), &keys)
+	if err != nil || len(keys.Keys) != 1 {
+		t.Fatalf("unexpected key set: %v - %v", keys, err)
+	}
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.Claims{}
+	custom := identityClaims{}
+	err = parsed.Claims(keys.Keys[0].Key, &claims, &custom)
+	if err != nil {
+		t.Fatalf("unable to verify identity token: %v", err)
+	}
+
+	err = claims.Validate(jwt.Expected{Issuer: identityTokenIssuer, Subject: instance.ID, Audience: jwt.Audience{"inventory"}, Time: time.Now()})
+	if err != nil {
+		t.Errorf("unexpected claims: %v", err)
+	}
+	if custom.InstanceID != instance.ID || custom.ProjectID != instance.TenantID || custom.Role != "test" {
+		t.Errorf("unexpected claims: %v", custom)
+	}
+	if ttl := claims.Expiry.Time().Sub(claims.IssuedAt.Time()); ttl != 300*time.Second {
+		t.Errorf("unexpected ttl: %v", ttl)
+	}
+}
+
+func TestLoginWithoutIdentityToken(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("5f7b9d1f-3b5d-4f7b-9d1f-3b5d7f9b1d3f")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	res, err := b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if _, ok := res.Data["identity_token"]; ok {
+		t.Errorf("unexpected identity token in response")
+	}
+}
@@ -0,0 +1,36 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// AttestImage is used to attest that the instance was booted from one of
+// the Glance images bound to the role.
+func (at *Attestor) AttestImage(instance *Instance, role *Role) error {
+	if len(role.BoundImageIDs) == 0 {
+		return nil
+	}
+
+	// The image of an instance booted from a volume is empty.
+	id, _ := instance.Image["id"].(string)
+	if id == "" {
+		return &AttestError{
+			Reason: ReasonImageMismatch,
+			Hint:   "the instance was booted from a volume, launch it from one of the images bound to the role",
+			Err:    errors.New("instance has no image"),
+		}
+	}
+
+	if !strutil.StrListContains(role.BoundImageIDs, id) {
+		return &AttestError{
+			Reason: ReasonImageMismatch,
+			Hint:   fmt.Sprintf("the instance was booted from image %s, launch it from one of the images bound to the role or update bound_image_ids", id),
+			Err:    fmt.Errorf("image mismatched: %s is not bound to the role", id),
+		}
+	}
+
+	return nil
+}
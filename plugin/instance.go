@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/go-uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	errInvalidInstanceID = errors.New("invalid instance ID")
+	errInstanceNotFound  = errors.New("instance not found")
+	errUnauthorized      = errors.New("openstack credentials were rejected")
+	errForbidden         = errors.New("openstack user is not permitted to read the instance")
+	errTooManyLookups    = errors.New("too many concurrent instance lookups")
+	errUnavailable       = errors.New("openstack compute API is unavailable")
+)
+
+// maxConcurrentLookups is the maximum number of distinct instance lookups
+// in flight. Lookups beyond the limit fail fast instead of piling up
+// goroutines and buffers while the compute API is slow.
+const maxConcurrentLookups = 256
+
+const (
+	// notFoundCacheSize is the maximum number of cached missing instances.
+	notFoundCacheSize = 4096
+
+	// notFoundCacheTTL is the duration to remember a missing instance.
+	notFoundCacheTTL = 10 * time.Second
+
+	// instanceCacheSize is the maximum number of cached instances.
+	instanceCacheSize = 4096
+
+	// defaultInstanceCacheTTL is the duration to reuse a looked up instance
+	// when the config doesn't set instance_cache_ttl.
+	defaultInstanceCacheTTL = 5 * time.Second
+
+	// maxInstanceCacheTTL is the longest instance_cache_ttl, since the
+	// cached instance is attested as if it was just looked up.
+	maxInstanceCacheTTL = time.Minute
+)
+
+// lookupOptions are the options of the instance lookups of the compute API.
+type lookupOptions struct {
+	// attempts is the number of attempts of a lookup failing with a
+	// transient error.
+	attempts int
+
+	// cacheTTL is the duration to reuse the instance, zero not to cache
+	// it.
+	cacheTTL time.Duration
+}
+
+// lookupOptions returns the options of the instance lookups of the role.
+// The instances of the roles with a nonce are not cached, since the nonce
+// is set in the metadata right before the login.
+func (c *Config) lookupOptions(role *Role) lookupOptions {
+	opts := lookupOptions{
+		attempts: c.lookupAttempts(),
+		cacheTTL: c.instanceCacheTTL(),
+	}
+
+	if role.NonceMetadataKey != "" {
+		opts.cacheTTL = 0
+	}
+
+	return opts
+}
+
+// Instance is an OpenStack instance to attest. It is the server returned by
+// the compute API with the attributes of the API extensions.
+type Instance struct {
+	servers.Server
+	availabilityzones.ServerAvailabilityZoneExt
+
+	// FloatingIPs are the floating IPs of the instance resolved with the
+	// networking API.
+	FloatingIPs []string `json:"-"`
+}
+
+// instanceCacheTTL returns the duration to reuse a looked up instance. An
+// explicit 0 disables the cache.
+func (c *Config) instanceCacheTTL() time.Duration {
+	if c.InstanceCacheTTL == nil {
+		return defaultInstanceCacheTTL
+	}
+
+	return *c.InstanceCacheTTL
+}
+
+// getInstance fetches the instance information from the compute API,
+// retrying on transient errors. Concurrent lookups of the same instance
+// with the same client share a single in-flight request, and the instance
+// is reused for the cache TTL, so the returned server must not be
+// modified.
+func (b *OpenStackAuthBackend) getInstance(ctx context.Context, client *gophercloud.ServiceClient, clientKey clientKey, instanceID string, opts lookupOptions) (*Instance, error) {
+	// The ID is always resolved with GET /servers/<uuid>. Anything else
+	// could address another resource such as /servers/detail.
+	if _, err := uuid.ParseUUID(instanceID); err != nil {
+		return nil, errInvalidInstanceID
+	}
+
+	key := instanceKey(clientKey, instanceID)
+
+	// Repeated lookups of a missing instance are answered from the cache
+	// so that enumerating random IDs doesn't hit the compute API.
+	if _, ok := b.notFoundCache.Get(key); ok {
+		return nil, errInstanceNotFound
+	}
+
+	// Bursts of logins of the same instance are answered from the cache
+	// so that they don't hit the rate limits of the compute API.
+	if opts.cacheTTL > 0 {
+		if instance, ok := b.instanceCache.Get(key); ok {
+			return instance, nil
+		}
+	}
+
+	val, err, _ := b.instanceGroup.Do(key, func() (interface{}, error) {
+		select {
+		case b.lookupSlots <- struct{}{}:
+			defer func() { <-b.lookupSlots }()
+		default:
+			metrics.IncrCounter([]string{"openstack", "lookup", "rejected"}, 1)
+			return nil, errTooManyLookups
+		}
+
+		instance := &Instance{}
+		err := retryTransient(ctx, opts.attempts, func() error {
+			_, span := startSpan(ctx, "nova.servers.get", attribute.String("openstack.instance_id", instanceID))
+			err := servers.Get(client, instanceID).ExtractInto(instance)
+			endSpan(span, err)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return instance, nil
+	})
+	if err != nil {
+		err = instanceError(err)
+		if errors.Is(err, errInstanceNotFound) {
+			b.notFoundCache.Add(key, struct{}{})
+		}
+		return nil, err
+	}
+
+	instance := val.(*Instance)
+	if opts.cacheTTL > 0 {
+		b.instanceCache.AddWithTTL(key, instance, opts.cacheTTL)
+	}
+
+	return instance, nil
+}
+
+// instanceKey returns the key of the instance in the caches. The instances
+// are cached per client since the clients of different projects see
+// different instances.
+func instanceKey(key clientKey, instanceID string) string {
+	return key.String() + "/" + instanceID
+}
+
+// instanceError maps the error returned by the compute API to one of the
+// internal errors so that permission problems are not reported as a
+// missing instance.
+func instanceError(err error) error {
+	switch {
+	case errors.As(err, &gophercloud.ErrDefault404{}):
+		return errInstanceNotFound
+	case errors.As(err, &gophercloud.ErrDefault401{}):
+		return fmt.Errorf("%w: %v", errUnauthorized, err)
+	case errors.As(err, &gophercloud.ErrDefault403{}):
+		return fmt.Errorf("%w: %v", errForbidden, err)
+	case errors.As(err, &gophercloud.ErrDefault429{}), errors.As(err, &gophercloud.ErrDefault503{}), errors.Is(err, errCircuitOpen):
+		return fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+
+	return err
+}
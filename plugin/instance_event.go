@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Events of the instance lifecycle received from the cloud notifications.
+const (
+	instanceEventCreated = "created"
+	instanceEventDeleted = "deleted"
+)
+
+// InstanceEvent is the last lifecycle event of an instance received from
+// the cloud notifications. It is kept until no token issued to the
+// instance can still be valid.
+type InstanceEvent struct {
+	Name       string    `json:"name" structs:"name" mapstructure:"name"`
+	Event      string    `json:"event" structs:"event" mapstructure:"event"`
+	ProjectID  string    `json:"project_id" structs:"project_id" mapstructure:"project_id"`
+	Time       time.Time `json:"time" structs:"time" mapstructure:"time"`
+	Expiration time.Time `json:"expiration" structs:"expiration" mapstructure:"expiration"`
+}
+
+// deletedInstanceStatuses are the statuses of the instances which are
+// being deleted or have been deleted.
+var deletedInstanceStatuses = []string{"DELETED", "SOFT_DELETED"}
+
+// instanceDeleted returns whether the instance has been deleted.
+func instanceDeleted(instance *Instance) bool {
+	return strutil.StrListContains(deletedInstanceStatuses, instance.Status)
+}
+
+func readInstanceEvent(ctx context.Context, s logical.Storage, name string) (*InstanceEvent, error) {
+	entry, err := s.Get(ctx, fmt.Sprintf("instance_event/%s", name))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	event := &InstanceEvent{}
+	err = entry.DecodeJSON(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func updateInstanceEvent(ctx context.Context, s logical.Storage, event *InstanceEvent) error {
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("instance_event/%s", event.Name), event)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func cleanupInstanceEvent(ctx context.Context, s logical.Storage) (sweepResult, error) {
+	result := sweepResult{}
+
+	keys, err := s.List(ctx, "instance_event/")
+	if err != nil {
+		return result, err
+	}
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		result.Scanned += 1
+
+		event, err := readInstanceEvent(ctx, s, key)
+		if err != nil {
+			return result, err
+		}
+
+		if event == nil {
+			continue
+		}
+
+		if time.Now().After(event.Expiration) {
+			err := s.Delete(ctx, fmt.Sprintf("instance_event/%s", key))
+			if err != nil {
+				return result, err
+			}
+			result.Deleted += 1
+		}
+	}
+
+	return result, nil
+}
+
+// withInstanceEvents wraps the lookup so that the instances reported as
+// deleted by the cloud notifications are not found, without asking the
+// API and even if the API still returns the instance while it is being
+// deleted.
+func withInstanceEvents(s logical.Storage, lookup lookupFunc) lookupFunc {
+	return func(ctx context.Context, instanceID string) (*Instance, error) {
+		// Malformed IDs are rejected by the lookup without the storage.
+		if _, err := uuid.ParseUUID(instanceID); err != nil {
+			return lookup(ctx, instanceID)
+		}
+
+		event, err := readInstanceEvent(ctx, s, instanceID)
+		if err != nil {
+			return nil, err
+		}
+
+		if event != nil && event.Event == instanceEventDeleted {
+			return nil, errInstanceNotFound
+		}
+
+		return lookup(ctx, instanceID)
+	}
+}
+
+// recordInstanceDeleted records the instance as deleted when a login or a
+// renewal finds it so, as the delete notification does, so that the logins
+// replayed with its ID are denied even if a stale server record is still
+// returned.
+func (b *OpenStackAuthBackend) recordInstanceDeleted(ctx context.Context, s logical.Storage, instanceID, projectID string) error {
+	existing, err := readInstanceEvent(ctx, s, instanceID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Event == instanceEventDeleted {
+		return nil
+	}
+
+	now := time.Now()
+	err = updateInstanceEvent(ctx, s, &InstanceEvent{
+		Name:       instanceID,
+		Event:      instanceEventDeleted,
+		ProjectID:  projectID,
+		Time:       now,
+		Expiration: now.Add(b.System().MaxLeaseTTL()),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.Logger().Info("instance recorded as deleted", "instance_id", instanceID, "project", projectID)
+
+	return nil
+}
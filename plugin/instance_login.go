@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// InstanceLogin is the login of an instance with a role disallowing the
+// reauthentication. It is kept until no token issued by the login can still
+// be valid, and the instance cannot log in again until then.
+type InstanceLogin struct {
+	Name       string    `json:"name" structs:"name" mapstructure:"name"`
+	Role       string    `json:"role" structs:"role" mapstructure:"role"`
+	Time       time.Time `json:"time" structs:"time" mapstructure:"time"`
+	Expiration time.Time `json:"expiration" structs:"expiration" mapstructure:"expiration"`
+}
+
+func readInstanceLogin(ctx context.Context, s logical.Storage, name string) (*InstanceLogin, error) {
+	entry, err := s.Get(ctx, fmt.Sprintf("instance_login/%s", name))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	login := &InstanceLogin{}
+	err = entry.DecodeJSON(login)
+	if err != nil {
+		return nil, err
+	}
+
+	return login, nil
+}
+
+func updateInstanceLogin(ctx context.Context, s logical.Storage, login *InstanceLogin) error {
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("instance_login/%s", login.Name), login)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func cleanupInstanceLogin(ctx context.Context, s logical.Storage) (sweepResult, error) {
+	result := sweepResult{}
+
+	keys, err := s.List(ctx, "instance_login/")
+	if err != nil {
+		return result, err
+	}
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		result.Scanned += 1
+
+		login, err := readInstanceLogin(ctx, s, key)
+		if err != nil {
+			return result, err
+		}
+
+		if login == nil {
+			continue
+		}
+
+		if time.Now().After(login.Expiration) {
+			err := s.Delete(ctx, fmt.Sprintf("instance_login/%s", key))
+			if err != nil {
+				return result, err
+			}
+			result.Deleted += 1
+		}
+	}
+
+	return result, nil
+}
+
+// AttestReauthentication is used to attest that the instance has not logged
+// in before, when the role disallows the reauthentication.
+func (at *Attestor) AttestReauthentication(instance *Instance, role *Role) error {
+	if !role.DisallowReauthentication {
+		return nil
+	}
+
+	login, err := readInstanceLogin(context.Background(), at.storage, instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if login != nil && time.Now().Before(login.Expiration) {
+		return &AttestError{
+			Reason: ReasonReauthenticationDisallowed,
+			Hint:   fmt.Sprintf("the instance logged in with role %s at %s and may log in only once, renew the token instead", login.Role, login.Time.UTC().Format(time.RFC3339)),
+			Err:    errors.New("instance has already logged in"),
+		}
+	}
+
+	return nil
+}
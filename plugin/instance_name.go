@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	errInstanceNameBinding   = errors.New("instance_name requires a cloud role bound to a project")
+	errInstanceNameAmbiguous = errors.New("instance name is not unique in the project")
+)
+
+// boundProjectID returns the ID of the project the role is bound to, or an
+// empty string if it is bound by the name only.
+func (r *Role) boundProjectID() string {
+	if r.ProjectID != "" {
+		return r.ProjectID
+	}
+
+	return r.TenantID
+}
+
+// findInstanceID resolves the name of an instance in the project of the
+// role to its ID. The name must be unique in the project, since the
+// instances of a project may share a name.
+func (b *OpenStackAuthBackend) findInstanceID(ctx context.Context, s logical.Storage, config *Config, role *Role, name string) (id string, err error) {
+	if role.ServerType != "" && role.ServerType != serverTypeCloud {
+		return "", errInstanceNameBinding
+	}
+
+	projectID := role.boundProjectID()
+	if projectID == "" && role.projectName() == "" {
+		return "", errInstanceNameBinding
+	}
+
+	client, err := b.getClient(ctx, s, role)
+	if err != nil {
+		return "", err
+	}
+
+	_, span := startSpan(ctx, "nova.servers.list", attribute.String("openstack.instance_name", name))
+	defer func() { endSpan(span, err) }()
+
+	// The name filter of the compute API is a regular expression.
+	opts := servers.ListOpts{Name: "^" + regexp.QuoteMeta(name) + "$"}
+	if config.AllTenants {
+		opts.AllTenants = true
+		opts.TenantID = projectID
+	}
+
+	pages, err := servers.List(client, opts).AllPages()
+	if err != nil {
+		return "", instanceError(err)
+	}
+
+	found, err := servers.ExtractServers(pages)
+	if err != nil {
+		return "", err
+	}
+
+	ids := []string{}
+	for _, server := range found {
+		if server.Name != name || (projectID != "" && server.TenantID != projectID) {
+			continue
+		}
+		ids = append(ids, server.ID)
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", errInstanceNotFound
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%w: %d instances are named %s", errInstanceNameAmbiguous, len(ids), name)
+	}
+}
@@ -0,0 +1,217 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// nonceTTL is the time an instance has to write an issued nonce into
+	// its metadata and log in.
+	nonceTTL = 5 * time.Minute
+
+	// maxInstanceNonces is the number of the nonces kept for an instance.
+	// Issuing more nonces drops the oldest ones, so that the nonces issued
+	// to someone else cannot be used to lock out the instance.
+	maxInstanceNonces = 4
+)
+
+// InstanceNonce holds the nonces issued to an instance. Only the hashes of
+// the nonces are stored.
+type InstanceNonce struct {
+	Name   string       `json:"name" structs:"name" mapstructure:"name"`
+	Nonces []nonceEntry `json:"nonces" structs:"nonces" mapstructure:"nonces"`
+}
+
+type nonceEntry struct {
+	Hash       string    `json:"hash" structs:"hash" mapstructure:"hash"`
+	Role       string    `json:"role" structs:"role" mapstructure:"role"`
+	Expiration time.Time `json:"expiration" structs:"expiration" mapstructure:"expiration"`
+}
+
+// prune drops the expired nonces.
+func (n *InstanceNonce) prune(now time.Time) {
+	nonces := []nonceEntry{}
+	for _, entry := range n.Nonces {
+		if now.Before(entry.Expiration) {
+			nonces = append(nonces, entry)
+		}
+	}
+
+	n.Nonces = nonces
+}
+
+// matches returns whether the value is an unexpired nonce issued for the
+// role.
+func (n *InstanceNonce) matches(value, roleName string, now time.Time) bool {
+	hash := nonceHash(value)
+
+	matched := false
+	for _, entry := range n.Nonces {
+		if entry.Role != roleName || !now.Before(entry.Expiration) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(entry.Hash), []byte(hash)) == 1 {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func nonceHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func readInstanceNonce(ctx context.Context, s logical.Storage, name string) (*InstanceNonce, error) {
+	entry, err := s.Get(ctx, fmt.Sprintf("instance_nonce/%s", name))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	nonce := &InstanceNonce{}
+	err = entry.DecodeJSON(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return nonce, nil
+}
+
+func updateInstanceNonce(ctx context.Context, s logical.Storage, nonce *InstanceNonce) error {
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("instance_nonce/%s", nonce.Name), nonce)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func deleteInstanceNonce(ctx context.Context, s logical.Storage, name string) error {
+	return s.Delete(ctx, fmt.Sprintf("instance_nonce/%s", name))
+}
+
+// issueInstanceNonce generates a nonce for the instance and the role, and
+// returns it with its expiration.
+func issueInstanceNonce(ctx context.Context, s logical.Storage, instanceID, roleName string) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(buf)
+
+	nonce, err := readInstanceNonce(ctx, s, instanceID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if nonce == nil {
+		nonce = &InstanceNonce{Name: instanceID}
+	}
+
+	now := time.Now()
+	expiration := now.Add(nonceTTL)
+
+	nonce.prune(now)
+	nonce.Nonces = append(nonce.Nonces, nonceEntry{
+		Hash:       nonceHash(value),
+		Role:       roleName,
+		Expiration: expiration,
+	})
+	if len(nonce.Nonces) > maxInstanceNonces {
+		nonce.Nonces = nonce.Nonces[len(nonce.Nonces)-maxInstanceNonces:]
+	}
+
+	err = updateInstanceNonce(ctx, s, nonce)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return value, expiration, nil
+}
+
+func cleanupInstanceNonce(ctx context.Context, s logical.Storage) (sweepResult, error) {
+	result := sweepResult{}
+
+	keys, err := s.List(ctx, "instance_nonce/")
+	if err != nil {
+		return result, err
+	}
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		result.Scanned += 1
+
+		nonce, err := readInstanceNonce(ctx, s, key)
+		if err != nil {
+			return result, err
+		}
+
+		if nonce == nil {
+			continue
+		}
+
+		nonce.prune(time.Now())
+		if len(nonce.Nonces) == 0 {
+			err := deleteInstanceNonce(ctx, s, key)
+			if err != nil {
+				return result, err
+			}
+			result.Deleted += 1
+		}
+	}
+
+	return result, nil
+}
+
+// AttestNonce is used to attest that the instance wrote a nonce issued for
+// the role into its metadata, when the role requires a nonce.
+func (at *Attestor) AttestNonce(instance *Instance, role *Role) error {
+	if role.NonceMetadataKey == "" {
+		return nil
+	}
+
+	hint := fmt.Sprintf("the role requires a nonce, request one with `vault write auth/<mount>/login/nonce instance_id=%s role=%s` and write it into the instance metadata key '%s' before it expires", instance.ID, role.Name, role.NonceMetadataKey)
+
+	value, ok := instance.Metadata[role.NonceMetadataKey]
+	if !ok || value == "" {
+		return &AttestError{
+			Reason: ReasonNonceMismatch,
+			Hint:   hint,
+			Err:    errors.New("nonce not found in instance metadata"),
+		}
+	}
+
+	nonce, err := readInstanceNonce(context.Background(), at.storage, instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if nonce == nil || !nonce.matches(value, role.Name, time.Now()) {
+		return &AttestError{
+			Reason: ReasonNonceMismatch,
+			Hint:   hint,
+			Err:    errors.New("nonce in instance metadata was not issued or has expired"),
+		}
+	}
+
+	return nil
+}
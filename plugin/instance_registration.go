@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// InstanceRegistration is an instance pre-registered by the provisioning
+// pipeline, which may log in with the roles requiring pre-registration.
+type InstanceRegistration struct {
+	Name       string    `json:"name" structs:"name" mapstructure:"name"`
+	Roles      []string  `json:"roles" structs:"roles" mapstructure:"roles"`
+	Created    time.Time `json:"created" structs:"created" mapstructure:"created"`
+	Expiration time.Time `json:"expiration" structs:"expiration" mapstructure:"expiration"`
+}
+
+// expired returns whether the registration has expired. A registration
+// without expiration never expires.
+func (r *InstanceRegistration) expired(now time.Time) bool {
+	return !r.Expiration.IsZero() && now.After(r.Expiration)
+}
+
+// allows returns whether the registration allows the role. A registration
+// without roles allows every role.
+func (r *InstanceRegistration) allows(roleName string) bool {
+	return len(r.Roles) == 0 || strutil.StrListContains(r.Roles, roleName)
+}
+
+func readInstanceRegistration(ctx context.Context, s logical.Storage, name string) (*InstanceRegistration, error) {
+	entry, err := s.Get(ctx, fmt.Sprintf("instance_registration/%s", name))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	registration := &InstanceRegistration{}
+	err = entry.DecodeJSON(registration)
+	if err != nil {
+		return nil, err
+	}
+
+	return registration, nil
+}
+
+func updateInstanceRegistration(ctx context.Context, s logical.Storage, registration *InstanceRegistration) error {
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("instance_registration/%s", registration.Name), registration)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func cleanupInstanceRegistration(ctx context.Context, s logical.Storage) (sweepResult, error) {
+	result := sweepResult{}
+
+	keys, err := s.List(ctx, "instance_registration/")
+	if err != nil {
+		return result, err
+	}
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		result.Scanned += 1
+
+		registration, err := readInstanceRegistration(ctx, s, key)
+		if err != nil {
+			return result, err
+		}
+
+		if registration == nil {
+			continue
+		}
+
+		if registration.expired(time.Now()) {
+			err := s.Delete(ctx, fmt.Sprintf("instance_registration/%s", key))
+			if err != nil {
+				return result, err
+			}
+			result.Deleted += 1
+		}
+	}
+
+	return result, nil
+}
+
+// AttestRegistration is used to attest that the instance was pre-registered
+// for the role, when the role requires pre-registration.
+func (at *Attestor) AttestRegistration(instance *Instance, role *Role) error {
+	if !role.RequirePreregistration {
+		return nil
+	}
+
+	registration, err := readInstanceRegistration(context.Background(), at.storage, instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if registration == nil || registration.expired(time.Now()) {
+		return &AttestError{
+			Reason: ReasonNotRegistered,
+			Hint:   fmt.Sprintf("the role requires pre-registration, register the instance with `vault write auth/<mount>/allowlist/instances/%s roles=%s`", instance.ID, role.Name),
+			Err:    errors.New("instance is not pre-registered"),
+		}
+	}
+
+	if !registration.allows(role.Name) {
+		return &AttestError{
+			Reason: ReasonNotRegistered,
+			Hint:   fmt.Sprintf("add %s to the roles of the registration of the instance", role.Name),
+			Err:    fmt.Errorf("instance is not pre-registered for role %s", role.Name),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// InstanceRevocation is an instance cut off by an operator, which may
+// neither log in nor renew its tokens until the revocation is removed.
+type InstanceRevocation struct {
+	Name    string    `json:"name" structs:"name" mapstructure:"name"`
+	Revoked time.Time `json:"revoked" structs:"revoked" mapstructure:"revoked"`
+}
+
+func readInstanceRevocation(ctx context.Context, s logical.Storage, name string) (*InstanceRevocation, error) {
+	entry, err := s.Get(ctx, fmt.Sprintf("instance_revocation/%s", name))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	revocation := &InstanceRevocation{}
+	err = entry.DecodeJSON(revocation)
+	if err != nil {
+		return nil, err
+	}
+
+	return revocation, nil
+}
+
+func updateInstanceRevocation(ctx context.Context, s logical.Storage, revocation *InstanceRevocation) error {
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("instance_revocation/%s", revocation.Name), revocation)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// AttestRevocation is used to attest that the instance was not revoked.
+func (at *Attestor) AttestRevocation(instance *Instance) error {
+	return attestNotRevoked(context.Background(), at.storage, instance.ID)
+}
+
+func attestNotRevoked(ctx context.Context, s logical.Storage, instanceID string) error {
+	revocation, err := readInstanceRevocation(ctx, s, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if revocation != nil {
+		return &AttestError{
+			Reason: ReasonInstanceRevoked,
+			Hint:   fmt.Sprintf("the instance was revoked at %s, remove the revocation with `vault delete auth/<mount>/revoke-instance/%s` once the instance is trusted again", revocation.Revoked.UTC().Format(time.RFC3339), instanceID),
+			Err:    errors.New("instance has been revoked"),
+		}
+	}
+
+	return nil
+}
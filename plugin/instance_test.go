@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestComputeClient(t *testing.T, handler http.HandlerFunc) *gophercloud.ServiceClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       server.URL + "/",
+	}
+}
+
+func TestGetInstanceSharesRequests(t *testing.T) {
+	var count int32
+
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"server": {"id": "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", "status": "ACTIVE"}}`)
+	})
+
+	b := NewBackend()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance, err := b.getInstance(context.Background(), client, clientKey{}, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", lookupOptions{attempts: 1})
+			if err != nil || instance.ID != "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5" {
+				t.Errorf("unexpected result: %v - %v", instance, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count != 1 {
+		t.Errorf("unexpected number of requests: %d", count)
+	}
+}
+
+func TestGetInstanceErrors(t *testing.T) {
+	var tests = []struct {
+		instanceID string
+		status     int
+		result     error
+	}{
+		{"ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", http.StatusNotFound, errInstanceNotFound},
+		{"ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", http.StatusUnauthorized, errUnauthorized},
+		{"ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", http.StatusForbidden, errForbidden},
+		{"detail", http.StatusOK, errInvalidInstanceID},
+		{"../flavors", http.StatusOK, errInvalidInstanceID},
+	}
+
+	for _, test := range tests {
+		var path string
+
+		client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.WriteHeader(test.status)
+		})
+
+		_, err := NewBackend().getInstance(context.Background(), client, clientKey{}, test.instanceID, lookupOptions{attempts: 1})
+		if !errors.Is(err, test.result) {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+
+		if path != "" && path != fmt.Sprintf("/servers/%s", test.instanceID) {
+			t.Errorf("unexpected request path: %s", path)
+		}
+	}
+}
+
+func TestGetInstanceLimitsLookups(t *testing.T) {
+	release := make(chan struct{})
+
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	b := NewBackend()
+	b.lookupSlots = make(chan struct{}, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := b.getInstance(context.Background(), client, clientKey{}, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", lookupOptions{attempts: 1})
+		done <- err
+	}()
+
+	for len(b.lookupSlots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := b.getInstance(context.Background(), client, clientKey{}, "0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c", lookupOptions{attempts: 1})
+	if !errors.Is(err, errTooManyLookups) {
+		t.Errorf("unexpected result: %v", err)
+	}
+
+	close(release)
+	if err := <-done; !errors.Is(err, errInstanceNotFound) {
+		t.Errorf("unexpected result: %v", err)
+	}
+}
+
+func TestGetInstanceCachesNotFound(t *testing.T) {
+	var count int32
+
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	b := NewBackend()
+
+	for i := 0; i < 3; i++ {
+		_, err := b.getInstance(context.Background(), client, clientKey{}, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", lookupOptions{attempts: 1})
+		if !errors.Is(err, errInstanceNotFound) {
+			t.Errorf("unexpected result: %v", err)
+		}
+	}
+
+	if count != 1 {
+		t.Errorf("unexpected number of requests: %d", count)
+	}
+}
+
+func TestGetInstanceCaches(t *testing.T) {
+	var tests = []struct {
+		ttl      time.Duration
+		requests int32
+	}{
+		{time.Minute, 1},
+		{0, 3},
+	}
+
+	for _, test := range tests {
+		var count int32
+
+		client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&count, 1)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"server": {"id": "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", "status": "ACTIVE"}}`)
+		})
+
+		b := NewBackend()
+
+		for i := 0; i < 3; i++ {
+			instance, err := b.getInstance(context.Background(), client, clientKey{}, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", lookupOptions{attempts: 1, cacheTTL: test.ttl})
+			if err != nil || instance.ID != "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5" {
+				t.Errorf("unexpected result: %v - %v", instance, err)
+			}
+		}
+
+		if count != test.requests {
+			t.Errorf("unexpected number of requests: %v - %d", test, count)
+		}
+	}
+}
+
+func TestInstanceCacheTTL(t *testing.T) {
+	var tests = []struct {
+		data map[string]interface{}
+		ttl  time.Duration
+	}{
+		{map[string]interface{}{}, defaultInstanceCacheTTL},
+		{map[string]interface{}{"instance_cache_ttl": 30}, 30 * time.Second},
+		{map[string]interface{}{"instance_cache_ttl": 0}, 0},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestBackend(t)
+
+		data := map[string]interface{}{
+			"auth_url":   "http://127.0.0.1/v3",
+			"token":      "token",
+			"project_id": mockProjectID,
+		}
+		for key, val := range test.data {
+			data[key] = val
+		}
+		writeTestConfig(t, b, storage, data)
+
+		config, err := readConfig(context.Background(), storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl := config.instanceCacheTTL(); ttl != test.ttl {
+			t.Errorf("unexpected cache TTL: %v - %s", test.data, ttl)
+		}
+	}
+}
+
+func TestGetInstanceRetries(t *testing.T) {
+	var tests = []struct {
+		statuses []int
+		attempts int
+		requests int32
+		result   bool
+	}{
+		{[]int{http.StatusServiceUnavailable, http.StatusBadGateway}, 3, 3, true},
+		// over-limit responses are retried by the provider client instead
+		{[]int{http.StatusTooManyRequests}, 3, 1, false},
+		{[]int{http.StatusInternalServerError, http.StatusInternalServerError}, 2, 2, false},
+		{[]int{http.StatusServiceUnavailable}, 1, 1, false},
+		// missing instances are not retried
+		{[]int{http.StatusNotFound}, 3, 1, false},
+	}
+
+	for _, test := range tests {
+		var count int32
+
+		client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&count, 1))
+			if n <= len(test.statuses) {
+				w.WriteHeader(test.statuses[n-1])
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"server": {"id": "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", "status": "ACTIVE"}}`)
+		})
+
+		_, err := NewBackend().getInstance(context.Background(), client, clientKey{}, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", lookupOptions{attempts: test.attempts})
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, err)
+		}
+
+		if count != test.requests {
+			t.Errorf("unexpected number of requests: %v - %d", test, count)
+		}
+	}
+}
+
+func TestGetInstanceTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	_, err := NewBackend().getInstance(context.Background(), client, clientKey{}, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", lookupOptions{attempts: 1})
+	if !errors.Is(err, errInstanceNotFound) {
+		t.Errorf("unexpected result: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "nova.servers.get" || spans[0].Status().Code != codes.Error {
+		t.Errorf("unexpected spans: %v", spans)
+	}
+}
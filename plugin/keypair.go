@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// AttestKeyName is used to attest that the instance was launched with one
+// of the key pairs bound to the role.
+func (at *Attestor) AttestKeyName(instance *Instance, role *Role) error {
+	if len(role.BoundKeyNames) == 0 {
+		return nil
+	}
+
+	if instance.KeyName == "" {
+		return &AttestError{
+			Reason: ReasonKeyNameMismatch,
+			Hint:   "the instance was launched without a key pair, launch it with one of the key pairs bound to the role",
+			Err:    errors.New("instance has no key pair"),
+		}
+	}
+
+	if !strutil.StrListContains(role.BoundKeyNames, instance.KeyName) {
+		return &AttestError{
+			Reason: ReasonKeyNameMismatch,
+			Hint:   fmt.Sprintf("the instance was launched with key pair '%s', launch it with one of the key pairs bound to the role or update bound_key_names", instance.KeyName),
+			Err:    fmt.Errorf("key pair mismatched: %s is not bound to the role", instance.KeyName),
+		}
+	}
+
+	return nil
+}
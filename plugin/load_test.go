@@ -0,0 +1,76 @@
+//go:build loadtest
+
+package plugin
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	loadInstances   = flag.Int("load.instances", 1000, "number of instances logging in")
+	loadLogins      = flag.Int("load.logins", 5, "number of concurrent logins per instance")
+	loadConcurrency = flag.Int("load.concurrency", 500, "number of concurrent login requests")
+)
+
+// TestLoginLoad drives concurrent logins against the mock OpenStack API
+// and reports the throughput and the number of upstream requests.
+func TestLoginLoad(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	ids := make([]string, *loadInstances)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("00000000-0000-4000-8000-%012d", i)
+		m.AddServer(&newTestLoginInstance(ids[i]).Server)
+	}
+
+	var success, failure int64
+	sem := make(chan struct{}, *loadConcurrency)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for _, id := range ids {
+		for i := 0; i < *loadLogins; i++ {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(id string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				res, err := b.HandleRequest(context.Background(), newTestLoginRequest(storage, id, correctIPv4))
+				switch requestOutcome(res, err) {
+				case outcomeSuccess:
+					atomic.AddInt64(&success, 1)
+				case outcomeDenied:
+					atomic.AddInt64(&failure, 1)
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := success + failure
+	t.Logf("logins: %d (success: %d, denied: %d)", total, success, failure)
+	t.Logf("elapsed: %s (%.0f logins/s)", elapsed, float64(total)/elapsed.Seconds())
+	t.Logf("upstream requests: auth %d, servers %d", m.AuthRequests(), m.ServerRequests())
+
+	if success == 0 {
+		t.Errorf("no login succeeded")
+	}
+	if success > int64(*loadInstances) {
+		t.Errorf("auth limit was exceeded: %d successful logins", success)
+	}
+	if m.AuthRequests() != 1 {
+		t.Errorf("unexpected number of auth requests: %d", m.AuthRequests())
+	}
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// logSampleWindow is the period in which identical log lines are
+	// emitted only once.
+	logSampleWindow = 1 * time.Minute
+
+	// logSamplerSize is the maximum number of tracked log lines.
+	logSamplerSize = 4096
+)
+
+// logSampler suppresses identical log lines, so that an instance retrying
+// a failing login every second doesn't flood the log.
+type logSampler struct {
+	window  time.Duration
+	mutex   sync.Mutex
+	entries *cache[*logSample]
+}
+
+type logSample struct {
+	start      time.Time
+	suppressed int
+}
+
+func newLogSampler(window time.Duration, size int) *logSampler {
+	return &logSampler{
+		window:  window,
+		entries: newCache[*logSample]("log_sampler", size, 2*window),
+	}
+}
+
+// Sample returns true if the log line identified by the key should be
+// emitted, along with the number of lines suppressed since the last one.
+func (s *logSampler) Sample(key string) (bool, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	sample, ok := s.entries.Get(key)
+	if !ok {
+		s.entries.Add(key, &logSample{start: now})
+		return true, 0
+	}
+
+	if now.Sub(sample.start) < s.window {
+		sample.suppressed += 1
+		return false, 0
+	}
+
+	suppressed := sample.suppressed
+	s.entries.Add(key, &logSample{start: now})
+
+	return true, suppressed
+}
+
+// Rollover returns the number of the lines suppressed by key in the windows
+// which have passed without another line being emitted, and forgets them,
+// so that the suppressed lines are reported even if the instance stopped
+// retrying.
+func (s *logSampler) Rollover() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	suppressed := map[string]int{}
+	s.entries.Range(func(key string, sample *logSample) {
+		if sample.suppressed > 0 && now.Sub(sample.start) >= s.window {
+			suppressed[key] = sample.suppressed
+		}
+	})
+
+	for key := range suppressed {
+		s.entries.Remove(key)
+	}
+
+	return suppressed
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestLogSampler(t *testing.T) {
+	s := newLogSampler(50*time.Millisecond, 10)
+
+	if ok, suppressed := s.Sample("a"); !ok || suppressed != 0 {
+		t.Errorf("unexpected result: %v, %d", ok, suppressed)
+	}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := s.Sample("a"); ok {
+			t.Errorf("log line was not suppressed")
+		}
+	}
+
+	if ok, _ := s.Sample("b"); !ok {
+		t.Errorf("log line of another key was suppressed")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if ok, suppressed := s.Sample("a"); !ok || suppressed != 3 {
+		t.Errorf("unexpected result: %v, %d", ok, suppressed)
+	}
+}
+
+func TestLogSamplerRollover(t *testing.T) {
+	s := newLogSampler(50*time.Millisecond, 10)
+
+	s.Sample("a")
+	s.Sample("a")
+	s.Sample("a")
+	s.Sample("b")
+
+	if suppressed := s.Rollover(); len(suppressed) != 0 {
+		t.Errorf("window was rolled over early: %v", suppressed)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	suppressed := s.Rollover()
+	if len(suppressed) != 1 || suppressed["a"] != 2 {
+		t.Errorf("unexpected suppressed lines: %v", suppressed)
+	}
+
+	if ok, suppressed := s.Sample("a"); !ok || suppressed != 0 {
+		t.Errorf("suppressed lines were reported twice: %v, %d", ok, suppressed)
+	}
+}
+
+func TestRejectedLookupsSampled(t *testing.T) {
+	b := NewBackend()
+
+	var buf bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{Output: &buf})
+
+	for _, instanceID := range []string{"ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", "4e6a8c0e-2a4c-4e6a-8c0e-2a4c6e8a0c2e"} {
+		for i := 0; i < 3; i++ {
+			_, err := b.instanceErrorResponse(logger, instanceID, errTooManyLookups)
+			if err == nil {
+				t.Fatalf("lookup was not rejected")
+			}
+		}
+	}
+
+	if count := strings.Count(buf.String(), "rejecting instance lookup"); count != 1 {
+		t.Errorf("unexpected number of log lines: %d", count)
+	}
+}
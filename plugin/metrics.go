@@ -0,0 +1,220 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Outcomes of the login and renewal requests.
+const (
+	outcomeSuccess = "success"
+	outcomeDenied  = "denied"
+	outcomeError   = "error"
+)
+
+// Reasons of the login denials other than the attestation failures.
+const (
+	reasonInvalidRequest   = "invalid_request"
+	reasonInvalidRole      = "invalid_role"
+	reasonInstanceNotFound = "instance_not_found"
+	reasonOther            = "other"
+)
+
+// Phases of a login measured by the latency breakdown.
+const (
+	phaseStorage  = "storage"
+	phaseKeystone = "keystone"
+	phaseNova     = "nova"
+	phaseAttest   = "attest"
+)
+
+// unknownRole is the role label of the logins with a role which does not
+// exist, so that the label values are not chosen by the unauthenticated
+// callers.
+const unknownRole = "unknown"
+
+// backendStats holds the internal counters of the backend which are
+// returned by the metrics endpoint.
+type backendStats struct {
+	mutex    sync.Mutex
+	logins   map[string]uint64
+	denials  map[string]uint64
+	renewals map[string]uint64
+}
+
+func newBackendStats() *backendStats {
+	return &backendStats{
+		logins:   map[string]uint64{},
+		denials:  map[string]uint64{},
+		renewals: map[string]uint64{},
+	}
+}
+
+func (s *backendStats) addLogin(outcome, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.logins[outcome] += 1
+	if reason != "" {
+		s.denials[reason] += 1
+	}
+}
+
+func (s *backendStats) addRenewal(outcome string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.renewals[outcome] += 1
+}
+
+// Snapshot returns a copy of the counters.
+func (s *backendStats) Snapshot() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return map[string]interface{}{
+		"logins":   copyCounters(s.logins),
+		"denials":  copyCounters(s.denials),
+		"renewals": copyCounters(s.renewals),
+	}
+}
+
+func copyCounters(counters map[string]uint64) map[string]uint64 {
+	copied := make(map[string]uint64, len(counters))
+	for key, val := range counters {
+		copied[key] = val
+	}
+
+	return copied
+}
+
+// requestOutcome classifies the result of a request handler. Errors
+// which deny the request or ask the client to back off are counted as
+// denials.
+func requestOutcome(res *logical.Response, err error) string {
+	var codedErr logical.HTTPCodedError
+	switch {
+	case errors.Is(err, logical.ErrPermissionDenied):
+		return outcomeDenied
+	case errors.As(err, &codedErr) && (codedErr.Code() == http.StatusForbidden || codedErr.Code() == http.StatusTooManyRequests):
+		return outcomeDenied
+	case err != nil:
+		return outcomeError
+	case res == nil || res.IsError():
+		return outcomeDenied
+	}
+
+	return outcomeSuccess
+}
+
+// recordLogin emits the counter of the login requests by role, outcome
+// and reason of the denial.
+func (b *OpenStackAuthBackend) recordLogin(roleName string, reason string, res *logical.Response, err error) {
+	outcome := requestOutcome(res, err)
+	if outcome != outcomeDenied {
+		reason = ""
+	} else if reason == "" {
+		reason = reasonOther
+	}
+
+	b.stats.addLogin(outcome, reason)
+	metrics.IncrCounterWithLabels([]string{"openstack", "login"}, 1, []metrics.Label{
+		{Name: "role", Value: roleName},
+		{Name: "outcome", Value: outcome},
+		{Name: "reason", Value: reason},
+	})
+}
+
+// measureLoginPhase emits the time spent in a phase of a login, so that
+// the time spent in Vault can be told apart from the time spent in the
+// OpenStack API.
+func measureLoginPhase(phase string, start time.Time) {
+	metrics.MeasureSinceWithLabels([]string{"openstack", "login", "phase"}, start, []metrics.Label{
+		{Name: "phase", Value: phase},
+	})
+}
+
+// measureAPICall emits the latency of an OpenStack API call by service,
+// operation and outcome, and counts the failed calls. The name of the call
+// is the name of its span, such as nova.servers.get.
+func measureAPICall(name string, start time.Time, err error) {
+	service, operation, ok := strings.Cut(name, ".")
+	if !ok {
+		service, operation = "other", name
+	}
+
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeError
+	}
+
+	labels := []metrics.Label{
+		{Name: "service", Value: service},
+		{Name: "operation", Value: operation},
+		{Name: "outcome", Value: outcome},
+	}
+	metrics.MeasureSinceWithLabels([]string{"openstack", "api", "call"}, start, labels)
+	if err != nil {
+		metrics.IncrCounterWithLabels([]string{"openstack", "api", "error"}, 1, labels[:2])
+	}
+}
+
+// recordRenew emits the counter of the token renewals by role and outcome.
+func (b *OpenStackAuthBackend) recordRenew(roleName string, res *logical.Response, err error) {
+	outcome := requestOutcome(res, err)
+
+	b.stats.addRenewal(outcome)
+	metrics.IncrCounterWithLabels([]string{"openstack", "renew"}, 1, []metrics.Label{
+		{Name: "role", Value: roleName},
+		{Name: "outcome", Value: outcome},
+	})
+}
+
+// recordChange logs, emits and publishes the revision of the config or a
+// role after it was changed, so that the changes of the login behavior can
+// be correlated with the administrative edits.
+func (b *OpenStackAuthBackend) recordChange(ctx context.Context, req *logical.Request, kind, name string, version int, fingerprint string) {
+	operation := string(req.Operation)
+
+	metrics.IncrCounterWithLabels([]string{"openstack", "change"}, 1, []metrics.Label{
+		{Name: "kind", Value: kind},
+		{Name: "name", Value: name},
+		{Name: "operation", Value: operation},
+	})
+	metrics.SetGaugeWithLabels([]string{"openstack", kind, "version"}, float32(version), []metrics.Label{
+		{Name: "name", Value: name},
+	})
+
+	b.requestLogger(req).Info("configuration changed", "kind", kind, "name", name, "operation", operation, "version", version, "fingerprint", fingerprint)
+
+	b.sendEvent(ctx, changeEventType(kind, req.Operation), map[string]interface{}{
+		"name":           name,
+		"path":           req.Path,
+		"version":        version,
+		"fingerprint":    fingerprint,
+		"mount_accessor": req.MountAccessor,
+	})
+}
+
+// recordSweep emits the duration and the number of scanned and deleted
+// records of a maintenance run.
+func (b *OpenStackAuthBackend) recordSweep(name string, start time.Time, result sweepResult, err error) {
+	labels := []metrics.Label{
+		{Name: "sweeper", Value: name},
+		{Name: "success", Value: strconv.FormatBool(err == nil)},
+	}
+
+	metrics.MeasureSinceWithLabels([]string{"openstack", "sweep", "duration"}, start, labels)
+	metrics.IncrCounterWithLabels([]string{"openstack", "sweep", "scanned"}, float32(result.Scanned), labels)
+	metrics.IncrCounterWithLabels([]string{"openstack", "sweep", "deleted"}, float32(result.Deleted), labels)
+
+	b.Logger().Debug("maintenance run finished", "sweeper", name, "duration", time.Since(start), "scanned", result.Scanned, "deleted", result.Deleted, "error", err)
+}
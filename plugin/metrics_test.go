@@ -0,0 +1,222 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func newTestMetricsSink(t *testing.T) *metrics.InmemSink {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+
+	conf := metrics.DefaultConfig("vault")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	metrics.NewGlobal(conf, sink)
+	t.Cleanup(func() {
+		metrics.NewGlobal(conf, &metrics.BlackholeSink{})
+	})
+
+	return sink
+}
+
+func counterValue(sink *metrics.InmemSink, prefix string) int {
+	count := 0
+	for _, interval := range sink.Data() {
+		interval.RLock()
+		for name, counter := range interval.Counters {
+			if len(name) >= len(prefix) && name[:len(prefix)] == prefix {
+				count += counter.Count
+			}
+		}
+		interval.RUnlock()
+	}
+
+	return count
+}
+
+func TestLoginMetrics(t *testing.T) {
+	sink := newTestMetricsSink(t)
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		addr   string
+		status int
+	}{
+		{wrongIPv4, http.StatusForbidden},
+		{correctIPv4, http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		// Denied logins are reported with an error and no response.
+		req := newTestLoginRequest(storage, instance.ID, test.addr)
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); res != nil || status != test.status {
+			t.Errorf("unexpected result: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	req.Data["role"] = "c7f1e2d3"
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || !res.IsError() {
+		t.Errorf("unexpected result of unknown role: %v - %v", res, err)
+	}
+
+	if count := counterValue(sink, "vault.openstack.login;role=test;outcome=denied;reason=addr_mismatch"); count != 1 {
+		t.Errorf("unexpected number of denied logins: %d", count)
+	}
+	if count := counterValue(sink, "vault.openstack.login;role=test;outcome=denied;reason=auth_limit_exceeded"); count != 1 {
+		t.Errorf("unexpected number of denied logins: %d", count)
+	}
+	// The roles which do not exist are not reported by name.
+	if count := counterValue(sink, "vault.openstack.login;role=unknown;outcome=denied;reason=invalid_role"); count != 1 {
+		t.Errorf("unexpected number of denied logins: %d", count)
+	}
+	if count := counterValue(sink, "vault.openstack.login;role=c7f1e2d3"); count != 0 {
+		t.Errorf("unexpected number of logins of unknown role: %d", count)
+	}
+}
+
+func sampleCount(sink *metrics.InmemSink, name string) int {
+	count := 0
+	for _, interval := range sink.Data() {
+		interval.RLock()
+		if sample, ok := interval.Samples[name]; ok {
+			count += sample.Count
+		}
+		interval.RUnlock()
+	}
+
+	return count
+}
+
+func TestLoginPhaseMetrics(t *testing.T) {
+	sink := newTestMetricsSink(t)
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	_, err := b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, phase := range []string{phaseStorage, phaseKeystone, phaseNova, phaseAttest} {
+		if count := sampleCount(sink, "vault.openstack.login.phase;phase="+phase); count != 1 {
+			t.Errorf("unexpected number of %s samples: %d", phase, count)
+		}
+	}
+}
+
+func TestAPICallMetrics(t *testing.T) {
+	sink := newTestMetricsSink(t)
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	for _, id := range []string{instance.ID, "0b1d3f5a-7c9e-4b1d-8f3a-5c7e9b1d3f5a"} {
+		// The login of the unknown instance fails, which is counted below.
+		b.HandleRequest(context.Background(), newTestLoginRequest(storage, id, correctIPv4))
+	}
+
+	if count := sampleCount(sink, "vault.openstack.api.call;service=nova;operation=servers.get;outcome=success"); count != 1 {
+		t.Errorf("unexpected number of successful calls: %d", count)
+	}
+	if count := sampleCount(sink, "vault.openstack.api.call;service=keystone;operation=authenticate;outcome=success"); count != 1 {
+		t.Errorf("unexpected number of authentications: %d", count)
+	}
+	if count := counterValue(sink, "vault.openstack.api.error;service=nova;operation=servers.get"); count != 1 {
+		t.Errorf("unexpected number of failed calls: %d", count)
+	}
+}
+
+func TestReadMetrics(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	for _, addr := range []string{correctIPv4, correctIPv4} {
+		// Denied logins are reported with an error, which is counted below.
+		b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, addr))
+	}
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "metrics",
+		Storage:   storage,
+	})
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	logins := res.Data["logins"].(map[string]uint64)
+	denials := res.Data["denials"].(map[string]uint64)
+	if logins[outcomeSuccess] != 1 || logins[outcomeDenied] != 1 || denials[ReasonAuthLimitExceeded] != 1 {
+		t.Errorf("unexpected metrics: %v", res.Data)
+	}
+}
+
+func TestChangeMetrics(t *testing.T) {
+	sink := newTestMetricsSink(t)
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	role, err := readRole(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fp := role.Fingerprint()
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data:      map[string]interface{}{"auth_limit": 1},
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	role, err = readRole(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if role.Version != 2 || role.Fingerprint() != fp {
+		t.Errorf("unexpected revision: %d, %s", role.Version, role.Fingerprint())
+	}
+
+	for _, name := range []string{
+		"vault.openstack.change;kind=config;name=config;operation=update",
+		"vault.openstack.change;kind=role;name=test;operation=create",
+		"vault.openstack.change;kind=role;name=test;operation=update",
+	} {
+		if count := counterValue(sink, name); count != 1 {
+			t.Errorf("unexpected number of changes: %s - %d", name, count)
+		}
+	}
+
+	config, err := readConfig(context.Background(), storage)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fp = config.Fingerprint()
+	config.Password = "rotated"
+	if config.Fingerprint() != fp {
+		t.Errorf("fingerprint depends on credentials")
+	}
+}
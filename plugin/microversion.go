@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// computeFeatureMicroversions are the compute API microversions which
+// return the instance fields used by the backend.
+var computeFeatureMicroversions = map[string]string{
+	"tags": "2.26",
+}
+
+// negotiateMicroversion returns the highest microversion needed by the
+// features which is supported by the compute API. The features the API
+// doesn't support are left out, and an empty version is returned when the
+// API doesn't support microversions at all, so that the lookups keep
+// working with the base version.
+func negotiateMicroversion(ctx context.Context, client *gophercloud.ServiceClient) (version string, unsupported []string, err error) {
+	_, span := startSpan(ctx, "nova.versions.get")
+	defer func() { endSpan(span, err) }()
+
+	var body struct {
+		Version struct {
+			MinVersion string `json:"min_version"`
+			Version    string `json:"version"`
+		} `json:"version"`
+	}
+	_, err = client.Get(client.Endpoint, &body, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	min, max := body.Version.MinVersion, body.Version.Version
+	for feature, required := range computeFeatureMicroversions {
+		if max == "" || compareMicroversions(required, min) < 0 || compareMicroversions(required, max) > 0 {
+			unsupported = append(unsupported, feature)
+			continue
+		}
+
+		if version == "" || compareMicroversions(required, version) > 0 {
+			version = required
+		}
+	}
+
+	sort.Strings(unsupported)
+
+	return version, unsupported, nil
+}
+
+// microversionPattern matches the compute API microversions.
+var microversionPattern = regexp.MustCompile(`^2\.[0-9]+$`)
+
+// validateComputeAPIMicroversion returns an error if the
+// compute_api_microversion of the config is neither a compute API
+// microversion nor latest.
+func (c *Config) validateComputeAPIMicroversion() error {
+	errs := fieldErrors{}
+
+	v := c.ComputeAPIMicroversion
+	if v != "" && v != "latest" && (!microversionPattern.MatchString(v) || compareMicroversions(v, "2.1") < 0) {
+		errs.add("compute_api_microversion", "must be a compute API microversion, such as 2.79, or latest")
+	}
+
+	return errs.err()
+}
+
+// compareMicroversions compares the microversions, which are compared by
+// the major and the minor version as numbers.
+func compareMicroversions(a, b string) int {
+	am, an := parseMicroversion(a)
+	bm, bn := parseMicroversion(b)
+
+	switch {
+	case am != bm:
+		return am - bm
+	default:
+		return an - bn
+	}
+}
+
+func parseMicroversion(v string) (major, minor int) {
+	parts := strings.SplitN(v, ".", 2)
+	major, _ = strconv.Atoi(parts[0])
+	if len(parts) == 2 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+
+	return major, minor
+}
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestNegotiateMicroversion(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	var tests = []struct {
+		available string
+		expected  string
+	}{
+		{"2.96", "2.26"},
+		{"2.26", "2.26"},
+		// tags are not supported
+		{"2.25", ""},
+		// version document is unavailable
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		m.SetComputeVersion(test.available)
+
+		b, storage := newTestLoginBackend(t, m)
+		client, err := b.(*OpenStackAuthBackend).getClient(context.Background(), storage, &Role{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if client.Microversion != test.expected {
+			t.Errorf("unexpected microversion: %v - %s", test, client.Microversion)
+		}
+	}
+}
+
+func TestConfiguredMicroversion(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	for _, version := range []string{"2.79", "latest"} {
+		b, storage := newTestLoginBackend(t, m)
+
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"compute_api_microversion": version,
+			},
+		})
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		client, err := b.(*OpenStackAuthBackend).getClient(context.Background(), storage, &Role{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if client.Microversion != version {
+			t.Errorf("unexpected microversion: %s - %s", version, client.Microversion)
+		}
+	}
+}
+
+func TestCompareMicroversions(t *testing.T) {
+	var tests = []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.26", "2.26", 0},
+		{"2.9", "2.26", -1},
+		{"2.100", "2.96", 1},
+		{"3.1", "2.96", 1},
+	}
+
+	for _, test := range tests {
+		result := compareMicroversions(test.a, test.b)
+		if (result < 0 && test.expected >= 0) || (result > 0 && test.expected <= 0) || (result == 0 && test.expected != 0) {
+			t.Errorf("unexpected result: %v - %d", test, result)
+		}
+	}
+}
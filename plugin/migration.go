@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// schemaVersionStorageKey is the storage key of the schema version of the
+// stored entries.
+const schemaVersionStorageKey = "schema_version"
+
+// baseSchemaVersion is the schema of the entries written before the schema
+// was versioned.
+const baseSchemaVersion = 1
+
+// migration upgrades the stored entries to a schema version. It returns the
+// number of the entries it rewrote, and must be safe to run again after a
+// partial run.
+type migration struct {
+	version int
+	name    string
+	run     func(ctx context.Context, s logical.Storage) (int, error)
+}
+
+// migrations is the list of the migrations in the order of the versions.
+// The entries of the base schema need no migration.
+var migrations = []migration{}
+
+// schemaVersion is the schema version of the stored entries.
+type schemaVersion struct {
+	Version    int       `json:"version"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// migrationResult is the result of a run of a migration.
+type migrationResult struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+}
+
+// currentSchemaVersion returns the schema version the backend writes.
+func currentSchemaVersion() int {
+	if len(migrations) == 0 {
+		return baseSchemaVersion
+	}
+
+	return migrations[len(migrations)-1].version
+}
+
+// readSchemaVersion returns the schema version of the stored entries. The
+// entries of a mount without a schema version are of the base schema.
+func readSchemaVersion(ctx context.Context, s logical.Storage) (*schemaVersion, error) {
+	entry, err := s.Get(ctx, schemaVersionStorageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	version := &schemaVersion{}
+	err = entry.DecodeJSON(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// pendingMigrations returns the migrations newer than the version.
+func pendingMigrations(version int) []migration {
+	pending := []migration{}
+	for _, m := range migrations {
+		if m.version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// migrate runs the pending migrations in order, storing the schema version
+// after each of them so that a failed run resumes from the failed one.
+func (b *OpenStackAuthBackend) migrate(ctx context.Context, s logical.Storage) ([]migrationResult, error) {
+	b.migrationMutex.Lock()
+	defer b.migrationMutex.Unlock()
+
+	stored, err := readSchemaVersion(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	version := baseSchemaVersion
+	if stored != nil {
+		version = stored.Version
+	}
+
+	if version > currentSchemaVersion() {
+		return nil, fmt.Errorf("schema version %d is newer than the supported version %d", version, currentSchemaVersion())
+	}
+
+	results := []migrationResult{}
+	for _, m := range pendingMigrations(version) {
+		start := time.Now()
+		entries, err := m.run(ctx, s)
+		if err != nil {
+			return results, fmt.Errorf("migration to schema version %d (%s) failed: %w", m.version, m.name, err)
+		}
+
+		err = writeSchemaVersion(ctx, s, m.version)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, migrationResult{Version: m.version, Name: m.name, Entries: entries})
+		b.Logger().Info("storage migrated", "version", m.version, "name", m.name, "entries", entries, "duration", time.Since(start))
+	}
+
+	if stored == nil && len(results) == 0 {
+		// Record the schema version of the mounts created before the
+		// schema was versioned.
+		err = writeSchemaVersion(ctx, s, baseSchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func writeSchemaVersion(ctx context.Context, s logical.Storage, version int) error {
+	entry, err := logical.StorageEntryJSON(schemaVersionStorageKey, &schemaVersion{
+		Version:    version,
+		MigratedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
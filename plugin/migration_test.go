@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestMigrate(t *testing.T) {
+	b, storage := newTestBackend(t)
+	ctx := context.Background()
+
+	runs := map[string]int{}
+	fail := true
+	defer func(m []migration) { migrations = m }(migrations)
+	migrations = []migration{
+		{version: 2, name: "first", run: func(ctx context.Context, s logical.Storage) (int, error) {
+			runs["first"]++
+			return 3, nil
+		}},
+		{version: 3, name: "second", run: func(ctx context.Context, s logical.Storage) (int, error) {
+			runs["second"]++
+			if fail {
+				return 0, errors.New("broken entry")
+			}
+			return 1, nil
+		}},
+	}
+
+	err := b.Initialize(ctx, &logical.InitializationRequest{Storage: storage})
+	if err == nil {
+		t.Fatal("expected migration error")
+	}
+
+	res, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "migrate",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["schema_version"] != 2 || res.Data["current_version"] != 3 {
+		t.Fatalf("unexpected versions: %v", res.Data)
+	}
+	if pending := res.Data["pending_migrations"].([]string); len(pending) != 1 || pending[0] != "second" {
+		t.Fatalf("unexpected pending migrations: %v", pending)
+	}
+
+	fail = false
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "migrate",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["from_version"] != 2 || res.Data["to_version"] != 3 {
+		t.Fatalf("unexpected versions: %v", res.Data)
+	}
+	results := res.Data["migrations"].([]migrationResult)
+	if len(results) != 1 || results[0].Name != "second" || results[0].Entries != 1 {
+		t.Fatalf("unexpected migrations: %v", results)
+	}
+	if runs["first"] != 1 || runs["second"] != 2 {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+
+	err = b.Initialize(ctx, &logical.InitializationRequest{Storage: storage})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runs["first"] != 1 || runs["second"] != 2 {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	b, storage := newTestBackend(t)
+	ctx := context.Background()
+
+	err := writeSchemaVersion(ctx, storage, currentSchemaVersion()+1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = b.Initialize(ctx, &logical.InitializationRequest{Storage: storage})
+	if err == nil {
+		t.Fatal("expected error for newer schema version")
+	}
+}
+
+func TestMigrateBaseSchema(t *testing.T) {
+	b, storage := newTestBackend(t)
+	ctx := context.Background()
+
+	err := b.Initialize(ctx, &logical.InitializationRequest{Storage: storage})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored, err := readSchemaVersion(ctx, storage)
+	if err != nil || stored == nil || stored.Version != baseSchemaVersion {
+		t.Fatalf("unexpected schema version: %v - %v", stored, err)
+	}
+}
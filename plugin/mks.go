@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// hasMKSBindings returns whether the role is bound to Selectel Managed
+// Kubernetes clusters or node groups.
+func (r *Role) hasMKSBindings() bool {
+	return len(r.BoundMKSClusterIDs) > 0 || len(r.BoundMKSNodeGroupIDs) > 0
+}
+
+// AttestMKS verifies that the instance is a worker node of one of the
+// Kubernetes clusters and node groups bound to the role. The cluster and
+// the node group of a node are read from the instance metadata with the
+// configured keys.
+func (at *Attestor) AttestMKS(instance *Instance, role *Role, clusterKey, nodeGroupKey string) error {
+	err := attestMKSBinding(instance, "cluster", role.BoundMKSClusterIDs, "mks_cluster_metadata_key", clusterKey)
+	if err != nil {
+		return err
+	}
+
+	return attestMKSBinding(instance, "node group", role.BoundMKSNodeGroupIDs, "mks_nodegroup_metadata_key", nodeGroupKey)
+}
+
+func attestMKSBinding(instance *Instance, kind string, bound []string, field, key string) error {
+	if len(bound) == 0 {
+		return nil
+	}
+
+	if key == "" {
+		return &AttestError{Reason: ReasonMKSMismatch, Hint: fmt.Sprintf("set %s in the config", field), Err: fmt.Errorf("%s is not configured", field)}
+	}
+
+	val, ok := instance.Metadata[key]
+	if !ok {
+		return &AttestError{
+			Reason: ReasonMKSMismatch,
+			Hint:   fmt.Sprintf("instance metadata key '%s' missing, check %s in the config", key, field),
+			Err:    fmt.Errorf("instance is not a node of a %s", kind),
+		}
+	}
+
+	if !strutil.StrListContains(bound, val) {
+		return &AttestError{Reason: ReasonMKSMismatch, Err: fmt.Errorf("%s mismatched: %s", kind, val)}
+	}
+
+	return nil
+}
+
+// attestBindings verifies the bindings of the role which are attested in
+// addition to the instance itself: the Heat stack, the server group, the
+// flavor, the Kubernetes clusters and the DNS zone.
+func (b *OpenStackAuthBackend) attestBindings(ctx context.Context, s logical.Storage, config *Config, role *Role, instance *Instance) error {
+	err := b.attestStack(ctx, s, role, instance)
+	if err != nil {
+		return err
+	}
+
+	err = b.attestServerGroup(ctx, s, config, role, instance)
+	if err != nil {
+		return err
+	}
+
+	err = b.attestFlavor(ctx, s, role, instance)
+	if err != nil {
+		return err
+	}
+
+	err = NewAttestor(s).AttestMKS(instance, role, config.MKSClusterMetadataKey, config.MKSNodeGroupMetadataKey)
+	if err != nil {
+		return err
+	}
+
+	return b.attestDNS(ctx, s, role, instance)
+}
@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/summerwind/vault-plugin-auth-openstack/internal/openstacktest"
+)
+
+// The tests of the package drive the backend against the fake cloud of
+// openstacktest under the names they have always used.
+const (
+	mockToken     = openstacktest.Token
+	mockProjectID = openstacktest.ProjectID
+	mockUserID    = openstacktest.UserID
+
+	mockFederatedToken = openstacktest.FederatedToken
+	mockAccessToken    = openstacktest.AccessToken
+	mockClientID       = openstacktest.ClientID
+	mockClientSecret   = openstacktest.ClientSecret
+	mockRegion         = openstacktest.Region
+
+	mockSelectelToken = openstacktest.SelectelToken
+)
+
+type (
+	mockOpenStack   = openstacktest.Server
+	mockStack       = openstacktest.Stack
+	mockNode        = openstacktest.Node
+	mockServerGroup = openstacktest.ServerGroup
+)
+
+func newMockOpenStack(t testing.TB) *mockOpenStack {
+	return openstacktest.NewServer(t)
+}
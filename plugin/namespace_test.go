@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// TestMultipleMounts verifies that the mounts of the plugin, such as the
+// mounts in different namespaces, share no state even in the same process.
+func TestMultipleMounts(t *testing.T) {
+	ctx := context.Background()
+
+	m1 := newMockOpenStack(t)
+	m2 := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("8b0d2f4a-6c8e-4a0c-9e2a-4c6e8a0c2e4a")
+	m1.AddServer(&instance.Server)
+
+	b1, storage1 := newTestLoginBackend(t, m1)
+	b2, storage2 := newTestLoginBackend(t, m2)
+
+	// The instance exists only in the cloud of the first mount.
+	req := newTestLoginRequest(storage2, instance.ID, correctIPv4)
+	res, err := b2.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Fatalf("unexpected status: %d, %v, %v", status, res, err)
+	}
+
+	// The instance cached as missing by the second mount is found by the
+	// first one.
+	req = newTestLoginRequest(storage1, instance.ID, correctIPv4)
+	res, err = b1.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %v, %v", status, res, err)
+	}
+
+	// The auth attempts are stored in the storage of each mount.
+	attempt, err := readAuthAttempt(ctx, storage1, instance.ID)
+	if err != nil || attempt == nil || attempt.Count != 1 {
+		t.Fatalf("unexpected attempt of first mount: %v - %v", attempt, err)
+	}
+	attempt, err = readAuthAttempt(ctx, storage2, instance.ID)
+	if err != nil || attempt != nil {
+		t.Fatalf("unexpected attempt of second mount: %v - %v", attempt, err)
+	}
+
+	// Invalidating the config of a mount keeps the client of the other.
+	backend1 := b1.(*OpenStackAuthBackend)
+	backend2 := b2.(*OpenStackAuthBackend)
+	if len(backend2.clients) == 0 {
+		t.Fatal("client of second mount was not built")
+	}
+	b1.InvalidateKey(ctx, "config")
+	if len(backend1.clients) != 0 {
+		t.Error("client of first mount was not reset")
+	}
+	if len(backend2.clients) == 0 {
+		t.Error("client of second mount was reset")
+	}
+	if backend2.notFoundCache.Len() != 1 || backend1.notFoundCache.Len() != 0 {
+		t.Errorf("unexpected not found caches: %d, %d", backend1.notFoundCache.Len(), backend2.notFoundCache.Len())
+	}
+
+	// The instance added to the cloud of the second mount is found once
+	// its notification is received.
+	m2.AddServer(&instance.Server)
+	res, err = b2.HandleRequest(ctx, newTestNotificationRequest(storage2, map[string]interface{}{
+		"event_type": "compute.instance.create.end",
+		"payload":    map[string]interface{}{"instance_id": instance.ID, "tenant_id": instance.TenantID},
+	}))
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	req = newTestLoginRequest(storage2, instance.ID, correctIPv4)
+	res, err = b2.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %v, %v", status, res, err)
+	}
+}
@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+const (
+	// authTypePassword authenticates with the credentials of a Keystone
+	// user, an application credential or a token.
+	authTypePassword = "password"
+
+	// authTypeOIDCPassword authenticates with a federated token obtained
+	// with the resource owner password grant of the identity provider.
+	authTypeOIDCPassword = "v3oidcpassword"
+
+	// authTypeOIDCClientCredentials authenticates with a federated token
+	// obtained with the client credentials grant of the identity provider.
+	authTypeOIDCClientCredentials = "v3oidcclientcredentials"
+
+	// defaultFederationProtocol is the federation protocol of Keystone
+	// used by default.
+	defaultFederationProtocol = "openid"
+
+	// defaultOIDCScope is the scope requested from the identity provider by
+	// default.
+	defaultOIDCScope = "openid"
+)
+
+var authTypes = []string{authTypePassword, authTypeOIDCPassword, authTypeOIDCClientCredentials}
+
+// federated returns whether the config authenticates through an external
+// identity provider.
+func (c *Config) federated() bool {
+	return c.AuthType == authTypeOIDCPassword || c.AuthType == authTypeOIDCClientCredentials
+}
+
+// validateAuthType verifies that the options of the auth type are set.
+func (c *Config) validateAuthType() error {
+	errs := fieldErrors{}
+
+	if c.AuthType != "" && !strutil.StrListContains(authTypes, c.AuthType) {
+		errs.add("auth_type", "must be one of %s", strings.Join(authTypes, ", "))
+	}
+
+	if !c.federated() {
+		return errs.err()
+	}
+
+	if c.IdentityProvider == "" {
+		errs.add("identity_provider", "is required with federated auth")
+	}
+	if c.ClientID == "" {
+		errs.add("client_id", "is required with federated auth")
+	}
+	if c.AccessTokenEndpoint == "" && c.DiscoveryEndpoint == "" {
+		errs.add("access_token_endpoint", "access_token_endpoint or discovery_endpoint is required with federated auth")
+	}
+	if c.AuthType == authTypeOIDCPassword && (c.Username == "" || c.Password == "") {
+		errs.add("username", "username and password are required with v3oidcpassword")
+	}
+	if c.ProjectID == "" && c.ProjectName == "" && c.TenantID == "" && c.TenantName == "" {
+		errs.add("project_id", "project_id or project_name is required with federated auth")
+	}
+	if c.TOTPSecret != "" {
+		errs.add("totp_secret", "cannot be used with federated auth")
+	}
+	if c.ApplicationCredentialID != "" {
+		errs.add("application_credential_id", "cannot be used with federated auth")
+	}
+
+	return errs.err()
+}
+
+// federatedToken returns an unscoped Keystone token of the federated user,
+// exchanged for an access token of the identity provider.
+func federatedToken(ctx context.Context, client *http.Client, config *Config) (string, error) {
+	accessToken, err := oidcAccessToken(ctx, client, config)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	protocol := config.FederationProtocol
+	if protocol == "" {
+		protocol = defaultFederationProtocol
+	}
+
+	endpoint := fmt.Sprintf("%s/OS-FEDERATION/identity_providers/%s/protocols/%s/auth",
+		strings.TrimSuffix(config.AuthURL, "/"), url.PathEscape(config.IdentityProvider), url.PathEscape(protocol))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("unexpected status from keystone federation: %d", res.StatusCode)
+	}
+
+	token := res.Header.Get("X-Subject-Token")
+	if token == "" {
+		return "", errors.New("keystone federation returned no token")
+	}
+
+	return token, nil
+}
+
+// oidcAccessToken returns an access token of the identity provider, with
+// the grant of the auth type.
+func oidcAccessToken(ctx context.Context, client *http.Client, config *Config) (string, error) {
+	endpoint := config.AccessTokenEndpoint
+	if endpoint == "" {
+		var err error
+		endpoint, err = oidcTokenEndpoint(ctx, client, config.DiscoveryEndpoint)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	scope := config.OIDCScope
+	if scope == "" {
+		scope = defaultOIDCScope
+	}
+
+	form := url.Values{"scope": {scope}}
+	if config.AuthType == authTypeOIDCPassword {
+		form.Set("grant_type", "password")
+		form.Set("username", config.Username)
+		form.Set("password", config.Password)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from identity provider: %d", res.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("identity provider returned no access token")
+	}
+
+	return body.AccessToken, nil
+}
+
+// oidcTokenEndpoint returns the token endpoint of the OpenID Connect
+// discovery document.
+func oidcTokenEndpoint(ctx context.Context, client *http.Client, discoveryEndpoint string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from discovery endpoint: %d", res.StatusCode)
+	}
+
+	var body struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	if body.TokenEndpoint == "" {
+		return "", errors.New("discovery document has no token_endpoint")
+	}
+
+	return body.TokenEndpoint, nil
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestConfigFederated(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("8b0d2f4a-6c8e-4a0b-9d2f-4b6d8f0a2c4e")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		config map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{
+			"auth_type":             "v3oidcclientcredentials",
+			"identity_provider":     "idp",
+			"client_id":             mockClientID,
+			"client_secret":         mockClientSecret,
+			"access_token_endpoint": m.IDPURL() + "/token",
+		}, http.StatusOK},
+		{map[string]interface{}{
+			"auth_type":          "v3oidcclientcredentials",
+			"identity_provider":  "idp",
+			"client_id":          mockClientID,
+			"client_secret":      mockClientSecret,
+			"discovery_endpoint": m.IDPURL() + "/.well-known/openid-configuration",
+		}, http.StatusOK},
+		{map[string]interface{}{
+			"auth_type":          "v3oidcpassword",
+			"identity_provider":  "idp",
+			"client_id":          mockClientID,
+			"client_secret":      mockClientSecret,
+			"discovery_endpoint": m.IDPURL() + "/.well-known/openid-configuration",
+			"username":           "alice",
+			"password":           "wonderland",
+		}, http.StatusOK},
+		// fail: wrong client secret
+		{map[string]interface{}{
+			"auth_type":             "v3oidcclientcredentials",
+			"identity_provider":     "idp",
+			"client_id":             mockClientID,
+			"client_secret":         "wrong",
+			"access_token_endpoint": m.IDPURL() + "/token",
+		}, http.StatusBadGateway},
+		// fail: unknown identity provider
+		{map[string]interface{}{
+			"auth_type":             "v3oidcclientcredentials",
+			"identity_provider":     "other",
+			"client_id":             mockClientID,
+			"client_secret":         mockClientSecret,
+			"access_token_endpoint": m.IDPURL() + "/token",
+		}, http.StatusBadGateway},
+		// fail: wrong password
+		{map[string]interface{}{
+			"auth_type":             "v3oidcpassword",
+			"identity_provider":     "idp",
+			"client_id":             mockClientID,
+			"client_secret":         mockClientSecret,
+			"access_token_endpoint": m.IDPURL() + "/token",
+			"username":              "alice",
+			"password":              "wrong",
+		}, http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      test.config,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test.config, status, res, err)
+		}
+	}
+}
+
+func TestConfigFederatedValidation(t *testing.T) {
+	var tests = []struct {
+		config *Config
+		valid  bool
+	}{
+		{&Config{}, true},
+		{&Config{AuthType: authTypePassword}, true},
+		{&Config{AuthType: authTypeOIDCClientCredentials, IdentityProvider: "idp", ClientID: "vault", AccessTokenEndpoint: "https://idp/token", ProjectID: mockProjectID}, true},
+		// fail: unknown auth type
+		{&Config{AuthType: "v3saml"}, false},
+		// fail: no identity provider
+		{&Config{AuthType: authTypeOIDCClientCredentials, ClientID: "vault", AccessTokenEndpoint: "https://idp/token", ProjectID: mockProjectID}, false},
+		// fail: no token endpoint
+		{&Config{AuthType: authTypeOIDCClientCredentials, IdentityProvider: "idp", ClientID: "vault", ProjectID: mockProjectID}, false},
+		// fail: no password
+		{&Config{AuthType: authTypeOIDCPassword, IdentityProvider: "idp", ClientID: "vault", AccessTokenEndpoint: "https://idp/token", Username: "alice", ProjectID: mockProjectID}, false},
+		// fail: no project to scope the federated token to
+		{&Config{AuthType: authTypeOIDCClientCredentials, IdentityProvider: "idp", ClientID: "vault", AccessTokenEndpoint: "https://idp/token"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.config.validateAuthType()
+		if (err == nil) != test.valid {
+			t.Errorf("unexpected result: %v - %v", test.config, err)
+		}
+	}
+}
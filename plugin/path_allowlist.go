@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const allowlistSynopsis = "Pre-registers an instance for the roles requiring pre-registration."
+const allowlistDescription = `
+Instances may only log in with the roles with require_preregistration set
+after they were registered here, usually by the provisioning pipeline which
+created them. The registration can be limited to some roles and can expire.
+`
+
+const allowlistListSynopsis = "Lists the pre-registered instances."
+const allowlistListDescription = `
+The list will contain the IDs of the pre-registered instances.
+`
+
+var allowlistFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+	"roles": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Names of the roles the instance may log in with. Defaults to all of the roles.",
+	},
+	"ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Duration after which the registration expires. The registration never expires if zero.",
+	},
+}
+
+func NewPathAllowlist(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("allowlist/instances/%s", framework.GenericNameRegex("instance_id")),
+			Fields:  allowlistFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readAllowlistHandler,
+					Summary:  "Read the registration of an instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"roles":      allowlistFields["roles"],
+							"created":    {Type: framework.TypeTime, Description: "Time the instance was registered."},
+							"expiration": {Type: framework.TypeTime, Description: "Time the registration expires, if any."},
+						}}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.updateAllowlistHandler,
+					Summary:   "Register an instance.",
+					Responses: noContentResponses,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.deleteAllowlistHandler,
+					Summary:   "Remove the registration of an instance.",
+					Responses: noContentResponses,
+				},
+			},
+			HelpSynopsis:    allowlistSynopsis,
+			HelpDescription: allowlistDescription,
+		},
+		{
+			Pattern: "allowlist/instances/?",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listAllowlistHandler,
+					Summary:  "List the pre-registered instances.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"keys": {Type: framework.TypeStringSlice, Description: "List of the instance IDs."},
+						}}},
+					},
+				},
+			},
+			HelpSynopsis:    allowlistListSynopsis,
+			HelpDescription: allowlistListDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) readAllowlistHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	registration, err := readInstanceRegistration(ctx, req.Storage, data.Get("instance_id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if registration == nil || registration.expired(time.Now()) {
+		return nil, nil
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"roles":   registration.Roles,
+			"created": registration.Created,
+		},
+	}
+	if !registration.Expiration.IsZero() {
+		res.Data["expiration"] = registration.Expiration
+	}
+
+	return res, nil
+}
+
+func (b *OpenStackAuthBackend) updateAllowlistHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+	if ttl < 0 {
+		return logical.ErrorResponse("ttl cannot be negative"), nil
+	}
+
+	now := time.Now()
+	registration := &InstanceRegistration{
+		Name:    data.Get("instance_id").(string),
+		Roles:   data.Get("roles").([]string),
+		Created: now,
+	}
+	if ttl > 0 {
+		registration.Expiration = now.Add(ttl)
+	}
+
+	err := updateInstanceRegistration(ctx, req.Storage, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *OpenStackAuthBackend) deleteAllowlistHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := req.Storage.Delete(ctx, fmt.Sprintf("instance_registration/%s", data.Get("instance_id").(string)))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *OpenStackAuthBackend) listAllowlistHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List(ctx, "instance_registration/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
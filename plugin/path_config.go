@@ -2,8 +2,13 @@ package plugin
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -26,6 +31,9 @@ var configFields map[string]*framework.FieldSchema = map[string]*framework.Field
 	"token": {
 		Type:        framework.TypeString,
 		Description: "Pre-generated authentication token.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
 	},
 	"user_id": {
 		Type:        framework.TypeString,
@@ -38,6 +46,9 @@ var configFields map[string]*framework.FieldSchema = map[string]*framework.Field
 	"password": {
 		Type:        framework.TypeString,
 		Description: "The password of the user.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
 	},
 	"project_id": {
 		Type:        framework.TypeString,
@@ -87,26 +98,343 @@ var configFields map[string]*framework.FieldSchema = map[string]*framework.Field
 		Type:        framework.TypeStringSlice,
 		Description: "List of header names which can be used to identify the address of the request in addition to the real remote address.",
 	},
+	"request_address_source": {
+		Type:        framework.TypeString,
+		Description: "Source of the request addresses verified against the instance. One of connection for the remote address of the connection, headers for request_address_headers, or both.",
+		Default:     addressSourceBoth,
+	},
+	"trusted_proxies": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of CIDR blocks of the proxies allowed to set request_address_headers. The headers of other connections are ignored. If empty, every connection may set the headers.",
+	},
+	"all_tenants": {
+		Type:        framework.TypeBool,
+		Description: "Look up instances across all projects. The user must have the admin or reader role. Role project bindings are verified against the instance instead of scoping the client.",
+	},
+	"audit_non_hmac_fields": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of the login fields to record in the token metadata, which is not HMAC'd in the audit log. Valid values are instance_id, role and request_addr.",
+	},
+	"alias_name": {
+		Type:        framework.TypeString,
+		Description: "Attribute the entity alias of the instances is named after. One of instance_id, project_id or role.",
+		Default:     aliasNameInstanceID,
+	},
+	"auth_attempt_cleanup_interval": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Minimum interval between the storage cleanups of the periodic function. Defaults to 0, which runs a cleanup on every call of the periodic function.",
+	},
+	"ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Default TTL of the tokens issued with the roles which do not set token_ttl.",
+	},
+	"max_ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Default maximum TTL of the tokens issued with the roles which do not set token_max_ttl.",
+	},
+	"period": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Default period of the tokens issued with the roles which do not set token_period.",
+	},
+	"cacert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded CA certificates to verify the certificates of the OpenStack endpoints with, instead of the system CAs.",
+	},
+	"insecure_skip_verify": {
+		Type:        framework.TypeBool,
+		Description: "Skip the verification of the certificates of the OpenStack endpoints. Only for testing.",
+	},
+	"client_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded client certificate presented to the OpenStack endpoints. Requires client_key.",
+	},
+	"client_key": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded private key of client_cert.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"http_proxy": {
+		Type:        framework.TypeString,
+		Description: "URL of the proxy of the OpenStack API requests. Defaults to the proxy of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.",
+	},
+	"request_timeout": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Timeout of each OpenStack API request. Defaults to 30 seconds.",
+	},
+	"max_retries": {
+		Type:        framework.TypeInt,
+		Description: "Number of retries of the OpenStack API requests rejected with an over-limit status. Defaults to 3, 0 disables the retries.",
+	},
+	"lookup_attempts": {
+		Type:        framework.TypeInt,
+		Description: "Number of attempts of an instance lookup failing with an over-limit or a server error status, or a dropped connection. Defaults to 3, 1 disables the retries.",
+	},
+	"instance_cache_ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Duration to reuse an instance looked up from the compute API for the logins of the same instance. Defaults to 5 seconds, at most 1 minute, 0 disables the cache. The instances of the roles with nonce_metadata_key are not cached.",
+	},
+	"compute_api_microversion": {
+		Type:        framework.TypeString,
+		Description: "Compute API microversion of the instance lookups, such as 2.79, or latest. Defaults to the lowest microversion returning the instance fields used by the plugin which the API supports.",
+	},
+	"selectel_api_url": {
+		Type:        framework.TypeString,
+		Description: "Endpoint URL of the Selectel cloud management API.",
+		Default:     defaultSelectelAPIURL,
+	},
+	"selectel_api_token": {
+		Type:        framework.TypeString,
+		Description: "Token of the Selectel cloud management API used to resolve project names to IDs across the account.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"selectel_servers_api_url": {
+		Type:        framework.TypeString,
+		Description: "Endpoint URL of the Selectel dedicated servers API.",
+		Default:     defaultSelectelServersAPIURL,
+	},
+	"totp_secret": {
+		Type:        framework.TypeString,
+		Description: "Base32 encoded TOTP secret of the user, for users that Keystone requires to authenticate with the password and a TOTP passcode.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"mks_cluster_metadata_key": {
+		Type:        framework.TypeString,
+		Description: "Key of the instance metadata holding the Selectel Managed Kubernetes cluster ID of a worker node.",
+	},
+	"mks_nodegroup_metadata_key": {
+		Type:        framework.TypeString,
+		Description: "Key of the instance metadata holding the Selectel Managed Kubernetes node group ID of a worker node.",
+	},
+	"application_credential_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the application credential to authenticate with instead of the user credentials. The client stays scoped to the project of the application credential.",
+	},
+	"application_credential_secret": {
+		Type:        framework.TypeString,
+		Description: "Secret of the application credential.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"auth_type": {
+		Type:        framework.TypeString,
+		Description: "Type of the authentication. One of password for the Keystone credentials, v3oidcpassword or v3oidcclientcredentials for the federated authentication with an OpenID Connect identity provider.",
+		Default:     authTypePassword,
+	},
+	"identity_provider": {
+		Type:        framework.TypeString,
+		Description: "Name of the identity provider registered in Keystone for the federated authentication.",
+	},
+	"protocol": {
+		Type:        framework.TypeString,
+		Description: "Federation protocol of the identity provider in Keystone.",
+		Default:     defaultFederationProtocol,
+	},
+	"client_id": {
+		Type:        framework.TypeString,
+		Description: "OpenID Connect client ID.",
+	},
+	"client_secret": {
+		Type:        framework.TypeString,
+		Description: "OpenID Connect client secret.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"discovery_endpoint": {
+		Type:        framework.TypeString,
+		Description: "URL of the OpenID Connect discovery document of the identity provider, used to find the token endpoint.",
+	},
+	"access_token_endpoint": {
+		Type:        framework.TypeString,
+		Description: "URL of the token endpoint of the identity provider. Takes precedence over discovery_endpoint.",
+	},
+	"openid_scope": {
+		Type:        framework.TypeString,
+		Description: "Scope requested from the identity provider.",
+		Default:     defaultOIDCScope,
+	},
+	"warm_up_client": {
+		Type:        framework.TypeBool,
+		Description: "Build the OpenStack client when the backend is initialized or configured instead of on the first login.",
+	},
+	"identity_document_certificates": {
+		Type:        framework.TypeStringSlice,
+		Description: "PEM encoded certificates which sign the instance identity documents.",
+	},
 }
 
+// configResponseFields is the schema of the config read response. The
+// credentials are never returned, only the names of those which are set.
+var configResponseFields map[string]*framework.FieldSchema = responseFields(configFields, map[string]*framework.FieldSchema{
+	"version": {
+		Type:        framework.TypeInt,
+		Description: "Version of the config, incremented on every write.",
+	},
+	"auth_method": {
+		Type:        framework.TypeString,
+		Description: "How the config authenticates to Keystone. One of password, totp, token, application_credential, v3oidcpassword or v3oidcclientcredentials.",
+	},
+	"configured_secrets": {
+		Type:        framework.TypeStringSlice,
+		Description: "Names of the credential fields which are set. Their values are never returned.",
+	},
+}, "token", "password", "selectel_api_token", "totp_secret", "application_credential_secret", "client_secret", "client_key")
+
+const configProfileSynopsis = "Configures a named profile of the OpenStack API information."
+const configProfileDescription = `
+A config profile holds another set of the OpenStack API information, such
+as the credentials of another region or Selectel project, in the same mount.
+A role looks up the instances with the profile named in its config field
+instead of the config of the backend. The profiles take the same fields as
+the config, and a profile used by a role cannot be deleted.
+`
+
+const configExistsSynopsis = "Checks whether the config exists."
+const configExistsDescription = `
+Returns whether the config, or the config profile given by name, exists and
+how it authenticates, without returning the config itself.
+`
+
+const configProfileListSynopsis = "Lists the config profiles."
+const configProfileListDescription = `
+The list will contain the names of the config profiles.
+`
+
+// configProfileFields is the schema of the config profiles, which are named
+// in the path.
+var configProfileFields map[string]*framework.FieldSchema = func() map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeString,
+			Description: "Name of the config profile.",
+		},
+	}
+	for name, field := range configFields {
+		fields[name] = field
+	}
+
+	return fields
+}()
+
 func NewPathConfig(b *OpenStackAuthBackend) []*framework.Path {
 	return []*framework.Path{
 		&framework.Path{
 			Pattern: "config",
 			Fields:  configFields,
-			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.updateConfigHandler,
-				logical.ReadOperation:   b.readConfigHandler,
-				logical.UpdateOperation: b.updateConfigHandler,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback:  b.updateConfigHandler,
+					Summary:   "Configure the access to the OpenStack API.",
+					Responses: noContentResponses,
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readConfigHandler,
+					Summary:  "Read the configuration of the access to the OpenStack API.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: configResponseFields}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.updateConfigHandler,
+					Summary:   "Configure the access to the OpenStack API.",
+					Responses: noContentResponses,
+				},
 			},
 			HelpSynopsis:    configSynopsis,
 			HelpDescription: configDescription,
 		},
+		&framework.Path{
+			Pattern: "config/exists$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the config profile. Defaults to the config of the backend.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.configExistsHandler,
+					Summary:  "Check whether the config exists.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"exists":      {Type: framework.TypeBool, Description: "Whether the config exists."},
+							"auth_method": {Type: framework.TypeString, Description: "How the config authenticates to Keystone."},
+						}}},
+					},
+				},
+			},
+			HelpSynopsis:    configExistsSynopsis,
+			HelpDescription: configExistsDescription,
+		},
+		&framework.Path{
+			Pattern: fmt.Sprintf("config/%s", framework.GenericNameRegex("name")),
+			Fields:  configProfileFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback:  b.updateConfigHandler,
+					Summary:   "Configure a profile of the access to the OpenStack API.",
+					Responses: noContentResponses,
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readConfigHandler,
+					Summary:  "Read a profile of the access to the OpenStack API.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: configResponseFields}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.updateConfigHandler,
+					Summary:   "Configure a profile of the access to the OpenStack API.",
+					Responses: noContentResponses,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.deleteConfigHandler,
+					Summary:   "Delete a profile of the access to the OpenStack API.",
+					Responses: noContentResponses,
+				},
+			},
+			HelpSynopsis:    configProfileSynopsis,
+			HelpDescription: configProfileDescription,
+		},
+		&framework.Path{
+			Pattern: "config/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listConfigHandler,
+					Summary:  "List the config profiles.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"keys": {Type: framework.TypeStringSlice, Description: "List of the config profile names."},
+						}}},
+					},
+				},
+			},
+			HelpSynopsis:    configProfileListSynopsis,
+			HelpDescription: configProfileListDescription,
+		},
+	}
+}
+
+// configName returns the name of the config profile of the request, which
+// is empty for the default config.
+func configName(data *framework.FieldData) string {
+	name, ok := data.GetOk("name")
+	if !ok {
+		return ""
 	}
+
+	return name.(string)
 }
 
 func (b *OpenStackAuthBackend) readConfigHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := readConfig(ctx, req.Storage)
+	config, err := readNamedConfig(ctx, req.Storage, configName(data))
 	if err != nil {
 		return nil, err
 	}
@@ -115,26 +443,82 @@ func (b *OpenStackAuthBackend) readConfigHandler(ctx context.Context, req *logic
 		return nil, nil
 	}
 
+	_, secrets := config.withoutSecrets()
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"auth_method":                    config.authMethod(),
+			"configured_secrets":             secrets.names(),
+			"auth_url":                       config.AuthURL,
+			"availability":                   config.Availability,
+			"user_id":                        config.UserID,
+			"username":                       config.Username,
+			"project_id":                     config.ProjectID,
+			"project_name":                   config.ProjectName,
+			"tenant_id":                      config.TenantID,
+			"tenant_name":                    config.TenantName,
+			"user_domain_id":                 config.UserDomainID,
+			"user_domain_name":               config.UserDomainName,
+			"project_domain_id":              config.ProjectDomainID,
+			"project_domain_name":            config.ProjectDomainName,
+			"domain_id":                      config.DomainID,
+			"domain_name":                    config.DomainName,
+			"region_name":                    config.RegionName,
+			"request_address_headers":        config.RequestAddressHeaders,
+			"request_address_source":         config.addressSource(),
+			"trusted_proxies":                config.TrustedProxies,
+			"warm_up_client":                 config.WarmUpClient,
+			"all_tenants":                    config.AllTenants,
+			"audit_non_hmac_fields":          config.AuditNonHMACFields,
+			"alias_name":                     config.AliasName,
+			"auth_attempt_cleanup_interval":  int64(config.AuthAttemptCleanupInterval.Seconds()),
+			"ttl":                            int64(config.TTL.Seconds()),
+			"max_ttl":                        int64(config.MaxTTL.Seconds()),
+			"period":                         int64(config.Period.Seconds()),
+			"cacert":                         config.CACert,
+			"insecure_skip_verify":           config.InsecureSkipVerify,
+			"client_cert":                    config.ClientCert,
+			"http_proxy":                     config.HTTPProxy,
+			"request_timeout":                int64(config.requestTimeout().Seconds()),
+			"max_retries":                    config.maxRetries(),
+			"lookup_attempts":                config.lookupAttempts(),
+			"instance_cache_ttl":             int64(config.instanceCacheTTL().Seconds()),
+			"compute_api_microversion":       config.ComputeAPIMicroversion,
+			"selectel_api_url":               config.SelectelAPIURL,
+			"selectel_servers_api_url":       config.SelectelServersAPIURL,
+			"mks_cluster_metadata_key":       config.MKSClusterMetadataKey,
+			"mks_nodegroup_metadata_key":     config.MKSNodeGroupMetadataKey,
+			"application_credential_id":      config.ApplicationCredentialID,
+			"auth_type":                      config.AuthType,
+			"identity_provider":              config.IdentityProvider,
+			"protocol":                       config.FederationProtocol,
+			"client_id":                      config.ClientID,
+			"discovery_endpoint":             config.DiscoveryEndpoint,
+			"access_token_endpoint":          config.AccessTokenEndpoint,
+			"openid_scope":                   config.OIDCScope,
+			"identity_document_certificates": config.IdentityDocumentCertificates,
+			"version":                        config.Version,
+		},
+	}
+
+	return res, nil
+}
+
+func (b *OpenStackAuthBackend) configExistsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readNamedConfig(ctx, req.Storage, configName(data))
+	if err != nil {
+		return nil, err
+	}
+
 	res := &logical.Response{
 		Data: map[string]interface{}{
-			"auth_url":                config.AuthURL,
-			"availability":            config.Availability,
-			"user_id":                 config.UserID,
-			"username":                config.Username,
-			"project_id":              config.ProjectID,
-			"project_name":            config.ProjectName,
-			"tenant_id":               config.TenantID,
-			"tenant_name":             config.TenantName,
-			"user_domain_id":          config.UserDomainID,
-			"user_domain_name":        config.UserDomainName,
-			"project_domain_id":       config.ProjectDomainID,
-			"project_domain_name":     config.ProjectDomainName,
-			"domain_id":               config.DomainID,
-			"domain_name":             config.DomainName,
-			"region_name":             config.RegionName,
-			"request_address_headers": config.RequestAddressHeaders,
+			"exists":      config != nil,
+			"auth_method": "",
 		},
 	}
+	if config != nil {
+		res.Data["auth_method"] = config.authMethod()
+	}
 
 	return res, nil
 }
@@ -143,7 +527,12 @@ func (b *OpenStackAuthBackend) updateConfigHandler(ctx context.Context, req *log
 	var val interface{}
 	var ok bool
 
-	config, err := readConfig(ctx, req.Storage)
+	name := configName(data)
+	if strutil.StrListContains(reservedConfigNames, name) {
+		return logical.ErrorResponse(fmt.Sprintf("config profile name %s is reserved", name)), nil
+	}
+
+	config, err := readNamedConfig(ctx, req.Storage, name)
 	if err != nil {
 		return nil, err
 	}
@@ -152,6 +541,8 @@ func (b *OpenStackAuthBackend) updateConfigHandler(ctx context.Context, req *log
 		config = &Config{}
 	}
 
+	errs := requestFieldErrors(ctx)
+
 	val, ok = data.GetOk("auth_url")
 	if ok {
 		config.AuthURL = val.(string)
@@ -242,7 +633,236 @@ func (b *OpenStackAuthBackend) updateConfigHandler(ctx context.Context, req *log
 		config.RequestAddressHeaders = val.([]string)
 	}
 
-	entry, err := logical.StorageEntryJSON("config", config)
+	val, ok = data.GetOk("request_address_source")
+	if ok {
+		config.RequestAddressSource = val.(string)
+	}
+
+	val, ok = data.GetOk("trusted_proxies")
+	if ok {
+		config.TrustedProxies = val.([]string)
+	}
+
+	val, ok = data.GetOk("all_tenants")
+	if ok {
+		config.AllTenants = val.(bool)
+	}
+
+	val, ok = data.GetOk("audit_non_hmac_fields")
+	if ok {
+		fields := val.([]string)
+		for _, field := range fields {
+			if !strutil.StrListContains(auditFields, field) {
+				errs.add("audit_non_hmac_fields", "unknown field %s", field)
+			}
+		}
+		config.AuditNonHMACFields = fields
+	}
+
+	val, ok = data.GetOk("alias_name")
+	if ok {
+		config.AliasName = val.(string)
+	}
+
+	val, ok = data.GetOk("auth_attempt_cleanup_interval")
+	if ok {
+		config.AuthAttemptCleanupInterval = time.Duration(val.(int)) * time.Second
+		if config.AuthAttemptCleanupInterval < 0 {
+			errs.add("auth_attempt_cleanup_interval", "cannot be negative")
+		}
+	}
+
+	val, ok = data.GetOk("ttl")
+	if ok {
+		config.TTL = time.Duration(val.(int)) * time.Second
+	}
+
+	val, ok = data.GetOk("max_ttl")
+	if ok {
+		config.MaxTTL = time.Duration(val.(int)) * time.Second
+	}
+
+	val, ok = data.GetOk("period")
+	if ok {
+		config.Period = time.Duration(val.(int)) * time.Second
+	}
+
+	val, ok = data.GetOk("cacert")
+	if ok {
+		config.CACert = val.(string)
+	}
+
+	val, ok = data.GetOk("insecure_skip_verify")
+	if ok {
+		config.InsecureSkipVerify = val.(bool)
+	}
+
+	val, ok = data.GetOk("client_cert")
+	if ok {
+		config.ClientCert = val.(string)
+	}
+
+	val, ok = data.GetOk("client_key")
+	if ok {
+		config.ClientKey = val.(string)
+	}
+
+	val, ok = data.GetOk("http_proxy")
+	if ok {
+		config.HTTPProxy = val.(string)
+	}
+
+	val, ok = data.GetOk("request_timeout")
+	if ok {
+		config.RequestTimeout = time.Duration(val.(int)) * time.Second
+	}
+
+	val, ok = data.GetOk("max_retries")
+	if ok {
+		maxRetries := val.(int)
+		config.MaxRetries = &maxRetries
+	}
+
+	val, ok = data.GetOk("lookup_attempts")
+	if ok {
+		config.LookupAttempts = val.(int)
+		if config.LookupAttempts < 0 {
+			errs.add("lookup_attempts", "cannot be negative")
+		}
+	}
+
+	val, ok = data.GetOk("instance_cache_ttl")
+	if ok {
+		instanceCacheTTL := time.Duration(val.(int)) * time.Second
+		config.InstanceCacheTTL = &instanceCacheTTL
+		switch {
+		case instanceCacheTTL < 0:
+			errs.add("instance_cache_ttl", "cannot be negative")
+		case instanceCacheTTL > maxInstanceCacheTTL:
+			errs.add("instance_cache_ttl", "cannot be longer than %s", maxInstanceCacheTTL)
+		}
+	}
+
+	val, ok = data.GetOk("compute_api_microversion")
+	if ok {
+		config.ComputeAPIMicroversion = val.(string)
+	}
+
+	val, ok = data.GetOk("selectel_api_url")
+	if ok {
+		config.SelectelAPIURL = val.(string)
+	}
+
+	val, ok = data.GetOk("selectel_api_token")
+	if ok {
+		config.SelectelAPIToken = val.(string)
+	}
+
+	val, ok = data.GetOk("selectel_servers_api_url")
+	if ok {
+		config.SelectelServersAPIURL = val.(string)
+	}
+
+	val, ok = data.GetOk("totp_secret")
+	if ok {
+		if _, err := totpPasscode(val.(string), time.Now()); val.(string) != "" && err != nil {
+			errs.add("totp_secret", "%v", err)
+		}
+		config.TOTPSecret = val.(string)
+	}
+
+	val, ok = data.GetOk("mks_cluster_metadata_key")
+	if ok {
+		config.MKSClusterMetadataKey = val.(string)
+	}
+
+	val, ok = data.GetOk("mks_nodegroup_metadata_key")
+	if ok {
+		config.MKSNodeGroupMetadataKey = val.(string)
+	}
+
+	val, ok = data.GetOk("application_credential_id")
+	if ok {
+		config.ApplicationCredentialID = val.(string)
+	}
+
+	val, ok = data.GetOk("application_credential_secret")
+	if ok {
+		config.ApplicationCredentialSecret = val.(string)
+	}
+
+	val, ok = data.GetOk("auth_type")
+	if ok {
+		config.AuthType = val.(string)
+	}
+
+	val, ok = data.GetOk("identity_provider")
+	if ok {
+		config.IdentityProvider = val.(string)
+	}
+
+	val, ok = data.GetOk("protocol")
+	if ok {
+		config.FederationProtocol = val.(string)
+	}
+
+	val, ok = data.GetOk("client_id")
+	if ok {
+		config.ClientID = val.(string)
+	}
+
+	val, ok = data.GetOk("client_secret")
+	if ok {
+		config.ClientSecret = val.(string)
+	}
+
+	val, ok = data.GetOk("discovery_endpoint")
+	if ok {
+		config.DiscoveryEndpoint = val.(string)
+	}
+
+	val, ok = data.GetOk("access_token_endpoint")
+	if ok {
+		config.AccessTokenEndpoint = val.(string)
+	}
+
+	val, ok = data.GetOk("openid_scope")
+	if ok {
+		config.OIDCScope = val.(string)
+	}
+
+	val, ok = data.GetOk("warm_up_client")
+	if ok {
+		config.WarmUpClient = val.(bool)
+	}
+
+	val, ok = data.GetOk("identity_document_certificates")
+	if ok {
+		config.IdentityDocumentCertificates = val.([]string)
+	}
+
+	errs.addErr(config.validateAuthType())
+	errs.addErr(config.validateAliasName())
+	errs.addErr(config.validateTokenDefaults())
+	errs.addErr(config.validateComputeAPIMicroversion())
+	errs.addErr(config.validateTLS())
+	errs.addErr(config.validateHTTPClient())
+	errs.addErr(config.validateRequestAddresses())
+	errs.addErr(config.validateIdentityDocumentCertificates())
+	if len(errs) > 0 {
+		return logical.ErrorResponse(fmt.Sprintf("invalid config: %v", errs)), nil
+	}
+
+	if _, ok := data.GetOk("region_name"); ok && config.RegionName != "" {
+		err = b.validateRegion(ctx, config)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid region_name: %v", err)), nil
+		}
+	}
+
+	config.Version += 1
+
+	entry, err := logical.StorageEntryJSON(configStorageKey(name), config)
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +872,64 @@ func (b *OpenStackAuthBackend) updateConfigHandler(ctx context.Context, req *log
 		return nil, err
 	}
 
-	b.Close()
+	b.recordChange(ctx, req, "config", configDisplayName(name), config.Version, config.Fingerprint())
+
+	b.resetNamedConfig(name)
+
+	if config.WarmUpClient {
+		b.warmUpClient(req.Storage, name)
+	}
 
 	return nil, nil
 }
+
+func (b *OpenStackAuthBackend) deleteConfigHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := configName(data)
+
+	config, err := readNamedConfig(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return nil, nil
+	}
+
+	roles, err := req.Storage.List(ctx, "role/")
+	if err != nil {
+		return nil, err
+	}
+
+	used := []string{}
+	for _, roleName := range roles {
+		role, err := readRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Config == name {
+			used = append(used, roleName)
+		}
+	}
+	if len(used) > 0 {
+		return logical.ErrorResponse(fmt.Sprintf("config profile %s is used by the roles: %s", name, strings.Join(used, ", "))), nil
+	}
+
+	err = req.Storage.Delete(ctx, configStorageKey(name))
+	if err != nil {
+		return nil, err
+	}
+
+	b.recordChange(ctx, req, "config", name, config.Version, "")
+	b.resetNamedConfig(name)
+
+	return nil, nil
+}
+
+func (b *OpenStackAuthBackend) listConfigHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List(ctx, "config/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
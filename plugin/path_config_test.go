@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestConfigProfiles(t *testing.T) {
+	ctx := context.Background()
+
+	m1 := newMockOpenStack(t)
+	first := newTestLoginInstance("4c6e8a0c-2e4a-4c6e-8a0c-2e4a6c8e0a2c")
+	m1.AddServer(&first.Server)
+
+	m2 := newMockOpenStack(t)
+	second := newTestLoginInstance("6e8a0c2e-4a6c-4e8a-8c2e-4a6c8e0a2c4e")
+	second.Metadata["vault-role"] = "other"
+	m2.AddServer(&second.Server)
+
+	b, storage := newTestLoginBackend(t, m1)
+
+	requests := []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "config/second",
+			Data: map[string]interface{}{
+				"auth_url":         m2.AuthURL(),
+				"username":         "vault",
+				"password":         "secret",
+				"user_domain_name": "Default",
+				"project_id":       mockProjectID,
+			},
+		},
+		{
+			Operation: logical.CreateOperation,
+			Path:      "role/other",
+			Data: map[string]interface{}{
+				"policies":     "other",
+				"metadata_key": "vault-role",
+				"auth_period":  120,
+				"auth_limit":   3,
+				"config":       "second",
+			},
+		},
+	}
+	for _, req := range requests {
+		req.Storage = storage
+		res, err := b.HandleRequest(ctx, req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+	}
+
+	res, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/second",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.Data["auth_url"] != m2.AuthURL() || res.Data["password"] != nil {
+		t.Errorf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "config/",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || !reflect.DeepEqual(res.Data["keys"], []string{"second"}) {
+		t.Errorf("unexpected result: %v - %v", res, err)
+	}
+
+	var tests = []struct {
+		role       string
+		instanceID string
+		status     int
+	}{
+		{"test", first.ID, http.StatusOK},
+		{"other", second.ID, http.StatusOK},
+		// fail: instance of the default cloud
+		{"other", first.ID, http.StatusForbidden},
+		// fail: instance of the cloud of the profile
+		{"test", second.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		req.Data["role"] = test.role
+		res, err := b.HandleRequest(ctx, req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/unknown",
+		Storage:   storage,
+		Data:      map[string]interface{}{"config": "unknown"},
+	})
+	if err != nil || res == nil || !res.IsError() {
+		t.Errorf("role with unknown config profile was written: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "config/second",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || !res.IsError() {
+		t.Errorf("config profile used by a role was deleted: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "export",
+		Storage:   storage,
+		Data:      map[string]interface{}{"passphrase": "correct horse"},
+	})
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	b2, storage2 := newTestBackend(t)
+	res, err = b2.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "import",
+		Storage:   storage2,
+		Data:      map[string]interface{}{"document": res.Data["document"], "passphrase": "correct horse"},
+	})
+	if err != nil || res == nil || res.IsError() || !reflect.DeepEqual(res.Data["configs"], []string{"second"}) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	config, err := readNamedConfig(ctx, storage2, "second")
+	if err != nil || config == nil || config.AuthURL != m2.AuthURL() || config.Password != "secret" {
+		t.Errorf("unexpected config profile: %v - %v", config, err)
+	}
+
+	for _, path := range []string{"role/other", "config/second"} {
+		res, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      path,
+			Storage:   storage,
+		})
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+	}
+
+	config, err = readNamedConfig(ctx, storage, "second")
+	if err != nil || config != nil {
+		t.Errorf("config profile was not deleted: %v - %v", config, err)
+	}
+}
+
+func TestConfigSecretsRedacted(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	res, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/exists",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.Data["exists"] != false {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"auth_url":    "http://keystone.test/v3",
+			"username":    "vault",
+			"password":    "secret",
+			"totp_secret": "JBSWY3DPEHPK3PXP",
+		},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	for _, value := range res.Data {
+		if value == "secret" || value == "JBSWY3DPEHPK3PXP" {
+			t.Errorf("secret is returned: %v", res.Data)
+		}
+	}
+	if res.Data["auth_method"] != "totp" || !reflect.DeepEqual(res.Data["configured_secrets"], []string{"password", "totp_secret"}) {
+		t.Errorf("unexpected credentials: %v, %v", res.Data["auth_method"], res.Data["configured_secrets"])
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/exists",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.Data["exists"] != true || res.Data["auth_method"] != "totp" {
+		t.Errorf("unexpected result: %v - %v", res, err)
+	}
+}
@@ -0,0 +1,337 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/applicationcredentials"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const generateCredentialsSynopsis = "Generates an application credential for the backend."
+const generateCredentialsDescription = `
+Authenticates with the bootstrap credentials of a Keystone user and creates
+an application credential of the user, restricted to the read-only API
+requests the backend makes. The application credential replaces the
+credentials of the config. The bootstrap credentials are only used for the
+request and are never stored.
+`
+
+const rotateConfigSynopsis = "Rotates the credentials of the backend."
+const rotateConfigDescription = `
+Replaces the password of the Keystone user of the config with a random one,
+or replaces the password with a new application credential of the user.
+The new secret is only stored in the config, so the credentials of the
+backend never have to leave Vault. Only a config authenticating with the
+password of a Keystone user can be rotated.
+`
+
+const (
+	rotateMethodPassword              = "password"
+	rotateMethodApplicationCredential = "application_credential"
+)
+
+var rotateConfigFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"method": {
+		Type:        framework.TypeString,
+		Description: "What replaces the password of the config. One of password or application_credential.",
+		Default:     rotateMethodPassword,
+	},
+	"name": {
+		Type:        framework.TypeString,
+		Description: "Name of the application credential. Defaults to vault-auth-openstack with the creation time.",
+	},
+	"roles": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Names of the roles of the user on the project delegated to the application credential. Defaults to all of them.",
+	},
+}
+
+var generateCredentialsFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"auth_url": {
+		Type:        framework.TypeString,
+		Description: "Keystone endpoint URL. Defaults to the auth_url of the config.",
+	},
+	"user_id": {
+		Type:        framework.TypeString,
+		Description: "Unique ID of the bootstrap user.",
+	},
+	"username": {
+		Type:        framework.TypeString,
+		Description: "Username of the bootstrap user.",
+	},
+	"password": {
+		Type:        framework.TypeString,
+		Description: "Password of the bootstrap user.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"user_domain_id": {
+		Type:        framework.TypeString,
+		Description: "Unique ID of the domain where the bootstrap user resides.",
+	},
+	"user_domain_name": {
+		Type:        framework.TypeString,
+		Description: "Name of the domain where the bootstrap user resides.",
+	},
+	"project_id": {
+		Type:        framework.TypeString,
+		Description: "Unique ID of the project of the application credential.",
+	},
+	"project_name": {
+		Type:        framework.TypeString,
+		Description: "Name of the project of the application credential.",
+	},
+	"project_domain_id": {
+		Type:        framework.TypeString,
+		Description: "Unique ID of the domain where the project resides.",
+	},
+	"project_domain_name": {
+		Type:        framework.TypeString,
+		Description: "Name of the domain where the project resides.",
+	},
+	"name": {
+		Type:        framework.TypeString,
+		Description: "Name of the application credential. Defaults to vault-auth-openstack with the creation time.",
+	},
+	"roles": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Names of the roles of the bootstrap user on the project delegated to the application credential. Defaults to all of them.",
+	},
+}
+
+func NewPathCredentials(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "config/generate-credentials$",
+			Fields:  generateCredentialsFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.generateCredentialsHandler,
+					Summary:  "Generate an application credential for the backend.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"application_credential_id": {Type: framework.TypeString, Description: "ID of the application credential."},
+							"name":                      {Type: framework.TypeString, Description: "Name of the application credential."},
+							"project_id":                {Type: framework.TypeString, Description: "ID of the project of the application credential."},
+							"access_rules":              {Type: framework.TypeInt, Description: "Number of the access rules of the application credential."},
+						}}},
+						http.StatusBadRequest: {{Description: "The bootstrap credentials are invalid"}},
+					},
+				},
+			},
+			HelpSynopsis:    generateCredentialsSynopsis,
+			HelpDescription: generateCredentialsDescription,
+		},
+		{
+			Pattern: "config/rotate$",
+			Fields:  rotateConfigFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.rotateConfigHandler,
+					Summary:  "Rotate the credentials of the backend.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"method":                    {Type: framework.TypeString, Description: "What replaced the password of the config."},
+							"user_id":                   {Type: framework.TypeString, Description: "ID of the user whose password was rotated."},
+							"application_credential_id": {Type: framework.TypeString, Description: "ID of the application credential."},
+							"name":                      {Type: framework.TypeString, Description: "Name of the application credential."},
+						}}},
+						http.StatusBadRequest: {{Description: "The config cannot be rotated"}},
+					},
+				},
+			},
+			HelpSynopsis:    rotateConfigSynopsis,
+			HelpDescription: rotateConfigDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) generateCredentialsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		config = &Config{}
+	}
+
+	if authURL := data.Get("auth_url").(string); authURL != "" {
+		config.AuthURL = authURL
+	}
+	if config.AuthURL == "" {
+		return logical.ErrorResponse("auth_url is required"), nil
+	}
+
+	bootstrap := &Config{
+		AuthURL:           config.AuthURL,
+		Availability:      config.Availability,
+		RegionName:        config.RegionName,
+		UserID:            data.Get("user_id").(string),
+		Username:          data.Get("username").(string),
+		Password:          data.Get("password").(string),
+		UserDomainID:      data.Get("user_domain_id").(string),
+		UserDomainName:    data.Get("user_domain_name").(string),
+		ProjectID:         data.Get("project_id").(string),
+		ProjectName:       data.Get("project_name").(string),
+		ProjectDomainID:   data.Get("project_domain_id").(string),
+		ProjectDomainName: data.Get("project_domain_name").(string),
+	}
+	if bootstrap.Password == "" {
+		return logical.ErrorResponse("password is required"), nil
+	}
+
+	name := data.Get("name").(string)
+	if name == "" {
+		name = defaultCredentialName(time.Now())
+	}
+
+	credential, err := b.generateCredential(ctx, bootstrap, name, data.Get("roles").([]string))
+	if err != nil {
+		msg := fmt.Sprintf("failed to generate application credential: %v", err)
+		if errors.Is(err, errUnauthorized) || errors.Is(err, errForbidden) || errors.Is(err, errIdentityNotFound) {
+			return logical.ErrorResponse(msg), nil
+		}
+		return nil, logical.CodedError(http.StatusBadGateway, msg)
+	}
+
+	config.useApplicationCredential(credential)
+
+	err = b.putRotatedConfig(ctx, req, config)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"application_credential_id": credential.ID,
+			"name":                      credential.Name,
+			"project_id":                credential.ProjectID,
+			"access_rules":              len(credential.AccessRules),
+		},
+	}
+
+	return res, nil
+}
+
+func (b *OpenStackAuthBackend) rotateConfigHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return logical.ErrorResponse("backend is not configured"), nil
+	}
+	if !config.rotatable() {
+		return logical.ErrorResponse("only a config authenticating with the password of a keystone user can be rotated"), nil
+	}
+
+	res := &logical.Response{Data: map[string]interface{}{}}
+
+	method := data.Get("method").(string)
+	switch method {
+	case rotateMethodPassword:
+		userID, password, err := b.rotatePassword(ctx, config)
+		if err != nil {
+			return rotateErrorResponse("failed to rotate password", err)
+		}
+		config.Password = password
+		res.Data["user_id"] = userID
+
+	case rotateMethodApplicationCredential:
+		name := data.Get("name").(string)
+		if name == "" {
+			name = defaultCredentialName(time.Now())
+		}
+
+		credential, err := b.generateCredential(ctx, config, name, data.Get("roles").([]string))
+		if err != nil {
+			return rotateErrorResponse("failed to generate application credential", err)
+		}
+		config.useApplicationCredential(credential)
+		res.Data["application_credential_id"] = credential.ID
+		res.Data["name"] = credential.Name
+
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("method must be %s or %s", rotateMethodPassword, rotateMethodApplicationCredential)), nil
+	}
+	res.Data["method"] = method
+
+	err = b.putRotatedConfig(ctx, req, config)
+	if err != nil {
+		b.Logger().Error("failed to store rotated credentials, the previous credentials of the config are no longer valid", "method", method, "error", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// rotateErrorResponse returns the response to a failed request to Keystone.
+// The rejected credentials are the problem of the config, the other
+// failures are those of the API.
+func rotateErrorResponse(msg string, err error) (*logical.Response, error) {
+	msg = fmt.Sprintf("%s: %v", msg, err)
+	if errors.Is(err, errUnauthorized) || errors.Is(err, errForbidden) || errors.Is(err, errIdentityNotFound) {
+		return logical.ErrorResponse(msg), nil
+	}
+	return nil, logical.CodedError(http.StatusBadGateway, msg)
+}
+
+// useApplicationCredential replaces the credentials of the config with the
+// application credential. The application credential is scoped to its
+// project, the other credentials and scopes of the config are discarded.
+func (c *Config) useApplicationCredential(credential *applicationcredentials.ApplicationCredential) {
+	c.ApplicationCredentialID = credential.ID
+	c.ApplicationCredentialSecret = credential.Secret
+	c.AuthType = ""
+	c.Token = ""
+	c.UserID = ""
+	c.Username = ""
+	c.Password = ""
+	c.TOTPSecret = ""
+	c.ClientSecret = ""
+	c.ProjectID = ""
+	c.ProjectName = ""
+	c.TenantID = ""
+	c.TenantName = ""
+	c.UserDomainID = ""
+	c.UserDomainName = ""
+	c.ProjectDomainID = ""
+	c.ProjectDomainName = ""
+	c.DomainID = ""
+	c.DomainName = ""
+}
+
+// putRotatedConfig stores the config with its new credentials, and drops
+// the clients authenticated with the previous ones.
+func (b *OpenStackAuthBackend) putRotatedConfig(ctx context.Context, req *logical.Request, config *Config) error {
+	config.Version += 1
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return err
+	}
+
+	err = req.Storage.Put(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	b.recordChange(ctx, req, "config", "config", config.Version, config.Fingerprint())
+
+	b.resetConfig()
+	b.Close()
+
+	if config.WarmUpClient {
+		b.warmUpClient(req.Storage, "")
+	}
+
+	return nil
+}
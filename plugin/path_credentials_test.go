@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/applicationcredentials"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestGenerateCredentials(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("2c4e6a8b-0d1f-4a3c-9e5b-7d9f1b3d5f7a")
+	m.AddServer(&instance.Server)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/generate-credentials",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"username":         "admin",
+			"user_domain_name": "Default",
+			"project_id":       mockProjectID,
+		},
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status without password: %d, %v, %v", status, res, err)
+	}
+
+	req.Data["password"] = "bootstrap"
+	req.Data["name"] = "vault"
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	id := res.Data["application_credential_id"].(string)
+	credential := m.ApplicationCredential(id)
+	if credential == nil || credential.Name != "vault" {
+		t.Fatalf("unexpected application credential: %v", credential)
+	}
+	if credential.Unrestricted {
+		t.Errorf("application credential is unrestricted")
+	}
+
+	rules := []applicationcredentials.AccessRule{}
+	for _, rule := range credential.AccessRules {
+		if rule.Service == "compute" {
+			rules = append(rules, rule)
+		}
+	}
+	expected := []applicationcredentials.AccessRule{
+		{Service: "compute", Method: "GET", Path: "/v2.1/"},
+		{Service: "compute", Method: "GET", Path: "/v2.1/servers/*"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("unexpected compute access rules: %v", rules)
+	}
+
+	config, err := readConfig(context.Background(), storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ApplicationCredentialID != id || config.ApplicationCredentialSecret != credential.Secret {
+		t.Errorf("application credential is not stored: %v", config)
+	}
+	if config.Username != "" || config.Password != "" || config.ProjectID != "" {
+		t.Errorf("previous credentials are not discarded: %v", config)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unable to login with application credential: %v - %v", res, err)
+	}
+}
+
+func TestRotateConfig(t *testing.T) {
+	m := newMockOpenStack(t)
+	m.SetPassword("secret")
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("4d6f8a0c-2e4b-4c6d-8f0a-2c4e6a8b0d2f")
+	m.AddServer(&instance.Server)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate",
+		Storage:   storage,
+		Data:      map[string]interface{}{"method": "ssh_key"},
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status with unknown method: %d, %v, %v", status, res, err)
+	}
+
+	req.Data = map[string]interface{}{}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["method"] != "password" || res.Data["user_id"] != mockUserID {
+		t.Errorf("unexpected response: %v", res.Data)
+	}
+
+	config, err := readConfig(context.Background(), storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Password() == "secret" || config.Password != m.Password() {
+		t.Errorf("password is not rotated: %q, %q", config.Password, m.Password())
+	}
+
+	login := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), login)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unable to login with rotated password: %v - %v", res, err)
+	}
+
+	req.Data = map[string]interface{}{"method": "application_credential", "name": "vault"}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	config, err = readConfig(context.Background(), storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ApplicationCredentialID != res.Data["application_credential_id"] || config.Password != "" {
+		t.Errorf("application credential is not stored: %v", config)
+	}
+
+	// The application credential cannot be rotated by the backend.
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadRequest {
+		t.Errorf("unexpected status with application credential: %d, %v, %v", status, res, err)
+	}
+}
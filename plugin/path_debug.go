@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const debugAttestSynopsis = "Traces the attestation of an OpenStack instance."
+const debugAttestDescription = `
+Fetches the instance from the OpenStack API and runs every check of the
+attestation for the role, returning the inputs and the result of each check.
+No token is issued and no authentication attempt is counted. The address
+check is only performed when request_addr is specified.
+
+This endpoint requires sudo capability.
+`
+
+var debugAttestFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+	"role": {
+		Type:        framework.TypeString,
+		Description: "Name of the role.",
+	},
+	"request_addr": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of request addresses to verify against the instance addresses.",
+	},
+}
+
+// debugAttestResponseFields is the schema of the attestation trace.
+var debugAttestResponseFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+	"role": {
+		Type:        framework.TypeString,
+		Description: "Name of the role.",
+	},
+	"passed": {
+		Type:        framework.TypeBool,
+		Description: "Whether every check passed.",
+	},
+	"checks": {
+		Type:        framework.TypeSlice,
+		Description: "Inputs and result of each check.",
+	},
+}
+
+func NewPathDebug(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("debug/attest/%s", framework.GenericNameRegex("instance_id")),
+			Fields:  debugAttestFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.debugAttestHandler,
+					Summary:  "Trace the attestation of an OpenStack instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: debugAttestResponseFields}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.debugAttestHandler,
+					Summary:  "Trace the attestation of an OpenStack instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: debugAttestResponseFields}},
+					},
+				},
+			},
+			HelpSynopsis:    debugAttestSynopsis,
+			HelpDescription: debugAttestDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) debugAttestHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instanceID := data.Get("instance_id").(string)
+
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("role required"), nil
+	}
+
+	return b.traceAttestation(ctx, req, roleName, instanceID, "", data.Get("request_addr").([]string))
+}
+
+// traceAttestation runs every check of the attestation of the instance for
+// the role and returns the trace. The instance is looked up by name when
+// instanceName is given. The address checks are skipped when addrs is empty.
+func (b *OpenStackAuthBackend) traceAttestation(ctx context.Context, req *logical.Request, roleName, instanceID, instanceName string, addrs []string) (*logical.Response, error) {
+	role, err := readRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %s", roleName)), nil
+	}
+
+	config, err := b.getRoleConfig(ctx, req.Storage, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return configMissingResponse(role), nil
+	}
+
+	role, err = b.bindProjectID(ctx, config, role)
+	switch {
+	case errors.Is(err, errProjectNameBinding), errors.Is(err, errProjectBinding), errors.Is(err, errProjectNotFound):
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+	case err != nil:
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to resolve project of role: %v", err))
+	}
+
+	lookup, err := b.instanceLookup(ctx, req.Storage, config, role)
+	if err != nil {
+		return lookupErrorResponse(b.requestLogger(req), roleName, err)
+	}
+
+	if instanceName != "" {
+		instanceID, err = b.findInstanceID(ctx, req.Storage, config, role, instanceName)
+		switch {
+		case errors.Is(err, errInstanceNameBinding), errors.Is(err, errInstanceNameAmbiguous):
+			return logical.ErrorResponse(fmt.Sprintf("failed to find instance: %v", err)), nil
+		case err != nil:
+			return b.instanceErrorResponse(b.requestLogger(req), instanceName, err)
+		}
+	}
+
+	instance, err := lookup(ctx, instanceID)
+	if err != nil {
+		return b.instanceErrorResponse(b.requestLogger(req), instanceID, err)
+	}
+
+	instance, err = b.resolveFloatingIPs(ctx, req.Storage, role, instance, addrs)
+	if err != nil {
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to resolve floating IPs: %v", err))
+	}
+
+	attestor := NewAttestor(req.Storage)
+
+	checks, err := attestor.Trace(instance, role, addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	portCheck := newAttestCheck("port_ownership", map[string]interface{}{
+		"addresses": addrs,
+	}, nil)
+	if role.AttestPortOwnership && len(addrs) > 0 {
+		err = b.attestPortOwnership(ctx, req.Storage, role, instance, addrs)
+		if err != nil && attestReason(err) == "" {
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to verify port ownership: %v", err))
+		}
+		portCheck = newAttestCheck(portCheck.Name, portCheck.Input, err)
+	} else {
+		portCheck.Skipped = true
+	}
+	checks = append(checks, portCheck)
+
+	stackCheck := newAttestCheck("stack", map[string]interface{}{
+		"stack": role.BoundStackID,
+	}, nil)
+	if role.BoundStackID != "" {
+		err = b.attestStack(ctx, req.Storage, role, instance)
+		if err != nil && attestReason(err) == "" {
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to verify stack: %v", err))
+		}
+		stackCheck = newAttestCheck(stackCheck.Name, stackCheck.Input, err)
+	} else {
+		stackCheck.Skipped = true
+	}
+	checks = append(checks, stackCheck)
+
+	serverGroupCheck := newAttestCheck("server_group", map[string]interface{}{
+		"server_group_id":   role.BoundServerGroupID,
+		"server_group_name": role.BoundServerGroupName,
+	}, nil)
+	if role.hasServerGroupBinding() {
+		err = b.attestServerGroup(ctx, req.Storage, config, role, instance)
+		if err != nil && attestReason(err) == "" {
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to verify server group: %v", err))
+		}
+		serverGroupCheck = newAttestCheck(serverGroupCheck.Name, serverGroupCheck.Input, err)
+	} else {
+		serverGroupCheck.Skipped = true
+	}
+	checks = append(checks, serverGroupCheck)
+
+	flavorCheck := newAttestCheck("flavor", map[string]interface{}{
+		"instance":     instance.Flavor,
+		"flavor_ids":   role.BoundFlavorIDs,
+		"flavor_names": role.BoundFlavorNames,
+	}, nil)
+	if role.hasFlavorBinding() {
+		err = b.attestFlavor(ctx, req.Storage, role, instance)
+		if err != nil && attestReason(err) == "" {
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to verify flavor: %v", err))
+		}
+		flavorCheck = newAttestCheck(flavorCheck.Name, flavorCheck.Input, err)
+	} else {
+		flavorCheck.Skipped = true
+	}
+	checks = append(checks, flavorCheck)
+
+	mksCheck := newAttestCheck("mks", map[string]interface{}{
+		"clusters":    role.BoundMKSClusterIDs,
+		"node_groups": role.BoundMKSNodeGroupIDs,
+	}, nil)
+	if role.hasMKSBindings() {
+		err = attestor.AttestMKS(instance, role, config.MKSClusterMetadataKey, config.MKSNodeGroupMetadataKey)
+		mksCheck = newAttestCheck(mksCheck.Name, mksCheck.Input, err)
+	} else {
+		mksCheck.Skipped = true
+	}
+	checks = append(checks, mksCheck)
+
+	dnsCheck := newAttestCheck("dns", map[string]interface{}{
+		"zone": role.BoundDNSZone,
+		"name": instance.Name,
+	}, nil)
+	if role.BoundDNSZone != "" {
+		err = b.attestDNS(ctx, req.Storage, role, instance)
+		if err != nil && attestReason(err) == "" {
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to verify dns record: %v", err))
+		}
+		dnsCheck = newAttestCheck(dnsCheck.Name, dnsCheck.Input, err)
+	} else {
+		dnsCheck.Skipped = true
+	}
+	checks = append(checks, dnsCheck)
+
+	passed := true
+	for _, check := range checks {
+		if !check.Passed && !check.Skipped {
+			passed = false
+		}
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"instance_id": instance.ID,
+			"role":        roleName,
+			"passed":      passed,
+			"checks":      checks,
+		},
+	}
+
+	return res, nil
+}
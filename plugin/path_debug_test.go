@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestDebugAttest(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	instance.Status = "SHUTOFF"
+	m.AddServer(&instance.Server)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "debug/attest/" + instance.ID,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"role":         "test",
+			"request_addr": wrongIPv4,
+		},
+	}
+
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	if res.Data["passed"] != false {
+		t.Errorf("unexpected result: %v", res.Data)
+	}
+
+	failed := map[string]string{}
+	for _, check := range res.Data["checks"].([]*AttestCheck) {
+		if !check.Passed {
+			failed[check.Name] = check.Reason
+		}
+	}
+	if len(failed) != 2 || failed["status"] != ReasonInstanceNotActive || failed["address"] != ReasonAddrMismatch {
+		t.Errorf("unexpected failed checks: %v", failed)
+	}
+
+	attempt, err := readAuthAttempt(context.Background(), storage, instance.ID)
+	if err != nil || attempt != nil {
+		t.Errorf("auth attempt was counted: %v - %v", attempt, err)
+	}
+}
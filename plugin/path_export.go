@@ -0,0 +1,322 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const exportSynopsis = "Exports the state of the backend."
+const exportDescription = `
+Serializes the config, the config profiles, the roles and the instance
+allowlist into a single document, which can be imported to another mount
+with the import endpoint. The credentials of the configs and the signing
+key of the identity tokens are only exported when a passphrase is given,
+sealed with a key derived from the passphrase.
+`
+
+const importSynopsis = "Imports the state of the backend."
+const importDescription = `
+Writes the config, the config profiles, the roles and the instance
+allowlist of a document exported with the export endpoint. The profiles,
+the roles and the registrations of the document replace the ones with the
+same names, the other ones are kept. The sealed secrets are restored with
+the passphrase of the export. Without them, the credentials of the current
+configs are kept.
+`
+
+var exportFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"passphrase": {
+		Type:        framework.TypeString,
+		Description: "Passphrase sealing the secrets of the backend. The secrets are not exported without a passphrase.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+}
+
+var importFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"document": {
+		Type:        framework.TypeString,
+		Description: "Document returned by the export endpoint.",
+		Required:    true,
+	},
+	"passphrase": {
+		Type:        framework.TypeString,
+		Description: "Passphrase the secrets of the document were sealed with.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+}
+
+func NewPathExport(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "export$",
+			Fields:  exportFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.exportHandler,
+					Summary:  "Export the state of the backend.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"document": {Type: framework.TypeString, Description: "JSON document of the state of the backend."},
+						}}},
+					},
+				},
+			},
+			HelpSynopsis:    exportSynopsis,
+			HelpDescription: exportDescription,
+		},
+		{
+			Pattern: "import$",
+			Fields:  importFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.importHandler,
+					Summary:  "Import the state of the backend.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK, possibly with warnings", Fields: map[string]*framework.FieldSchema{
+							"config":       {Type: framework.TypeBool, Description: "Whether the config was imported."},
+							"configs":      {Type: framework.TypeStringSlice, Description: "Names of the imported config profiles."},
+							"roles":        {Type: framework.TypeStringSlice, Description: "Names of the imported roles."},
+							"allowlist":    {Type: framework.TypeInt, Description: "Number of the imported instance registrations."},
+							"identity_key": {Type: framework.TypeBool, Description: "Whether the signing key of the identity tokens was imported."},
+						}}},
+						http.StatusBadRequest: {{Description: "The document is invalid"}},
+					},
+				},
+			},
+			HelpSynopsis:    importSynopsis,
+			HelpDescription: importDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) exportHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	passphrase := data.Get("passphrase").(string)
+
+	doc, err := exportState(ctx, req.Storage, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"document": string(body),
+		},
+	}
+	if passphrase == "" {
+		res.AddWarning("the secrets of the backend were not exported, set passphrase to export them sealed")
+	}
+
+	return res, nil
+}
+
+func (b *OpenStackAuthBackend) importHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	doc := &exportDocument{}
+	err := json.Unmarshal([]byte(data.Get("document").(string)), doc)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid document: %v", err)), nil
+	}
+
+	if doc.FormatVersion != exportFormatVersion {
+		return logical.ErrorResponse(fmt.Sprintf("invalid document: unsupported format version %d", doc.FormatVersion)), nil
+	}
+	if doc.SchemaVersion != currentSchemaVersion() {
+		return logical.ErrorResponse(fmt.Sprintf("invalid document: schema version %d differs from the schema version %d of the plugin", doc.SchemaVersion, currentSchemaVersion())), nil
+	}
+
+	var secrets *exportSecrets
+	passphrase := data.Get("passphrase").(string)
+	switch {
+	case doc.Sealed != "" && passphrase != "":
+		secrets, err = doc.unsealSecrets(passphrase)
+		if errors.Is(err, errSealedSecrets) {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	case doc.Sealed != "":
+		return logical.ErrorResponse("passphrase is required to import the sealed secrets"), nil
+	}
+
+	errs := fieldErrors{}
+
+	// The default config is imported under the empty name with the
+	// profiles.
+	configs := map[string]*Config{}
+	if doc.Config != nil {
+		configs[""] = doc.Config
+	}
+	for name, config := range doc.Configs {
+		if name == "" || config == nil || strutil.StrListContains(reservedConfigNames, name) {
+			errs = append(errs, fmt.Sprintf("config profile %s: invalid profile", name))
+			continue
+		}
+		configs[name] = config
+	}
+	configNames := make([]string, 0, len(configs))
+	for name := range configs {
+		configNames = append(configNames, name)
+	}
+	sort.Strings(configNames)
+
+	names := make([]string, 0, len(doc.Roles))
+	for name, role := range doc.Roles {
+		if role == nil || role.Name != name {
+			errs = append(errs, fmt.Sprintf("role %s: name mismatched", name))
+			continue
+		}
+		_, err := role.Validate(b.System())
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("role %s: %v", name, err))
+		}
+		config, ok := configs[role.Config]
+		if !ok {
+			config, err = readNamedConfig(ctx, req.Storage, role.Config)
+			if err != nil {
+				return nil, err
+			}
+			if config == nil && role.Config != "" {
+				errs = append(errs, fmt.Sprintf("role %s: config profile %s does not exist", name, role.Config))
+			}
+		}
+		if config != nil && config.AllTenants && !role.hasProjectBinding() {
+			errs = append(errs, fmt.Sprintf("role %s: project_id is required with a config which sets all_tenants", name))
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"config":       false,
+			"configs":      []string{},
+			"roles":        names,
+			"allowlist":    len(doc.Allowlist),
+			"identity_key": false,
+		},
+	}
+
+	for _, name := range configNames {
+		config := configs[name]
+
+		current, err := readNamedConfig(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+
+		label := "config"
+		if name != "" {
+			label = fmt.Sprintf("config profile %s", name)
+		}
+
+		config.Version = 1
+		switch {
+		case secrets != nil:
+			config.setSecrets(secrets.configSecrets(name))
+		case current != nil:
+			_, currentSecrets := current.withoutSecrets()
+			config.setSecrets(currentSecrets)
+			res.AddWarning(fmt.Sprintf("the document has no secrets, the credentials of the current %s were kept", label))
+		default:
+			res.AddWarning(fmt.Sprintf("the document has no secrets, write the credentials to the %s", label))
+		}
+		if current != nil {
+			config.Version = current.Version + 1
+		}
+
+		if err := config.validateAuthType(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", label, err))
+		}
+	}
+	if len(errs) > 0 {
+		return logical.ErrorResponse(fmt.Sprintf("invalid document: %v", errs)), nil
+	}
+
+	for _, name := range configNames {
+		config := configs[name]
+
+		entry, err := logical.StorageEntryJSON(configStorageKey(name), config)
+		if err != nil {
+			return nil, err
+		}
+		err = req.Storage.Put(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		b.recordChange(ctx, req, "config", configDisplayName(name), config.Version, config.Fingerprint())
+		b.resetNamedConfig(name)
+		if name == "" {
+			res.Data["config"] = true
+		} else {
+			res.Data["configs"] = append(res.Data["configs"].([]string), name)
+		}
+	}
+
+	for _, name := range names {
+		role := doc.Roles[name]
+
+		current, err := readRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		role.Version = 1
+		if current != nil {
+			role.Version = current.Version + 1
+		}
+
+		entry, err := logical.StorageEntryJSON(fmt.Sprintf("role/%s", name), role)
+		if err != nil {
+			return nil, err
+		}
+		err = req.Storage.Put(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		b.recordChange(ctx, req, "role", name, role.Version, role.Fingerprint())
+	}
+
+	for id, registration := range doc.Allowlist {
+		registration.Name = id
+		err := updateInstanceRegistration(ctx, req.Storage, registration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if secrets != nil && secrets.IdentityKey != nil {
+		entry, err := logical.StorageEntryJSON(identityKeyStorageKey, secrets.IdentityKey)
+		if err != nil {
+			return nil, err
+		}
+		err = req.Storage.Put(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		b.identityKeyMutex.Lock()
+		b.identityKey = nil
+		b.identityKeyMutex.Unlock()
+		res.Data["identity_key"] = true
+	}
+
+	return res, nil
+}
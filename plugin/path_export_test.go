@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	m := newMockOpenStack(t)
+	b1, storage1 := newTestLoginBackend(t, m)
+
+	requests := []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Data:      map[string]interface{}{"selectel_api_token": "selectel-secret"},
+		},
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Data:      map[string]interface{}{"identity_token_ttl": 300, "require_preregistration": true},
+		},
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "allowlist/instances/9c1e3a5b-7d9f-4b1d-8f3b-5d7f9b1d3f5b",
+			Data:      map[string]interface{}{"roles": "test"},
+		},
+	}
+	for _, req := range requests {
+		req.Storage = storage1
+		res, err := b1.HandleRequest(ctx, req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+	}
+
+	export := func(passphrase string) string {
+		res, err := b1.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "export",
+			Storage:   storage1,
+			Data:      map[string]interface{}{"passphrase": passphrase},
+		})
+		if err != nil || res == nil || res.IsError() {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+		return res.Data["document"].(string)
+	}
+
+	sanitized := export("")
+	sealed := export("correct horse")
+	for _, doc := range []string{sanitized, sealed} {
+		if strings.Contains(doc, "selectel-secret") || strings.Contains(doc, `"password":"secret"`) {
+			t.Fatalf("secrets were exported: %s", doc)
+		}
+	}
+
+	b2, storage2 := newTestBackend(t)
+	importDoc := func(doc, passphrase string) (*logical.Response, error) {
+		return b2.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "import",
+			Storage:   storage2,
+			Data:      map[string]interface{}{"document": doc, "passphrase": passphrase},
+		})
+	}
+
+	for _, passphrase := range []string{"", "wrong horse"} {
+		res, err := importDoc(sealed, passphrase)
+		if err != nil || res == nil || !res.IsError() {
+			t.Fatalf("sealed document was imported with %q: %v - %v", passphrase, res, err)
+		}
+	}
+
+	res, err := importDoc(sealed, "correct horse")
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["config"] != true || res.Data["allowlist"] != 1 || res.Data["identity_key"] != true {
+		t.Errorf("unexpected import result: %v", res.Data)
+	}
+
+	config, err := readConfig(ctx, storage2)
+	if err != nil || config == nil || config.Password != "secret" || config.SelectelAPIToken != "selectel-secret" || config.AuthURL != m.AuthURL() {
+		t.Fatalf("unexpected config: %v - %v", config, err)
+	}
+
+	role, err := readRole(ctx, storage2, "test")
+	if err != nil || role == nil || !role.RequirePreregistration || role.Version != 1 {
+		t.Fatalf("unexpected role: %v - %v", role, err)
+	}
+
+	key1, err := b1.(*OpenStackAuthBackend).getIdentityKey(ctx, storage1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key2, err := b2.(*OpenStackAuthBackend).getIdentityKey(ctx, storage2)
+	if err != nil || key2.KeyID != key1.KeyID {
+		t.Fatalf("unexpected identity key: %v - %v", key2, err)
+	}
+
+	// The credentials of the current config are kept without secrets.
+	res, err = importDoc(sanitized, "")
+	if err != nil || res == nil || res.IsError() || len(res.Warnings) == 0 {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	config, err = readConfig(ctx, storage2)
+	if err != nil || config == nil || config.Password != "secret" || config.Version != 2 {
+		t.Fatalf("unexpected config: %v - %v", config, err)
+	}
+
+	res, err = importDoc(strings.Replace(sanitized, `"schema_version":1`, `"schema_version":99`, 1), "")
+	if err != nil || res == nil || !res.IsError() {
+		t.Fatalf("document of another schema was imported: %v - %v", res, err)
+	}
+
+	// fail: the role is not bound to a project under all_tenants
+	res, err = importDoc(strings.Replace(sanitized, `"all_tenants":false`, `"all_tenants":true`, 1), "")
+	if err != nil || res == nil || !res.IsError() {
+		t.Fatalf("unbound role was imported with all_tenants: %v - %v", res, err)
+	}
+}
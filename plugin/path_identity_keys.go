@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const identityKeysSynopsis = "Returns the public keys of the identity tokens."
+const identityKeysDescription = `
+Returns the JSON web key set to verify the signature of the identity tokens
+issued on login, for the services which cannot call Vault. This endpoint
+does not require authentication.
+`
+
+func NewPathIdentityKeys(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "identity/keys$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.identityKeysHandler,
+					Summary:  "Read the JSON web key set of the identity tokens.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", MediaType: "application/json"}},
+					},
+				},
+			},
+			HelpSynopsis:    identityKeysSynopsis,
+			HelpDescription: identityKeysDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) identityKeysHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keys := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+
+	key, err := b.getIdentityKey(ctx, req.Storage)
+	switch {
+	case errors.Is(err, errNoIdentityKey):
+	case err != nil:
+		return nil, err
+	default:
+		public, err := key.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys.Keys = append(keys.Keys, public)
+	}
+
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     body,
+			logical.HTTPContentType: "application/json",
+		},
+	}
+
+	return res, nil
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const infoSynopsis = "Returns the information of the plugin."
+const infoDescription = `
+Returns the version and the build commit of the plugin, the features
+enabled in the config and whether the backend is configured.
+`
+
+func NewPathInfo(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "info$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readInfoHandler,
+					Summary:  "Read the information of the plugin.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"version": {
+									Type:        framework.TypeString,
+									Description: "Version of the plugin.",
+								},
+								"commit": {
+									Type:        framework.TypeString,
+									Description: "Commit the plugin was built from.",
+								},
+								"go_version": {
+									Type:        framework.TypeString,
+									Description: "Go version the plugin was built with.",
+								},
+								"configured": {
+									Type:        framework.TypeBool,
+									Description: "Whether the backend is configured.",
+								},
+								"features": {
+									Type:        framework.TypeMap,
+									Description: "Features enabled in the config.",
+								},
+							},
+						}},
+					},
+				},
+			},
+			HelpSynopsis:    infoSynopsis,
+			HelpDescription: infoDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) readInfoHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	features := map[string]bool{
+		"all_tenants":             false,
+		"request_address_headers": false,
+		"selectel_api":            false,
+		"warm_up_client":          false,
+	}
+
+	if config != nil {
+		features["all_tenants"] = config.AllTenants
+		features["request_address_headers"] = len(config.RequestAddressHeaders) > 0
+		features["selectel_api"] = config.SelectelAPIToken != ""
+		features["warm_up_client"] = config.WarmUpClient
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"version":    Version,
+			"commit":     Commit,
+			"go_version": runtime.Version(),
+			"configured": config != nil,
+			"features":   features,
+		},
+	}
+
+	return res, nil
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestReadInfo(t *testing.T) {
+	b, storage := newTestBackend(t)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "info",
+		Storage:   storage,
+	}
+
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["version"] != Version || res.Data["configured"] != false {
+		t.Errorf("unexpected info: %v", res.Data)
+	}
+
+	if v := b.(logical.PluginVersioner).PluginVersion(); v.Version != "v"+Version {
+		t.Errorf("unexpected plugin version: %v", v)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"auth_url": "http://keystone.test/v3", "all_tenants": true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	features := res.Data["features"].(map[string]bool)
+	if res.Data["configured"] != true || !features["all_tenants"] || features["warm_up_client"] {
+		t.Errorf("unexpected info: %v", res.Data)
+	}
+}
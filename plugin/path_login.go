@@ -2,14 +2,25 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
-	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-hclog"
+	sockaddr "github.com/hashicorp/go-sockaddr"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/helper/policyutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// maxRequestAddresses is the maximum number of request addresses
+// collected from the connection and the request headers.
+const maxRequestAddresses = 16
+
 const loginSynopsis = "Authenticates OpenStack instance with Vault."
 const loginDescription = `
 Authenticates OpenStack instance.
@@ -24,16 +35,49 @@ var loginFields map[string]*framework.FieldSchema = map[string]*framework.FieldS
 		Type:        framework.TypeString,
 		Description: "Name of the role.",
 	},
+	"identity_document": {
+		Type:        framework.TypeString,
+		Description: "Signed identity document of the instance, read from its vendordata.",
+	},
 }
 
+// loginPathFields are the fields of the login, which also takes the name
+// of the instance in place of its ID.
+var loginPathFields = func() map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		"instance_name": {
+			Type:        framework.TypeString,
+			Description: "Name of the instance, looked up in the project of the role in place of instance_id. The name must be unique in the project.",
+		},
+	}
+	for name, field := range loginFields {
+		fields[name] = field
+	}
+
+	return fields
+}()
+
 func NewPathLogin(b *OpenStackAuthBackend) []*framework.Path {
 	return []*framework.Path{
 		{
 			Pattern: "login$",
-			Fields:  loginFields,
-			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.UpdateOperation:         b.loginHandler,
-				logical.AliasLookaheadOperation: b.loginHandler,
+			Fields:  loginPathFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.loginHandler,
+					Summary:  "Log in with an OpenStack instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK:                 {{Description: "OK, the token is returned in the auth section"}},
+						http.StatusBadRequest:         {{Description: "The request is malformed"}},
+						http.StatusForbidden:          {{Description: "The instance was not found or failed the attestation"}},
+						http.StatusTooManyRequests:    {{Description: "The authentication limit of the instance was exceeded"}},
+						http.StatusBadGateway:         {{Description: "The OpenStack API returned an unexpected error"}},
+						http.StatusServiceUnavailable: {{Description: "The OpenStack API is unavailable"}},
+					},
+				},
+				logical.AliasLookaheadOperation: &framework.PathOperation{
+					Callback: b.loginHandler,
+				},
 			},
 			HelpSynopsis:    loginSynopsis,
 			HelpDescription: loginDescription,
@@ -41,107 +85,287 @@ func NewPathLogin(b *OpenStackAuthBackend) []*framework.Path {
 	}
 }
 
-func (b *OpenStackAuthBackend) loginHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := readConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
+func (b *OpenStackAuthBackend) loginHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (res *logical.Response, err error) {
+	reason := ""
+	roleLabel := unknownRole
+	if req.Operation == logical.UpdateOperation {
+		defer func() {
+			b.recordLogin(roleLabel, reason, res, err)
+			b.sendLoginEvent(ctx, req, data.Get("role").(string), data.Get("instance_id").(string), reason, res, err)
+		}()
 	}
 
+	logger := b.requestLogger(req)
+
+	start := time.Now()
+
 	var val interface{}
 	var ok bool
 
-	val, ok = data.GetOk("instance_id")
-	if !ok {
-		return logical.ErrorResponse("instance_id required"), nil
+	instanceID := data.Get("instance_id").(string)
+	instanceName := data.Get("instance_name").(string)
+	switch {
+	case instanceID == "" && instanceName == "":
+		reason = reasonInvalidRequest
+		return logical.ErrorResponse("instance_id or instance_name required"), nil
+	case instanceID != "" && instanceName != "":
+		reason = reasonInvalidRequest
+		return logical.ErrorResponse("only one of instance_id and instance_name can be given"), nil
 	}
-	instanceID := val.(string)
 
 	val, ok = data.GetOk("role")
 	if !ok {
+		reason = reasonInvalidRequest
 		return logical.ErrorResponse("role required"), nil
 	}
 	roleName := val.(string)
 
-	b.Logger().Info("login attempt", "instance_id", instanceID, "role", roleName)
+	logger.Info("login attempt", "instance_id", instanceID, "instance_name", instanceName, "role", roleName)
 
 	role, err := readRole(ctx, req.Storage, roleName)
 	if err != nil || role == nil {
+		measureLoginPhase(phaseStorage, start)
+		reason = reasonInvalidRole
 		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
 	}
+	roleLabel = roleName
 
-	client, err := b.getClient(ctx, req.Storage, role)
+	config, err := b.getRoleConfig(ctx, req.Storage, role)
+	measureLoginPhase(phaseStorage, start)
 	if err != nil {
-		msg := "openstack client error"
-		b.Logger().Error(msg, "error", err)
-		return nil, fmt.Errorf("%s: %v", msg, err)
+		return nil, err
+	}
+
+	if config == nil {
+		return configMissingResponse(role), nil
 	}
 
-	instance, err := servers.Get(client, instanceID).Extract()
+	role, err = b.bindProjectID(ctx, config, role)
+	switch {
+	case errors.Is(err, errProjectNameBinding), errors.Is(err, errProjectBinding), errors.Is(err, errProjectNotFound):
+		reason = reasonInvalidRole
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+	case err != nil:
+		msg := "failed to resolve project of role"
+		logger.Error(msg, "role", roleName, "error", err)
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+	}
+
+	start = time.Now()
+	lookup, err := b.instanceLookup(ctx, req.Storage, config, role)
+	measureLoginPhase(phaseKeystone, start)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("failed to find instance: %v", err)), nil
+		if errors.Is(err, errSelectelNotConfigured) {
+			reason = reasonInvalidRole
+		}
+		return lookupErrorResponse(logger, roleName, err)
+	}
+
+	start = time.Now()
+	if instanceName != "" {
+		instanceID, err = b.findInstanceID(ctx, req.Storage, config, role, instanceName)
+		switch {
+		case errors.Is(err, errInstanceNameBinding), errors.Is(err, errInstanceNameAmbiguous):
+			measureLoginPhase(phaseNova, start)
+			reason = reasonInvalidRequest
+			return logical.ErrorResponse(fmt.Sprintf("failed to find instance: %v", err)), nil
+		case err != nil:
+			measureLoginPhase(phaseNova, start)
+			reason = reasonInstanceNotFound
+			return b.instanceErrorResponse(logger, instanceName, err)
+		}
+	}
+
+	instance, err := lookup(ctx, instanceID)
+	measureLoginPhase(phaseNova, start)
+	if err != nil {
+		reason = reasonInstanceNotFound
+		return b.instanceErrorResponse(logger, instanceID, err)
+	}
+
+	// The status check of the attestation denies the login, while the
+	// record denies the later ones without asking the API.
+	if instanceDeleted(instance) && req.Operation == logical.UpdateOperation {
+		err = b.recordInstanceDeleted(ctx, req.Storage, instance.ID, instance.TenantID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The nonce and the reauthentication record are checked by the
+	// attestation and written at the end of the login, so the concurrent
+	// logins of the instance are serialized in between.
+	if (role.NonceMetadataKey != "" || role.DisallowReauthentication) && req.Operation == logical.UpdateOperation {
+		lock := locksutil.LockForKey(b.instanceLocks, instanceID)
+		lock.Lock()
+		defer lock.Unlock()
 	}
 
 	attestor := NewAttestor(req.Storage)
 	if err != nil {
 		msg := "attestor error"
-		b.Logger().Error(msg, "error", err)
+		logger.Error(msg, "error", err)
 		return nil, fmt.Errorf("%s: %v", msg, err)
 	}
 
-	attestAddresses := []string{req.Connection.RemoteAddr}
-	for _, header := range config.RequestAddressHeaders {
-		if val, ok := req.Headers[header]; ok {
-			attestAddresses = append(attestAddresses, val...)
+	if document := data.Get("identity_document").(string); document != "" {
+		keys, err := config.identityDocumentKeys()
+		if err != nil {
+			return nil, err
+		}
+		roleKeys, err := b.roleIdentityDocumentKeys(ctx, req.Storage, role)
+		if err != nil {
+			msg := "failed to read identity document certificates"
+			logger.Error(msg, "role", roleName, "error", err)
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+		}
+		keys = append(keys, roleKeys...)
+		if len(keys) == 0 {
+			reason = reasonInvalidRequest
+			return logical.ErrorResponse("identity documents are not accepted (hint: set identity_document_certificates in the config or identity_document_secrets on the role)"), nil
+		}
+		attestor.VerifyIdentityDocument(keys, document, instanceID)
+	}
+
+	attestAddresses := b.requestAddresses(req, config)
+
+	start = time.Now()
+	instance, err = b.resolveFloatingIPs(ctx, req.Storage, role, instance, attestAddresses)
+	if err != nil {
+		msg := "failed to resolve floating IPs"
+		logger.Error(msg, "instance_id", instanceID, "role", roleName, "error", err)
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+	}
+
+	err = b.attestBindings(ctx, req.Storage, config, role, instance)
+	if err != nil && attestReason(err) == "" {
+		return bindingErrorResponse(logger, instanceID, roleName, role, err)
+	}
+	if err == nil {
+		err = attestor.Attest(instance, role, attestAddresses)
+	}
+	if err == nil {
+		err = b.attestPortOwnership(ctx, req.Storage, role, instance, b.trustedAddresses(req, config))
+		if err != nil && attestReason(err) == "" {
+			msg := "failed to verify port ownership"
+			logger.Error(msg, "instance_id", instanceID, "role", roleName, "error", err)
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+		}
+	}
+	measureLoginPhase(phaseAttest, start)
+	if err != nil {
+		reason = attestReason(err)
+		if ok, suppressed := b.logSampler.Sample(fmt.Sprintf("login/%s/%s/%s", instanceID, roleName, reason)); ok {
+			logger.Warn("attestation failed", "instance_id", instanceID, "role", roleName, "project", instance.TenantID, "request_addr", attestAddresses, "reason", reason, "retryable", attestRetryable(err), "hint", attestHint(err), "error", err, "suppressed", suppressed)
 		}
+		return attestErrorResponse("failed to login", err)
 	}
 
-	err = attestor.Attest(instance, role, attestAddresses)
+	var boundCIDRs []*sockaddr.SockAddrMarshaler
+	if role.BindTokenAddresses {
+		boundCIDRs, err = instanceBoundCIDRs(instance, role)
+		if err != nil {
+			return attestErrorResponse("failed to login", err)
+		}
+	}
+
+	groupAliases, err := b.groupAliases(ctx, req.Storage, role, instance)
 	if err != nil {
-		b.Logger().Info("attestation failed", "error", err)
-		return logical.ErrorResponse(fmt.Sprintf("failed to login: %v", err)), nil
+		msg := "failed to look up role assignments"
+		logger.Error(msg, "instance_id", instanceID, "role", roleName, "user", instance.UserID, "error", err)
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
 	}
 
-	res := &logical.Response{}
+	logger.Info("login succeeded", "instance_id", instanceID, "role", roleName, "project", instance.TenantID)
+
+	res = &logical.Response{}
 
 	if req.Operation == logical.AliasLookaheadOperation {
 		res.Auth = &logical.Auth{
 			Alias: &logical.Alias{
-				Name: instance.ID,
+				Name: entityAliasName(config, roleName, instance),
 			},
 		}
 	}
 
+	if role.IdentityTokenTTL > 0 && req.Operation == logical.UpdateOperation {
+		token, err := b.identityToken(ctx, req.Storage, config, role, roleName, instance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign identity token: %w", err)
+		}
+		res.Data = map[string]interface{}{
+			"identity_token": token,
+		}
+	}
+
+	identity := identityMetadata(config, role, instance)
+
+	metadata := auditMetadata(config, instanceID, roleName, b.trustedAddresses(req, config))
+	for key, val := range identity {
+		metadata[key] = val
+	}
+
 	res.Auth = &logical.Auth{
-		Period: role.Period,
 		Alias: &logical.Alias{
-			Name: instance.ID,
-		},
-		Policies: role.Policies,
-		Metadata: map[string]string{
-			"role": roleName,
-		},
-		DisplayName: instance.Name,
-		LeaseOptions: logical.LeaseOptions{
-			Renewable: true,
-			TTL:       role.TTL,
-			MaxTTL:    role.MaxTTL,
+			Name:     entityAliasName(config, roleName, instance),
+			Metadata: identity,
 		},
+		GroupAliases: groupAliases,
+		Metadata:     metadata,
+		DisplayName:  instance.Name,
+	}
+	role.PopulateTokenAuth(res.Auth)
+	config.populateTokenDefaults(role, res.Auth)
+	res.Auth.Renewable = role.TokenType != logical.TokenTypeBatch
+	if role.BindTokenAddresses {
+		res.Auth.BoundCIDRs = boundCIDRs
+	}
+	if req.Operation == logical.UpdateOperation {
+		res.WrapInfo = responseWrapInfo(req, role)
+	}
+
+	// The nonce is consumed and the login recorded only once nothing else
+	// can fail, while the alias lookahead runs before the login itself.
+	if role.NonceMetadataKey != "" && req.Operation == logical.UpdateOperation {
+		err = deleteInstanceNonce(ctx, req.Storage, instanceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if role.DisallowReauthentication && req.Operation == logical.UpdateOperation {
+		now := time.Now()
+		err = updateInstanceLogin(ctx, req.Storage, &InstanceLogin{
+			Name:       instanceID,
+			Role:       roleName,
+			Time:       now,
+			Expiration: now.Add(b.System().MaxLeaseTTL()),
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return res, nil
 }
 
-func (b *OpenStackAuthBackend) authRenewHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := readConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
+func (b *OpenStackAuthBackend) authRenewHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (res *logical.Response, err error) {
+	defer func() {
+		b.recordRenew(req.Auth.Metadata["role"], res, err)
+	}()
+
+	logger := b.requestLogger(req)
 
 	if req.Auth.Alias == nil {
 		return logical.ErrorResponse("instance ID associated with token is invalid"), nil
 	}
 
-	instanceID := req.Auth.Alias.Name
+	// The alias is named after the instance unless alias_name of the config
+	// says otherwise, while the metadata always records the instance.
+	instanceID := req.Auth.Metadata["instance_id"]
+	if instanceID == "" {
+		instanceID = req.Auth.Alias.Name
+	}
 	if instanceID == "" {
 		return logical.ErrorResponse("instance ID associated with token is invalid"), nil
 	}
@@ -151,6 +375,15 @@ func (b *OpenStackAuthBackend) authRenewHandler(ctx context.Context, req *logica
 		return logical.ErrorResponse("role name associated with token is invalid"), nil
 	}
 
+	err = attestNotRevoked(ctx, req.Storage, instanceID)
+	if err != nil && attestReason(err) == "" {
+		return nil, err
+	}
+	if err != nil {
+		logger.Warn("renewal attestation failed", "instance_id", instanceID, "role", roleName, "reason", attestReason(err), "retryable", attestRetryable(err), "hint", attestHint(err), "error", err)
+		return attestErrorResponse("failed to renew", err)
+	}
+
 	role, err := readRole(ctx, req.Storage, roleName)
 	if err != nil {
 		return nil, err
@@ -160,49 +393,326 @@ func (b *OpenStackAuthBackend) authRenewHandler(ctx context.Context, req *logica
 		return logical.ErrorResponse(fmt.Sprintf("role '%s' no longer exists", roleName)), nil
 	}
 
-	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+	if !policyutil.EquivalentPolicies(role.TokenPolicies, req.Auth.Policies) {
 		return logical.ErrorResponse(fmt.Sprintf("policies on role '%s' have changed, cannot renew", roleName)), nil
 	}
 
-	client, err := b.getClient(ctx, req.Storage, role)
+	config, err := b.getRoleConfig(ctx, req.Storage, role)
 	if err != nil {
-		msg := "openstack client error"
-		b.Logger().Error(msg, "error", err)
-		return nil, fmt.Errorf("%s: %v", msg, err)
+		return nil, err
+	}
+
+	if config == nil {
+		return configMissingResponse(role), nil
 	}
 
-	instance, err := servers.Get(client, instanceID).Extract()
+	role, err = b.bindProjectID(ctx, config, role)
+	switch {
+	case errors.Is(err, errProjectNameBinding), errors.Is(err, errProjectBinding), errors.Is(err, errProjectNotFound):
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+	case err != nil:
+		msg := "failed to resolve project of role"
+		logger.Error(msg, "role", roleName, "error", err)
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+	}
+
+	lookup, err := b.instanceLookup(ctx, req.Storage, config, role)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("failed to find instance: %v", err)), nil
+		return lookupErrorResponse(logger, roleName, err)
+	}
+
+	// An instance which got a token and is no longer found by a lookup
+	// across all the projects has been deleted.
+	instance, err := lookup(ctx, instanceID)
+	if errors.Is(err, errInstanceNotFound) && config.AllTenants {
+		recordErr := b.recordInstanceDeleted(ctx, req.Storage, instanceID, req.Auth.Metadata["project_id"])
+		if recordErr != nil {
+			return nil, recordErr
+		}
+	}
+	if err != nil {
+		return b.instanceErrorResponse(logger, instanceID, err)
+	}
+
+	if instanceDeleted(instance) {
+		err = b.recordInstanceDeleted(ctx, req.Storage, instance.ID, instance.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		return b.instanceErrorResponse(logger, instanceID, errInstanceNotFound)
 	}
 
 	attestor := NewAttestor(req.Storage)
 	if err != nil {
 		msg := "attestor error"
-		b.Logger().Error(msg, "error", err)
+		logger.Error(msg, "error", err)
 		return nil, fmt.Errorf("%s: %v", msg, err)
 	}
 
-	err = attestor.AttestMetadata(instance, role.MetadataKey, role.Name)
+	err = attestor.AttestRoleMetadata(instance, role)
+	if err == nil {
+		err = attestor.AttestBoundMetadata(instance, role.BoundMetadata)
+	}
+	if err == nil {
+		err = attestor.AttestTags(instance, role)
+	}
+	if err == nil {
+		err = attestor.AttestTenantID(instance, role.TenantID)
+	}
+	if err == nil {
+		err = attestor.AttestTenantID(instance, role.ProjectID)
+	}
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("failed to renew: %v", err)), nil
+		if ok, suppressed := b.logSampler.Sample(fmt.Sprintf("renew/%s/%s/%s", instanceID, roleName, attestReason(err))); ok {
+			logger.Warn("renewal attestation failed", "instance_id", instanceID, "role", roleName, "project", instance.TenantID, "reason", attestReason(err), "retryable", attestRetryable(err), "hint", attestHint(err), "error", err, "suppressed", suppressed)
+		}
+		return attestErrorResponse("failed to renew", err)
 	}
 
-	attestAddresses := []string{req.Connection.RemoteAddr}
-	for _, header := range config.RequestAddressHeaders {
-		if val, ok := req.Headers[header]; ok {
-			attestAddresses = append(attestAddresses, val...)
+	err = b.attestBindings(ctx, req.Storage, config, role, instance)
+	if err != nil && attestReason(err) == "" {
+		return bindingErrorResponse(logger, instanceID, roleName, role, err)
+	}
+	if err != nil {
+		if ok, suppressed := b.logSampler.Sample(fmt.Sprintf("renew/%s/%s/%s", instanceID, roleName, attestReason(err))); ok {
+			logger.Warn("renewal attestation failed", "instance_id", instanceID, "role", roleName, "project", instance.TenantID, "reason", attestReason(err), "retryable", attestRetryable(err), "hint", attestHint(err), "error", err, "suppressed", suppressed)
+		}
+		return attestErrorResponse("failed to renew", err)
+	}
+
+	// The roles requiring a nonce do not verify the address, and the nonce
+	// cannot be verified again since the login consumed it.
+	attestAddresses := b.requestAddresses(req, config)
+	if role.NonceMetadataKey == "" {
+		instance, err = b.resolveFloatingIPs(ctx, req.Storage, role, instance, attestAddresses)
+		if err != nil {
+			msg := "failed to resolve floating IPs"
+			logger.Error(msg, "instance_id", instanceID, "role", roleName, "error", err)
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+		}
+		err = attestor.AttestAddr(instance, attestAddresses, role.AcceptedSourceCIDRs)
+		if err == nil {
+			err = b.attestPortOwnership(ctx, req.Storage, role, instance, b.trustedAddresses(req, config))
+			if err != nil && attestReason(err) == "" {
+				msg := "failed to verify port ownership"
+				logger.Error(msg, "instance_id", instanceID, "role", roleName, "error", err)
+				return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+			}
 		}
 	}
-	err = attestor.AttestAddr(instance, attestAddresses, role.AdditionalAcceptedPrefixes)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("failed to renew: %v", err)), nil
+		if ok, suppressed := b.logSampler.Sample(fmt.Sprintf("renew/%s/%s/%s", instanceID, roleName, attestReason(err))); ok {
+			logger.Warn("renewal attestation failed", "instance_id", instanceID, "role", roleName, "project", instance.TenantID, "request_addr", attestAddresses, "reason", attestReason(err), "retryable", attestRetryable(err), "hint", attestHint(err), "error", err, "suppressed", suppressed)
+		}
+		return attestErrorResponse("failed to renew", err)
 	}
 
-	res := &logical.Response{Auth: req.Auth}
-	res.Auth.Period = role.Period
-	res.Auth.TTL = role.TTL
-	res.Auth.MaxTTL = role.MaxTTL
+	groupAliases, err := b.groupAliases(ctx, req.Storage, role, instance)
+	if err != nil {
+		msg := "failed to look up role assignments"
+		logger.Error(msg, "instance_id", instanceID, "role", roleName, "user", instance.UserID, "error", err)
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+	}
+
+	res = &logical.Response{Auth: req.Auth}
+	if role.KeystoneGroupAliases {
+		res.Auth.GroupAliases = groupAliases
+	}
+	res.Auth.Period = role.TokenPeriod
+	res.Auth.TTL = role.TokenTTL
+	res.Auth.MaxTTL = role.TokenMaxTTL
+	config.populateTokenDefaults(role, res.Auth)
 
 	return res, nil
 }
+
+// auditMetadata returns the token metadata. The role name is always
+// recorded since the renewal depends on it, the other login fields are
+// recorded only if configured so that they appear in the audit log as is.
+func auditMetadata(config *Config, instanceID, roleName string, addrs []string) map[string]string {
+	metadata := map[string]string{
+		"role": roleName,
+	}
+
+	for _, field := range config.AuditNonHMACFields {
+		switch field {
+		case "instance_id":
+			metadata["instance_id"] = instanceID
+		case "request_addr":
+			metadata["request_addr"] = strings.Join(addrs, ",")
+		}
+	}
+
+	return metadata
+}
+
+// identityMetadata returns the OpenStack identity of the instance, which
+// is set on both the entity alias, for the identity templates, and the
+// token. The attributes the instance does not have are left out.
+func identityMetadata(config *Config, role *Role, instance *Instance) map[string]string {
+	metadata := map[string]string{}
+
+	for key, val := range map[string]string{
+		"instance_id":   instance.ID,
+		"instance_name": instance.Name,
+		"project_id":    instance.TenantID,
+		"user_id":       instance.UserID,
+		"region":        role.region(config),
+	} {
+		if val != "" {
+			metadata[key] = val
+		}
+	}
+
+	return metadata
+}
+
+// requestLogger returns the logger annotated with the request ID and the
+// mount accessor, so that the log lines can be matched with the audit log.
+func (b *OpenStackAuthBackend) requestLogger(req *logical.Request) hclog.Logger {
+	return b.Logger().With("request_id", req.ID, "mount_accessor", req.MountAccessor)
+}
+
+type loggerContextKey struct{}
+
+// contextLogger returns the logger of the request the context was passed
+// with, or the logger of the backend outside of the requests, such as in
+// the periodic function.
+func (b *OpenStackAuthBackend) contextLogger(ctx context.Context) hclog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(hclog.Logger); ok {
+		return logger
+	}
+
+	return b.Logger()
+}
+
+// requestAddresses returns the addresses of the request used for the
+// attestation, taken from the connection, the address headers of the
+// config or both. With trusted_proxies, the headers are only honored on
+// the connections of the proxies, and each header value yields the client
+// address behind the proxies. The number of addresses is capped so that a
+// request with oversized headers cannot inflate the memory used by a login.
+func (b *OpenStackAuthBackend) requestAddresses(req *logical.Request, config *Config) []string {
+	addrs := make([]string, 0, maxRequestAddresses)
+
+	remoteAddr := ""
+	if req.Connection != nil {
+		remoteAddr = req.Connection.RemoteAddr
+	}
+
+	source := config.addressSource()
+	if remoteAddr != "" && source != addressSourceHeaders {
+		addrs = append(addrs, remoteAddr)
+	}
+
+	proxies := config.trustedProxies()
+	if source == addressSourceConnection || (len(proxies) > 0 && !proxies.contains(remoteAddr)) {
+		return addrs
+	}
+
+	for _, header := range config.RequestAddressHeaders {
+		for _, val := range req.Headers[header] {
+			if len(proxies) > 0 {
+				val = proxies.clientAddress(val)
+				if val == "" {
+					continue
+				}
+			}
+			if len(addrs) >= maxRequestAddresses {
+				metrics.IncrCounter([]string{"openstack", "login", "addresses_truncated"}, 1)
+				if ok, suppressed := b.logSampler.Sample("login/addresses_truncated"); ok {
+					b.requestLogger(req).Warn("too many request addresses, ignoring the rest", "limit", maxRequestAddresses, "suppressed", suppressed)
+				}
+				return addrs
+			}
+			addrs = append(addrs, val)
+		}
+	}
+
+	return addrs
+}
+
+// trustedAddresses returns the request addresses which the caller cannot
+// choose: the address of the connection, or the addresses of the headers
+// when they were resolved through trusted_proxies. Without trusted_proxies,
+// every caller may set the address headers.
+func (b *OpenStackAuthBackend) trustedAddresses(req *logical.Request, config *Config) []string {
+	if len(config.trustedProxies()) > 0 {
+		return b.requestAddresses(req, config)
+	}
+
+	if req.Connection == nil || req.Connection.RemoteAddr == "" {
+		return nil
+	}
+
+	return []string{req.Connection.RemoteAddr}
+}
+
+// instanceErrorResponse converts the instance lookup error to the response.
+// A missing instance denies the request, while errors caused by the backend
+// credentials or the compute API are reported as upstream failures instead
+// of being reported as a missing instance.
+func (b *OpenStackAuthBackend) instanceErrorResponse(logger hclog.Logger, instanceID string, err error) (*logical.Response, error) {
+	switch {
+	case errors.Is(err, errInvalidInstanceID):
+		return logical.ErrorResponse(fmt.Sprintf("failed to find instance: %v", err)), nil
+	case errors.Is(err, errInstanceNotFound):
+		return nil, logical.CodedError(http.StatusForbidden, fmt.Sprintf("failed to find instance: %v (hint: %s)", err, instanceNotFoundHint))
+	case errors.Is(err, errTooManyLookups), errors.Is(err, errUnavailable):
+		// The rejections come in bursts from many instances at once, so
+		// the line is sampled regardless of the instance.
+		key := "lookup/unavailable"
+		if errors.Is(err, errTooManyLookups) {
+			key = "lookup/too_many"
+		}
+		if ok, suppressed := b.logSampler.Sample(key); ok {
+			logger.Warn("rejecting instance lookup", "instance_id", instanceID, "error", err, "suppressed", suppressed)
+		}
+		return nil, logical.CodedError(http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, errUnauthorized), errors.Is(err, errForbidden):
+		logger.Error("openstack client is not allowed to read instance", "instance_id", instanceID, "hint", credentialsHint, "error", err)
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%v (hint: %s)", err, credentialsHint))
+	}
+
+	msg := "openstack client error"
+	logger.Error(msg, "instance_id", instanceID, "error", err)
+	return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+}
+
+// bindingErrorResponse converts the error of a role binding which could not
+// be verified, as opposed to an instance failing the binding, to the
+// response.
+func bindingErrorResponse(logger hclog.Logger, instanceID, roleName string, role *Role, err error) (*logical.Response, error) {
+	if errors.Is(err, errCircuitOpen) {
+		logger.Warn("rejecting role binding lookup", "instance_id", instanceID, "role", roleName, "error", err)
+		return nil, logical.CodedError(http.StatusServiceUnavailable, err.Error())
+	}
+
+	msg := "failed to verify role bindings"
+	logger.Error(msg, "instance_id", instanceID, "role", roleName, "stack", role.BoundStackID, "error", err)
+	return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("%s: %v", msg, err))
+}
+
+const (
+	instanceNotFoundHint = "pass the ID of the instance from the metadata service, the instance must be in the project of the role"
+	credentialsHint      = "the credentials of the config need a reader role on the project of the role, check them with `openstack server show`"
+)
+
+// attestErrorResponse returns the response to a failed attestation.
+// Exceeding the authentication limit is reported as 429 so that the
+// clients back off, other failures deny the request with 403. Vault only
+// returns the message of the error to the client, so the reason of the
+// failure and whether it is worth retrying are put in the message, as
+// key=value pairs a client can match.
+func attestErrorResponse(msg string, err error) (*logical.Response, error) {
+	reason := attestReason(err)
+	if reason != "" {
+		msg = fmt.Sprintf("%s (reason=%s retryable=%t)", msg, reason, attestRetryable(err))
+	}
+	msg = withHint(fmt.Sprintf("%s: %v", msg, err), err)
+	if reason == ReasonAuthLimitExceeded {
+		return nil, logical.CodedError(http.StatusTooManyRequests, msg)
+	}
+
+	return nil, logical.CodedError(http.StatusForbidden, msg)
+}
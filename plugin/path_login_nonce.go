@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const loginNonceSynopsis = "Issues a nonce for an OpenStack instance to log in with."
+const loginNonceDescription = `
+Issues a one-time nonce for an instance and a role which requires a nonce.
+The instance writes the nonce into its server metadata under the
+nonce_metadata_key of the role with the compute API, then logs in. The
+nonce is consumed by the login and expires after 5 minutes.
+`
+
+func NewPathLoginNonce(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "login/nonce$",
+			Fields:  loginFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.loginNonceHandler,
+					Summary:  "Issue a nonce for an OpenStack instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"nonce": {
+									Type:        framework.TypeString,
+									Description: "Nonce to write into the instance metadata.",
+								},
+								"metadata_key": {
+									Type:        framework.TypeString,
+									Description: "Instance metadata key to write the nonce into.",
+								},
+								"expiration": {
+									Type:        framework.TypeTime,
+									Description: "Time the nonce expires at.",
+								},
+							},
+						}},
+						http.StatusBadRequest: {{Description: "The request is malformed or the role does not require a nonce"}},
+						http.StatusForbidden:  {{Description: "The instance was not found"}},
+					},
+				},
+			},
+			HelpSynopsis:    loginNonceSynopsis,
+			HelpDescription: loginNonceDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) loginNonceHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	logger := b.requestLogger(req)
+
+	instanceID := data.Get("instance_id").(string)
+	if instanceID == "" {
+		return logical.ErrorResponse("instance_id required"), nil
+	}
+
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("role required"), nil
+	}
+
+	role, err := readRole(ctx, req.Storage, roleName)
+	if err != nil || role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+	}
+
+	if role.NonceMetadataKey == "" {
+		return logical.ErrorResponse(fmt.Sprintf("role '%s' does not require a nonce", roleName)), nil
+	}
+
+	config, err := b.getRoleConfig(ctx, req.Storage, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return configMissingResponse(role), nil
+	}
+
+	role, err = b.bindProjectID(ctx, config, role)
+	switch {
+	case errors.Is(err, errProjectNameBinding), errors.Is(err, errProjectBinding), errors.Is(err, errProjectNotFound):
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+	case err != nil:
+		return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to resolve project of role: %v", err))
+	}
+
+	// The nonces are only issued to existing instances, so that the
+	// storage cannot be filled with the nonces of made up instances.
+	lookup, err := b.instanceLookup(ctx, req.Storage, config, role)
+	if err != nil {
+		return lookupErrorResponse(logger, roleName, err)
+	}
+
+	_, err = lookup(ctx, instanceID)
+	if err != nil {
+		return b.instanceErrorResponse(logger, instanceID, err)
+	}
+
+	// The nonces of the instance are not issued while a login consumes
+	// them.
+	lock := locksutil.LockForKey(b.instanceLocks, instanceID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	nonce, expiration, err := issueInstanceNonce(ctx, req.Storage, instanceID, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue nonce: %w", err)
+	}
+
+	logger.Info("nonce issued", "instance_id", instanceID, "role", roleName, "expiration", expiration)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"nonce":        nonce,
+			"metadata_key": role.NonceMetadataKey,
+			"expiration":   expiration,
+		},
+	}, nil
+}
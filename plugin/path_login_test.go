@@ -0,0 +1,1883 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/summerwind/vault-plugin-auth-openstack/internal/openstacktest"
+)
+
+func newTestLoginBackend(t testing.TB, m *mockOpenStack) (logical.Backend, logical.Storage) {
+	b, storage := newTestBackend(t)
+
+	requests := []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"auth_url":         m.AuthURL(),
+				"username":         "vault",
+				"password":         "secret",
+				"user_domain_name": "Default",
+				"project_id":       mockProjectID,
+			},
+		},
+		{
+			Operation: logical.CreateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"policies":     "test",
+				"metadata_key": "vault-role",
+				"auth_period":  120,
+				"auth_limit":   1,
+			},
+		},
+	}
+
+	for _, req := range requests {
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unable to configure backend: %v - %v", res, err)
+		}
+	}
+
+	return b, storage
+}
+
+func newTestLoginRequest(storage logical.Storage, instanceID, addr string) *logical.Request {
+	return &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login",
+		Storage:    storage,
+		Connection: &logical.Connection{RemoteAddr: addr},
+		Data: map[string]interface{}{
+			"instance_id": instanceID,
+			"role":        "test",
+		},
+	}
+}
+
+func TestLogin(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		instanceID string
+		addr       string
+		status     int
+	}{
+		// fail: address mismatched
+		{instance.ID, wrongIPv4, http.StatusForbidden},
+		// fail: unknown instance
+		{"0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c", correctIPv4, http.StatusForbidden},
+		// fail: invalid instance ID
+		{"detail", correctIPv4, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := newTestLoginRequest(storage, test.instanceID, test.addr)
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+
+	b, storage := newTestLoginBackend(t, m)
+
+	res, err := b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Auth.Alias.Name != instance.ID || res.Auth.Metadata["role"] != "test" {
+		t.Errorf("unexpected auth: %v", res.Auth)
+	}
+	for _, metadata := range []map[string]string{res.Auth.Alias.Metadata, res.Auth.Metadata} {
+		if metadata["instance_id"] != instance.ID || metadata["instance_name"] != instance.Name || metadata["project_id"] != instance.TenantID || metadata["user_id"] != instance.UserID {
+			t.Errorf("unexpected identity metadata: %v", metadata)
+		}
+	}
+
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusTooManyRequests {
+		t.Errorf("auth limit was not enforced: %d, %v - %v", status, res, err)
+	}
+}
+
+func TestLoginUpstreamError(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	m.Close()
+
+	req := newTestLoginRequest(storage, "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5", correctIPv4)
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadGateway {
+		t.Errorf("unexpected status: %d, %v - %v", status, res, err)
+	}
+}
+
+// responseStatus returns the HTTP status code which Vault responds with
+// for the result of the request.
+func responseStatus(req *logical.Request, res *logical.Response, err error) int {
+	status, _ := logical.RespondErrorCommon(req, res, err)
+	if status == 0 {
+		return http.StatusOK
+	}
+	logical.AdjustErrorStatusCode(&status, err)
+
+	return status
+}
+
+func TestLoginAuditMetadata(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"audit_non_hmac_fields": "invalid"},
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || !res.IsError() {
+		t.Fatalf("invalid field was accepted: %v - %v", res, err)
+	}
+
+	req.Data["audit_non_hmac_fields"] = "instance_id,request_addr"
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	metadata := res.Auth.Metadata
+	if metadata["role"] != "test" || metadata["instance_id"] != instance.ID || metadata["request_addr"] != correctIPv4 {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+
+	// Without trusted_proxies, any caller may set the address headers, so
+	// only the address of the connection is recorded.
+	other := newTestLoginInstance("4e6a8c0e-2a4c-4e6a-8c0e-2a4c6e8a0c2e")
+	m.AddServer(&other.Server)
+
+	req.Data = map[string]interface{}{"request_address_headers": "X-Forwarded-For"}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	req = newTestLoginRequest(storage, other.ID, correctIPv4)
+	req.Headers = map[string][]string{"X-Forwarded-For": {"203.0.113.10"}}
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	if addr := res.Auth.Metadata["request_addr"]; addr != correctIPv4 {
+		t.Errorf("unexpected request address: %s", addr)
+	}
+}
+
+func TestLoginAliasName(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		aliasName string
+		alias     string
+		status    int
+	}{
+		{"", instance.ID, http.StatusOK},
+		{"instance_id", instance.ID, http.StatusOK},
+		{"project_id", instance.TenantID, http.StatusOK},
+		{"role", "test", http.StatusOK},
+		// fail: unknown attribute
+		{"user_id", "", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      map[string]interface{}{"alias_name": test.aliasName},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != http.StatusOK {
+			if status != test.status {
+				t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+			}
+			continue
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+			continue
+		}
+
+		if res.Auth.Alias.Name != test.alias || res.Auth.Metadata["instance_id"] != instance.ID {
+			t.Errorf("unexpected alias: %v - %v", test, res.Auth)
+		}
+
+		req = &logical.Request{
+			Operation: logical.RenewOperation,
+			Path:      "login",
+			Storage:   storage,
+			Auth:      res.Auth,
+			Connection: &logical.Connection{
+				RemoteAddr: correctIPv4,
+			},
+		}
+		req.Auth.IssueTime = time.Now()
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Errorf("unexpected renewal result: %v - %v, %v", test, res, err)
+		}
+	}
+}
+
+func TestLoginServerChanges(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("1f3b5d7f-9b1d-4f3b-8d7f-9b1d3f5b7d9f")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		status   string
+		metadata map[string]string
+		code     int
+	}{
+		{"ACTIVE", map[string]string{"vault-role": "test"}, http.StatusOK},
+		// fail: instance is not running
+		{"SHUTOFF", map[string]string{"vault-role": "test"}, http.StatusForbidden},
+		// fail: role is not assigned to the instance
+		{"ACTIVE", map[string]string{"vault-role": "other"}, http.StatusForbidden},
+		{"ACTIVE", map[string]string{"vault-role": "test"}, http.StatusOK},
+	}
+
+	for i, test := range tests {
+		m.SetServerStatus(instance.ID, test.status)
+		m.SetServerMetadata(instance.ID, test.metadata)
+
+		b, storage := newTestLoginBackend(t, m)
+		req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err := b.HandleRequest(context.Background(), req)
+		if code := responseStatus(req, res, err); code != test.code {
+			t.Errorf("%d: unexpected status: %d - %v - %v", i, code, res, err)
+		}
+	}
+}
+
+func TestLoginDeletedInstance(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("7d9f1a3c-5e7b-4d1f-8a5c-7e9b1d3f5a7c")
+	m.AddServer(&instance.Server)
+	m.SetServerStatus(instance.ID, "SOFT_DELETED")
+
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("deleted instance logged in: %d, %v, %v", status, res, err)
+	}
+
+	event, err := readInstanceEvent(context.Background(), storage, instance.ID)
+	if err != nil || event == nil || event.Event != instanceEventDeleted {
+		t.Fatalf("deleted instance was not recorded: %v, %v", event, err)
+	}
+
+	// A stale server record does not bring the instance back.
+	m.SetServerStatus(instance.ID, "ACTIVE")
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("replayed login was not denied: %d, %v, %v", status, res, err)
+	}
+}
+
+func TestLoginDisallowReauthentication(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("9f1a3c5e-7b9d-4f3a-8c7e-9b1d3f5a7c9e")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		disallow bool
+		status   int
+	}{
+		{false, http.StatusOK},
+		// fail: logged in before
+		{true, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"auth_limit": 10, "disallow_reauthentication": test.disallow},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil || res.IsError() {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginDisallowReauthenticationFailedLogin(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("3e5a7c9f-1b3d-4f5a-8c7e-9d1b3f5a7c2e")
+	m.AddServer(&instance.Server)
+	m.AddRoleAssignment(instance.UserID, instance.TenantID, "member")
+
+	b, storage := newTestLoginBackend(t, m)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data:      map[string]interface{}{"auth_limit": 10, "disallow_reauthentication": true, "keystone_group_aliases": true},
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	// A login which fails after the attestation is not recorded.
+	m.SetRoleAssignmentsForbidden(true)
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadGateway {
+		t.Fatalf("unexpected status: %d, %v, %v", status, res, err)
+	}
+
+	m.SetRoleAssignmentsForbidden(false)
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res.IsError() {
+		t.Fatalf("instance was locked out: %v - %v", res, err)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("reauthentication was not denied: %d, %v, %v", status, res, err)
+	}
+}
+
+func TestLoginFloatingIP(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("1a3c5e7b-9d1f-4a5c-8e7b-1d3f5a7c9e1b")
+	m.AddServer(&instance.Server)
+	m.AddServerFloatingIP(instance.ID, "203.0.113.10")
+
+	var tests = []struct {
+		resolve bool
+		addr    string
+		status  int
+	}{
+		{true, "203.0.113.10", http.StatusOK},
+		{true, correctIPv4, http.StatusOK},
+		// fail: floating IPs are not resolved
+		{false, "203.0.113.10", http.StatusForbidden},
+		// fail: floating IP of another instance
+		{true, "203.0.113.20", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"resolve_floating_ips": test.resolve},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, test.addr)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginPortOwnership(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("3c5e7b9d-1f3a-4c7e-8b9d-3f5a7c9e1b3d")
+	m.AddServer(&instance.Server)
+	m.AddServerFloatingIP(instance.ID, "203.0.113.10")
+
+	headers := map[string]interface{}{"request_address_headers": "X-Forwarded-For"}
+	proxies := map[string]interface{}{"request_address_headers": "X-Forwarded-For", "trusted_proxies": wrongIPv4 + "/32"}
+
+	var tests = []struct {
+		config map[string]interface{}
+		data   map[string]interface{}
+		addr   string
+		header string
+		status int
+	}{
+		{nil, map[string]interface{}{"attest_port_ownership": true}, correctIPv4, "", http.StatusOK},
+		{nil, map[string]interface{}{"attest_port_ownership": true, "resolve_floating_ips": true}, "203.0.113.10", "", http.StatusOK},
+		{nil, map[string]interface{}{"accepted_source_cidrs": wrongIPv4 + "/32"}, wrongIPv4, "", http.StatusOK},
+		// fail: no port holds the accepted address
+		{nil, map[string]interface{}{"attest_port_ownership": true, "accepted_source_cidrs": wrongIPv4 + "/32"}, wrongIPv4, "", http.StatusForbidden},
+		// fail: the header is not set by a trusted proxy
+		{headers, map[string]interface{}{"attest_port_ownership": true}, wrongIPv4, correctIPv4, http.StatusForbidden},
+		{proxies, map[string]interface{}{"attest_port_ownership": true}, wrongIPv4, correctIPv4, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		if test.config != nil {
+			req := &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data:      test.config,
+			}
+			res, err := b.HandleRequest(context.Background(), req)
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.data,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, test.addr)
+		if test.header != "" {
+			req.Headers = map[string][]string{"X-Forwarded-For": {test.header}}
+		}
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test.data, status, res, err)
+		}
+	}
+}
+
+func TestLoginPortOwnershipSharedAddress(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("9b1d3f5a-7c9e-4b1d-8f3a-5c7e9b1d3f6a")
+	m.AddServer(&instance.Server)
+
+	// An instance of another network holds the same fixed IP.
+	other := newTestLoginInstance("2c4e6a8b-0d2f-4a6c-8e0b-4d6f8a0c2e4b")
+	other.TenantID = "2ba1f6a5d7b64a7d9bc6e5e2f2b7c3d1"
+	m.AddServer(&other.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data:      map[string]interface{}{"attest_port_ownership": true},
+	}
+	res, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("login with a shared address was not denied: %d, %v, %v", status, res, err)
+	}
+}
+
+func TestLoginConfigTokenDefaults(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("5e7b9d1f-3a5c-4e9b-8d1f-5a7c9e1b3d5f")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		role   map[string]interface{}
+		ttl    time.Duration
+		maxTTL time.Duration
+		period time.Duration
+	}{
+		{map[string]interface{}{}, 10 * time.Minute, time.Hour, 5 * time.Minute},
+		{map[string]interface{}{"token_ttl": 60, "token_period": 120}, time.Minute, time.Hour, 2 * time.Minute},
+		{map[string]interface{}{"token_type": "batch"}, 10 * time.Minute, time.Hour, 0},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		requests := []*logical.Request{
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data:      map[string]interface{}{"ttl": 600, "max_ttl": 3600, "period": 300},
+			},
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "role/test",
+				Storage:   storage,
+				Data:      test.role,
+			},
+		}
+		for _, req := range requests {
+			res, err := b.HandleRequest(context.Background(), req)
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || res.IsError() {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+		if res.Auth.TTL != test.ttl || res.Auth.MaxTTL != test.maxTTL || res.Auth.Period != test.period {
+			t.Errorf("unexpected token params: %v - %v, %v, %v", test.role, res.Auth.TTL, res.Auth.MaxTTL, res.Auth.Period)
+		}
+	}
+}
+
+func TestLoginResponseWrapping(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("7b9d1f3a-5c7e-4b1d-8f3a-7c9e1b3d5f7a")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		role    map[string]interface{}
+		wrapTTL time.Duration
+		ttl     time.Duration
+	}{
+		{map[string]interface{}{}, 0, 0},
+		{map[string]interface{}{"require_response_wrapping": true}, 0, time.Minute},
+		{map[string]interface{}{"require_response_wrapping": true, "response_wrapping_ttl": 300}, 0, 5 * time.Minute},
+		{map[string]interface{}{"require_response_wrapping": true, "response_wrapping_ttl": 300}, 30 * time.Second, 30 * time.Second},
+		{map[string]interface{}{"require_response_wrapping": true}, time.Hour, time.Minute},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.role,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		if test.wrapTTL > 0 {
+			req.WrapInfo = &logical.RequestWrapInfo{TTL: test.wrapTTL}
+		}
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil || res.IsError() {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		var ttl time.Duration
+		if res.WrapInfo != nil {
+			ttl = res.WrapInfo.TTL
+		}
+		if ttl != test.ttl {
+			t.Errorf("unexpected wrapping TTL: %v - %v", test.role, ttl)
+		}
+	}
+}
+
+func TestLoginInstanceName(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	web := newTestLoginInstance("1a3c5e7b-9d1f-4a5c-8e7b-9d1f3a5c7e9b")
+	web.Name = "web-1"
+	m.AddServer(&web.Server)
+
+	for _, id := range []string{"3c5e7b9d-1f3a-4c7e-9b1d-3f5a7c9e1b3d", "5e7b9d1f-3a5c-4e9b-8d3f-5a7c9e1b3d5f"} {
+		db := newTestLoginInstance(id)
+		db.Name = "db"
+		m.AddServer(&db.Server)
+	}
+
+	var tests = []struct {
+		data   map[string]interface{}
+		role   map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{"instance_name": "web-1"}, map[string]interface{}{"project_id": mockProjectID}, http.StatusOK},
+		// fail: not a regular expression
+		{map[string]interface{}{"instance_name": "web-."}, map[string]interface{}{"project_id": mockProjectID}, http.StatusForbidden},
+		// fail: unknown name
+		{map[string]interface{}{"instance_name": "web-2"}, map[string]interface{}{"project_id": mockProjectID}, http.StatusForbidden},
+		// fail: ambiguous name
+		{map[string]interface{}{"instance_name": "db"}, map[string]interface{}{"project_id": mockProjectID}, http.StatusBadRequest},
+		// fail: role not bound to a project
+		{map[string]interface{}{"instance_name": "web-1"}, map[string]interface{}{}, http.StatusBadRequest},
+		// fail: both instance_id and instance_name
+		{map[string]interface{}{"instance_name": "web-1", "instance_id": web.ID}, map[string]interface{}{"project_id": mockProjectID}, http.StatusBadRequest},
+		// fail: neither instance_id nor instance_name
+		{map[string]interface{}{}, map[string]interface{}{"project_id": mockProjectID}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.role,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, "", correctIPv4)
+		delete(req.Data, "instance_id")
+		for key, val := range test.data {
+			req.Data[key] = val
+		}
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+			continue
+		}
+
+		if test.status == http.StatusOK && res.Auth.Alias.Name != web.ID {
+			t.Errorf("unexpected alias: %v - %v", test, res.Auth.Alias)
+		}
+	}
+}
+
+func newTestLoginInstance(id string) *Instance {
+	instance := newTestInstance()
+	instance.ID = id
+	instance.AccessIPv4 = correctIPv4
+	instance.Metadata["vault-role"] = "test"
+	instance.Created = time.Now()
+
+	return instance
+}
+
+func TestRequestAddresses(t *testing.T) {
+	b := NewBackend()
+	b.Setup(context.Background(), &logical.BackendConfig{})
+
+	req := &logical.Request{
+		Connection: &logical.Connection{RemoteAddr: proxyIPv4},
+		Headers: map[string][]string{
+			"X-Real-Ip":       {correctIPv4},
+			"X-Forwarded-For": make([]string, 100),
+		},
+	}
+
+	addrs := b.requestAddresses(req, &Config{RequestAddressHeaders: []string{"X-Real-Ip"}})
+	if len(addrs) != 2 || addrs[0] != proxyIPv4 || addrs[1] != correctIPv4 {
+		t.Errorf("unexpected addresses: %v", addrs)
+	}
+
+	addrs = b.requestAddresses(req, &Config{RequestAddressHeaders: []string{"X-Real-Ip", "X-Forwarded-For"}})
+	if len(addrs) != maxRequestAddresses {
+		t.Errorf("unexpected number of addresses: %d", len(addrs))
+	}
+
+	req.Headers["X-Forwarded-For"] = []string{wrongIPv4 + ", " + correctIPv4 + ", " + proxyIPv4}
+
+	var tests = []struct {
+		source  string
+		proxies []string
+		addrs   []string
+	}{
+		{"", nil, []string{proxyIPv4, wrongIPv4 + ", " + correctIPv4 + ", " + proxyIPv4}},
+		{"connection", nil, []string{proxyIPv4}},
+		{"headers", []string{proxyIPv4 + "/32"}, []string{correctIPv4}},
+		{"both", []string{proxyIPv4 + "/32"}, []string{proxyIPv4, correctIPv4}},
+		// the connection is not a trusted proxy
+		{"headers", []string{wrongIPv4 + "/32"}, []string{}},
+	}
+
+	for _, test := range tests {
+		config := &Config{
+			RequestAddressHeaders: []string{"X-Forwarded-For"},
+			RequestAddressSource:  test.source,
+			TrustedProxies:        test.proxies,
+		}
+		addrs := b.requestAddresses(req, config)
+		if !reflect.DeepEqual(addrs, test.addrs) {
+			t.Errorf("unexpected addresses: %v - %v", test, addrs)
+		}
+	}
+}
+
+func TestLoginAllTenants(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("ef079b0c-e610-4dfb-b1aa-b49f07ac48e5")
+	m.AddServer(&instance.Server)
+	m.AddProject(instance.TenantID, "test")
+	m.AddProject("2ba1f6a5d7b64a7d9bc6e5e2f2b7c3d1", "other")
+
+	var tests = []struct {
+		projectID   string
+		projectName string
+		selectel    bool
+		result      bool
+	}{
+		{instance.TenantID, "", false, true},
+		{"2ba1f6a5d7b64a7d9bc6e5e2f2b7c3d1", "", false, false},
+		{"", "test", false, false},
+		{"", "test", true, true},
+		{"", "other", true, false},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		config := map[string]interface{}{"all_tenants": true}
+		if test.selectel {
+			config["selectel_api_url"] = m.SelectelURL()
+			config["selectel_api_token"] = mockSelectelToken
+		}
+
+		requests := []*logical.Request{
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data:      config,
+			},
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "role/test",
+				Storage:   storage,
+				Data:      map[string]interface{}{"project_id": test.projectID, "project_name": test.projectName},
+			},
+		}
+		for _, req := range requests {
+			res, err := b.HandleRequest(context.Background(), req)
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil && responseStatus(req, res, err) != http.StatusForbidden {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if (res != nil && res.Auth != nil && !res.IsError()) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, res)
+		}
+	}
+}
+
+func TestRenewAllTenants(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("5c2e8a4d-3f1b-4e7a-9d6c-8b0a2f4e6c1d")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	requests := []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      map[string]interface{}{"all_tenants": true},
+		},
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"project_id": instance.TenantID},
+		},
+	}
+	for _, req := range requests {
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+	}
+
+	// fail: the role is not bound to a project
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data:      map[string]interface{}{"project_id": ""},
+	})
+	if err != nil || res == nil || !res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	auth := res.Auth
+
+	// The role moves to another project after the login.
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data:      map[string]interface{}{"project_id": "2ba1f6a5d7b64a7d9bc6e5e2f2b7c3d1"},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      auth,
+		Connection: &logical.Connection{
+			RemoteAddr: correctIPv4,
+		},
+	}
+	req.Auth.IssueTime = time.Now()
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("unexpected status: %d, %v, %v", status, res, err)
+	}
+}
+
+func TestLoginAllTenantsUnboundRole(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("7a9c1e3b-5d7f-4b9a-8c1e-3d5f7b9a1c4e")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/nonce",
+		Storage:   storage,
+		Data:      map[string]interface{}{"nonce_metadata_key": "vault-nonce"},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	auth := res.Auth
+
+	// The config sets all_tenants after the roles were written.
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"all_tenants": true},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	requests := []*logical.Request{
+		newTestLoginRequest(storage, instance.ID, correctIPv4),
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "login/nonce",
+			Storage:   storage,
+			Data:      map[string]interface{}{"instance_id": instance.ID, "role": "nonce"},
+		},
+		{
+			Operation: logical.RenewOperation,
+			Path:      "login",
+			Storage:   storage,
+			Auth:      auth,
+			Connection: &logical.Connection{
+				RemoteAddr: correctIPv4,
+			},
+		},
+	}
+	for _, req := range requests {
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != http.StatusBadRequest {
+			t.Errorf("unbound role was not denied: %s %s - %d, %v, %v", req.Operation, req.Path, status, res, err)
+		}
+	}
+}
+
+func TestRoleProjectValidation(t *testing.T) {
+	m := newMockOpenStack(t)
+	m.AddProject(mockProjectID, "test")
+
+	b, storage := newTestLoginBackend(t, m)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"selectel_api_url":   m.SelectelURL(),
+			"selectel_api_token": mockSelectelToken,
+		},
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		projectName string
+		result      bool
+	}{
+		{"test", true},
+		{"unknown", false},
+	}
+
+	for _, test := range tests {
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"project_name": test.projectName},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if (res == nil || !res.IsError()) != test.result {
+			t.Errorf("unexpected result: %v - %v", test, res)
+		}
+	}
+}
+
+func TestLoginDedicated(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	server := &openstacktest.DedicatedServer{
+		UUID:        "7d1e2a3b-4c5d-4e6f-8a9b-0c1d2e3f4a5b",
+		Name:        "dedicated",
+		State:       "active",
+		ProjectUUID: mockProjectID,
+		IPAddresses: []string{correctIPv4},
+		Tags:        map[string]string{"vault-role": "test"},
+		Created:     time.Now(),
+	}
+	m.AddDedicatedServer(server)
+
+	var tests = []struct {
+		selectel   bool
+		instanceID string
+		addr       string
+		status     int
+	}{
+		// fail: selectel API is not configured
+		{false, server.UUID, correctIPv4, http.StatusBadRequest},
+		// fail: unknown server
+		{true, "0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c", correctIPv4, http.StatusForbidden},
+		// fail: address mismatched
+		{true, server.UUID, wrongIPv4, http.StatusForbidden},
+		{true, server.UUID, correctIPv4, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		config := map[string]interface{}{}
+		if test.selectel {
+			config["selectel_servers_api_url"] = m.SelectelServersURL()
+			config["selectel_api_token"] = mockSelectelToken
+		}
+
+		requests := []*logical.Request{
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data:      config,
+			},
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "role/test",
+				Storage:   storage,
+				Data:      map[string]interface{}{"server_type": serverTypeDedicated},
+			},
+		}
+		for _, req := range requests {
+			res, err := b.HandleRequest(context.Background(), req)
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req := newTestLoginRequest(storage, test.instanceID, test.addr)
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+
+	if m.AuthRequests() != 0 {
+		t.Errorf("unexpected number of auth requests: %d", m.AuthRequests())
+	}
+}
+
+func TestLoginStack(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	member := newTestLoginInstance("3f1c9a52-8f0e-4b1d-9c55-2a7d6c1e0b41")
+	other := newTestLoginInstance("a6b0e7d2-1c3f-4e58-8d9a-5f2b4c6e7a10")
+	failed := newTestLoginInstance("c2d4e6f8-0a1b-4c3d-8e5f-7a9b1c3d5e7f")
+	m.AddServer(&member.Server)
+	m.AddServer(&other.Server)
+	m.AddServer(&failed.Server)
+
+	m.AddStack(&mockStack{ID: "5b3e8f1a-2c4d-4e6f-9a0b-1c2d3e4f5a6b", Name: "app", Status: "UPDATE_COMPLETE", Instances: []string{member.ID}})
+	m.AddStack(&mockStack{ID: "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b", Name: "broken", Status: "CREATE_FAILED", Instances: []string{failed.ID}})
+	m.AddStack(&mockStack{ID: "1d2c3b4a-5f6e-4d7c-8b9a-0f1e2d3c4b5a", Name: "updating", Status: "UPDATE_IN_PROGRESS", Instances: []string{other.ID}})
+
+	var tests = []struct {
+		stack      string
+		instanceID string
+		status     int
+	}{
+		{"app", member.ID, http.StatusOK},
+		{"5b3e8f1a-2c4d-4e6f-9a0b-1c2d3e4f5a6b", member.ID, http.StatusOK},
+		// fail: instance is not a resource of the stack
+		{"app", other.ID, http.StatusForbidden},
+		// fail: stack is not healthy
+		{"broken", failed.ID, http.StatusForbidden},
+		// fail: stack operation is in progress
+		{"updating", other.ID, http.StatusForbidden},
+		// fail: unknown stack
+		{"missing", member.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"bound_stack_id": test.stack},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginServerGroup(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	member := newTestLoginInstance("4a6c8e0a-2c4e-4a6c-8e0a-2c4e6a8c0e2b")
+	other := newTestLoginInstance("6c8e0a2c-4e6a-4c8e-8a2c-4e6a8c0e2a4d")
+	m.AddServer(&member.Server)
+	m.AddServer(&other.Server)
+
+	m.AddServerGroup(&mockServerGroup{ID: "8e0a2c4e-6a8c-4e0a-8c4e-6a8c0e2a4c6f", Name: "db", Members: []string{member.ID}})
+	m.AddServerGroup(&mockServerGroup{ID: "0a2c4e6a-8c0e-4a2c-8e6a-8c0e2a4c6e80", Name: "dup"})
+	m.AddServerGroup(&mockServerGroup{ID: "2c4e6a8c-0e2a-4c4e-8a8c-0e2a4c6e8a02", Name: "dup"})
+
+	var tests = []struct {
+		data       map[string]interface{}
+		instanceID string
+		status     int
+	}{
+		{map[string]interface{}{"server_group_id": "8e0a2c4e-6a8c-4e0a-8c4e-6a8c0e2a4c6f"}, member.ID, http.StatusOK},
+		{map[string]interface{}{"server_group_name": "db"}, member.ID, http.StatusOK},
+		// fail: instance is not a member of the group
+		{map[string]interface{}{"server_group_name": "db"}, other.ID, http.StatusForbidden},
+		// fail: unknown group
+		{map[string]interface{}{"server_group_id": "missing"}, member.ID, http.StatusForbidden},
+		{map[string]interface{}{"server_group_name": "missing"}, member.ID, http.StatusForbidden},
+		// fail: ambiguous name
+		{map[string]interface{}{"server_group_name": "dup"}, member.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.data,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginTokenType(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("7f91b3d5-e7a9-4c1e-8b3d-5f7a9c1e3b5d")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		data      map[string]interface{}
+		tokenType logical.TokenType
+		renewable bool
+		valid     bool
+	}{
+		{map[string]interface{}{}, logical.TokenTypeDefault, true, true},
+		{map[string]interface{}{"token_type": "service"}, logical.TokenTypeService, true, true},
+		{map[string]interface{}{"token_type": "batch"}, logical.TokenTypeBatch, false, true},
+		// fail: batch tokens cannot be periodic
+		{map[string]interface{}{"token_type": "batch", "token_period": 60}, 0, false, false},
+		{map[string]interface{}{"token_type": "batch", "period": 60}, 0, false, false},
+		// fail: unknown type
+		{map[string]interface{}{"token_type": "invalid"}, 0, false, false},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.data,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if valid := err == nil && (res == nil || !res.IsError()); valid != test.valid {
+			t.Fatalf("unexpected result: %v - %v, %v", test, res, err)
+		}
+		if !test.valid {
+			continue
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if err != nil || res == nil || res.Auth == nil {
+			t.Fatalf("unexpected result: %v - %v, %v", test, res, err)
+		}
+		if res.Auth.TokenType != test.tokenType || res.Auth.Renewable != test.renewable {
+			t.Errorf("unexpected token: %v - %v, %v", test, res.Auth.TokenType, res.Auth.Renewable)
+		}
+	}
+}
+
+func TestLoginBoundMetadata(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("5d7f91b3-c5e7-4a9c-8e1b-3d5f7a9c1e3b")
+	instance.Metadata["env"] = "prod"
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		bound  map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{"env": "prod"}, http.StatusOK},
+		{map[string]interface{}{"env": "p*"}, http.StatusOK},
+		// fail: metadata value mismatched
+		{map[string]interface{}{"env": "dev"}, http.StatusForbidden},
+		// fail: metadata key missing
+		{map[string]interface{}{"env": "prod", "tier": "web"}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"bound_metadata": test.bound},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginFlavor(t *testing.T) {
+	m := newMockOpenStack(t)
+	m.AddFlavor("5b7d9f13-c5e7-4a9c-8d3f-5b7d9f1e3a5c", "hardened")
+
+	instance := newTestLoginInstance("7d9f13b5-e7a9-4c1e-8f5b-7d9f1e3a5c7e")
+	instance.Flavor = map[string]interface{}{"id": "5b7d9f13-c5e7-4a9c-8d3f-5b7d9f1e3a5c"}
+	m.AddServer(&instance.Server)
+
+	// Since microversion 2.47 the flavor of the instance has no ID.
+	embedded := newTestLoginInstance("9f13b5d7-a9c1-4e3a-8b7d-9f1e3a5c7e90")
+	embedded.Flavor = map[string]interface{}{"original_name": "hardened", "vcpus": float64(2)}
+	m.AddServer(&embedded.Server)
+
+	var tests = []struct {
+		data       map[string]interface{}
+		instanceID string
+		status     int
+	}{
+		{map[string]interface{}{"bound_flavor_ids": "5b7d9f13-c5e7-4a9c-8d3f-5b7d9f1e3a5c"}, instance.ID, http.StatusOK},
+		{map[string]interface{}{"bound_flavor_names": "standard,hardened"}, instance.ID, http.StatusOK},
+		{map[string]interface{}{"bound_flavor_names": "hardened"}, embedded.ID, http.StatusOK},
+		{map[string]interface{}{"bound_flavor_ids": "other", "bound_flavor_names": "hardened"}, instance.ID, http.StatusOK},
+		// fail: instance is built on another flavor
+		{map[string]interface{}{"bound_flavor_ids": "other"}, instance.ID, http.StatusForbidden},
+		{map[string]interface{}{"bound_flavor_names": "standard"}, instance.ID, http.StatusForbidden},
+		{map[string]interface{}{"bound_flavor_names": "standard"}, embedded.ID, http.StatusForbidden},
+		// fail: flavor ID is not returned
+		{map[string]interface{}{"bound_flavor_ids": "5b7d9f13-c5e7-4a9c-8d3f-5b7d9f1e3a5c"}, embedded.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.data,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginImage(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("1d3f5b7d-9f1a-4c3e-8d5f-7b9d1f3a5c7e")
+	instance.Image = map[string]interface{}{"id": "2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"}
+	m.AddServer(&instance.Server)
+
+	volume := newTestLoginInstance("3f5b7d9f-1a3c-4e5f-8b7d-9f1a3c5e7b9d")
+	m.AddServer(&volume.Server)
+
+	var tests = []struct {
+		instanceID string
+		status     int
+	}{
+		{instance.ID, http.StatusOK},
+		// fail: booted from a volume
+		{volume.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"bound_image_ids": "2f4b6d8e-0a1c-4e3f-9b5d-7f9a1c3e5b7d"},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginBindTokenAddresses(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("5b7d9f1a-3c5e-4f7b-9d1f-3a5c7e9b1d3f")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		role   map[string]interface{}
+		status int
+		cidrs  []string
+	}{
+		{map[string]interface{}{}, http.StatusOK, nil},
+		{map[string]interface{}{"bind_token_addresses": true}, http.StatusOK, []string{"192.168.1.1"}},
+		{map[string]interface{}{"bind_token_addresses": true, "bind_token_ipv4_mask": 24}, http.StatusOK, []string{"192.168.1.0/24"}},
+		{map[string]interface{}{"bind_token_addresses": true, "accepted_source_cidrs": "10.0.0.0/8"}, http.StatusOK, []string{"192.168.1.1", "10.0.0.0/8"}},
+		// fail: invalid mask
+		{map[string]interface{}{"bind_token_addresses": true, "bind_token_ipv4_mask": 33}, http.StatusBadRequest, nil},
+		// fail: conflicts with token_bound_cidrs
+		{map[string]interface{}{"bind_token_addresses": true, "token_bound_cidrs": "10.0.0.0/8"}, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.role,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != http.StatusOK {
+			if status != test.status {
+				t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+			}
+			continue
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+			continue
+		}
+
+		cidrs := []string{}
+		for _, cidr := range res.Auth.BoundCIDRs {
+			cidrs = append(cidrs, cidr.String())
+		}
+		if len(test.cidrs) == 0 && len(cidrs) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(cidrs, test.cidrs) {
+			t.Errorf("unexpected bound CIDRs: %v - %v", test, cidrs)
+		}
+	}
+}
+
+func TestLoginAvailabilityZone(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("3b5d7f91-a3c5-4e7a-9b1d-3f5a7c9e1b3d")
+	m.AddServer(&instance.Server)
+	m.SetServerAvailabilityZone(instance.ID, "ru-1a")
+
+	var tests = []struct {
+		data   map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{}, http.StatusOK},
+		{map[string]interface{}{"bound_availability_zones": "ru-1a"}, http.StatusOK},
+		{map[string]interface{}{"bound_availability_zones": "ru-1b,ru-1a"}, http.StatusOK},
+		// fail: instance runs in another zone
+		{map[string]interface{}{"bound_availability_zones": "ru-1b"}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      test.data,
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+		if test.status == http.StatusForbidden && !strings.Contains(err.Error(), "availability zone mismatched") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestLoginMKS(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	node := newTestLoginInstance("7d2f4b6a-8c0e-4a1d-9b3f-5e7c9a1b3d5f")
+	delete(node.Metadata, "vault-role")
+	node.Metadata["mks-cluster-id"] = "c1a2b3c4-d5e6-4f70-8a9b-0c1d2e3f4a5b"
+	node.Metadata["mks-nodegroup-id"] = "e5f6a7b8-c9d0-4e1f-8a2b-3c4d5e6f7a8b"
+	m.AddServer(&node.Server)
+
+	plain := newTestLoginInstance("0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e")
+	delete(plain.Metadata, "vault-role")
+	m.AddServer(&plain.Server)
+
+	var tests = []struct {
+		configured bool
+		clusters   string
+		nodeGroups string
+		instanceID string
+		status     int
+	}{
+		{true, "c1a2b3c4-d5e6-4f70-8a9b-0c1d2e3f4a5b", "", node.ID, http.StatusOK},
+		{true, "", "e5f6a7b8-c9d0-4e1f-8a2b-3c4d5e6f7a8b", node.ID, http.StatusOK},
+		{true, "c1a2b3c4-d5e6-4f70-8a9b-0c1d2e3f4a5b", "e5f6a7b8-c9d0-4e1f-8a2b-3c4d5e6f7a8b", node.ID, http.StatusOK},
+		// fail: node of another cluster
+		{true, "f0e1d2c3-b4a5-4968-8776-655443322110", "", node.ID, http.StatusForbidden},
+		// fail: node of another node group
+		{true, "c1a2b3c4-d5e6-4f70-8a9b-0c1d2e3f4a5b", "f0e1d2c3-b4a5-4968-8776-655443322110", node.ID, http.StatusForbidden},
+		// fail: instance is not a Kubernetes node
+		{true, "c1a2b3c4-d5e6-4f70-8a9b-0c1d2e3f4a5b", "", plain.ID, http.StatusForbidden},
+		// fail: metadata keys are not configured
+		{false, "c1a2b3c4-d5e6-4f70-8a9b-0c1d2e3f4a5b", "", node.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		requests := []*logical.Request{
+			{
+				Operation: logical.UpdateOperation,
+				Path:      "role/test",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"metadata_key":            "",
+					"bound_mks_cluster_ids":   test.clusters,
+					"bound_mks_nodegroup_ids": test.nodeGroups,
+				},
+			},
+		}
+		if test.configured {
+			requests = append(requests, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"mks_cluster_metadata_key":   "mks-cluster-id",
+					"mks_nodegroup_metadata_key": "mks-nodegroup-id",
+				},
+			})
+		}
+
+		for _, req := range requests {
+			res, err := b.HandleRequest(context.Background(), req)
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req := newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		res, err := b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginDNS(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	web := newTestLoginInstance("4a6c8e0b-2d4f-4b6a-8c0e-1f3b5d7f9b1d")
+	web.Name = "web-1"
+	web.AccessIPv6 = correctIPv6
+	m.AddServer(&web.Server)
+
+	stale := newTestLoginInstance("6e8a0c2d-4f6b-4d8e-9a1c-3b5d7f9b1d3f")
+	stale.Name = "web-2"
+	m.AddServer(&stale.Server)
+
+	m.AddRecordSet("example.com.", "web-1.example.com.", "A", correctIPv4)
+	m.AddRecordSet("example.org.", "web-1.example.org.", "AAAA", "2001:0db8:0000:0000:0000:0000:0000:0001")
+	m.AddRecordSet("example.com.", "web-2.example.com.", "A", wrongIPv4)
+	m.AddRecordSet("example.com.", "web-2.example.com.", "TXT", correctIPv4)
+
+	var tests = []struct {
+		zone       string
+		instanceID string
+		status     int
+	}{
+		{"example.com", web.ID, http.StatusOK},
+		{"Example.COM.", web.ID, http.StatusOK},
+		{"example.org", web.ID, http.StatusOK},
+		// fail: record points at another address
+		{"example.com", stale.ID, http.StatusForbidden},
+		// fail: no record for the instance
+		{"example.org", stale.ID, http.StatusForbidden},
+		// fail: unknown zone
+		{"example.net", web.ID, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"bound_dns_zone": test.zone},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, test.instanceID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginPreregistration(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("7a9c1e3b-5d7f-4b9d-8f1b-3d5f7b9d1f3b")
+	m.AddServer(&instance.Server)
+
+	var tests = []struct {
+		registration map[string]interface{}
+		status       int
+	}{
+		{map[string]interface{}{}, http.StatusOK},
+		{map[string]interface{}{"roles": "test"}, http.StatusOK},
+		{map[string]interface{}{"roles": "test", "ttl": 60}, http.StatusOK},
+		// fail: not registered
+		{nil, http.StatusForbidden},
+		// fail: registered for another role
+		{map[string]interface{}{"roles": "other"}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"require_preregistration": true},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		if test.registration != nil {
+			req = &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "allowlist/instances/" + instance.ID,
+				Storage:   storage,
+				Data:      test.registration,
+			}
+			res, err = b.HandleRequest(context.Background(), req)
+			if err != nil || (res != nil && res.IsError()) {
+				t.Fatalf("unexpected result: %v - %v", res, err)
+			}
+		}
+
+		req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestCleanupInstanceRegistration(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	registrations := []*InstanceRegistration{
+		{Name: "expired", Expiration: time.Now().Add(-time.Minute)},
+		{Name: "valid", Expiration: time.Now().Add(time.Minute)},
+		{Name: "permanent"},
+	}
+	for _, registration := range registrations {
+		err := updateInstanceRegistration(ctx, storage, registration)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	result, err := cleanupInstanceRegistration(ctx, storage)
+	if result.Scanned != 3 || result.Deleted != 1 || err != nil {
+		t.Errorf("unexpected result: %+v %v", result, err)
+	}
+
+	keys, _ := storage.List(ctx, "instance_registration/")
+	if len(keys) != 2 {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestLoginGroupAliases(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("5e7c1d3a-9b2f-4a6e-8c0d-2f4b6a8c0e1d")
+	m.AddServer(&instance.Server)
+	m.AddRoleAssignment(instance.UserID, instance.TenantID, "member")
+	m.AddRoleAssignment(instance.UserID, instance.TenantID, "admin")
+	m.AddRoleAssignment(instance.UserID, instance.TenantID, "member")
+
+	var tests = []struct {
+		enabled bool
+		aliases []string
+	}{
+		{false, []string{}},
+		{true, []string{"os-project-" + instance.TenantID + "-admin", "os-project-" + instance.TenantID + "-member"}},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"keystone_group_aliases": test.enabled},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		res, err = b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+		if err != nil || res == nil || res.IsError() {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		aliases := []string{}
+		for _, alias := range res.Auth.GroupAliases {
+			aliases = append(aliases, alias.Name)
+		}
+		if !reflect.DeepEqual(aliases, test.aliases) {
+			t.Errorf("unexpected group aliases: %v - %v", test, aliases)
+		}
+	}
+}
+
+func TestLoginBaremetal(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	node := &mockNode{
+		UUID:      "1be26c0b-03f2-4d2e-ae87-c02d7f33c123",
+		Name:      "node-1",
+		State:     "active",
+		Owner:     mockProjectID,
+		Extra:     map[string]string{"vault-role": "test"},
+		Addresses: map[string]string{"52:54:00:12:34:56": correctIPv4},
+		Deployed:  time.Now(),
+	}
+	m.AddNode(node)
+
+	deploying := &mockNode{
+		UUID:      "8c1f5a9e-2d3b-4e7f-9a6c-0b1d2e3f4a5b",
+		Name:      "node-2",
+		State:     "deploying",
+		Owner:     mockProjectID,
+		Extra:     map[string]string{"vault-role": "test"},
+		Addresses: map[string]string{"52:54:00:65:43:21": correctIPv4},
+		Deployed:  time.Now(),
+	}
+	m.AddNode(deploying)
+
+	// A port of another node with the same MAC address does not lend its
+	// address to the node.
+	stale := &mockNode{
+		UUID:      "5a9d2c7e-6b1f-4a3d-8e2c-7f4b9a1d3e5c",
+		Name:      "node-3",
+		State:     "available",
+		Owner:     mockProjectID,
+		Addresses: map[string]string{"52:54:00:12:34:56": wrongIPv4},
+		Deployed:  time.Now(),
+	}
+	m.AddNode(stale)
+
+	var tests = []struct {
+		instanceID string
+		addr       string
+		status     int
+	}{
+		// fail: unknown node
+		{"0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c", correctIPv4, http.StatusForbidden},
+		// fail: address mismatched
+		{node.UUID, wrongIPv4, http.StatusForbidden},
+		// fail: node is not active
+		{deploying.UUID, correctIPv4, http.StatusForbidden},
+		{node.UUID, correctIPv4, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"server_type": serverTypeBaremetal},
+		}
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		req = newTestLoginRequest(storage, test.instanceID, test.addr)
+		res, err = b.HandleRequest(context.Background(), req)
+		if status := responseStatus(req, res, err); status != test.status {
+			t.Errorf("unexpected status: %v - %d, %v, %v", test, status, res, err)
+		}
+	}
+}
+
+func TestLoginNonce(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("1f3b5d7f-9b1d-4f3b-8d7f-9b1d3f5b7d9f")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	nonceRequest := func(instanceID string) *logical.Request {
+		return &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login/nonce",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"instance_id": instanceID,
+				"role":        "test",
+			},
+		}
+	}
+
+	// The role does not require a nonce yet.
+	req := nonceRequest(instance.ID)
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusBadRequest {
+		t.Errorf("unexpected status: %d, %v - %v", status, res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"nonce_metadata_key": "vault-nonce",
+			"auth_limit":         3,
+		},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	req = nonceRequest("0b1e4b4d-7b4c-4a5e-9a07-1f3a5b0d5a3c")
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("nonce issued to unknown instance: %d, %v - %v", status, res, err)
+	}
+
+	req = nonceRequest(instance.ID)
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	nonce := res.Data["nonce"].(string)
+	if res.Data["metadata_key"] != "vault-nonce" {
+		t.Errorf("unexpected metadata key: %v", res.Data)
+	}
+
+	// The nonce is not in the metadata yet.
+	req = newTestLoginRequest(storage, instance.ID, wrongIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("unexpected status: %d, %v - %v", status, res, err)
+	}
+
+	// The nonce replaces the address check.
+	m.SetServerMetadata(instance.ID, map[string]string{"vault-role": "test", "vault-nonce": nonce})
+	req = newTestLoginRequest(storage, instance.ID, wrongIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	// The nonce was consumed by the login.
+	req = newTestLoginRequest(storage, instance.ID, wrongIPv4)
+	res, err = b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("nonce was not consumed: %d, %v - %v", status, res, err)
+	}
+}
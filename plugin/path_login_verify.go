@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const loginVerifySynopsis = "Verifies the login of an OpenStack instance without issuing a token."
+const loginVerifyDescription = `
+Runs the attestation of the login of the instance for the role and returns
+the inputs and the result of each check, such as the status, the address,
+the metadata, the tenant, the auth period and the auth limit. No token is
+issued and no authentication attempt is counted, so the login of the
+instance is not affected. The address checks are only performed when
+request_addr is specified.
+
+Unlike login, this endpoint requires a token with sudo capability.
+`
+
+var loginVerifyFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+	"instance_name": {
+		Type:        framework.TypeString,
+		Description: "Name of the instance. Can be used instead of instance_id.",
+	},
+	"role": {
+		Type:        framework.TypeString,
+		Description: "Name of the role.",
+	},
+	"request_addr": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of addresses the instance logs in from.",
+	},
+}
+
+func NewPathLoginVerify(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "login/verify$",
+			Fields:  loginVerifyFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.loginVerifyHandler,
+					Summary:  "Verify the login of an OpenStack instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: debugAttestResponseFields}},
+					},
+				},
+			},
+			HelpSynopsis:    loginVerifySynopsis,
+			HelpDescription: loginVerifyDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) loginVerifyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instanceID := data.Get("instance_id").(string)
+	instanceName := data.Get("instance_name").(string)
+	switch {
+	case instanceID == "" && instanceName == "":
+		return logical.ErrorResponse("instance_id or instance_name required"), nil
+	case instanceID != "" && instanceName != "":
+		return logical.ErrorResponse("only one of instance_id and instance_name can be given"), nil
+	}
+
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("role required"), nil
+	}
+
+	return b.traceAttestation(ctx, req, roleName, instanceID, instanceName, data.Get("request_addr").([]string))
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestLoginVerify(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	instance := newTestLoginInstance("0b5b8c2e-4f7a-4c1d-9e3b-6a2f1d8c7e90")
+	m.AddServer(&instance.Server)
+
+	tests := []struct {
+		addr   string
+		passed bool
+		failed map[string]string
+	}{
+		{wrongIPv4, false, map[string]string{"address": ReasonAddrMismatch}},
+		{correctIPv4, true, map[string]string{}},
+	}
+
+	for i, test := range tests {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login/verify",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"role":         "test",
+				"instance_id":  instance.ID,
+				"request_addr": test.addr,
+			},
+		}
+
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || res.IsError() {
+			t.Fatalf("[%d] unexpected result: %v - %v", i, res, err)
+		}
+
+		if res.Data["passed"] != test.passed {
+			t.Errorf("[%d] unexpected result: %v", i, res.Data)
+		}
+
+		names := map[string]bool{}
+		failed := map[string]string{}
+		for _, check := range res.Data["checks"].([]*AttestCheck) {
+			names[check.Name] = true
+			if !check.Passed && !check.Skipped {
+				failed[check.Name] = check.Reason
+			}
+		}
+		for _, name := range []string{"status", "address", "metadata", "tenant_id", "auth_period", "auth_limit"} {
+			if !names[name] {
+				t.Errorf("[%d] check %s missing: %v", i, name, names)
+			}
+		}
+		if len(failed) != len(test.failed) || failed["address"] != test.failed["address"] {
+			t.Errorf("[%d] unexpected failed checks: %v", i, failed)
+		}
+	}
+
+	// The role allows a single login, which must not have been used.
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err := b.HandleRequest(context.Background(), req)
+	if status := responseStatus(req, res, err); status != 200 {
+		t.Errorf("unexpected login status: %d - %v - %v", status, res, err)
+	}
+}
+
+func TestLoginVerifyInvalidRequest(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	tests := []map[string]interface{}{
+		{"role": "test"},
+		{"instance_id": "test"},
+		{"role": "test", "instance_id": "test", "instance_name": "test"},
+	}
+
+	for i, data := range tests {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login/verify",
+			Storage:   storage,
+			Data:      data,
+		}
+
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil || res == nil || !res.IsError() {
+			t.Errorf("[%d] unexpected result: %v - %v", i, res, err)
+		}
+	}
+}
+
+func TestLoginVerifyRequiresSudo(t *testing.T) {
+	b, _ := newTestBackend(t)
+
+	if !strutil.StrListContains(b.SpecialPaths().Root, "login/verify") {
+		t.Errorf("login/verify does not require sudo: %v", b.SpecialPaths().Root)
+	}
+}
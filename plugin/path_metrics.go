@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const metricsSynopsis = "Returns a snapshot of the internal counters of the plugin."
+const metricsDescription = `
+Returns the number of logins by outcome, login denials by reason, token
+renewals and the statistics of the in-memory caches since the backend was
+started, the state of the circuit breakers of the OpenStack API endpoints
+and the revision of the config. This is useful when the telemetry of Vault
+is not available.
+`
+
+func NewPathMetrics(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "metrics$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readMetricsHandler,
+					Summary:  "Read the internal counters of the plugin.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"logins": {
+									Type:        framework.TypeMap,
+									Description: "Number of logins by outcome.",
+								},
+								"denials": {
+									Type:        framework.TypeMap,
+									Description: "Number of login denials by reason.",
+								},
+								"renewals": {
+									Type:        framework.TypeMap,
+									Description: "Number of token renewals by outcome.",
+								},
+								"caches": {
+									Type:        framework.TypeMap,
+									Description: "Statistics of the in-memory caches.",
+								},
+								"circuit_breaker": {
+									Type:        framework.TypeMap,
+									Description: "State of the circuit breaker of the OpenStack API requests by endpoint host.",
+								},
+								"config": {
+									Type:        framework.TypeMap,
+									Description: "Version and fingerprint of the config.",
+								},
+							},
+						}},
+					},
+				},
+			},
+			HelpSynopsis:    metricsSynopsis,
+			HelpDescription: metricsDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) readMetricsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := b.stats.Snapshot()
+	snapshot["caches"] = map[string]interface{}{
+		"not_found":    cacheSnapshot(b.notFoundCache.Stats(), b.notFoundCache.Len()),
+		"instance":     cacheSnapshot(b.instanceCache.Stats(), b.instanceCache.Len()),
+		"identity":     cacheSnapshot(b.identityCache.Stats(), b.identityCache.Len()),
+		"trust_anchor": cacheSnapshot(b.trustAnchorCache.Stats(), b.trustAnchorCache.Len()),
+	}
+	snapshot["circuit_breaker"] = b.breakers.Snapshot()
+	if config != nil {
+		snapshot["config"] = map[string]interface{}{
+			"version":     config.Version,
+			"fingerprint": config.Fingerprint(),
+		}
+	}
+
+	res := &logical.Response{
+		Data: snapshot,
+	}
+
+	return res, nil
+}
+
+func cacheSnapshot(stats cacheStats, size int) map[string]interface{} {
+	hitRate := 0.0
+	if total := stats.Hits + stats.Misses; total > 0 {
+		hitRate = float64(stats.Hits) / float64(total)
+	}
+
+	return map[string]interface{}{
+		"hits":      stats.Hits,
+		"misses":    stats.Misses,
+		"evictions": stats.Evictions,
+		"hit_rate":  hitRate,
+		"size":      size,
+	}
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const migrateSynopsis = "Migrates the storage to the current schema."
+const migrateDescription = `
+Reads the schema version of the stored config, roles and auth attempts, and
+runs the pending migrations to the current schema. The migrations also run
+when the plugin is initialized, this endpoint reruns them after a failure
+and reports the entries they rewrote.
+`
+
+func NewPathMigrate(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "migrate$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.migrateReadHandler,
+					Summary:  "Read the schema version of the storage.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"schema_version":     {Type: framework.TypeInt, Description: "Schema version of the storage."},
+							"current_version":    {Type: framework.TypeInt, Description: "Schema version of the plugin."},
+							"migrated_at":        {Type: framework.TypeTime, Description: "Time of the last migration."},
+							"pending_migrations": {Type: framework.TypeStringSlice, Description: "Names of the pending migrations."},
+						}}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.migrateUpdateHandler,
+					Summary:  "Run the pending migrations of the storage.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"from_version": {Type: framework.TypeInt, Description: "Schema version before the migrations."},
+							"to_version":   {Type: framework.TypeInt, Description: "Schema version after the migrations."},
+							"migrations":   {Type: framework.TypeSlice, Description: "Version, name and number of the rewritten entries of the migrations which ran."},
+						}}},
+					},
+				},
+			},
+			HelpSynopsis:    migrateSynopsis,
+			HelpDescription: migrateDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) migrateReadHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	stored, err := readSchemaVersion(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	version := baseSchemaVersion
+	res := &logical.Response{Data: map[string]interface{}{}}
+	if stored != nil {
+		version = stored.Version
+		res.Data["migrated_at"] = stored.MigratedAt
+	}
+
+	pending := []string{}
+	for _, m := range pendingMigrations(version) {
+		pending = append(pending, m.name)
+	}
+
+	res.Data["schema_version"] = version
+	res.Data["current_version"] = currentSchemaVersion()
+	res.Data["pending_migrations"] = pending
+
+	return res, nil
+}
+
+func (b *OpenStackAuthBackend) migrateUpdateHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	stored, err := readSchemaVersion(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	from := baseSchemaVersion
+	if stored != nil {
+		from = stored.Version
+	}
+
+	results, err := b.migrate(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	to := from
+	if len(results) > 0 {
+		to = results[len(results)-1].Version
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"from_version": from,
+			"to_version":   to,
+			"migrations":   results,
+		},
+	}
+
+	return res, nil
+}
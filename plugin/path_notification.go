@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const instanceNotificationSynopsis = "Receives the lifecycle notifications of the instances."
+const instanceNotificationDescription = `
+Accepts the Nova notifications of the created and deleted instances, either
+the legacy or the versioned ones, as forwarded from the message bus. The
+instances reported as deleted can no longer login nor renew their tokens,
+and the instances reported as created are looked up again even if they
+were recently reported as missing by the compute API.
+
+The notifications do not revoke the tokens already issued to a deleted
+instance, since Vault doesn't let an auth plugin revoke tokens. The tokens
+stay valid until the end of their current TTL, and their renewals are
+denied. The other notifications, such as the ones of a shutdown, are
+ignored.
+
+This endpoint requires sudo capability.
+`
+
+var instanceNotificationFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"event_type": {
+		Type:        framework.TypeString,
+		Description: "Type of the notification, such as compute.instance.delete.end or instance.delete.end.",
+	},
+	"payload": {
+		Type:        framework.TypeMap,
+		Description: "Payload of the notification. The instance and the project are read from the payload unless specified.",
+	},
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+	"project_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the project of the instance.",
+	},
+}
+
+// instanceEventTypes maps the Nova notification types to the events.
+var instanceEventTypes = map[string]string{
+	"compute.instance.create.end": instanceEventCreated,
+	"instance.create.end":         instanceEventCreated,
+	"compute.instance.delete.end": instanceEventDeleted,
+	"instance.delete.end":         instanceEventDeleted,
+}
+
+func NewPathNotification(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "notifications/instance$",
+			Fields:  instanceNotificationFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.instanceNotificationHandler,
+					Summary:  "Receive a lifecycle notification of an instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK:         {{Description: "OK, the notification was ignored with a warning"}},
+						http.StatusNoContent:  {{Description: "No Content"}},
+						http.StatusBadRequest: {{Description: "The notification is malformed"}},
+					},
+				},
+			},
+			HelpSynopsis:    instanceNotificationSynopsis,
+			HelpDescription: instanceNotificationDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) instanceNotificationHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	eventType := data.Get("event_type").(string)
+	instanceID, projectID := notificationInstance(data)
+
+	if instanceID == "" {
+		return logical.ErrorResponse("instance_id is required"), nil
+	}
+	if _, err := uuid.ParseUUID(instanceID); err != nil {
+		return logical.ErrorResponse("invalid instance_id"), nil
+	}
+
+	kind, ok := instanceEventTypes[eventType]
+	if !ok {
+		res := &logical.Response{}
+		res.AddWarning(fmt.Sprintf("ignored event type: %s", eventType))
+		return res, nil
+	}
+
+	// Notifications are not ordered, a late create notification never
+	// brings a deleted instance back.
+	existing, err := readInstanceEvent(ctx, req.Storage, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Event == instanceEventDeleted {
+		res := &logical.Response{}
+		res.AddWarning("instance has already been deleted")
+		return res, nil
+	}
+
+	now := time.Now()
+	event := &InstanceEvent{
+		Name:       instanceID,
+		Event:      kind,
+		ProjectID:  projectID,
+		Time:       now,
+		Expiration: now.Add(b.System().MaxLeaseTTL()),
+	}
+	err = updateInstanceEvent(ctx, req.Storage, event)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range b.clientKeys() {
+		if kind == instanceEventCreated {
+			b.notFoundCache.Remove(instanceKey(key, instanceID))
+		}
+		b.instanceCache.Remove(instanceKey(key, instanceID))
+	}
+
+	metrics.IncrCounterWithLabels([]string{"openstack", "notification"}, 1, []metrics.Label{
+		{Name: "event", Value: kind},
+	})
+	b.requestLogger(req).Info("instance notification received", "instance_id", instanceID, "project", projectID, "event", kind)
+
+	return nil, nil
+}
+
+// notificationInstance returns the instance and the project of the
+// notification. The fields of the request take precedence over the
+// payload, which is either a legacy or a versioned notification payload.
+func notificationInstance(data *framework.FieldData) (instanceID, projectID string) {
+	payload := data.Get("payload").(map[string]interface{})
+
+	// Versioned notifications wrap the instance in a Nova object.
+	if object, ok := payload["nova_object.data"].(map[string]interface{}); ok {
+		instanceID, _ = object["uuid"].(string)
+		projectID, _ = object["tenant_id"].(string)
+	} else {
+		instanceID, _ = payload["instance_id"].(string)
+		projectID, _ = payload["tenant_id"].(string)
+	}
+
+	if val, ok := data.GetOk("instance_id"); ok {
+		instanceID = val.(string)
+	}
+	if val, ok := data.GetOk("project_id"); ok {
+		projectID = val.(string)
+	}
+
+	return instanceID, projectID
+}
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func newTestNotificationRequest(storage logical.Storage, data map[string]interface{}) *logical.Request {
+	return &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "notifications/instance",
+		Storage:   storage,
+		Data:      data,
+	}
+}
+
+func TestInstanceNotification(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("0d7e1c4b-6f2a-4b8e-9c3d-5a1f7e2b4c6d")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+	ctx := context.Background()
+
+	res, err := b.HandleRequest(ctx, newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected login result: %v - %v", res, err)
+	}
+	auth := res.Auth
+
+	var tests = []struct {
+		data    map[string]interface{}
+		error   bool
+		warning bool
+	}{
+		// fail: no instance
+		{map[string]interface{}{"event_type": "instance.delete.end"}, true, false},
+		// fail: malformed instance
+		{map[string]interface{}{"event_type": "instance.delete.end", "instance_id": "servers/detail"}, true, false},
+		{map[string]interface{}{"event_type": "instance.update", "instance_id": instance.ID}, false, true},
+		{map[string]interface{}{
+			"event_type": "instance.delete.end",
+			"payload": map[string]interface{}{
+				"nova_object.data": map[string]interface{}{"uuid": instance.ID, "tenant_id": instance.TenantID},
+			},
+		}, false, false},
+		// late create notification of the deleted instance
+		{map[string]interface{}{
+			"event_type": "compute.instance.create.end",
+			"payload":    map[string]interface{}{"instance_id": instance.ID, "tenant_id": instance.TenantID},
+		}, false, true},
+	}
+
+	for _, test := range tests {
+		res, err := b.HandleRequest(ctx, newTestNotificationRequest(storage, test.data))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if test.error != (res != nil && res.IsError()) || test.warning != (res != nil && len(res.Warnings) > 0) {
+			t.Errorf("unexpected response: %v - %v", test.data, res)
+		}
+	}
+
+	event, err := readInstanceEvent(ctx, storage, instance.ID)
+	if err != nil || event == nil || event.Event != instanceEventDeleted || event.ProjectID != instance.TenantID {
+		t.Fatalf("unexpected instance event: %v - %v", event, err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      auth,
+	}
+	res, err = b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("token of deleted instance was renewed: %d, %v, %v", status, res, err)
+	}
+
+	b, storage = newTestLoginBackend(t, m)
+	res, err = b.HandleRequest(ctx, newTestNotificationRequest(storage, map[string]interface{}{
+		"event_type":  "instance.delete.end",
+		"instance_id": instance.ID,
+	}))
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("deleted instance logged in: %d, %v, %v", status, res, err)
+	}
+}
+
+func TestInstanceNotificationCreated(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("7a3c5e9b-1d2f-4a6c-8e0b-3f5d7a9c1e2b")
+
+	b, storage := newTestLoginBackend(t, m)
+	ctx := context.Background()
+
+	// The lookup of the instance before it exists is cached as missing.
+	req := newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err := b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Fatalf("unexpected status: %d, %v, %v", status, res, err)
+	}
+
+	m.AddServer(&instance.Server)
+
+	res, err = b.HandleRequest(ctx, newTestNotificationRequest(storage, map[string]interface{}{
+		"event_type":  "instance.create.end",
+		"instance_id": instance.ID,
+	}))
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusOK {
+		t.Errorf("created instance cannot login: %d, %v, %v", status, res, err)
+	}
+}
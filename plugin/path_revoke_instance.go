@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const revokeInstanceSynopsis = "Cuts off an instance from the backend."
+const revokeInstanceDescription = `
+Revokes an instance, usually because it has been compromised. The instance
+can no longer log in, and the tokens it was issued are no longer renewed,
+until the revocation is deleted.
+
+Vault doesn't let an auth plugin revoke the tokens it issued, and the
+plugin never sees their accessors, so the tokens stay valid until the end
+of their current TTL. To cut them off at once, disable the entity of the
+instance as explained in the warnings of the response. Unless alias_name
+of the config is instance_id, the entity is shared with other instances.
+
+This endpoint requires sudo capability.
+`
+
+const revokeInstanceListSynopsis = "Lists the revoked instances."
+const revokeInstanceListDescription = `
+The list will contain the IDs of the revoked instances.
+`
+
+var revokeInstanceFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+}
+
+// revokeInstanceResponseFields is the schema of a revocation.
+var revokeInstanceResponseFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"instance_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the instance.",
+	},
+	"revoked": {
+		Type:        framework.TypeTime,
+		Description: "Time the instance was revoked.",
+	},
+	"login_attempts": {
+		Type:        framework.TypeInt,
+		Description: "Number of the login attempts of the instance recorded by the backend.",
+	},
+}
+
+func NewPathRevokeInstance(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("revoke-instance/%s", framework.GenericNameRegex("instance_id")),
+			Fields:  revokeInstanceFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readRevokeInstanceHandler,
+					Summary:  "Read the revocation of an instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: revokeInstanceResponseFields}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.updateRevokeInstanceHandler,
+					Summary:  "Revoke an instance.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: revokeInstanceResponseFields}},
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.deleteRevokeInstanceHandler,
+					Summary:   "Remove the revocation of an instance.",
+					Responses: noContentResponses,
+				},
+			},
+			HelpSynopsis:    revokeInstanceSynopsis,
+			HelpDescription: revokeInstanceDescription,
+		},
+		{
+			Pattern: "revoke-instance/?",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listRevokeInstanceHandler,
+					Summary:  "List the revoked instances.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"keys": {Type: framework.TypeStringSlice, Description: "List of the instance IDs."},
+						}}},
+					},
+				},
+			},
+			HelpSynopsis:    revokeInstanceListSynopsis,
+			HelpDescription: revokeInstanceListDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) readRevokeInstanceHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instanceID := data.Get("instance_id").(string)
+
+	revocation, err := readInstanceRevocation(ctx, req.Storage, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if revocation == nil {
+		return nil, nil
+	}
+
+	return b.revocationResponse(ctx, req, revocation)
+}
+
+func (b *OpenStackAuthBackend) updateRevokeInstanceHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instanceID := data.Get("instance_id").(string)
+
+	revocation, err := readInstanceRevocation(ctx, req.Storage, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Revoking an instance again keeps the time of the first revocation.
+	if revocation == nil {
+		revocation = &InstanceRevocation{Name: instanceID, Revoked: time.Now()}
+
+		err = updateInstanceRevocation(ctx, req.Storage, revocation)
+		if err != nil {
+			return nil, err
+		}
+
+		b.requestLogger(req).Info("instance revoked", "instance_id", instanceID)
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.revocationResponse(ctx, req, revocation)
+	if err != nil {
+		return nil, err
+	}
+
+	res.AddWarning("the tokens already issued to the instance are no longer renewed but stay valid until the end of their current TTL, since Vault doesn't let auth plugins revoke tokens")
+	res.AddWarning(entityWarning(config, instanceID, req.MountAccessor))
+
+	return res, nil
+}
+
+// entityWarning explains how to disable the entity of the instance, which
+// is named after the instance only with the default alias_name. Otherwise
+// the entity is shared with the other instances of the project or the role.
+func entityWarning(config *Config, instanceID, mountAccessor string) string {
+	aliasName := aliasNameInstanceID
+	if config != nil && config.AliasName != "" {
+		aliasName = config.AliasName
+	}
+
+	if aliasName == aliasNameInstanceID {
+		return fmt.Sprintf("to cut off the tokens at once, disable the entity of the instance: look it up with `vault write identity/lookup/entity alias_name=%s alias_mount_accessor=%s` and run `vault write identity/entity/id/<entity_id> disabled=true`", instanceID, mountAccessor)
+	}
+
+	return fmt.Sprintf("the entity of the instance is named after its %s since alias_name of the config is %s, so it is shared by every instance with the same %s and disabling it cuts them all off: look it up with `vault write identity/lookup/entity alias_name=<%s> alias_mount_accessor=%s` and run `vault write identity/entity/id/<entity_id> disabled=true`", aliasName, aliasName, aliasName, aliasName, mountAccessor)
+}
+
+func (b *OpenStackAuthBackend) deleteRevokeInstanceHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instanceID := data.Get("instance_id").(string)
+
+	err := req.Storage.Delete(ctx, fmt.Sprintf("instance_revocation/%s", instanceID))
+	if err != nil {
+		return nil, err
+	}
+
+	b.requestLogger(req).Info("instance revocation removed", "instance_id", instanceID)
+
+	return nil, nil
+}
+
+func (b *OpenStackAuthBackend) listRevokeInstanceHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List(ctx, "instance_revocation/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+// revocationResponse returns the revocation with the number of the login
+// attempts recorded for the instance.
+func (b *OpenStackAuthBackend) revocationResponse(ctx context.Context, req *logical.Request, revocation *InstanceRevocation) (*logical.Response, error) {
+	attempt, err := readAuthAttempt(ctx, req.Storage, revocation.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := 0
+	if attempt != nil {
+		attempts = attempt.Count
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"instance_id":    revocation.Name,
+			"revoked":        revocation.Revoked,
+			"login_attempts": attempts,
+		},
+	}, nil
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRevokeInstance(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("2b4d6f8a-0c2e-4b6d-8f0a-2c4e6b8d0f2a")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+	ctx := context.Background()
+
+	res, err := b.HandleRequest(ctx, newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	auth := res.Auth
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation:     logical.UpdateOperation,
+		Path:          "revoke-instance/" + instance.ID,
+		Storage:       storage,
+		MountAccessor: "auth_openstack_1234",
+	})
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["login_attempts"] != 1 || len(res.Warnings) != 2 {
+		t.Errorf("unexpected response: %v", res)
+	}
+	revoked := res.Data["revoked"].(time.Time)
+
+	// Revoking the instance again keeps the time of the first revocation.
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke-instance/" + instance.ID,
+		Storage:   storage,
+	})
+	if err != nil || res == nil || !res.Data["revoked"].(time.Time).Equal(revoked) {
+		t.Errorf("unexpected result: %v - %v", res, err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      auth,
+	}
+	res, err = b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden {
+		t.Errorf("token of revoked instance was renewed: %d, %v, %v", status, res, err)
+	}
+
+	b, storage = newTestLoginBackend(t, m)
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke-instance/" + instance.ID,
+		Storage:   storage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusForbidden || attempts(t, storage, instance.ID) != 0 {
+		t.Errorf("revoked instance logged in: %d, %v, %v", status, res, err)
+	}
+
+	res, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "revoke-instance/",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || len(res.Data["keys"].([]string)) != 1 {
+		t.Errorf("unexpected result: %v - %v", res, err)
+	}
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "revoke-instance/" + instance.ID,
+		Storage:   storage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req = newTestLoginRequest(storage, instance.ID, correctIPv4)
+	res, err = b.HandleRequest(ctx, req)
+	if status := responseStatus(req, res, err); status != http.StatusOK {
+		t.Errorf("unexpected status: %d, %v, %v", status, res, err)
+	}
+}
+
+func attempts(t *testing.T, s logical.Storage, instanceID string) int {
+	attempt, err := readAuthAttempt(context.Background(), s, instanceID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if attempt == nil {
+		return 0
+	}
+
+	return attempt.Count
+}
+
+func TestEntityWarning(t *testing.T) {
+	instanceID := "ef079b0c-e610-4dfb-b1aa-b49f07ac48e5"
+
+	var tests = []struct {
+		config *Config
+		alias  string
+	}{
+		{nil, "alias_name=" + instanceID + " "},
+		{&Config{AliasName: aliasNameInstanceID}, "alias_name=" + instanceID + " "},
+		{&Config{AliasName: aliasNameProjectID}, "alias_name=<project_id> "},
+		{&Config{AliasName: aliasNameRole}, "alias_name=<role> "},
+	}
+
+	for _, test := range tests {
+		warning := entityWarning(test.config, instanceID, "auth_openstack_1234")
+		if !strings.Contains(warning, test.alias) {
+			t.Errorf("unexpected warning: %v - %s", test.config, warning)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
-	"github.com/hashicorp/vault/sdk/helper/policyutil"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -20,38 +22,51 @@ token polices and token settings can all be configured using this endpoint.
 
 const roleListSynopsis = "Lists all the roles registered with the backend."
 const roleListDescription = `
-The list will contain the names of the roles.
+The list will contain the names of the roles. With detail=true, the
+policies, the effective TTLs and the bound project and region of each role
+are returned in key_info.
 `
 
-var roleFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+// roleFields are the fields of the role, including the common token fields
+// of the Vault SDK.
+var roleFields map[string]*framework.FieldSchema = withTokenFields(map[string]*framework.FieldSchema{
 	"name": {
 		Type:        framework.TypeString,
 		Description: "Name of the role.",
 	},
 	"policies": {
 		Type:        framework.TypeCommaStringSlice,
-		Description: "Policies to be set on tokens issued using this role.",
+		Description: tokenutil.DeprecationText("token_policies"),
+		Deprecated:  true,
 	},
 	"ttl": {
 		Type:        framework.TypeDurationSecond,
-		Default:     0,
-		Description: "Duration in seconds after which the issued token should expire. Defaults to 0, in which case the value will fallback to the system/mount defaults.",
+		Description: tokenutil.DeprecationText("token_ttl"),
+		Deprecated:  true,
 	},
 	"max_ttl": {
 		Type:        framework.TypeDurationSecond,
-		Default:     0,
-		Description: "The maximum allowed lifetime of tokens issued using this role.",
+		Description: tokenutil.DeprecationText("token_max_ttl"),
+		Deprecated:  true,
 	},
 	"period": {
 		Type:        framework.TypeDurationSecond,
-		Default:     0,
-		Description: "If set, indicates that the token generated using this role should never expire. The token should be renewed within the duration specified by this value. At each renewal, the token's TTL will be set to the value of this parameter.",
+		Description: tokenutil.DeprecationText("token_period"),
+		Deprecated:  true,
 	},
 	"metadata_key": {
 		Type:        framework.TypeString,
 		Default:     "vault-role",
 		Description: "The key name of the instance metadata to validate the role specified during authentication. The role name must be specified for the key of metadata of the instance specified here.",
 	},
+	"metadata_values": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Values of the instance metadata key accepted instead of the role name. A value may contain * wildcards, such as web-*.",
+	},
+	"bound_metadata": {
+		Type:        framework.TypeKVPairs,
+		Description: "Key-value pairs the instance metadata must all have. A value may contain * wildcards.",
+	},
 	"auth_period": {
 		Type:        framework.TypeDurationSecond,
 		Default:     120,
@@ -78,6 +93,180 @@ var roleFields map[string]*framework.FieldSchema = map[string]*framework.FieldSc
 		Type:        framework.TypeString,
 		Description: "Unique ID of the project. Overwrites global project_name",
 	},
+	"server_type": {
+		Type:          framework.TypeString,
+		Default:       serverTypeCloud,
+		AllowedValues: []interface{}{serverTypeCloud, serverTypeDedicated, serverTypeBaremetal},
+		Description:   "Type of the servers attested by the role. One of cloud for OpenStack instances, dedicated for Selectel dedicated servers or baremetal for Ironic nodes.",
+	},
+	"bound_stack_id": {
+		Type:        framework.TypeString,
+		Description: "Name or ID of the Heat stack the instance must be a resource of. The stack must be in a healthy state.",
+	},
+	"server_group_id": {
+		Type:        framework.TypeString,
+		Description: "ID of the Nova server group the instance must be a member of.",
+	},
+	"server_group_name": {
+		Type:        framework.TypeString,
+		Description: "Name of the Nova server group the instance must be a member of. The name must be unique.",
+	},
+	"bound_flavor_ids": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "IDs of the flavors the instance may be built on.",
+	},
+	"bound_flavor_names": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Names of the flavors the instance may be built on.",
+	},
+	"bound_image_ids": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "IDs of the Glance images the instance may be booted from.",
+	},
+	"bound_key_names": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Names of the key pairs the instance may be launched with.",
+	},
+	"bound_tags": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Nova server tags the instance must have. Requires compute API microversion 2.26 or later.",
+	},
+	"bound_availability_zones": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Availability zones the instance must run in.",
+	},
+	"keystone_group_aliases": {
+		Type:        framework.TypeBool,
+		Description: "Emit a group alias named os-project-<role> for each Keystone role assigned to the owner of the instance on its project.",
+	},
+	"bound_dns_zone": {
+		Type:        framework.TypeString,
+		Description: "Name of the Designate zone which must have an A or AAAA record for the name of the instance pointing at one of its addresses.",
+	},
+	"identity_token_ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "TTL of the signed identity token returned with the token on login. The identity token is not issued if zero.",
+	},
+	"identity_token_audience": {
+		Type:        framework.TypeString,
+		Description: "Audience of the identity token.",
+	},
+	"bound_mks_cluster_ids": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of the Selectel Managed Kubernetes cluster IDs the instance must be a worker node of. With a cluster or node group binding, metadata_key can be empty.",
+	},
+	"bound_mks_nodegroup_ids": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of the Selectel Managed Kubernetes node group IDs the instance must be a worker node of.",
+	},
+	"require_preregistration": {
+		Type:        framework.TypeBool,
+		Description: "Only allow the instances pre-registered with the allowlist/instances endpoint to log in with the role.",
+	},
+	"disallow_reauthentication": {
+		Type:        framework.TypeBool,
+		Description: "Only allow an instance to log in once with the role until the tokens of the login expire.",
+	},
+	"require_response_wrapping": {
+		Type:        framework.TypeBool,
+		Description: "Always return the token of a login wrapped in a response-wrapping token.",
+	},
+	"response_wrapping_ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "TTL of the response-wrapping token of a login. Defaults to 60 seconds. A shorter wrap_ttl of the request is honored.",
+	},
+	"bind_token_addresses": {
+		Type:        framework.TypeBool,
+		Description: "Bind the issued tokens to the addresses of the instance and the additional accepted prefixes.",
+	},
+	"bind_token_ipv4_mask": {
+		Type:        framework.TypeInt,
+		Description: "Prefix length the IPv4 addresses of the instance are widened to when the tokens are bound to them. Defaults to 32.",
+	},
+	"bind_token_ipv6_mask": {
+		Type:        framework.TypeInt,
+		Description: "Prefix length the IPv6 addresses of the instance are widened to when the tokens are bound to them. Defaults to 128.",
+	},
+	"accepted_source_cidrs": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of the CIDR blocks whose addresses are accepted as the request address in addition to the addresses of the instance.",
+	},
+	"resolve_floating_ips": {
+		Type:        framework.TypeBool,
+		Description: "Look up the floating IPs of the instance with the networking API when the request address is not one of the addresses returned by the compute API.",
+	},
+	"attest_port_ownership": {
+		Type:        framework.TypeBool,
+		Description: "Verify that the networking port holding the request address is attached to the instance.",
+	},
+	"additional_accepted_prefixes": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: tokenutil.DeprecationText("accepted_source_cidrs"),
+		Deprecated:  true,
+	},
+	"config": {
+		Type:        framework.TypeString,
+		Description: "Name of the config profile used to look up the instances. Defaults to the config of the backend.",
+	},
+	"region": {
+		Type:        framework.TypeString,
+		Description: "Region the instances are looked up in. Overwrites region_name of the config.",
+	},
+	"nonce_metadata_key": {
+		Type:        framework.TypeString,
+		Description: "Instance metadata key which must hold a nonce issued by login/nonce. When set, the nonce replaces the address check of the login.",
+	},
+	"require_identity_document": {
+		Type:        framework.TypeBool,
+		Description: "Require a signed instance identity document with the login.",
+	},
+	"identity_document_secrets": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of the IDs or references of the Barbican secrets holding the PEM encoded certificates which sign the identity documents, in addition to identity_document_certificates of the config.",
+	},
+})
+
+func withTokenFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	tokenutil.AddTokenFields(fields)
+	return fields
+}
+
+// roleResponseFields is the schema of the role read response.
+var roleResponseFields map[string]*framework.FieldSchema = responseFields(roleFields, map[string]*framework.FieldSchema{
+	"version": {
+		Type:        framework.TypeInt,
+		Description: "Version of the role, incremented on every write.",
+	},
+	"effective": {
+		Type:        framework.TypeMap,
+		Description: "Values the logins with the role use after the defaults of the mount and the config are applied: ttl, max_ttl, project_id, project_name and region.",
+	},
+}, "name")
+
+// roleListFields are the parameters of the role list operation.
+var roleListFields = map[string]*framework.FieldSchema{
+	"detail": {
+		Type:        framework.TypeBool,
+		Description: "Return the policies and the effective values of each role in key_info.",
+		Query:       true,
+	},
+}
+
+// roleListResponses documents the response of the role list operation.
+var roleListResponses = map[int][]framework.Response{
+	http.StatusOK: {{
+		Description: "OK",
+		Fields: map[string]*framework.FieldSchema{
+			"keys": {
+				Type:        framework.TypeStringSlice,
+				Description: "List of the role names.",
+			},
+			"key_info": {
+				Type:        framework.TypeMap,
+				Description: "Policies and effective values of each role, returned with detail=true.",
+			},
+		},
+	}},
 }
 
 func NewPathRole(b *OpenStackAuthBackend) []*framework.Path {
@@ -86,27 +275,59 @@ func NewPathRole(b *OpenStackAuthBackend) []*framework.Path {
 			Pattern:        fmt.Sprintf("role/%s", framework.GenericNameRegex("name")),
 			Fields:         roleFields,
 			ExistenceCheck: b.checkRoleHandler,
-			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.updateRoleHandler,
-				logical.ReadOperation:   b.readRoleHandler,
-				logical.UpdateOperation: b.updateRoleHandler,
-				logical.DeleteOperation: b.deleteRoleHandler,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.updateRoleHandler,
+					Summary:  "Create a role.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK, possibly with warnings"}},
+					},
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readRoleHandler,
+					Summary:  "Read a role.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: roleResponseFields}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.updateRoleHandler,
+					Summary:  "Update a role.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK, possibly with warnings"}},
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.deleteRoleHandler,
+					Summary:   "Delete a role.",
+					Responses: noContentResponses,
+				},
 			},
 			HelpSynopsis:    roleSynopsis,
 			HelpDescription: roleDescription,
 		},
 		{
 			Pattern: "role/?",
-			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.ListOperation: b.listRoleHandler,
+			Fields:  roleListFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.listRoleHandler,
+					Summary:   "List the roles.",
+					Responses: roleListResponses,
+				},
 			},
 			HelpSynopsis:    roleListSynopsis,
 			HelpDescription: roleListDescription,
 		},
 		{
 			Pattern: "roles/?",
-			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.ListOperation: b.listRoleHandler,
+			Fields:  roleListFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.listRoleHandler,
+					Summary:   "List the roles.",
+					Responses: roleListResponses,
+				},
 			},
 			HelpSynopsis:    roleListSynopsis,
 			HelpDescription: roleListDescription,
@@ -135,25 +356,144 @@ func (b *OpenStackAuthBackend) readRoleHandler(ctx context.Context, req *logical
 		return nil, nil
 	}
 
+	serverType := role.ServerType
+	if serverType == "" {
+		serverType = serverTypeCloud
+	}
+
 	res := &logical.Response{
 		Data: map[string]interface{}{
-			"policies":     role.Policies,
-			"ttl":          int64(role.TTL / time.Second),
-			"max_ttl":      int64(role.MaxTTL / time.Second),
-			"period":       int64(role.Period / time.Second),
-			"metadata_key": role.MetadataKey,
-			"auth_period":  int64(role.AuthPeriod / time.Second),
-			"auth_limit":   role.AuthLimit,
-			"project_id":   role.ProjectID,
-			"project_name": role.ProjectName,
-			"tenant_id":    role.TenantID,
-			"tenant_name":  role.TenantName,
+			"metadata_key":              role.MetadataKey,
+			"metadata_values":           role.MetadataValues,
+			"bound_metadata":            role.BoundMetadata,
+			"auth_period":               int64(role.AuthPeriod / time.Second),
+			"auth_limit":                role.AuthLimit,
+			"project_id":                role.ProjectID,
+			"project_name":              role.ProjectName,
+			"tenant_id":                 role.TenantID,
+			"tenant_name":               role.TenantName,
+			"server_type":               serverType,
+			"bound_stack_id":            role.BoundStackID,
+			"server_group_id":           role.BoundServerGroupID,
+			"server_group_name":         role.BoundServerGroupName,
+			"bound_flavor_ids":          role.BoundFlavorIDs,
+			"bound_flavor_names":        role.BoundFlavorNames,
+			"bound_image_ids":           role.BoundImageIDs,
+			"bound_key_names":           role.BoundKeyNames,
+			"bound_tags":                role.BoundTags,
+			"bound_availability_zones":  role.BoundAvailabilityZones,
+			"keystone_group_aliases":    role.KeystoneGroupAliases,
+			"bound_mks_cluster_ids":     role.BoundMKSClusterIDs,
+			"bound_mks_nodegroup_ids":   role.BoundMKSNodeGroupIDs,
+			"accepted_source_cidrs":     role.AcceptedSourceCIDRs,
+			"resolve_floating_ips":      role.ResolveFloatingIPs,
+			"attest_port_ownership":     role.AttestPortOwnership,
+			"bind_token_addresses":      role.BindTokenAddresses,
+			"bind_token_ipv4_mask":      role.BindTokenIPv4Mask,
+			"bind_token_ipv6_mask":      role.BindTokenIPv6Mask,
+			"require_preregistration":   role.RequirePreregistration,
+			"disallow_reauthentication": role.DisallowReauthentication,
+			"require_response_wrapping": role.RequireResponseWrapping,
+			"response_wrapping_ttl":     int64(role.ResponseWrappingTTL / time.Second),
+			"config":                    role.Config,
+			"region":                    role.Region,
+			"nonce_metadata_key":        role.NonceMetadataKey,
+			"require_identity_document": role.RequireIdentityDocument,
+			"identity_document_secrets": role.IdentityDocumentSecrets,
+			"bound_dns_zone":            role.BoundDNSZone,
+			"identity_token_ttl":        int64(role.IdentityTokenTTL / time.Second),
+			"identity_token_audience":   role.IdentityTokenAudience,
+			"version":                   role.Version,
 		},
 	}
 
+	role.PopulateTokenData(res.Data)
+
+	// The deprecated fields are only returned while they are in use.
+	if len(role.Policies) > 0 {
+		res.Data["policies"] = res.Data["token_policies"]
+	}
+	if role.TTL > 0 {
+		res.Data["ttl"] = int64(role.TTL / time.Second)
+	}
+	if role.MaxTTL > 0 {
+		res.Data["max_ttl"] = int64(role.MaxTTL / time.Second)
+	}
+	if role.Period > 0 {
+		res.Data["period"] = int64(role.Period / time.Second)
+	}
+	if len(role.AdditionalAcceptedPrefixes) > 0 {
+		res.Data["additional_accepted_prefixes"] = role.AcceptedSourceCIDRs
+	}
+
+	effective, err := b.effectiveRole(ctx, req.Storage, role)
+	if err != nil {
+		return nil, err
+	}
+	res.Data["effective"] = effective
+
 	return res, nil
 }
 
+// effectiveRole returns the values the logins with the role use after the
+// defaults of the mount and the config are applied.
+func (b *OpenStackAuthBackend) effectiveRole(ctx context.Context, s logical.Storage, role *Role) (map[string]interface{}, error) {
+	config, err := b.getRoleConfig(ctx, s, role)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &logical.Auth{}
+	role.PopulateTokenAuth(auth)
+	if config != nil {
+		config.populateTokenDefaults(role, auth)
+	}
+
+	sys := b.System()
+	maxTTL := sys.MaxLeaseTTL()
+	if auth.MaxTTL > 0 && auth.MaxTTL < maxTTL {
+		maxTTL = auth.MaxTTL
+	}
+	ttl := sys.DefaultLeaseTTL()
+	if auth.TTL > 0 {
+		ttl = auth.TTL
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	// The instances are bound to the project of the role, or to the project
+	// of the config unless the config looks up the instances of every
+	// project.
+	projectID, projectName := role.ProjectID, role.projectName()
+	if role.TenantID != "" {
+		projectID = role.TenantID
+	}
+	if projectID == "" && projectName == "" && config != nil && !config.AllTenants {
+		projectID, projectName = config.ProjectID, config.ProjectName
+		if config.TenantID != "" {
+			projectID = config.TenantID
+		}
+		if config.TenantName != "" {
+			projectName = config.TenantName
+		}
+	}
+
+	region := role.Region
+	if config != nil {
+		region = role.region(config)
+	}
+
+	return map[string]interface{}{
+		"ttl":          int64(ttl / time.Second),
+		"max_ttl":      int64(maxTTL / time.Second),
+		"period":       int64(auth.Period / time.Second),
+		"project_id":   projectID,
+		"project_name": projectName,
+		"region":       region,
+	}, nil
+}
+
 func (b *OpenStackAuthBackend) updateRoleHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var val interface{}
 	var ok bool
@@ -168,33 +508,50 @@ func (b *OpenStackAuthBackend) updateRoleHandler(ctx context.Context, req *logic
 		return nil, err
 	}
 
+	// The defaults of the schema apply to a new role, so that a role
+	// created without auth_period or auth_limit can be logged in with. The
+	// roles bound to Kubernetes clusters don't need a metadata key.
 	if role == nil {
-		role = &Role{Name: roleName}
+		role = &Role{
+			Name:       roleName,
+			AuthPeriod: time.Duration(data.Get("auth_period").(int)) * time.Second,
+			AuthLimit:  data.Get("auth_limit").(int),
+		}
+		_, clusters := data.GetOk("bound_mks_cluster_ids")
+		_, nodeGroups := data.GetOk("bound_mks_nodegroup_ids")
+		if !clusters && !nodeGroups {
+			role.MetadataKey = data.Get("metadata_key").(string)
+		}
 	}
 
-	val, ok = data.GetOk("policies")
-	if ok {
-		role.Policies = policyutil.ParsePolicies(val)
-	}
+	errs := requestFieldErrors(ctx)
+	errs.addErr(role.ParseTokenFields(req, data))
 
-	val, ok = data.GetOk("ttl")
+	val, ok = data.GetOk("accepted_source_cidrs")
 	if ok {
-		role.TTL = time.Duration(val.(int)) * time.Second
+		role.AcceptedSourceCIDRs = val.([]string)
 	}
 
-	val, ok = data.GetOk("max_ttl")
+	// The deprecated fields set their replacements unless those are given.
+	errs.addErr(tokenutil.UpgradeValue(data, "policies", "token_policies", &role.Policies, &role.TokenPolicies))
+	errs.addErr(tokenutil.UpgradeValue(data, "ttl", "token_ttl", &role.TTL, &role.TokenTTL))
+	errs.addErr(tokenutil.UpgradeValue(data, "max_ttl", "token_max_ttl", &role.MaxTTL, &role.TokenMaxTTL))
+	errs.addErr(tokenutil.UpgradeValue(data, "period", "token_period", &role.Period, &role.TokenPeriod))
+	errs.addErr(tokenutil.UpgradeValue(data, "additional_accepted_prefixes", "accepted_source_cidrs", &role.AdditionalAcceptedPrefixes, &role.AcceptedSourceCIDRs))
+
+	val, ok = data.GetOk("metadata_key")
 	if ok {
-		role.MaxTTL = time.Duration(val.(int)) * time.Second
+		role.MetadataKey = val.(string)
 	}
 
-	val, ok = data.GetOk("period")
+	val, ok = data.GetOk("metadata_values")
 	if ok {
-		role.Period = time.Duration(val.(int)) * time.Second
+		role.MetadataValues = val.([]string)
 	}
 
-	val, ok = data.GetOk("metadata_key")
+	val, ok = data.GetOk("bound_metadata")
 	if ok {
-		role.MetadataKey = val.(string)
+		role.BoundMetadata = val.(map[string]string)
 	}
 
 	val, ok = data.GetOk("auth_period")
@@ -227,11 +584,216 @@ func (b *OpenStackAuthBackend) updateRoleHandler(ctx context.Context, req *logic
 		role.TenantName = val.(string)
 	}
 
+	val, ok = data.GetOk("server_type")
+	if ok {
+		role.ServerType = val.(string)
+	}
+
+	val, ok = data.GetOk("bound_stack_id")
+	if ok {
+		role.BoundStackID = val.(string)
+	}
+
+	val, ok = data.GetOk("server_group_id")
+	if ok {
+		role.BoundServerGroupID = val.(string)
+	}
+
+	val, ok = data.GetOk("server_group_name")
+	if ok {
+		role.BoundServerGroupName = val.(string)
+	}
+
+	val, ok = data.GetOk("bound_flavor_ids")
+	if ok {
+		role.BoundFlavorIDs = val.([]string)
+	}
+
+	val, ok = data.GetOk("bound_flavor_names")
+	if ok {
+		role.BoundFlavorNames = val.([]string)
+	}
+
+	val, ok = data.GetOk("bound_image_ids")
+	if ok {
+		role.BoundImageIDs = val.([]string)
+	}
+
+	val, ok = data.GetOk("bound_key_names")
+	if ok {
+		role.BoundKeyNames = val.([]string)
+	}
+
+	val, ok = data.GetOk("bound_tags")
+	if ok {
+		role.BoundTags = val.([]string)
+	}
+
+	val, ok = data.GetOk("bound_availability_zones")
+	if ok {
+		role.BoundAvailabilityZones = val.([]string)
+	}
+
+	val, ok = data.GetOk("keystone_group_aliases")
+	if ok {
+		role.KeystoneGroupAliases = val.(bool)
+	}
+
+	val, ok = data.GetOk("bound_dns_zone")
+	if ok {
+		role.BoundDNSZone = val.(string)
+	}
+
+	val, ok = data.GetOk("identity_token_ttl")
+	if ok {
+		role.IdentityTokenTTL = time.Duration(val.(int)) * time.Second
+	}
+
+	val, ok = data.GetOk("identity_token_audience")
+	if ok {
+		role.IdentityTokenAudience = val.(string)
+	}
+
+	val, ok = data.GetOk("bound_mks_cluster_ids")
+	if ok {
+		role.BoundMKSClusterIDs = val.([]string)
+	}
+
+	val, ok = data.GetOk("bound_mks_nodegroup_ids")
+	if ok {
+		role.BoundMKSNodeGroupIDs = val.([]string)
+	}
+
+	val, ok = data.GetOk("require_preregistration")
+	if ok {
+		role.RequirePreregistration = val.(bool)
+	}
+
+	val, ok = data.GetOk("disallow_reauthentication")
+	if ok {
+		role.DisallowReauthentication = val.(bool)
+	}
+
+	val, ok = data.GetOk("require_response_wrapping")
+	if ok {
+		role.RequireResponseWrapping = val.(bool)
+	}
+
+	val, ok = data.GetOk("response_wrapping_ttl")
+	if ok {
+		role.ResponseWrappingTTL = time.Duration(val.(int)) * time.Second
+	}
+
+	val, ok = data.GetOk("resolve_floating_ips")
+	if ok {
+		role.ResolveFloatingIPs = val.(bool)
+	}
+
+	val, ok = data.GetOk("attest_port_ownership")
+	if ok {
+		role.AttestPortOwnership = val.(bool)
+	}
+
+	val, ok = data.GetOk("bind_token_addresses")
+	if ok {
+		role.BindTokenAddresses = val.(bool)
+	}
+
+	val, ok = data.GetOk("bind_token_ipv4_mask")
+	if ok {
+		role.BindTokenIPv4Mask = val.(int)
+	}
+
+	val, ok = data.GetOk("bind_token_ipv6_mask")
+	if ok {
+		role.BindTokenIPv6Mask = val.(int)
+	}
+
+	val, ok = data.GetOk("config")
+	if ok {
+		role.Config = val.(string)
+	}
+
+	val, ok = data.GetOk("region")
+	if ok {
+		role.Region = val.(string)
+	}
+
+	val, ok = data.GetOk("nonce_metadata_key")
+	if ok {
+		role.NonceMetadataKey = val.(string)
+	}
+
+	val, ok = data.GetOk("require_identity_document")
+	if ok {
+		role.RequireIdentityDocument = val.(bool)
+	}
+
+	val, ok = data.GetOk("identity_document_secrets")
+	if ok {
+		role.IdentityDocumentSecrets = val.([]string)
+	}
+
 	warnings, err := role.Validate(b.System())
+	errs.addErr(err)
+
+	config, err := b.getNamedConfig(ctx, req.Storage, role.Config)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+		return nil, err
+	}
+	if config == nil && role.Config != "" {
+		errs.add("config", "config profile %s does not exist", role.Config)
 	}
 
+	// A config looking up the instances of every project leaves the role
+	// as the only binding to a project.
+	if config != nil && config.AllTenants && !role.hasProjectBinding() {
+		errs.add("project_id", "required with a config which sets all_tenants, otherwise the role accepts the instances of every project")
+	}
+
+	if len(errs) > 0 {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", errs)), nil
+	}
+
+	// Verify that the project exists when the names can be resolved with
+	// the Selectel API, so that a typo doesn't surface only at login time.
+	if name := role.projectName(); name != "" && config != nil && config.SelectelAPIToken != "" {
+		_, err = b.resolveProjectID(ctx, config, name)
+		if errors.Is(err, errProjectNotFound) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid role: %v", err)), nil
+		}
+		if err != nil {
+			return nil, logical.CodedError(http.StatusBadGateway, fmt.Sprintf("failed to resolve project of role: %v", err))
+		}
+	}
+
+	// Verify that the compute API is available in the region of the role
+	// the same way as in the region of the config.
+	if _, ok := data.GetOk("region"); ok && role.Region != "" && config != nil {
+		regional := *config
+		regional.RegionName = role.Region
+		err = b.validateRegion(ctx, &regional)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid region: %v", err)), nil
+		}
+	}
+
+	if len(role.BoundMKSClusterIDs) > 0 && (config == nil || config.MKSClusterMetadataKey == "") {
+		warnings = append(warnings, "mks_cluster_metadata_key is not configured, logins with the role will be denied until it is")
+	}
+	if len(role.BoundMKSNodeGroupIDs) > 0 && (config == nil || config.MKSNodeGroupMetadataKey == "") {
+		warnings = append(warnings, "mks_nodegroup_metadata_key is not configured, logins with the role will be denied until it is")
+	}
+
+	if role.IdentityTokenTTL > 0 {
+		err = b.ensureIdentityKey(ctx, req.Storage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate identity token signing key: %w", err)
+		}
+	}
+
+	role.Version += 1
+
 	entry, err := logical.StorageEntryJSON(fmt.Sprintf("role/%s", roleName), role)
 	if err != nil {
 		return nil, err
@@ -242,6 +804,8 @@ func (b *OpenStackAuthBackend) updateRoleHandler(ctx context.Context, req *logic
 		return nil, err
 	}
 
+	b.recordChange(ctx, req, "role", roleName, role.Version, role.Fingerprint())
+
 	res := &logical.Response{
 		Warnings: warnings,
 	}
@@ -255,11 +819,22 @@ func (b *OpenStackAuthBackend) deleteRoleHandler(ctx context.Context, req *logic
 		return logical.ErrorResponse("role name is required"), nil
 	}
 
-	err := req.Storage.Delete(ctx, fmt.Sprintf("role/%s", roleName))
+	role, err := readRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, nil
+	}
+
+	err = req.Storage.Delete(ctx, fmt.Sprintf("role/%s", roleName))
 	if err != nil {
 		return nil, err
 	}
 
+	b.recordChange(ctx, req, "role", roleName, role.Version, "")
+
 	return nil, nil
 }
 
@@ -269,5 +844,28 @@ func (b *OpenStackAuthBackend) listRoleHandler(ctx context.Context, req *logical
 		return nil, err
 	}
 
-	return logical.ListResponse(roles), nil
+	if !data.Get("detail").(bool) {
+		return logical.ListResponse(roles), nil
+	}
+
+	keyInfo := map[string]interface{}{}
+	for _, name := range roles {
+		role, err := readRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			continue
+		}
+
+		info, err := b.effectiveRole(ctx, req.Storage, role)
+		if err != nil {
+			return nil, err
+		}
+		info["token_policies"] = role.TokenPolicies
+		info["config"] = role.Config
+		keyInfo[name] = info
+	}
+
+	return logical.ListResponseWithInfo(roles, keyInfo), nil
 }
@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRoleDefaults(t *testing.T) {
+	b, storage := newTestBackend(t)
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/web",
+		Storage:   storage,
+		Data:      map[string]interface{}{"policies": "web", "ttl": 60},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/web",
+		Storage:   storage,
+	})
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if res.Data["metadata_key"] != "vault-role" || res.Data["auth_period"] != int64(120) || res.Data["auth_limit"] != 1 {
+		t.Errorf("defaults were not applied: %v", res.Data)
+	}
+
+	sys := b.(*OpenStackAuthBackend).System()
+	expected := map[string]interface{}{
+		"ttl":          int64(60),
+		"max_ttl":      int64(sys.MaxLeaseTTL().Seconds()),
+		"period":       int64(0),
+		"project_id":   "",
+		"project_name": "",
+		"region":       "",
+	}
+	if !reflect.DeepEqual(res.Data["effective"], expected) {
+		t.Errorf("unexpected effective values: %v", res.Data["effective"])
+	}
+}
+
+func TestListRolesDetail(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/project",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"policies":   "project",
+			"project_id": "2a4c6e8a-0c2e-4a6c-8e0a-2c4e6a8c0e2a",
+			"region":     mockRegion,
+		},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "roles/",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.Data["key_info"] != nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "roles/",
+		Storage:   storage,
+		Data:      map[string]interface{}{"detail": true},
+	})
+	if err != nil || res == nil {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+	if keys := res.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	keyInfo := res.Data["key_info"].(map[string]interface{})
+
+	// The role without a project is bound to the project of the config.
+	test := keyInfo["test"].(map[string]interface{})
+	if test["project_id"] != mockProjectID || test["region"] != "" || !reflect.DeepEqual(test["token_policies"], []string{"test"}) {
+		t.Errorf("unexpected key info: %v", test)
+	}
+
+	project := keyInfo["project"].(map[string]interface{})
+	if project["project_id"] != "2a4c6e8a-0c2e-4a6c-8e0a-2c4e6a8c0e2a" || project["region"] != mockRegion {
+		t.Errorf("unexpected key info: %v", project)
+	}
+}
+
+func TestRoleDeprecatedTokenFields(t *testing.T) {
+	b, storage := newTestBackend(t)
+
+	// A role written before the token fields.
+	err := storage.Put(context.Background(), &logical.StorageEntry{
+		Key:   "role/old",
+		Value: []byte(`{"name":"old","policies":["web"],"ttl":3600000000000,"period":0,"metadata_key":"vault-role","additional_accepted_prefixes":["10.0.0.0/8"]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/new",
+		Storage:   storage,
+		Data:      map[string]interface{}{"policies": "web", "ttl": 3600, "additional_accepted_prefixes": "10.0.0.0/8"},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	for _, name := range []string{"old", "new"} {
+		res, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "role/" + name,
+			Storage:   storage,
+		})
+		if err != nil || res == nil {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+		if !reflect.DeepEqual(res.Data["token_policies"], []string{"web"}) || res.Data["token_ttl"] != int64(3600) {
+			t.Errorf("%s: token fields were not upgraded: %v", name, res.Data)
+		}
+		if !reflect.DeepEqual(res.Data["policies"], []string{"web"}) || res.Data["ttl"] != int64(3600) {
+			t.Errorf("%s: deprecated fields were not returned: %v", name, res.Data)
+		}
+		if _, ok := res.Data["period"]; ok {
+			t.Errorf("%s: unused deprecated field was returned: %v", name, res.Data)
+		}
+		if !reflect.DeepEqual(res.Data["accepted_source_cidrs"], []string{"10.0.0.0/8"}) || !reflect.DeepEqual(res.Data["additional_accepted_prefixes"], []string{"10.0.0.0/8"}) {
+			t.Errorf("%s: accepted_source_cidrs was not upgraded: %v", name, res.Data)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const tidySynopsis = "Removes the expired records from the storage."
+const tidyDescription = `
+Runs the cleanup of the expired auth attempts, instance events, instance
+registrations, instance nonces and instance logins, which is otherwise run
+by the periodic function of the mount, and reports the number of the
+records scanned and removed by each cleanup.
+`
+
+const tidyAuthAttemptsSynopsis = "Removes the expired auth attempts from the storage."
+const tidyAuthAttemptsDescription = `
+Runs the cleanup of the auth attempts only, keeping the attempts which
+expired less than safety_buffer ago, and reports the number of the auth
+attempts scanned and removed.
+`
+
+func NewPathTidy(b *OpenStackAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "tidy$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.tidyHandler,
+					Summary:  "Remove the expired records from the storage.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"auth_attempt":          {Type: framework.TypeMap, Description: "Number of the auth attempts scanned and removed."},
+							"instance_event":        {Type: framework.TypeMap, Description: "Number of the instance events scanned and removed."},
+							"instance_registration": {Type: framework.TypeMap, Description: "Number of the instance registrations scanned and removed."},
+							"instance_nonce":        {Type: framework.TypeMap, Description: "Number of the instance nonces scanned and removed."},
+							"instance_login":        {Type: framework.TypeMap, Description: "Number of the instance logins scanned and removed."},
+						}}},
+						http.StatusConflict: {{Description: "A cleanup is already running"}},
+					},
+				},
+			},
+			HelpSynopsis:    tidySynopsis,
+			HelpDescription: tidyDescription,
+		},
+		{
+			Pattern: "tidy/auth-attempts$",
+			Fields: map[string]*framework.FieldSchema{
+				"safety_buffer": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time the auth attempts are kept after they expire. Defaults to 0.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.tidyAuthAttemptsHandler,
+					Summary:  "Remove the expired auth attempts from the storage.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{Description: "OK", Fields: map[string]*framework.FieldSchema{
+							"scanned": {Type: framework.TypeInt, Description: "Number of the auth attempts scanned."},
+							"deleted": {Type: framework.TypeInt, Description: "Number of the auth attempts removed."},
+						}}},
+						http.StatusBadRequest: {{Description: "The safety buffer is negative"}},
+						http.StatusConflict:   {{Description: "A cleanup is already running"}},
+					},
+				},
+			},
+			HelpSynopsis:    tidyAuthAttemptsSynopsis,
+			HelpDescription: tidyAuthAttemptsDescription,
+		},
+	}
+}
+
+func (b *OpenStackAuthBackend) tidyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ctx, ok := b.acquireCleanup(ctx)
+	if !ok {
+		return nil, logical.CodedError(http.StatusConflict, "storage cleanup is already running")
+	}
+	defer b.releaseCleanup()
+
+	res := &logical.Response{Data: map[string]interface{}{}}
+	for _, result := range b.tidy(ctx, req.Storage) {
+		summary := map[string]interface{}{
+			"scanned": result.Scanned,
+			"deleted": result.Deleted,
+		}
+		if result.Err != nil {
+			summary["error"] = result.Err.Error()
+			res.AddWarning("failed to clean up " + result.Name + ": " + result.Err.Error())
+		}
+		res.Data[result.Name] = summary
+	}
+
+	return res, nil
+}
+
+func (b *OpenStackAuthBackend) tidyAuthAttemptsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	safetyBuffer := time.Duration(data.Get("safety_buffer").(int)) * time.Second
+	if safetyBuffer < 0 {
+		return logical.ErrorResponse("safety_buffer cannot be negative"), nil
+	}
+
+	ctx, ok := b.acquireCleanup(ctx)
+	if !ok {
+		return nil, logical.CodedError(http.StatusConflict, "storage cleanup is already running")
+	}
+	defer b.releaseCleanup()
+
+	start := time.Now()
+	result, err := tidyAuthAttempt(ctx, req.Storage, safetyBuffer)
+	b.recordSweep("auth_attempt", start, result, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean up auth attempts: %w", err)
+	}
+
+	if result.Deleted > 0 {
+		b.Logger().Info("expired auth attempts have been removed", "count", result.Deleted, "safety_buffer", safetyBuffer)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"scanned": result.Scanned,
+			"deleted": result.Deleted,
+		},
+	}, nil
+}
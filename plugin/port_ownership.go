@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	networkports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// attestPortOwnership verifies that the Neutron port holding one of the
+// request addresses, either as a fixed IP or through a floating IP, is
+// attached to the instance. Unlike the comparison with the addresses in the
+// server record, it binds the login to the network the request came from.
+// A fixed IP is not unique across the networks, so an address held by more
+// than one port cannot tell which one the request came from and is denied.
+func (b *OpenStackAuthBackend) attestPortOwnership(ctx context.Context, s logical.Storage, role *Role, instance *Instance, addrs []string) (err error) {
+	if !role.AttestPortOwnership {
+		return nil
+	}
+
+	client, err := b.getNetworkClient(ctx, s, role)
+	if err != nil {
+		return err
+	}
+
+	_, span := startSpan(ctx, "neutron.ports.verify", attribute.String("openstack.instance_id", instance.ID))
+	defer func() { endSpan(span, err) }()
+
+	for _, addr := range addrs {
+		owners, err := portOwners(client, addr)
+		if err != nil {
+			return err
+		}
+
+		if len(owners) > 1 {
+			return &AttestError{
+				Reason: ReasonPortOwnershipMismatch,
+				Hint:   "the address is held by ports in several networks, log in from an address which is unique across the networks",
+				Err:    fmt.Errorf("%d ports hold %s", len(owners), addr),
+			}
+		}
+
+		for _, owner := range owners {
+			if owner == instance.ID {
+				return nil
+			}
+		}
+	}
+
+	return &AttestError{
+		Reason: ReasonPortOwnershipMismatch,
+		Hint:   "log in from an address of a port attached to the instance, a NAT or a proxy in between hides it",
+		Err:    fmt.Errorf("no port holding %v is attached to the instance", addrs),
+	}
+}
+
+// portOwners returns the device IDs of the ports holding the address as a
+// fixed IP, or as the floating IP associated with them.
+func portOwners(client *gophercloud.ServiceClient, addr string) ([]string, error) {
+	pages, err := networkports.List(client, networkports.ListOpts{FixedIPs: []networkports.FixedIPOpts{{IPAddress: addr}}}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := networkports.ExtractPorts(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ports) == 0 {
+		pages, err := floatingips.List(client, floatingips.ListOpts{FloatingIP: addr}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := floatingips.ExtractFloatingIPs(pages)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			if ip.PortID == "" {
+				continue
+			}
+
+			port, err := networkports.Get(client, ip.PortID).Extract()
+			if err != nil {
+				return nil, err
+			}
+			ports = append(ports, *port)
+		}
+	}
+
+	owners := []string{}
+	for _, port := range ports {
+		owners = append(owners, port.DeviceID)
+	}
+
+	return owners, nil
+}
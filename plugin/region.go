@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// validateRegion verifies that the compute API is available in the region
+// of the config, so that a mistyped region fails when the config is written
+// instead of on the first login.
+func (b *OpenStackAuthBackend) validateRegion(ctx context.Context, config *Config) error {
+	provider, _, err := b.authenticate(ctx, config, &Role{})
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	result, ok := provider.GetAuthResult().(interface {
+		ExtractServiceCatalog() (*tokens.ServiceCatalog, error)
+	})
+	if !ok {
+		// The catalog of the Keystone v2 tokens is not verified.
+		return nil
+	}
+
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return fmt.Errorf("failed to read service catalog: %w", err)
+	}
+
+	regions := computeRegions(catalog, config.availability())
+	if !strutil.StrListContains(regions, config.RegionName) {
+		return fmt.Errorf("no %s compute endpoint in region %q, valid regions: %s", config.availability(), config.RegionName, strings.Join(regions, ", "))
+	}
+
+	return nil
+}
+
+// computeRegions returns the regions which have a compute endpoint with
+// the availability in the catalog, sorted.
+func computeRegions(catalog *tokens.ServiceCatalog, availability gophercloud.Availability) []string {
+	regions := []string{}
+	for _, entry := range catalog.Entries {
+		if entry.Type != "compute" {
+			continue
+		}
+
+		for _, endpoint := range entry.Endpoints {
+			if endpoint.Interface != string(availability) {
+				continue
+			}
+
+			// The endpoints are matched by either the region or the
+			// region ID, the same way as gophercloud does.
+			for _, region := range []string{endpoint.Region, endpoint.RegionID} {
+				if region != "" {
+					regions = append(regions, region)
+				}
+			}
+		}
+	}
+
+	return strutil.RemoveDuplicates(regions, false)
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestConfigRegion(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	var tests = []struct {
+		data  map[string]interface{}
+		error string
+	}{
+		{map[string]interface{}{"region_name": mockRegion}, ""},
+		{map[string]interface{}{"region_name": "RegionTwo"}, "valid regions: " + mockRegion},
+		{map[string]interface{}{"region_name": mockRegion, "availability": "internal"}, "no internal compute endpoint"},
+		// not verified: region is not written
+		{map[string]interface{}{"availability": "internal"}, ""},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      test.data,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if test.error == "" && res != nil && res.IsError() {
+			t.Errorf("unexpected error response: %v - %v", test.data, res.Error())
+		}
+		if test.error != "" && (res == nil || !strings.Contains(res.Error().Error(), test.error)) {
+			t.Errorf("unexpected response: %v - %v", test.data, res)
+		}
+	}
+}
+
+func TestRoleRegion(t *testing.T) {
+	m := newMockOpenStack(t)
+
+	instance := newTestLoginInstance("7b9d1f3b-5d7f-4b9d-9f3b-5d7f9b1d3f5b")
+	m.AddServer(&instance.Server)
+
+	b, storage := newTestLoginBackend(t, m)
+
+	var tests = []struct {
+		region string
+		error  string
+	}{
+		{"RegionTwo", "valid regions: " + mockRegion},
+		{mockRegion, ""},
+	}
+
+	for _, test := range tests {
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"region": test.region},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if test.error == "" && res != nil && res.IsError() {
+			t.Errorf("unexpected error response: %v - %v", test.region, res.Error())
+		}
+		if test.error != "" && (res == nil || !strings.Contains(res.Error().Error(), test.error)) {
+			t.Errorf("unexpected response: %v - %v", test.region, res)
+		}
+	}
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/test",
+		Storage:   storage,
+	})
+	if err != nil || res == nil || res.Data["region"] != mockRegion {
+		t.Fatalf("unexpected role: %v - %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), newTestLoginRequest(storage, instance.ID, correctIPv4))
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("unexpected result: %v - %v", res, err)
+	}
+
+	backend := b.(*OpenStackAuthBackend)
+	for key := range backend.clients {
+		if key.region != mockRegion {
+			t.Errorf("unexpected client region: %q", key.region)
+		}
+	}
+}
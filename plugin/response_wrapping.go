@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/wrapping"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// defaultResponseWrappingTTL is the TTL of the wrapping token of a role
+// requiring response wrapping without response_wrapping_ttl.
+const defaultResponseWrappingTTL = time.Minute
+
+// responseWrapInfo returns the wrapping of the login response forced by the
+// role, or nil if the role does not require it. The wrap_ttl of the request
+// is honored when it is shorter than the TTL of the role, so that the caller
+// cannot keep the wrapping token around longer than the role allows.
+func responseWrapInfo(req *logical.Request, role *Role) *wrapping.ResponseWrapInfo {
+	if !role.RequireResponseWrapping {
+		return nil
+	}
+
+	info := &wrapping.ResponseWrapInfo{TTL: role.ResponseWrappingTTL}
+	if info.TTL == 0 {
+		info.TTL = defaultResponseWrappingTTL
+	}
+
+	if req.WrapInfo != nil && req.WrapInfo.TTL > 0 && req.WrapInfo.TTL < info.TTL {
+		info.TTL = req.WrapInfo.TTL
+		info.Format = req.WrapInfo.Format
+	}
+
+	return info
+}
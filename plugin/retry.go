@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/gophercloud/gophercloud"
+)
+
+const (
+	// defaultLookupAttempts is the number of attempts of an instance
+	// lookup when the config doesn't set lookup_attempts.
+	defaultLookupAttempts = 3
+
+	minRetryDelay = 250 * time.Millisecond
+	maxRetryDelay = 2 * time.Second
+)
+
+// lookupAttempts returns how many times an instance lookup failing with a
+// transient error is attempted.
+func (c *Config) lookupAttempts() int {
+	if c.LookupAttempts == 0 {
+		return defaultLookupAttempts
+	}
+
+	return c.LookupAttempts
+}
+
+// retryTransient calls fn until it succeeds, fails with an error which is
+// not transient or has been attempted the given number of times. The delay
+// between the attempts doubles from minRetryDelay up to maxRetryDelay.
+func retryTransient(ctx context.Context, attempts int, fn func() error) error {
+	delay := minRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !transientError(err) {
+			return err
+		}
+
+		metrics.IncrCounter([]string{"openstack", "lookup", "retried"}, 1)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// transientError returns whether the request failed with a server error
+// status, or the connection was dropped, so that the same request may pass
+// when it is sent again. The over-limit responses are already retried by
+// the provider client up to max_retries times.
+func transientError(err error) bool {
+	switch {
+	case errors.As(err, &gophercloud.ErrDefault500{}), errors.As(err, &gophercloud.ErrDefault502{}), errors.As(err, &gophercloud.ErrDefault503{}), errors.As(err, &gophercloud.ErrDefault504{}):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+
+	return false
+}
@@ -2,79 +2,285 @@ package plugin
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
 type Role struct {
-	Name                       string        `json:"name" structs:"name" mapstructure:"name"`
-	Policies                   []string      `json:"policies" structs:"policies" mapstructure:"policies"`
-	TTL                        time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
-	MaxTTL                     time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
-	Period                     time.Duration `json:"period" structs:"period" mapstructure:"period"`
-	MetadataKey                string        `json:"metadata_key" structs:"metadata_key" mapstructure:"metadata_key"`
-	TenantID                   string        `json:"tenant_id" structs:"tenant_id" mapstructure:"tenant_id"`
-	TenantName                 string        `json:"tenant_name" structs:"tenant_name" mapstructure:"tenant_name"`
-	ProjectID                  string        `json:"project_id" structs:"project_id" mapstructure:"project_id"`
-	ProjectName                string        `json:"project_name" structs:"project_name" mapstructure:"project_name"`
-	UserID                     string        `json:"user_id" structs:"user_id" mapstructure:"user_id"`
-	AuthPeriod                 time.Duration `json:"auth_period" structs:"auth_period" mapstructure:"auth_period"`
-	AuthLimit                  int           `json:"auth_limit" structs:"auth_limit" mapstructure:"auth_limit"`
-	AdditionalAcceptedPrefixes []string      `json:"additional_accepted_prefixes" structs:"additional_accepted_prefixes" mapstructure:"additional_accepted_prefixes"`
+	tokenutil.TokenParams
+
+	Name                     string            `json:"name" structs:"name" mapstructure:"name"`
+	MetadataKey              string            `json:"metadata_key" structs:"metadata_key" mapstructure:"metadata_key"`
+	MetadataValues           []string          `json:"metadata_values" structs:"metadata_values" mapstructure:"metadata_values"`
+	BoundMetadata            map[string]string `json:"bound_metadata" structs:"bound_metadata" mapstructure:"bound_metadata"`
+	TenantID                 string            `json:"tenant_id" structs:"tenant_id" mapstructure:"tenant_id"`
+	TenantName               string            `json:"tenant_name" structs:"tenant_name" mapstructure:"tenant_name"`
+	ProjectID                string            `json:"project_id" structs:"project_id" mapstructure:"project_id"`
+	ProjectName              string            `json:"project_name" structs:"project_name" mapstructure:"project_name"`
+	UserID                   string            `json:"user_id" structs:"user_id" mapstructure:"user_id"`
+	AuthPeriod               time.Duration     `json:"auth_period" structs:"auth_period" mapstructure:"auth_period"`
+	AuthLimit                int               `json:"auth_limit" structs:"auth_limit" mapstructure:"auth_limit"`
+	BindTokenAddresses       bool              `json:"bind_token_addresses" structs:"bind_token_addresses" mapstructure:"bind_token_addresses"`
+	BindTokenIPv4Mask        int               `json:"bind_token_ipv4_mask" structs:"bind_token_ipv4_mask" mapstructure:"bind_token_ipv4_mask"`
+	BindTokenIPv6Mask        int               `json:"bind_token_ipv6_mask" structs:"bind_token_ipv6_mask" mapstructure:"bind_token_ipv6_mask"`
+	AcceptedSourceCIDRs      []string          `json:"accepted_source_cidrs" structs:"accepted_source_cidrs" mapstructure:"accepted_source_cidrs"`
+	ResolveFloatingIPs       bool              `json:"resolve_floating_ips" structs:"resolve_floating_ips" mapstructure:"resolve_floating_ips"`
+	AttestPortOwnership      bool              `json:"attest_port_ownership" structs:"attest_port_ownership" mapstructure:"attest_port_ownership"`
+	ServerType               string            `json:"server_type" structs:"server_type" mapstructure:"server_type"`
+	BoundStackID             string            `json:"bound_stack_id" structs:"bound_stack_id" mapstructure:"bound_stack_id"`
+	BoundServerGroupID       string            `json:"server_group_id" structs:"server_group_id" mapstructure:"server_group_id"`
+	BoundServerGroupName     string            `json:"server_group_name" structs:"server_group_name" mapstructure:"server_group_name"`
+	BoundFlavorIDs           []string          `json:"bound_flavor_ids" structs:"bound_flavor_ids" mapstructure:"bound_flavor_ids"`
+	BoundFlavorNames         []string          `json:"bound_flavor_names" structs:"bound_flavor_names" mapstructure:"bound_flavor_names"`
+	BoundImageIDs            []string          `json:"bound_image_ids" structs:"bound_image_ids" mapstructure:"bound_image_ids"`
+	BoundKeyNames            []string          `json:"bound_key_names" structs:"bound_key_names" mapstructure:"bound_key_names"`
+	BoundTags                []string          `json:"bound_tags" structs:"bound_tags" mapstructure:"bound_tags"`
+	BoundAvailabilityZones   []string          `json:"bound_availability_zones" structs:"bound_availability_zones" mapstructure:"bound_availability_zones"`
+	KeystoneGroupAliases     bool              `json:"keystone_group_aliases" structs:"keystone_group_aliases" mapstructure:"keystone_group_aliases"`
+	BoundMKSClusterIDs       []string          `json:"bound_mks_cluster_ids" structs:"bound_mks_cluster_ids" mapstructure:"bound_mks_cluster_ids"`
+	BoundMKSNodeGroupIDs     []string          `json:"bound_mks_nodegroup_ids" structs:"bound_mks_nodegroup_ids" mapstructure:"bound_mks_nodegroup_ids"`
+	IdentityTokenTTL         time.Duration     `json:"identity_token_ttl" structs:"identity_token_ttl" mapstructure:"identity_token_ttl"`
+	IdentityTokenAudience    string            `json:"identity_token_audience" structs:"identity_token_audience" mapstructure:"identity_token_audience"`
+	BoundDNSZone             string            `json:"bound_dns_zone" structs:"bound_dns_zone" mapstructure:"bound_dns_zone"`
+	RequirePreregistration   bool              `json:"require_preregistration" structs:"require_preregistration" mapstructure:"require_preregistration"`
+	DisallowReauthentication bool              `json:"disallow_reauthentication" structs:"disallow_reauthentication" mapstructure:"disallow_reauthentication"`
+	RequireResponseWrapping  bool              `json:"require_response_wrapping" structs:"require_response_wrapping" mapstructure:"require_response_wrapping"`
+	ResponseWrappingTTL      time.Duration     `json:"response_wrapping_ttl" structs:"response_wrapping_ttl" mapstructure:"response_wrapping_ttl"`
+	Config                   string            `json:"config" structs:"config" mapstructure:"config"`
+	Region                   string            `json:"region" structs:"region" mapstructure:"region"`
+	NonceMetadataKey         string            `json:"nonce_metadata_key" structs:"nonce_metadata_key" mapstructure:"nonce_metadata_key"`
+	RequireIdentityDocument  bool              `json:"require_identity_document" structs:"require_identity_document" mapstructure:"require_identity_document"`
+	IdentityDocumentSecrets  []string          `json:"identity_document_secrets" structs:"identity_document_secrets" mapstructure:"identity_document_secrets"`
+	Version                  int               `json:"version" structs:"version" mapstructure:"version"`
+
+	// The token settings of the roles written before the token fields.
+	Policies []string      `json:"policies,omitempty" structs:"policies" mapstructure:"policies"`
+	TTL      time.Duration `json:"ttl,omitempty" structs:"ttl" mapstructure:"ttl"`
+	MaxTTL   time.Duration `json:"max_ttl,omitempty" structs:"max_ttl" mapstructure:"max_ttl"`
+	Period   time.Duration `json:"period,omitempty" structs:"period" mapstructure:"period"`
+
+	// The accepted source CIDRs of the roles written before
+	// accepted_source_cidrs.
+	AdditionalAcceptedPrefixes []string `json:"additional_accepted_prefixes,omitempty" structs:"additional_accepted_prefixes" mapstructure:"additional_accepted_prefixes"`
+}
+
+// Fingerprint returns the fingerprint of the role. The version is
+// excluded, so that the fingerprint stays the same when the same role is
+// written again.
+func (r *Role) Fingerprint() string {
+	role := *r
+	role.Version = 0
+
+	return fingerprint(role)
 }
 
+// projectName returns the name of the project the role is bound to.
+func (r *Role) projectName() string {
+	if r.TenantName != "" {
+		return r.TenantName
+	}
+
+	return r.ProjectName
+}
+
+// hasProjectBinding returns whether the role is bound to a project by its
+// ID or its name.
+func (r *Role) hasProjectBinding() bool {
+	return r.ProjectID != "" || r.TenantID != "" || r.projectName() != ""
+}
+
+// region returns the region the role looks up the instances in.
+func (r *Role) region(config *Config) string {
+	if r.Region != "" {
+		return r.Region
+	}
+
+	return config.RegionName
+}
+
+// Validate returns the warnings about the role and the problems of all of
+// its fields.
 func (r *Role) Validate(sys logical.SystemView) (warnings []string, err error) {
 	warnings = []string{}
+	errs := fieldErrors{}
+
+	if r.MetadataKey == "" && !r.hasMKSBindings() {
+		errs.add("metadata_key", "cannot be empty")
+	}
+
+	if r.MetadataKey == "" && len(r.MetadataValues) > 0 {
+		errs.add("metadata_values", "cannot be used without metadata_key")
+	}
+
+	for _, val := range r.MetadataValues {
+		if val == "" {
+			errs.add("metadata_values", "cannot contain an empty value")
+			break
+		}
+	}
+
+	switch r.ServerType {
+	case "", serverTypeCloud, serverTypeDedicated, serverTypeBaremetal:
+	default:
+		errs.add("server_type", "must be %s, %s or %s", serverTypeCloud, serverTypeDedicated, serverTypeBaremetal)
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && r.BoundStackID != "" {
+		errs.add("bound_stack_id", "can only be used with cloud servers")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && r.hasServerGroupBinding() {
+		errs.add("server_group_id", "can only be used with cloud servers")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && r.ResolveFloatingIPs {
+		errs.add("resolve_floating_ips", "can only be used with cloud servers")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && r.AttestPortOwnership {
+		errs.add("attest_port_ownership", "can only be used with cloud servers")
+	}
+
+	if r.NonceMetadataKey != "" && r.AttestPortOwnership {
+		errs.add("attest_port_ownership", "cannot be used with nonce_metadata_key")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && r.hasFlavorBinding() {
+		errs.add("bound_flavor_ids", "can only be used with cloud servers")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && len(r.BoundImageIDs) > 0 {
+		errs.add("bound_image_ids", "can only be used with cloud servers")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && len(r.BoundKeyNames) > 0 {
+		errs.add("bound_key_names", "can only be used with cloud servers")
+	}
 
-	if r.MetadataKey == "" {
-		return warnings, errors.New("metadata_key cannot be empty")
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && len(r.BoundTags) > 0 {
+		errs.add("bound_tags", "can only be used with cloud servers")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && len(r.BoundAvailabilityZones) > 0 {
+		errs.add("bound_availability_zones", "can only be used with cloud servers")
+	}
+
+	if r.BoundServerGroupID != "" && r.BoundServerGroupName != "" {
+		errs.add("server_group_name", "cannot be used with server_group_id")
+	}
+
+	if r.ServerType != "" && r.ServerType != serverTypeCloud && r.NonceMetadataKey != "" {
+		errs.add("nonce_metadata_key", "can only be used with cloud servers")
+	}
+
+	if r.NonceMetadataKey != "" && r.NonceMetadataKey == r.MetadataKey {
+		errs.add("nonce_metadata_key", "cannot be the same as metadata_key")
+	}
+
+	if _, ok := r.BoundMetadata[r.NonceMetadataKey]; ok && r.NonceMetadataKey != "" {
+		errs.add("bound_metadata", "cannot bind nonce_metadata_key")
+	}
+
+	if r.ServerType == serverTypeDedicated && len(r.IdentityDocumentSecrets) > 0 {
+		errs.add("identity_document_secrets", "cannot be used with dedicated servers")
+	}
+
+	for _, ref := range r.IdentityDocumentSecrets {
+		if _, err := secretID(ref); err != nil {
+			errs.add("identity_document_secrets", "%v", err)
+		}
+	}
+
+	if r.IdentityTokenTTL < time.Duration(0) {
+		errs.add("identity_token_ttl", "cannot be negative")
+	}
+
+	if r.ResponseWrappingTTL < time.Duration(0) {
+		errs.add("response_wrapping_ttl", "cannot be negative")
+	}
+
+	if r.ResponseWrappingTTL > 0 && !r.RequireResponseWrapping {
+		errs.add("response_wrapping_ttl", "can only be used with require_response_wrapping")
 	}
 
 	if r.AuthPeriod < time.Duration(0) {
-		return warnings, errors.New("auth_period cannot be negative")
+		errs.add("auth_period", "cannot be negative")
+	}
+
+	// An instance cannot log in at all with a zero auth_limit, since the
+	// attempt is counted before it is verified.
+	if r.AuthLimit < 1 {
+		errs.add("auth_limit", "must be greater than 0")
+	}
+
+	if _, ok := r.BoundMetadata[""]; ok {
+		errs.add("bound_metadata", "cannot bind an empty key")
 	}
 
-	if r.AuthLimit < 0 {
-		return warnings, errors.New("auth_limit cannot be negative")
+	for _, policy := range r.TokenPolicies {
+		switch {
+		case policy == "root":
+			errs.add("token_policies", "cannot contain the root policy")
+		case strings.IndexFunc(policy, unicode.IsSpace) >= 0:
+			errs.add("token_policies", "'%s' is not a valid policy name", policy)
+		}
 	}
 
 	defaultLeaseTTL := sys.DefaultLeaseTTL()
-	if r.TTL > defaultLeaseTTL {
+	if r.TokenTTL > defaultLeaseTTL {
 		warnings = append(warnings, fmt.Sprintf(
-			"Given ttl of %d seconds greater than current mount/system default of %d seconds; ttl will be capped at login time",
-			r.TTL/time.Second, defaultLeaseTTL/time.Second))
+			"Given token_ttl of %d seconds greater than current mount/system default of %d seconds; token_ttl will be capped at login time",
+			r.TokenTTL/time.Second, defaultLeaseTTL/time.Second))
 	}
 
 	defaultMaxTTL := sys.MaxLeaseTTL()
-	if r.MaxTTL > defaultMaxTTL {
+	if r.TokenMaxTTL > defaultMaxTTL {
 		warnings = append(warnings, fmt.Sprintf(
-			"Given max_ttl of %d seconds greater than current mount/system default of %d seconds; max_ttl will be capped at login time",
-			r.MaxTTL/time.Second, defaultMaxTTL/time.Second))
+			"Given token_max_ttl of %d seconds greater than current mount/system default of %d seconds; token_max_ttl will be capped at login time",
+			r.TokenMaxTTL/time.Second, defaultMaxTTL/time.Second))
+	}
+
+	if r.TokenMaxTTL < time.Duration(0) {
+		errs.add("token_max_ttl", "cannot be negative")
+	}
+
+	if r.TokenMaxTTL != 0 && r.TokenMaxTTL < r.TokenTTL {
+		errs.add("token_ttl", "should be shorter than token_max_ttl")
 	}
 
-	if r.MaxTTL < time.Duration(0) {
-		return warnings, errors.New("max_ttl cannot be negative")
+	if r.TokenPeriod > sys.MaxLeaseTTL() {
+		errs.add("token_period", "'%s' is greater than the backend's maximum lease TTL of '%s'", r.TokenPeriod, sys.MaxLeaseTTL())
 	}
 
-	if r.MaxTTL != 0 && r.MaxTTL < r.TTL {
-		return warnings, errors.New("ttl should be shorter than max_ttl")
+	if r.TokenPeriod > 0 && (r.TokenType == logical.TokenTypeBatch || r.TokenType == logical.TokenTypeDefaultBatch) {
+		errs.add("token_period", "cannot be used with %s tokens", r.TokenType)
 	}
 
-	if r.Period > sys.MaxLeaseTTL() {
-		return warnings, fmt.Errorf("'period' of '%s' is greater than the backend's maximum lease TTL of '%s'", r.Period, sys.MaxLeaseTTL())
+	if r.BindTokenAddresses && len(r.TokenBoundCIDRs) > 0 {
+		errs.add("bind_token_addresses", "cannot be used with token_bound_cidrs")
 	}
 
-	for _, prefix := range r.AdditionalAcceptedPrefixes {
+	if r.BindTokenIPv4Mask < 0 || r.BindTokenIPv4Mask > 32 {
+		errs.add("bind_token_ipv4_mask", "must be between 0 and 32")
+	}
+
+	if r.BindTokenIPv6Mask < 0 || r.BindTokenIPv6Mask > 128 {
+		errs.add("bind_token_ipv6_mask", "must be between 0 and 128")
+	}
+
+	for _, prefix := range r.AcceptedSourceCIDRs {
 		if _, _, err := net.ParseCIDR(prefix); err != nil {
-			return warnings, fmt.Errorf("'%s' is not a valid CIDR", prefix)
+			errs.add("accepted_source_cidrs", "'%s' is not a valid CIDR", prefix)
 		}
 	}
 
-	return warnings, nil
+	return warnings, errs.err()
 }
 
 func readRole(ctx context.Context, s logical.Storage, name string) (*Role, error) {
@@ -93,5 +299,23 @@ func readRole(ctx context.Context, s logical.Storage, name string) (*Role, error
 		return nil, err
 	}
 
+	// The roles written before the token fields keep issuing the same
+	// tokens until they are written again.
+	if len(role.TokenPolicies) == 0 && len(role.Policies) > 0 {
+		role.TokenPolicies = role.Policies
+	}
+	if role.TokenTTL == 0 && role.TTL > 0 {
+		role.TokenTTL = role.TTL
+	}
+	if role.TokenMaxTTL == 0 && role.MaxTTL > 0 {
+		role.TokenMaxTTL = role.MaxTTL
+	}
+	if role.TokenPeriod == 0 && role.Period > 0 {
+		role.TokenPeriod = role.Period
+	}
+	if len(role.AcceptedSourceCIDRs) == 0 && len(role.AdditionalAcceptedPrefixes) > 0 {
+		role.AcceptedSourceCIDRs = role.AdditionalAcceptedPrefixes
+	}
+
 	return role, nil
 }
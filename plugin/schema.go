@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// noContentResponses documents the operations which return no data.
+var noContentResponses = map[int][]framework.Response{
+	http.StatusNoContent: {{Description: "No Content"}},
+}
+
+// responseFields returns the schema of a read response which returns the
+// request fields as stored, leaving out the excluded fields and adding the
+// fields only present in the response.
+func responseFields(fields, extra map[string]*framework.FieldSchema, exclude ...string) map[string]*framework.FieldSchema {
+	res := make(map[string]*framework.FieldSchema, len(fields)+len(extra))
+	for name, field := range fields {
+		res[name] = &framework.FieldSchema{
+			Type:        field.Type,
+			Description: field.Description,
+		}
+	}
+
+	for _, name := range exclude {
+		delete(res, name)
+	}
+
+	for name, field := range extra {
+		res[name] = field
+	}
+
+	return res
+}
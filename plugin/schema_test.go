@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/testhelpers/schema"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestResponseSchemas(t *testing.T) {
+	m := newMockOpenStack(t)
+	b, storage := newTestLoginBackend(t, m)
+
+	var tests = []struct {
+		path      string
+		operation logical.Operation
+	}{
+		{"config", logical.ReadOperation},
+		{"role/test", logical.ReadOperation},
+		{"role/", logical.ListOperation},
+		{"info", logical.ReadOperation},
+		{"metrics", logical.ReadOperation},
+	}
+
+	for _, test := range tests {
+		req := &logical.Request{
+			Operation: test.operation,
+			Path:      test.path,
+			Storage:   storage,
+		}
+
+		res, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s - %v", test.path, err)
+		}
+
+		path := b.(*OpenStackAuthBackend).Route(test.path)
+		schema.ValidateResponse(t, schema.GetResponseSchema(t, path, test.operation), res, true)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	b, storage := newTestBackend(t)
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.HelpOperation,
+		Storage:   storage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doc := res.Data["openapi"].(*framework.OASDocument)
+	for _, path := range []string{"/config", "/role/{name}", "/login"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("path is not documented: %s", path)
+		}
+	}
+}
+
+func TestConfigResponseFieldsSecrets(t *testing.T) {
+	for _, name := range (configSecrets{
+		Token:                       "x",
+		Password:                    "x",
+		SelectelAPIToken:            "x",
+		TOTPSecret:                  "x",
+		ApplicationCredentialSecret: "x",
+		ClientSecret:                "x",
+		ClientKey:                   "x",
+	}).names() {
+		if _, ok := configResponseFields[name]; ok {
+			t.Errorf("secret is in the response schema: %s", name)
+		}
+	}
+}
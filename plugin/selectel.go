@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultSelectelAPIURL is the endpoint of the Selectel cloud management API.
+const defaultSelectelAPIURL = "https://api.selectel.ru/vpc/resell"
+
+const (
+	// projectCacheSize is the maximum number of cached project names.
+	projectCacheSize = 1024
+
+	// projectCacheTTL is the duration to remember a resolved project name.
+	projectCacheTTL = 5 * time.Minute
+
+	// selectelTimeout is the timeout of a request to the Selectel API.
+	selectelTimeout = 10 * time.Second
+)
+
+var (
+	errProjectNotFound    = errors.New("project not found")
+	errProjectNameBinding = errors.New("role with project name binding cannot be used with all_tenants, use project_id or configure selectel_api_token")
+	errProjectBinding     = errors.New("role without project binding cannot be used with all_tenants, set project_id")
+)
+
+// selectelProject is a project of the Selectel account.
+type selectelProject struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// selectelClient is a client of the Selectel cloud management API, which
+// lists the projects of the whole account regardless of the Keystone role
+// of the OpenStack user.
+type selectelClient struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newSelectelClient(config *Config) *selectelClient {
+	url := config.SelectelAPIURL
+	if url == "" {
+		url = defaultSelectelAPIURL
+	}
+
+	return &selectelClient{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  config.SelectelAPIToken,
+		client: &http.Client{Timeout: selectelTimeout},
+	}
+}
+
+// Projects returns the projects of the account.
+func (c *selectelClient) Projects(ctx context.Context) (projects []selectelProject, err error) {
+	ctx, span := startSpan(ctx, "selectel.projects.list", attribute.String("selectel.api_url", c.url))
+	defer func() { endSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/v2/projects", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Token", c.token)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from selectel API: %d", res.StatusCode)
+	}
+
+	var body struct {
+		Projects []selectelProject `json:"projects"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	return body.Projects, nil
+}
+
+// resolveProjectID resolves the project name to the ID with the Selectel
+// API. The resolved names are cached for a while since the names of the
+// projects rarely change. The config profiles may belong to different
+// accounts, so the names are cached per profile.
+func (b *OpenStackAuthBackend) resolveProjectID(ctx context.Context, config *Config, name string) (string, error) {
+	key := config.name + "/" + name
+	if id, ok := b.projectCache.Get(key); ok {
+		return id, nil
+	}
+
+	projects, err := newSelectelClient(config).Projects(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, project := range projects {
+		if project.Name == name {
+			b.projectCache.Add(key, project.ID)
+			return project.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", errProjectNotFound, name)
+}
+
+// bindProjectID returns the role to attest the instances with when the
+// client is not scoped to the project of the role. A role bound to the
+// project only by name is bound to the ID resolved with the Selectel API,
+// since the instances only carry the project ID. A role without a project
+// binding is denied with all_tenants, which may have been set after the
+// role was written.
+func (b *OpenStackAuthBackend) bindProjectID(ctx context.Context, config *Config, role *Role) (*Role, error) {
+	if config.AllTenants && !role.hasProjectBinding() {
+		return nil, errProjectBinding
+	}
+
+	if !config.fixedScope() || role.ProjectID != "" || role.TenantID != "" {
+		return role, nil
+	}
+
+	name := role.projectName()
+	if name == "" {
+		return role, nil
+	}
+
+	if config.SelectelAPIToken == "" {
+		return nil, errProjectNameBinding
+	}
+
+	id, err := b.resolveProjectID(ctx, config, name)
+	if err != nil {
+		return nil, err
+	}
+
+	bound := *role
+	bound.ProjectID = id
+
+	return &bound, nil
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// hasServerGroupBinding returns whether the role is bound to a server group.
+func (r *Role) hasServerGroupBinding() bool {
+	return r.BoundServerGroupID != "" || r.BoundServerGroupName != ""
+}
+
+// attestServerGroup verifies that the instance is a member of the server
+// group bound to the role.
+func (b *OpenStackAuthBackend) attestServerGroup(ctx context.Context, s logical.Storage, config *Config, role *Role, instance *Instance) (err error) {
+	if !role.hasServerGroupBinding() {
+		return nil
+	}
+
+	client, err := b.getClient(ctx, s, role)
+	if err != nil {
+		return err
+	}
+
+	bound := role.BoundServerGroupID
+	if bound == "" {
+		bound = role.BoundServerGroupName
+	}
+
+	ctx, span := startSpan(ctx, "nova.server_groups.verify", attribute.String("openstack.server_group", bound), attribute.String("openstack.instance_id", instance.ID))
+	defer func() { endSpan(span, err) }()
+
+	group, err := findServerGroup(client, config, role)
+	if err != nil {
+		return err
+	}
+
+	if !strutil.StrListContains(group.Members, instance.ID) {
+		return &AttestError{
+			Reason: ReasonServerGroupMismatch,
+			Hint:   fmt.Sprintf("launch the instance in server group %s with `openstack server create --hint group=%s`", group.Name, group.ID),
+			Err:    fmt.Errorf("instance is not a member of server group %s", group.ID),
+		}
+	}
+
+	return nil
+}
+
+// findServerGroup returns the server group bound to the role by its ID or,
+// failing that, by its name, which must be unique.
+func findServerGroup(client *gophercloud.ServiceClient, config *Config, role *Role) (*servergroups.ServerGroup, error) {
+	notFound := &AttestError{
+		Reason: ReasonServerGroupMismatch,
+		Hint:   "check server_group_id or server_group_name of the role, the server group is not visible to the backend",
+	}
+
+	if role.BoundServerGroupID != "" {
+		group, err := servergroups.Get(client, role.BoundServerGroupID).Extract()
+		if errors.As(err, &gophercloud.ErrDefault404{}) {
+			notFound.Err = fmt.Errorf("server group not found: %s", role.BoundServerGroupID)
+			return nil, notFound
+		}
+
+		return group, err
+	}
+
+	pages, err := servergroups.List(client, servergroups.ListOpts{AllProjects: config.AllTenants}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := servergroups.ExtractServerGroups(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *servergroups.ServerGroup
+	for i := range groups {
+		if groups[i].Name != role.BoundServerGroupName {
+			continue
+		}
+		if found != nil {
+			return nil, &AttestError{
+				Reason: ReasonServerGroupMismatch,
+				Hint:   "bind the role with server_group_id instead",
+				Err:    fmt.Errorf("multiple server groups named %s", role.BoundServerGroupName),
+			}
+		}
+		found = &groups[i]
+	}
+
+	if found == nil {
+		notFound.Err = fmt.Errorf("server group not found: %s", role.BoundServerGroupName)
+		return nil, notFound
+	}
+
+	return found, nil
+}
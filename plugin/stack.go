@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/orchestration/v1/stackresources"
+	"github.com/gophercloud/gophercloud/openstack/orchestration/v1/stacks"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// stackNestedDepth is the depth of the nested stacks searched for the
+// instance, so that the instances of resource groups and nested templates
+// are found.
+const stackNestedDepth = 5
+
+// healthyStackStatuses is the list of the stack statuses in which the
+// instances of the stack can login. A stack operation in progress may still
+// fail or roll back, so the instances wait for it to complete.
+var healthyStackStatuses = []string{
+	"CREATE_COMPLETE",
+	"UPDATE_COMPLETE",
+	"RESUME_COMPLETE",
+	"CHECK_COMPLETE",
+}
+
+// attestStack verifies that the instance is a resource of the stack bound
+// to the role and that the stack is healthy.
+func (b *OpenStackAuthBackend) attestStack(ctx context.Context, s logical.Storage, role *Role, instance *Instance) (err error) {
+	if role.BoundStackID == "" {
+		return nil
+	}
+
+	client, err := b.getStackClient(ctx, s, role)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startSpan(ctx, "heat.stacks.verify", attribute.String("openstack.stack_id", role.BoundStackID), attribute.String("openstack.instance_id", instance.ID))
+	defer func() { endSpan(span, err) }()
+
+	stack, err := stacks.Find(client, role.BoundStackID).Extract()
+	if errors.As(err, &gophercloud.ErrDefault404{}) {
+		return &AttestError{
+			Reason: ReasonStackMismatch,
+			Hint:   "check bound_stack_id of the role, the stack is not visible to the backend",
+			Err:    fmt.Errorf("stack not found: %s", role.BoundStackID),
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if !strutil.StrListContains(healthyStackStatuses, stack.Status) {
+		return &AttestError{
+			Reason: ReasonStackMismatch,
+			Hint:   "log in once the stack operation has completed",
+			Err:    fmt.Errorf("stack is not healthy: %s", stack.Status),
+		}
+	}
+
+	pages, err := stackresources.List(client, stack.Name, stack.ID, stackresources.ListOpts{Depth: stackNestedDepth}).AllPages()
+	if err != nil {
+		return err
+	}
+
+	resources, err := stackresources.ExtractResources(pages)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if resource.PhysicalID == instance.ID {
+			return nil
+		}
+	}
+
+	return &AttestError{
+		Reason: ReasonStackMismatch,
+		Hint:   fmt.Sprintf("the instance must be a server resource of stack %s or of its nested stacks", stack.Name),
+		Err:    fmt.Errorf("instance is not a resource of stack %s", stack.ID),
+	}
+}
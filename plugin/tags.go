@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// AttestTags is used to attest that the instance has all the server tags
+// bound to the role. The compute API returns the tags from microversion
+// 2.26 on.
+func (at *Attestor) AttestTags(instance *Instance, role *Role) error {
+	if len(role.BoundTags) == 0 {
+		return nil
+	}
+
+	if instance.Tags == nil {
+		return &AttestError{
+			Reason: ReasonTagsMismatch,
+			Hint:   "the compute API did not return the tags of the instance, they require microversion 2.26 or later",
+			Err:    errors.New("instance tags are not available"),
+		}
+	}
+
+	missing := []string{}
+	for _, tag := range role.BoundTags {
+		if !strutil.StrListContains(*instance.Tags, tag) {
+			missing = append(missing, tag)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &AttestError{
+			Reason: ReasonTagsMismatch,
+			Hint:   fmt.Sprintf("the role requires the instance tags %s, add them with `openstack server add tag <instance> <tag>`", strings.Join(missing, ", ")),
+			Err:    fmt.Errorf("tags mismatched: %s missing", strings.Join(missing, ", ")),
+		}
+	}
+
+	return nil
+}
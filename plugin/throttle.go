@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+const (
+	minThrottleDelay  = 1 * time.Second
+	maxThrottleDelay  = 60 * time.Second
+	maxBackoffRetries = 3
+)
+
+// throttle slows down the outbound OpenStack requests to an endpoint after
+// the endpoint responded with an over-limit status.
+type throttle struct {
+	mutex sync.Mutex
+	until time.Time
+	delay time.Duration
+}
+
+// throttles holds a throttle per endpoint host, so that the rate limit of
+// one cloud, region or service doesn't hold up the requests to the others.
+type throttles struct {
+	mutex     sync.Mutex
+	throttles map[string]*throttle
+}
+
+func newThrottles() *throttles {
+	return &throttles{
+		throttles: map[string]*throttle{},
+	}
+}
+
+// Get returns the throttle of the host, creating it on first use.
+func (ts *throttles) Get(host string) *throttle {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if t, ok := ts.throttles[host]; ok {
+		return t
+	}
+
+	t := newThrottle()
+	ts.throttles[host] = t
+
+	return t
+}
+
+// Reset drops the throttles, which closes every throttling window.
+func (ts *throttles) Reset() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	ts.throttles = map[string]*throttle{}
+}
+
+// Backoff implements gophercloud.RetryBackoffFunc with the throttle of the
+// host the request was rejected by.
+func (ts *throttles) Backoff(ctx context.Context, respErr *gophercloud.ErrUnexpectedResponseCode, err error, retries uint) error {
+	if respErr == nil {
+		return nil
+	}
+
+	u, parseErr := url.Parse(respErr.URL)
+	if parseErr != nil {
+		return nil
+	}
+
+	return ts.Get(u.Host).Backoff(ctx, respErr, err, retries)
+}
+
+func newThrottle() *throttle {
+	return &throttle{}
+}
+
+// Wait blocks until the current throttling window has passed.
+func (t *throttle) Wait(ctx context.Context) error {
+	t.mutex.Lock()
+	wait := time.Until(t.until)
+	t.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Limit opens a throttling window. The delay is taken from the Retry-After
+// header when present, otherwise it grows exponentially with every
+// consecutive over-limit response.
+func (t *throttle) Limit(header http.Header) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delay, ok := parseRetryAfter(header.Get("Retry-After"))
+	if !ok {
+		delay = t.delay * 2
+		if delay < minThrottleDelay {
+			delay = minThrottleDelay
+		}
+	}
+	if delay > maxThrottleDelay {
+		delay = maxThrottleDelay
+	}
+
+	t.delay = delay
+	until := time.Now().Add(delay)
+	if until.After(t.until) {
+		t.until = until
+	}
+
+	return delay
+}
+
+// Reset clears the exponential delay after a successful response.
+func (t *throttle) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.delay = 0
+}
+
+// Backoff implements gophercloud.RetryBackoffFunc so that requests
+// rejected with 429 are retried once the throttling window has passed.
+func (t *throttle) Backoff(ctx context.Context, respErr *gophercloud.ErrUnexpectedResponseCode, err error, retries uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return t.Wait(ctx)
+}
+
+// throttledTransport is a http.RoundTripper which holds outbound requests
+// while the throttle of the host is active and opens a new window on
+// over-limit responses.
+type throttledTransport struct {
+	base      http.RoundTripper
+	throttles *throttles
+}
+
+func (tr *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	throttle := tr.throttles.Get(req.URL.Host)
+	if err := throttle.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	res, err := tr.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		// Older Nova releases report over-limit with 413 and Retry-After.
+		if res.StatusCode == http.StatusRequestEntityTooLarge && res.Header.Get("Retry-After") == "" {
+			break
+		}
+		throttle.Limit(res.Header)
+	default:
+		if res.StatusCode < http.StatusBadRequest {
+			throttle.Reset()
+		}
+	}
+
+	return res, nil
+}
+
+func parseRetryAfter(val string) (time.Duration, bool) {
+	if val == "" {
+		return 0, false
+	}
+
+	if sec, err := strconv.Atoi(val); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(val); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
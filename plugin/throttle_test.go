@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	var tests = []struct {
+		val    string
+		delay  time.Duration
+		result bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"invalid", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+
+	for _, test := range tests {
+		delay, ok := parseRetryAfter(test.val)
+		if ok != test.result || delay != test.delay {
+			t.Errorf("unexpected result: %v - %s, %v", test, delay, ok)
+		}
+	}
+}
+
+func TestThrottleLimit(t *testing.T) {
+	th := newThrottle()
+
+	delay := th.Limit(http.Header{})
+	if delay != minThrottleDelay {
+		t.Errorf("unexpected delay: %s", delay)
+	}
+
+	delay = th.Limit(http.Header{})
+	if delay != 2*minThrottleDelay {
+		t.Errorf("unexpected delay: %s", delay)
+	}
+
+	delay = th.Limit(http.Header{"Retry-After": []string{"5"}})
+	if delay != 5*time.Second {
+		t.Errorf("unexpected delay: %s", delay)
+	}
+
+	delay = th.Limit(http.Header{"Retry-After": []string{"3600"}})
+	if delay != maxThrottleDelay {
+		t.Errorf("unexpected delay: %s", delay)
+	}
+
+	th.Reset()
+	if th.delay != 0 {
+		t.Errorf("unexpected delay after reset: %s", th.delay)
+	}
+}
+
+func TestThrottledTransport(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count += 1
+		if count == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &throttledTransport{
+			base:      http.DefaultTransport,
+			throttles: newThrottles(),
+		},
+	}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status: %d", res.StatusCode)
+	}
+
+	start := time.Now()
+	res, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", res.StatusCode)
+	}
+
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("request was not throttled: %s", elapsed)
+	}
+}
+
+func TestThrottlesPerHost(t *testing.T) {
+	ts := newThrottles()
+
+	ts.Get("compute.test").Limit(http.Header{"Retry-After": []string{"60"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := ts.Get("identity.test").Wait(ctx); err != nil {
+		t.Errorf("other host was throttled: %v", err)
+	}
+	if err := ts.Get("compute.test").Wait(ctx); err == nil {
+		t.Errorf("host was not throttled")
+	}
+
+	ts.Reset()
+	if err := ts.Get("compute.test").Wait(context.Background()); err != nil {
+		t.Errorf("host was throttled after reset: %v", err)
+	}
+}
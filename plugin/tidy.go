@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// sweeper removes the expired records of a kind from the storage.
+type sweeper struct {
+	name    string
+	run     func(ctx context.Context, s logical.Storage) (sweepResult, error)
+	removed string
+}
+
+var sweepers = []sweeper{
+	{name: "auth_attempt", run: cleanupAuthAttempt, removed: "expired auth attempts have been removed"},
+	{name: "instance_event", run: cleanupInstanceEvent, removed: "expired instance events have been removed"},
+	{name: "instance_registration", run: cleanupInstanceRegistration, removed: "expired instance registrations have been removed"},
+	{name: "instance_nonce", run: cleanupInstanceNonce, removed: "expired instance nonces have been removed"},
+	{name: "instance_login", run: cleanupInstanceLogin, removed: "expired instance logins have been removed"},
+}
+
+// tidyResult is the result of a sweeper run by tidy.
+type tidyResult struct {
+	sweepResult
+	Name string
+	Err  error
+}
+
+// tidy runs every sweeper, continuing with the next one when a sweeper
+// fails.
+func (b *OpenStackAuthBackend) tidy(ctx context.Context, s logical.Storage) []tidyResult {
+	results := make([]tidyResult, 0, len(sweepers))
+
+	for _, sw := range sweepers {
+		start := time.Now()
+		result, err := sw.run(ctx, s)
+		b.recordSweep(sw.name, start, result, err)
+
+		if result.Deleted > 0 {
+			b.Logger().Info(sw.removed, "count", result.Deleted)
+		}
+		if err != nil {
+			b.Logger().Error("failed to clean up storage", "sweeper", sw.name, "error", err)
+		}
+
+		results = append(results, tidyResult{sweepResult: result, Name: sw.name, Err: err})
+	}
+
+	return results
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// tlsConfig returns the TLS config of the connections to the OpenStack
+// APIs, or nil when the config doesn't customize it.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.CACert == "" && !c.InsecureSkipVerify && c.ClientCert == "" && c.ClientKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("cacert: no PEM encoded certificate found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case c.ClientCert != "" && c.ClientKey != "":
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case c.ClientCert != "":
+		return nil, errors.New("client_cert: cannot be used without client_key")
+	case c.ClientKey != "":
+		return nil, errors.New("client_key: cannot be used without client_cert")
+	}
+
+	return tlsConfig, nil
+}
+
+func (c *Config) validateTLS() error {
+	_, err := c.tlsConfig()
+	return err
+}
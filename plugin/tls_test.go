@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"context"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/summerwind/vault-plugin-auth-openstack/internal/openstacktest"
+)
+
+func TestTLSConfig(t *testing.T) {
+	m := openstacktest.NewTLSServer(t)
+	cacert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: m.Certificate().Raw}))
+
+	var tests = []struct {
+		data   map[string]interface{}
+		result bool
+	}{
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"cacert": cacert}, true},
+		{map[string]interface{}{"insecure_skip_verify": true}, true},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestBackend(t)
+
+		data := map[string]interface{}{
+			"auth_url":         m.AuthURL(),
+			"username":         "vault",
+			"password":         "secret",
+			"user_domain_name": "Default",
+			"project_id":       mockProjectID,
+		}
+		for key, val := range test.data {
+			data[key] = val
+		}
+
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		_, err = b.(*OpenStackAuthBackend).getClient(context.Background(), storage, &Role{})
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test.data, err)
+		}
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	m := openstacktest.NewTLSServer(t)
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: m.Certificate().Raw}))
+
+	var tests = []struct {
+		config *Config
+		result bool
+	}{
+		{&Config{}, true},
+		{&Config{CACert: cert}, true},
+		{&Config{CACert: "bogus"}, false},
+		{&Config{ClientCert: cert}, false},
+		{&Config{ClientKey: "bogus"}, false},
+		{&Config{ClientCert: cert, ClientKey: "bogus"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.config.validateTLS()
+		if (err == nil) != test.result {
+			t.Errorf("unexpected result: %v - %v", test.config, err)
+		}
+	}
+}
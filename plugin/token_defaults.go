@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// validateTokenDefaults returns an error if the token defaults of the config
+// are negative or the ttl exceeds the max_ttl.
+func (c *Config) validateTokenDefaults() error {
+	errs := fieldErrors{}
+
+	if c.TTL < 0 {
+		errs.add("ttl", "cannot be negative")
+	}
+
+	if c.MaxTTL < 0 {
+		errs.add("max_ttl", "cannot be negative")
+	}
+
+	if c.MaxTTL > 0 && c.TTL > c.MaxTTL {
+		errs.add("ttl", "should be shorter than max_ttl")
+	}
+
+	if c.Period < 0 {
+		errs.add("period", "cannot be negative")
+	}
+
+	return errs.err()
+}
+
+// populateTokenDefaults sets the token defaults of the config on the auth
+// for the values the role leaves unset, so that the TTLs do not have to be
+// repeated on every role. A batch token cannot be periodic, so the period
+// is not inherited by such a role.
+func (c *Config) populateTokenDefaults(role *Role, auth *logical.Auth) {
+	if role.TokenTTL == 0 {
+		auth.TTL = c.TTL
+	}
+
+	if role.TokenMaxTTL == 0 {
+		auth.MaxTTL = c.MaxTTL
+	}
+
+	if role.TokenPeriod == 0 && role.TokenType != logical.TokenTypeBatch && role.TokenType != logical.TokenTypeDefaultBatch {
+		auth.Period = c.Period
+	}
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTOTPPasscode(t *testing.T) {
+	// The test vectors of RFC 6238 truncated to 6 digits. The secret is
+	// "12345678901234567890" encoded with base32.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	var tests = []struct {
+		unix     int64
+		passcode string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		passcode, err := totpPasscode(secret, time.Unix(test.unix, 0))
+		if err != nil || passcode != test.passcode {
+			t.Errorf("unexpected passcode: %v - %s, %v", test, passcode, err)
+		}
+	}
+
+	_, err := totpPasscode("not base32!", time.Now())
+	if err == nil {
+		t.Errorf("invalid secret was accepted")
+	}
+}
+
+func TestTOTPAuthentication(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+
+	m := newMockOpenStack(t)
+	m.SetTOTPSecret(secret)
+
+	var tests = []struct {
+		secret  string
+		success bool
+	}{
+		{secret, true},
+		// fail: passcode of another secret
+		{"KRSXG5CTMVRXEZLU", false},
+		// fail: no passcode
+		{"", false},
+	}
+
+	for _, test := range tests {
+		b, storage := newTestLoginBackend(t, m)
+		backend := b.(*OpenStackAuthBackend)
+
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      map[string]interface{}{"totp_secret": test.secret},
+		})
+		if err != nil || (res != nil && res.IsError()) {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		client, err := backend.getClient(context.Background(), storage, &Role{})
+		if test.success != (err == nil) {
+			t.Errorf("unexpected result: %v - %v", test, err)
+			continue
+		}
+		if !test.success {
+			continue
+		}
+
+		requests := m.AuthRequests()
+		err = client.ProviderClient.Reauthenticate("")
+		if err != nil || m.AuthRequests() != requests+1 {
+			t.Errorf("unexpected reauthentication: %d requests - %v", m.AuthRequests()-requests, err)
+		}
+	}
+
+	b, storage := newTestLoginBackend(t, m)
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"totp_secret": "not base32!"},
+	})
+	if err != nil || res == nil || !res.IsError() {
+		t.Errorf("invalid secret was accepted: %v - %v", res, err)
+	}
+}
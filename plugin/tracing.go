@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/summerwind/vault-plugin-auth-openstack"
+
+// apiSpan is the span of an upstream call, which also remembers when the
+// call started for the latency metric.
+type apiSpan struct {
+	trace.Span
+	name  string
+	start time.Time
+}
+
+// startSpan starts a span of an upstream call as a child of the span in
+// the context. Spans are discarded unless a tracer provider is registered,
+// while the latency of the call is always measured.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, &apiSpan{Span: span, name: name, start: time.Now()}
+}
+
+// endSpan records the error on the span, emits the latency of the call and
+// ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if s, ok := span.(*apiSpan); ok {
+		measureAPICall(s.name, s.start, err)
+	}
+	span.End()
+}
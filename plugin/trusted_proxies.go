@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"net"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// Sources of the request addresses verified by the attestation.
+const (
+	addressSourceConnection = "connection"
+	addressSourceHeaders    = "headers"
+	addressSourceBoth       = "both"
+)
+
+var addressSources = []string{addressSourceConnection, addressSourceHeaders, addressSourceBoth}
+
+// addressSource returns the source of the request addresses.
+func (c *Config) addressSource() string {
+	if c.RequestAddressSource == "" {
+		return addressSourceBoth
+	}
+
+	return c.RequestAddressSource
+}
+
+func (c *Config) validateRequestAddresses() error {
+	errs := fieldErrors{}
+
+	if !strutil.StrListContains(addressSources, c.addressSource()) {
+		errs.add("request_address_source", "must be one of %s", strings.Join(addressSources, ", "))
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			errs.add("trusted_proxies", "invalid CIDR %s", proxy)
+		}
+	}
+
+	return errs.err()
+}
+
+// trustedProxies holds the parsed trusted_proxies of the config. Without
+// trusted proxies, every connection may set the address headers.
+type trustedProxies []*net.IPNet
+
+func (c *Config) trustedProxies() trustedProxies {
+	proxies := trustedProxies{}
+	for _, proxy := range c.TrustedProxies {
+		if _, cidr, err := net.ParseCIDR(proxy); err == nil {
+			proxies = append(proxies, cidr)
+		}
+	}
+
+	return proxies
+}
+
+// contains returns whether the address belongs to a trusted proxy.
+func (p trustedProxies) contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range p {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientAddress returns the address of the client from a header value, such
+// as a comma separated X-Forwarded-For list. The entries on the left are set
+// by the client and may be forged, so the rightmost entry which is not a
+// trusted proxy is the client.
+func (p trustedProxies) clientAddress(val string) string {
+	entries := strings.Split(val, ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(entries[i])
+		if addr != "" && !p.contains(addr) {
+			return addr
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// fieldErrors collects the problems of the fields of a write, so that all
+// of them are reported at once instead of only the first one.
+type fieldErrors []string
+
+// add records a problem of the field.
+func (e *fieldErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+// addErr records an error which already names its field.
+func (e *fieldErrors) addErr(err error) {
+	if err != nil {
+		*e = append(*e, err.Error())
+	}
+}
+
+func (e fieldErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// err returns the collected problems as an error, or nil without problems.
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+type fieldErrorsContextKey struct{}
+
+// requestFieldErrors returns the conversion errors of the fields of the
+// request, which were removed from its data before it was handled.
+func requestFieldErrors(ctx context.Context) fieldErrors {
+	errs, _ := ctx.Value(fieldErrorsContextKey{}).(fieldErrors)
+	return append(fieldErrors{}, errs...)
+}
+
+// validatedFields returns the schema of the fields of the writes whose
+// problems are reported at once.
+func validatedFields(req *logical.Request) map[string]*framework.FieldSchema {
+	if req.Operation != logical.UpdateOperation && req.Operation != logical.CreateOperation {
+		return nil
+	}
+
+	switch {
+	case req.Path == "config":
+		return configFields
+	case strings.HasPrefix(req.Path, "config/") && !strutil.StrListContains(reservedConfigNames, strings.TrimPrefix(req.Path, "config/")):
+		return configProfileFields
+	case strings.HasPrefix(req.Path, "role/"):
+		return roleFields
+	}
+
+	return nil
+}
+
+// convertFields returns the errors of the fields which cannot be
+// converted to their types, sorted by the field names.
+func convertFields(schema map[string]*framework.FieldSchema, raw map[string]interface{}) (fieldErrors, []string) {
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		if _, ok := schema[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	errs := fieldErrors{}
+	invalid := []string{}
+	for _, name := range names {
+		data := &framework.FieldData{Raw: map[string]interface{}{name: raw[name]}, Schema: schema}
+		_, _, err := data.GetOkErr(name)
+		if err != nil {
+			errs.add(name, "%v", err)
+			invalid = append(invalid, name)
+		}
+	}
+
+	return errs, invalid
+}
+
+// HandleRequest handles the request with the framework. The framework
+// rejects a write at the first field which cannot be converted to its
+// type, so the fields of the config and role writes are converted first,
+// and the invalid ones are removed and passed on to the handlers to be
+// reported with the other problems of the write. The request logger is
+// passed with the context, for the helpers which log without the request.
+func (b *OpenStackAuthBackend) HandleRequest(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	ctx = context.WithValue(ctx, loggerContextKey{}, b.requestLogger(req))
+
+	schema := validatedFields(req)
+	if schema == nil {
+		return b.Backend.HandleRequest(ctx, req)
+	}
+
+	errs, invalid := convertFields(schema, req.Data)
+	if len(errs) == 0 {
+		return b.Backend.HandleRequest(ctx, req)
+	}
+
+	data := make(map[string]interface{}, len(req.Data))
+	for name, val := range req.Data {
+		data[name] = val
+	}
+	for _, name := range invalid {
+		delete(data, name)
+	}
+	req.Data = data
+
+	return b.Backend.HandleRequest(context.WithValue(ctx, fieldErrorsContextKey{}, errs), req)
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestFieldValidation(t *testing.T) {
+	b, storage := newTestBackend(t)
+
+	var tests = []struct {
+		path   string
+		data   map[string]interface{}
+		fields []string
+	}{
+		{
+			path: "role/test",
+			data: map[string]interface{}{
+				"ttl":                   "bogus",
+				"auth_limit":            -1,
+				"server_type":           "vm",
+				"accepted_source_cidrs": "10.0.0.0/8,10.0.0.0/33",
+			},
+			fields: []string{"ttl: ", "auth_limit: must be greater than 0", "server_type: must be", "accepted_source_cidrs: '10.0.0.0/33' is not a valid CIDR"},
+		},
+		{
+			path: "role/test",
+			data: map[string]interface{}{
+				"ttl":          600,
+				"max_ttl":      300,
+				"auth_period":  "forever",
+				"metadata_key": "",
+			},
+			fields: []string{"token_ttl: should be shorter than token_max_ttl", "auth_period: ", "metadata_key: cannot be empty"},
+		},
+		{
+			path: "role/test",
+			data: map[string]interface{}{
+				"auth_limit":            0,
+				"token_policies":        "default,root,web admin",
+				"bound_metadata":        map[string]interface{}{"": "web"},
+				"response_wrapping_ttl": 60,
+			},
+			fields: []string{"auth_limit: must be greater than 0", "token_policies: cannot contain the root policy", "token_policies: 'web admin' is not a valid policy name", "bound_metadata: cannot bind an empty key", "response_wrapping_ttl: can only be used with require_response_wrapping"},
+		},
+		{
+			path: "role/test",
+			data: map[string]interface{}{
+				"nonce_metadata_key":    "vault-nonce",
+				"attest_port_ownership": true,
+			},
+			fields: []string{"attest_port_ownership: cannot be used with nonce_metadata_key"},
+		},
+		{
+			path: "role/test",
+			data: map[string]interface{}{
+				"server_type": "dedicated",
+				"bound_tags":  "web",
+			},
+			fields: []string{"bound_tags: can only be used with cloud servers"},
+		},
+		{
+			path: "config",
+			data: map[string]interface{}{
+				"auth_url":                 "http://keystone.test/v3",
+				"all_tenants":              "maybe",
+				"audit_non_hmac_fields":    "instance_id,password",
+				"auth_type":                "kerberos",
+				"trusted_proxies":          "10.0.0.0/8,proxy",
+				"ttl":                      600,
+				"max_ttl":                  60,
+				"compute_api_microversion": "2",
+				"cacert":                   "bogus",
+				"http_proxy":               "ftp://proxy.test",
+				"max_retries":              -1,
+				"lookup_attempts":          -1,
+				"instance_cache_ttl":       3600,
+			},
+			fields: []string{"all_tenants: ", "audit_non_hmac_fields: unknown field password", "auth_type: must be one of", "trusted_proxies: invalid CIDR proxy", "ttl: should be shorter than max_ttl", "compute_api_microversion: must be a compute API microversion", "cacert: no PEM encoded certificate found", "http_proxy: unsupported scheme 'ftp'", "max_retries: cannot be negative", "lookup_attempts: cannot be negative", "instance_cache_ttl: cannot be longer than 1m0s"},
+		},
+	}
+
+	for _, test := range tests {
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      test.path,
+			Storage:   storage,
+			Data:      test.data,
+		})
+		if err != nil || res == nil || !res.IsError() {
+			t.Fatalf("unexpected result: %v - %v", res, err)
+		}
+
+		msg := res.Error().Error()
+		for _, field := range test.fields {
+			if !strings.Contains(msg, field) {
+				t.Errorf("%s: missing %q in %q", test.path, field, msg)
+			}
+		}
+	}
+
+	entries, err := storage.List(context.Background(), "role/")
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected roles: %v - %v", entries, err)
+	}
+}
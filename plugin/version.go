@@ -0,0 +1,20 @@
+package plugin
+
+import "strings"
+
+// Version and Commit identify the build of the plugin. They are set with
+// -ldflags at build time.
+var (
+	Version = "0.6.1"
+	Commit  = "unknown"
+)
+
+// runningVersion returns the version reported to Vault, which requires
+// the semantic version to be prefixed with "v".
+func runningVersion() string {
+	if Version == "" {
+		return ""
+	}
+
+	return "v" + strings.TrimPrefix(Version, "v")
+}